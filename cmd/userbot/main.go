@@ -25,7 +25,7 @@ import (
 //  1. bootstrap: stdout/stderr → pr, базовый log с префиксом времени,
 //  2. flags/env: пути к .env и filters.json,
 //  3. config: загрузка и предупреждения,
-//  4. logger: уровень и перенаправление вывода в pr,
+//  4. logger: уровень и перенаправление вывода в pr; с -storage-migrate — миграция шифрования и выход,
 //  5. signals: контекст с отменой по Ctrl+C/SIGTERM (stop обязателен к вызову),
 //  6. app: Init(ctx, stop) и Run().
 func main() {
@@ -38,7 +38,9 @@ func main() {
 
 	// envPath определяет расположение .env с секретами и общими настройками.
 	envPath := flag.String("env", "assets/.env", "path to .env file")
-	// // filtersPath указывает на JSON-файл с фильтрами, используемыми userbot.
+	// storageMigrate переводит файлы состояния в зашифрованный или открытый вид и завершает работу.
+	storageMigrate := flag.String("storage-migrate", "",
+		`migrate state files at rest: "encrypt" or "decrypt", then exit`)
 	flag.Parse()
 
 	// config.Load загружает конфигурацию из .env и других источников.
@@ -61,6 +63,17 @@ func main() {
 		logger.Warn(msg)
 	}
 
+	// Миграция шифрования выполняется без подключения к Telegram и без запуска приложения.
+	if *storageMigrate != "" {
+		if *storageMigrate != "encrypt" && *storageMigrate != "decrypt" {
+			log.Fatalf(`invalid -storage-migrate value %q (must be "encrypt" or "decrypt")`, *storageMigrate)
+		}
+		if err := app.MigrateStorage(*storageMigrate == "encrypt"); err != nil {
+			log.Fatalf("storage migration failed: %v", err)
+		}
+		return
+	}
+
 	// Контекст с обработкой системных сигналов (Ctrl+C/SIGTERM). Важно: stop() нужно вызвать, чтобы снять подписку.
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 
@@ -0,0 +1,51 @@
+// Package botapionotifier / файл bot_actions.go — кнопки действий под уведомлениями бота.
+//
+//   - replyMarkup кодирует notifications.ActionKeyboard в inline-клавиатуру reply_markup;
+//   - нажатия принимает UpdatesPoller (см. bot_updates.go) и передаёт их CallbackHandler.
+
+package botapionotifier
+
+import (
+	"context"
+	"encoding/json"
+
+	"telegram-userbot/internal/domain/notifications"
+)
+
+// replyMarkup возвращает JSON inline-клавиатуры с кнопками действий задания
+// или пустую строку, если кнопки выключены или заданию не положены.
+func (s *BotSender) replyMarkup(job notifications.Job) string {
+	if !s.actions {
+		return ""
+	}
+	ref, ok := job.ActionRef()
+	if !ok {
+		return ""
+	}
+	type button struct {
+		Text         string `json:"text"`
+		URL          string `json:"url,omitempty"`
+		CallbackData string `json:"callback_data,omitempty"`
+	}
+	var keyboard [][]button
+	for _, row := range notifications.ActionKeyboard(ref) {
+		buttons := make([]button, 0, len(row))
+		for _, b := range row {
+			buttons = append(buttons, button{Text: b.Text, URL: b.URL, CallbackData: b.Data})
+		}
+		keyboard = append(keyboard, buttons)
+	}
+	markup, err := json.Marshal(struct {
+		InlineKeyboard [][]button `json:"inline_keyboard"`
+	}{keyboard})
+	if err != nil {
+		return ""
+	}
+	return string(markup)
+}
+
+// CallbackHandler выполняет действие data, выбранное пользователем userID, и возвращает
+// текст ответа для всплывающего уведомления.
+type CallbackHandler interface {
+	HandleCallback(ctx context.Context, userID int64, data string) string
+}
@@ -0,0 +1,324 @@
+package botapionotifier
+
+// Package botapionotifier / файл bot_media.go — отправка копии исходного сообщения с медиа.
+// Бот не видит отслеживаемые чаты, поэтому медиа скачивает MTProto-клиент
+// (notifications.MediaFetcher), а бот загружает файлы заново multipart-запросами
+// sendPhoto/sendVideo/sendDocument/... или sendMediaGroup для альбомов, сохраняя подпись
+// с entities. Временные файлы удаляются сразу после доставки. Если медиа скачать
+// не удалось, отправляется только текстовая копия (как раньше).
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/infra/logger"
+)
+
+// captionMaxLen — лимит подписи к медиа в Bot API (UTF-16 единицы). Более длинный текст
+// отправляется отдельным сообщением после медиа.
+const captionMaxLen = 1024
+
+// mediaGroupMax — максимум элементов в одном sendMediaGroup.
+const mediaGroupMax = 10
+
+// mediaMethod описывает метод Bot API для одиночной отправки файла данного вида.
+type mediaMethod struct {
+	method string // sendPhoto, sendVideo, ...
+	field  string // имя multipart-поля с файлом
+}
+
+// singleMethods сопоставляет вид медиа с методом одиночной отправки.
+var singleMethods = map[string]mediaMethod{
+	notifications.MediaKindPhoto:     {"sendPhoto", "photo"},
+	notifications.MediaKindVideo:     {"sendVideo", "video"},
+	notifications.MediaKindAnimation: {"sendAnimation", "animation"},
+	notifications.MediaKindAudio:     {"sendAudio", "audio"},
+	notifications.MediaKindVoice:     {"sendVoice", "voice"},
+	notifications.MediaKindDocument:  {"sendDocument", "document"},
+}
+
+// groupType возвращает тип элемента sendMediaGroup: голосовые и GIF в альбомах
+// не поддерживаются и уходят документами.
+func groupType(kind string) string {
+	switch kind {
+	case notifications.MediaKindPhoto, notifications.MediaKindVideo, notifications.MediaKindAudio:
+		return kind
+	default:
+		return notifications.MediaKindDocument
+	}
+}
+
+// groupClass — класс совместимости элементов альбома: фото и видео смешиваются,
+// аудио и документы — только между собой.
+func groupClass(kind string) string {
+	t := groupType(kind)
+	if t == notifications.MediaKindVideo {
+		return notifications.MediaKindPhoto
+	}
+	return t
+}
+
+// multipartFile — файл, прикладываемый к multipart-запросу под именем поля field.
+type multipartFile struct {
+	field string
+	file  notifications.MediaFile
+}
+
+// deliverCopy отправляет копию исходного сообщения вместо пересылки: медиа с подписью,
+// если MediaFetcher их скачал, иначе текст с entities. Возвращает (permanent, err)
+// по правилам sendMessageRich.
+func (s *BotSender) deliverCopy(ctx context.Context, chatID int64, job notifications.Job, silent bool) (bool, error) {
+	var (
+		text     string
+		entities []notifications.CopyEntity
+	)
+	if job.Payload.Copy != nil {
+		text = job.Payload.Copy.Text
+		entities = job.Payload.Copy.Entities
+	}
+
+	fwd := job.Payload.Forward
+	if s.media != nil && len(fwd.MessageIDs) > 0 {
+		bundle, err := s.media.FetchMedia(ctx, fwd.FromPeer, fwd.MessageIDs)
+		if err != nil {
+			logger.Warnf("BotSender: media fetch failed for job %d, sending text copy: %v", job.ID, err)
+		} else {
+			defer func() {
+				if cleanupErr := bundle.Cleanup(); cleanupErr != nil {
+					logger.Warnf("BotSender: media cleanup for job %d failed: %v", job.ID, cleanupErr)
+				}
+			}()
+			if len(bundle.Files) > 0 {
+				return s.sendMedia(ctx, chatID, bundle.Files, text, entities, silent)
+			}
+		}
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return false, nil
+	}
+	return s.sendMessageRich(ctx, chatID, text, entities, silent)
+}
+
+// sendMedia отправляет файлы: один — одиночным методом, несколько совместимых — альбомами
+// по mediaGroupMax, несовместимые — по одному. Подпись прикрепляется к первому файлу;
+// слишком длинный текст уходит отдельным сообщением после медиа.
+func (s *BotSender) sendMedia(
+	ctx context.Context, chatID int64, files []notifications.MediaFile,
+	text string, entities []notifications.CopyEntity, silent bool,
+) (bool, error) {
+	caption, captionEntities := text, entities
+	separateText := len(utf16.Encode([]rune(text))) > captionMaxLen
+	if separateText {
+		caption, captionEntities = "", nil
+	}
+
+	var (
+		permanent bool
+		err       error
+	)
+	switch {
+	case len(files) == 1:
+		permanent, err = s.sendSingleMedia(ctx, chatID, files[0], caption, captionEntities, silent)
+	case sameGroupClass(files):
+		for start := 0; start < len(files) && err == nil; start += mediaGroupMax {
+			end := min(start+mediaGroupMax, len(files))
+			permanent, err = s.sendMediaGroup(ctx, chatID, files[start:end], caption, captionEntities, silent)
+			caption, captionEntities = "", nil
+		}
+	default:
+		for _, file := range files {
+			if permanent, err = s.sendSingleMedia(ctx, chatID, file, caption, captionEntities, silent); err != nil {
+				break
+			}
+			caption, captionEntities = "", nil
+		}
+	}
+	if err != nil {
+		return permanent, err
+	}
+
+	if !separateText || strings.TrimSpace(text) == "" {
+		return false, nil
+	}
+	return s.sendMessageRich(ctx, chatID, text, entities, silent)
+}
+
+// sameGroupClass сообщает, можно ли отправить все файлы альбомами одного класса.
+func sameGroupClass(files []notifications.MediaFile) bool {
+	for _, file := range files[1:] {
+		if groupClass(file.Kind) != groupClass(files[0].Kind) {
+			return false
+		}
+	}
+	return true
+}
+
+// sendSingleMedia загружает один файл методом, соответствующим его виду.
+func (s *BotSender) sendSingleMedia(
+	ctx context.Context, chatID int64, file notifications.MediaFile,
+	caption string, entities []notifications.CopyEntity, silent bool,
+) (bool, error) {
+	m, ok := singleMethods[file.Kind]
+	if !ok {
+		m = singleMethods[notifications.MediaKindDocument]
+	}
+	fields := mediaFields(chatID, silent)
+	if caption != "" {
+		fields["caption"] = caption
+		if len(entities) > 0 {
+			raw, err := json.Marshal(entities)
+			if err != nil {
+				return true, fmt.Errorf("encode caption entities: %w", err)
+			}
+			fields["caption_entities"] = string(raw)
+		}
+	}
+	return s.uploadMultipart(ctx, m.method, fields, []multipartFile{{field: m.field, file: file}})
+}
+
+// sendMediaGroup загружает до mediaGroupMax файлов одним альбомом (sendMediaGroup).
+func (s *BotSender) sendMediaGroup(
+	ctx context.Context, chatID int64, files []notifications.MediaFile,
+	caption string, entities []notifications.CopyEntity, silent bool,
+) (bool, error) {
+	type inputMedia struct {
+		Type            string                     `json:"type"`
+		Media           string                     `json:"media"`
+		Caption         string                     `json:"caption,omitempty"`
+		CaptionEntities []notifications.CopyEntity `json:"caption_entities,omitempty"`
+	}
+	media := make([]inputMedia, 0, len(files))
+	attachments := make([]multipartFile, 0, len(files))
+	for i, file := range files {
+		field := "file" + strconv.Itoa(i)
+		item := inputMedia{Type: groupType(file.Kind), Media: "attach://" + field}
+		if i == 0 {
+			item.Caption = caption
+			item.CaptionEntities = entities
+		}
+		media = append(media, item)
+		attachments = append(attachments, multipartFile{field: field, file: file})
+	}
+	raw, err := json.Marshal(media)
+	if err != nil {
+		return true, fmt.Errorf("encode media group: %w", err)
+	}
+	fields := mediaFields(chatID, silent)
+	fields["media"] = string(raw)
+	return s.uploadMultipart(ctx, "sendMediaGroup", fields, attachments)
+}
+
+// mediaFields — общие поля запросов отправки медиа.
+func mediaFields(chatID int64, silent bool) map[string]string {
+	fields := map[string]string{"chat_id": strconv.FormatInt(chatID, 10)}
+	if silent {
+		fields["disable_notification"] = "true"
+	}
+	return fields
+}
+
+// uploadMultipart выполняет multipart-запрос под троттлером. Семантика (permanent, err)
+// совпадает с sendMessage.
+func (s *BotSender) uploadMultipart(
+	ctx context.Context, method string, fields map[string]string, files []multipartFile,
+) (bool, error) {
+	if s.limiter == nil {
+		return s.performMultipart(ctx, method, fields, files)
+	}
+
+	var (
+		permanent  bool
+		requestErr error
+	)
+	err := s.limiter.Do(ctx, func() error {
+		var errDo error
+		permanent, errDo = s.performMultipart(ctx, method, fields, files)
+		requestErr = errDo
+		if errDo != nil && permanent {
+			return &stopRetryError{err: errDo}
+		}
+		return errDo
+	})
+	if err != nil {
+		if permanent {
+			return true, requestErr
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// performMultipart отправляет POST multipart/form-data без троттлера. Тело пишется
+// потоково из временных файлов, чтобы не держать крупные медиа в памяти.
+func (s *BotSender) performMultipart(
+	ctx context.Context, method string, fields map[string]string, files []multipartFile,
+) (bool, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeMultipart(mw, fields, files))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+"/"+method, pr)
+	if err != nil {
+		_ = pr.Close()
+		return false, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := s.uploadClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return handleHTTPError(resp, body)
+	}
+	return handleJSONResponse(body)
+}
+
+// writeMultipart пишет поля и файлы в multipart-writer и закрывает его.
+func writeMultipart(mw *multipart.Writer, fields map[string]string, files []multipartFile) error {
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if err := copyFilePart(mw, f); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// copyFilePart добавляет содержимое временного файла как часть multipart.
+func copyFilePart(mw *multipart.Writer, f multipartFile) error {
+	src, err := os.Open(f.file.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	part, err := mw.CreateFormFile(f.field, f.file.FileName)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, src)
+	return err
+}
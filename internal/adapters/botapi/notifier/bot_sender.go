@@ -2,7 +2,10 @@
 //
 // В этом файле (bot_sender.go):
 //   - настраивается HTTP‑клиент и общий троттлер запросов;
-//   - реализуется последовательная доставка текста и, при необходимости, «копии» исходного сообщения;
+//   - реализуется последовательная доставка текста и, при необходимости, «копии» исходного сообщения
+//     (с медиа, скачанными MTProto-клиентом, — см. bot_media.go);
+//   - реализуется правка ранее отправленного уведомления (editMessageText);
+//   - к уведомлениям прикрепляются кнопки действий (inline-клавиатура, см. bot_actions.go);
 //   - классифицируются ошибки Bot API на временные (retry_after) и постоянные (большинство 4xx);
 //   - аккуратно извлекается retry_after из заголовков/тела и передается троттлеру через интерфейс.
 //
@@ -32,6 +35,13 @@ import (
 // колебания и не зависать бесконечно на медленных соединениях.
 const httpClientTimeout = 30
 
+// uploadClientTimeout — таймаут загрузки медиа, секунды: файлы до 50 МБ идут дольше обычных запросов.
+const uploadClientTimeout = 300
+
+// throttleMaxRetries ограничивает повторы и паузы retry_after внутри троттлера: дальше
+// задание откладывает политика повторов очереди, не блокируя остальные.
+const throttleMaxRetries = 2
+
 // botSuperPrefix используется для построения chat_id каналов/супергрупп в Bot API.
 // Формула: chat_id = -100<channel_id>. Для обычных групп — просто отрицательный id.
 const botSuperPrefix int64 = -1000000000000
@@ -39,13 +49,23 @@ const botSuperPrefix int64 = -1000000000000
 // BotSender реализует notifications.PreparedSender поверх Telegram Bot API.
 //
 // Поля:
-//   - baseURL — конечная точка sendMessage для заданного бота (с учётом /test);
+//   - apiURL  — корень методов бота (с учётом /test);
+//   - baseURL — конечная точка sendMessage для заданного бота;
+//   - editURL — конечная точка editMessageText того же бота;
 //   - client  — HTTP‑клиент с умеренным таймаутом;
-//   - limiter — общий троттлер (token bucket) c поддержкой BotAPIRetryAfterExtractor.
+//   - uploadClient — HTTP‑клиент для загрузки медиа с увеличенным таймаутом;
+//   - limiter — общий троттлер (token bucket) c поддержкой BotAPIRetryAfterExtractor;
+//   - media   — источник медиа исходных сообщений (nil — только текстовая копия);
+//   - actions — прикреплять ли кнопки действий к уведомлениям.
 type BotSender struct {
-	baseURL string
-	client  *http.Client
-	limiter *throttle.Throttler
+	apiURL       string
+	baseURL      string
+	editURL      string
+	client       *http.Client
+	uploadClient *http.Client
+	limiter      *throttle.Throttler
+	media        notifications.MediaFetcher
+	actions      bool
 }
 
 // NewBotSender создаёт PreparedSender для бота.
@@ -53,27 +73,54 @@ type BotSender struct {
 // Поведение:
 //   - при testDC=true добавляет суффикс /test к токену согласно Bot API;
 //   - формирует базовый URL вида https://api.telegram.org/bot<token>/sendMessage;
-//   - подключает троттлер с экстрактором BotAPIRetryAfterExtractor;
-//   - rps задаёт целевую среднюю частоту запросов.
-func NewBotSender(token string, testDC bool, rps int) *BotSender {
-	if testDC {
-		token += "/test"
-	}
-	base := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", token)
+//   - подключает троттлер с экстрактором BotAPIRetryAfterExtractor и лимитом повторов;
+//   - rps задаёт целевую среднюю частоту запросов;
+//   - media скачивает медиа исходных сообщений для копии (nil — только текст);
+//   - actions=true прикрепляет к уведомлениям кнопки действий (нажатия принимает UpdatesPoller).
+func NewBotSender(
+	token string, testDC bool, rps int, media notifications.MediaFetcher, actions bool,
+) *BotSender {
+	api := botAPIURL(token, testDC)
 
 	// Троттлер ограничивает частоту и уважает retry_after из ответов сервера.
 	limiter := throttle.New(
 		rps,
+		throttle.WithMaxRetries(throttleMaxRetries),
+		throttle.WithMaxWaits(throttleMaxRetries),
 		throttle.WithWaitExtractors(BotAPIRetryAfterExtractor()),
 	)
 
 	return &BotSender{
-		baseURL: base,
+		apiURL:  api,
+		baseURL: api + "/sendMessage",
+		editURL: api + "/editMessageText",
 		client: &http.Client{
 			Timeout: httpClientTimeout * time.Second,
 		},
+		uploadClient: &http.Client{
+			Timeout: uploadClientTimeout * time.Second,
+		},
 		limiter: limiter,
+		media:   media,
+		actions: actions,
+	}
+}
+
+// WithMedia возвращает отправителя с источником медиа media, разделяющего с s токен,
+// HTTP-клиенты и троттлер: один бот обслуживает несколько аккаунтов, а медиа исходных
+// сообщений скачивает клиент того аккаунта, чья очередь доставляет задание.
+func (s *BotSender) WithMedia(media notifications.MediaFetcher) *BotSender {
+	view := *s
+	view.media = media
+	return &view
+}
+
+// botAPIURL строит корень методов бота; в тестовом DC к токену добавляется суффикс /test.
+func botAPIURL(token string, testDC bool) string {
+	if testDC {
+		token += "/test"
 	}
+	return fmt.Sprintf("https://api.telegram.org/bot%s", token)
 }
 
 // Start подключает троттлер к жизненному циклу очереди.
@@ -117,26 +164,44 @@ func toBotChatID(r notifications.Recipient) int64 {
 }
 
 // Deliver отправляет уведомление одному получателю (job.Recipient).
-// Если в payload включён Forward и подготовлена копия исходного сообщения (text+entities),
-// бот отправляет ДВА сообщения: (1) обычный текст уведомления и (2) копию исходного текста
-// с entities (не форвард). Такая последовательность совпадает с бизнес‑логикой клиента.
+// Если в payload включён Forward, бот отправляет обычный текст уведомления и затем копию
+// исходного сообщения (не форвард): медиа с подписью, если их удалось скачать, иначе текст
+// с entities. Такая последовательность совпадает с бизнес‑логикой клиента.
+// При EditOf вместо отправки правит текст ранее доставленного уведомления.
+// Текст уведомления и правка несут кнопки действий (см. replyMarkup).
 // Возвращает aggregated outcome: Retry=true — нужна повторная попытка позже;
-// PermanentFailures — список чатов, для которых Bot API вернул постоянную 4xx‑ошибку.
+// PermanentFailures — список чатов, для которых Bot API вернул постоянную 4xx‑ошибку;
+// SentMessageID — message_id отправленного текста уведомления.
 func (s *BotSender) Deliver(ctx context.Context, job notifications.Job) (notifications.SendOutcome, error) {
 	var outcome notifications.SendOutcome
 
+	if job.Payload.EditOf != 0 {
+		permanent, err := s.editMessage(
+			ctx, toBotChatID(job.Recipient), job.Payload.EditOf, job.Payload.Text, s.replyMarkup(job))
+		if err != nil {
+			if permanent {
+				outcome.PermanentFailures = append(outcome.PermanentFailures, job.Recipient)
+				outcome.PermanentError = errors.Join(outcome.PermanentError, err)
+				return outcome, nil
+			}
+			outcome.Retry = true
+			return outcome, err
+		}
+		return outcome, nil
+	}
+
 	// Предварительно вычисляем, что именно будем отправлять: обычный текст и/или «копию».
 	hasText := strings.TrimSpace(job.Payload.Text) != ""
-	hasCopy := job.Payload.Forward != nil &&
-		job.Payload.Forward.Enabled &&
-		job.Payload.Copy != nil &&
-		strings.TrimSpace(job.Payload.Copy.Text) != ""
+	hasCopy := job.Payload.Forward != nil && job.Payload.Forward.Enabled
 
 	recipient := job.Recipient
+	// Низкий приоритет и тихие часы (политика silent) — без звука (disable_notification).
+	silent := job.SilentDelivery()
 	// 1) Сначала отправляем обычный текст уведомления, если он есть.
 	if hasText {
 		chatID := toBotChatID(recipient)
-		permanent, err := s.sendMessage(ctx, chatID, job.Payload.Text)
+		sentID, permanent, err := s.sendMessage(
+			ctx, chatID, job.Payload.Text, job.Payload.ReplyTo, silent, s.replyMarkup(job))
 		if err != nil {
 			if permanent {
 				outcome.PermanentFailures = append(outcome.PermanentFailures, recipient)
@@ -147,12 +212,13 @@ func (s *BotSender) Deliver(ctx context.Context, job notifications.Job) (notific
 			outcome.Retry = true
 			return outcome, err
 		}
+		outcome.SentMessageID = sentID
 	}
 
-	// 2) Затем, если включён forward и подготовлена копия — отправляем копию исходного сообщения.
+	// 2) Затем, если включён forward — отправляем копию исходного сообщения (медиа и/или текст).
 	if hasCopy {
 		chatID := toBotChatID(recipient)
-		permanent, err := s.sendMessageRich(ctx, chatID, job.Payload.Copy.Text, job.Payload.Copy.Entities)
+		permanent, err := s.deliverCopy(ctx, chatID, job, silent)
 		if err != nil {
 			if permanent {
 				outcome.PermanentFailures = append(outcome.PermanentFailures, recipient)
@@ -168,24 +234,31 @@ func (s *BotSender) Deliver(ctx context.Context, job notifications.Job) (notific
 }
 
 // sendMessage выполняет GET /sendMessage с минимальным набором полей.
-// Возвращает (permanent, err):
+// replyTo != 0 отправляет текст ответом на сообщение бота с этим message_id;
+// silent=true выставляет disable_notification; markup — reply_markup в JSON (пусто — без кнопок).
+// Возвращает (messageID, permanent, err):
 //
 //   - permanent=true, err!=nil  — ошибка 4xx, адресат фиксируется как постоянная неудача;
 //   - permanent=false, err!=nil — временная ошибка или сетевой сбой (в том числе retry_after);
-//   - permanent=false, err==nil — успех.
+//   - permanent=false, err==nil — успех, messageID — ID отправленного сообщения.
 //
 // При наличии троттлера запрос выполняется внутри limiter.Do().
-func (s *BotSender) sendMessage(ctx context.Context, chatID int64, text string) (bool, error) {
+func (s *BotSender) sendMessage(
+	ctx context.Context, chatID int64, text string, replyTo int, silent bool, markup string,
+) (int, bool, error) {
 	if s.limiter == nil {
-		return s.performSend(ctx, chatID, text)
+		return s.performSend(ctx, chatID, text, replyTo, silent, markup)
 	}
 
-	var permanent bool
-	var requestErr error
+	var (
+		messageID  int
+		permanent  bool
+		requestErr error
+	)
 
 	err := s.limiter.Do(ctx, func() error {
 		var sendErr error
-		permanent, sendErr = s.performSend(ctx, chatID, text)
+		messageID, permanent, sendErr = s.performSend(ctx, chatID, text, replyTo, silent, markup)
 		requestErr = sendErr
 		if sendErr == nil {
 			return nil
@@ -197,60 +270,151 @@ func (s *BotSender) sendMessage(ctx context.Context, chatID int64, text string)
 	})
 	if err != nil {
 		if permanent {
-			return true, requestErr
+			return 0, true, requestErr
 		}
-		return false, err
+		return 0, false, err
 	}
 
-	return false, nil
+	return messageID, false, nil
 }
 
 // performSend выполняет запрос без троттлера. Обрабатывает HTTP/JSON ответы и
-// приводит их к паре (permanent, error).
-func (s *BotSender) performSend(ctx context.Context, chatID int64, text string) (bool, error) {
+// приводит их к тройке (messageID, permanent, error).
+func (s *BotSender) performSend(
+	ctx context.Context, chatID int64, text string, replyTo int, silent bool, markup string,
+) (int, bool, error) {
 	params := url.Values{}
 	params.Set("chat_id", strconv.FormatInt(chatID, 10))
 	params.Set("text", text)
 	params.Set("disable_web_page_preview", "true")
+	if silent {
+		params.Set("disable_notification", "true")
+	}
+	if replyTo != 0 {
+		params.Set("reply_parameters",
+			fmt.Sprintf(`{"message_id":%d,"allow_sending_without_reply":true}`, replyTo))
+	}
+	if markup != "" {
+		params.Set("reply_markup", markup)
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"?"+params.Encode(), nil)
+	body, permanent, err := s.performGet(ctx, s.baseURL, params)
 	if err != nil {
-		return false, err
+		return 0, permanent, err
 	}
+	return decodeSentMessageID(body), false, nil
+}
 
-	resp, err := s.client.Do(req)
+// editMessage выполняет GET /editMessageText под троттлером. Семантика (permanent, err)
+// совпадает с sendMessage; ответ «message is not modified» считается успехом.
+// markup повторно передаёт кнопки: без reply_markup Bot API снимает их с сообщения.
+func (s *BotSender) editMessage(
+	ctx context.Context, chatID int64, messageID int, text string, markup string,
+) (bool, error) {
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(chatID, 10))
+	params.Set("message_id", strconv.Itoa(messageID))
+	params.Set("text", text)
+	params.Set("disable_web_page_preview", "true")
+	if markup != "" {
+		params.Set("reply_markup", markup)
+	}
+
+	perform := func() (bool, error) {
+		_, permanent, err := s.performGet(ctx, s.editURL, params)
+		if err != nil && strings.Contains(strings.ToLower(err.Error()), "message is not modified") {
+			return false, nil
+		}
+		return permanent, err
+	}
+	if s.limiter == nil {
+		return perform()
+	}
+
+	var permanent bool
+	var requestErr error
+	err := s.limiter.Do(ctx, func() error {
+		var errDo error
+		permanent, errDo = perform()
+		requestErr = errDo
+		if errDo != nil && permanent {
+			return &stopRetryError{err: errDo}
+		}
+		return errDo
+	})
 	if err != nil {
+		if permanent {
+			return true, requestErr
+		}
 		return false, err
 	}
+	return false, nil
+}
+
+// performGet выполняет GET-запрос к методу Bot API и возвращает тело успешного ответа.
+func (s *BotSender) performGet(ctx context.Context, endpoint string, params url.Values) ([]byte, bool, error) {
+	return botGet(ctx, s.client, endpoint, params)
+}
+
+// botGet выполняет GET-запрос к методу Bot API клиентом client и возвращает тело успешного ответа.
+// Ошибки нормализуются через handleHTTPError/handleJSONResponse.
+func botGet(ctx context.Context, client *http.Client, endpoint string, params url.Values) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return handleHTTPError(resp, body)
+		permanent, errHTTP := handleHTTPError(resp, body)
+		return nil, permanent, errHTTP
 	}
 
-	return handleJSONResponse(body)
+	permanent, err := handleJSONResponse(body)
+	if err != nil {
+		return nil, permanent, err
+	}
+	return body, false, nil
+}
+
+// decodeSentMessageID извлекает result.message_id из успешного ответа sendMessage (0 при ошибке разбора).
+func decodeSentMessageID(body []byte) int {
+	var apiResp struct {
+		Result struct {
+			MessageID int `json:"message_id"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return 0
+	}
+	return apiResp.Result.MessageID
 }
 
 // sendMessageRich отправляет текст с entities (Bot API), сохраняя тот же троттлинг.
 // Используется после успешной доставки обычного текста, если включён режим «копии».
 func (s *BotSender) sendMessageRich(
 	ctx context.Context, chatID int64, text string,
-	entities []notifications.CopyEntity,
+	entities []notifications.CopyEntity, silent bool,
 ) (bool, error) {
 	if s.limiter == nil {
-		return s.performSendRich(ctx, chatID, text, entities)
+		return s.performSendRich(ctx, chatID, text, entities, silent)
 	}
 	var permanent bool
 	var sendErr error
 	// Выполняем под троттлером
 	err := s.limiter.Do(ctx, func() error {
 		var errDo error
-		permanent, errDo = s.performSendRich(ctx, chatID, text, entities)
+		permanent, errDo = s.performSendRich(ctx, chatID, text, entities, silent)
 		return errDo
 	})
 	if err != nil {
@@ -267,18 +431,20 @@ func (s *BotSender) sendMessageRich(
 //   - BODY формируется через json.Marshal. TODO: можно заменить strings.NewReader(string(body)) на bytes.NewReader(body).
 func (s *BotSender) performSendRich(
 	ctx context.Context, chatID int64, text string,
-	entities []notifications.CopyEntity,
+	entities []notifications.CopyEntity, silent bool,
 ) (bool, error) {
 	payload := struct {
 		ChatID                int64                      `json:"chat_id"`
 		Text                  string                     `json:"text"`
 		Entities              []notifications.CopyEntity `json:"entities,omitempty"`
 		DisableWebPagePreview bool                       `json:"disable_web_page_preview,omitempty"`
+		DisableNotification   bool                       `json:"disable_notification,omitempty"`
 	}{
 		ChatID:                chatID,
 		Text:                  text,
 		Entities:              entities,
 		DisableWebPagePreview: true,
+		DisableNotification:   silent,
 	}
 	body, err := json.Marshal(payload)
 	if err != nil {
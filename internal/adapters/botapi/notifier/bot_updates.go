@@ -0,0 +1,223 @@
+// Package botapionotifier / файл bot_updates.go — приём апдейтов бота через getUpdates (long polling).
+//
+//   - нажатия inline-кнопок (callback_query) передаются обработчику действий, а его ответ
+//     показывается всплывающим уведомлением (answerCallbackQuery);
+//   - текстовые сообщения (message) передаются маршрутизатору команд, а его ответ
+//     отправляется в тот же чат ответом на команду.
+//
+// getUpdates недоступен, если у бота настроен webhook: Bot API отвечает 409, и опрос
+// повторяется с нарастающей паузой, не мешая доставке уведомлений.
+
+package botapionotifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Параметры опроса getUpdates: время удержания запроса сервером (секунды) и паузы после ошибок.
+const (
+	pollTimeout       = 50
+	pollRetryDelay    = 5 * time.Second
+	pollMaxRetryDelay = time.Minute
+)
+
+// commandReplyRunes — предел длины ответа на команду (лимит sendMessage — 4096 символов).
+const commandReplyRunes = 4000
+
+// CommandHandler выполняет команду text, присланную пользователем userID, и возвращает ответ.
+// ok=false — сообщение не обрабатывается и остаётся без ответа.
+type CommandHandler interface {
+	HandleCommand(ctx context.Context, userID int64, text string) (reply string, ok bool)
+}
+
+// UpdatesPoller принимает апдейты бота через getUpdates. Апдейты обрабатываются
+// последовательно в порядке update_id; offset подтверждает обработанные апдейты.
+type UpdatesPoller struct {
+	apiURL    string
+	client    *http.Client
+	callbacks CallbackHandler
+	commands  CommandHandler
+	offset    int64
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// botUpdate — апдейт getUpdates; учитываются нажатия кнопок и текстовые сообщения.
+type botUpdate struct {
+	UpdateID      int64          `json:"update_id"`
+	CallbackQuery *callbackQuery `json:"callback_query"`
+	Message       *botMessage    `json:"message"`
+}
+
+// callbackQuery — нажатие inline-кнопки: кто нажал и данные кнопки.
+type callbackQuery struct {
+	ID   string `json:"id"`
+	From struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	Data string `json:"data"`
+}
+
+// botChatPrivate — тип личного чата с ботом в Bot API.
+const botChatPrivate = "private"
+
+// botMessage — входящее сообщение боту: отправитель, чат (ID и тип) и текст.
+type botMessage struct {
+	MessageID int `json:"message_id"`
+	From      *struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	Chat struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+// NewUpdatesPoller создаёт опросчик апдейтов для бота token (testDC — тестовый DC).
+// callbacks обрабатывает нажатия кнопок, commands — команды; nil отключает соответствующие апдейты.
+func NewUpdatesPoller(token string, testDC bool, callbacks CallbackHandler, commands CommandHandler) *UpdatesPoller {
+	return &UpdatesPoller{
+		apiURL: botAPIURL(token, testDC),
+		// Таймаут клиента должен превышать время удержания long polling.
+		client:    &http.Client{Timeout: (pollTimeout + httpClientTimeout) * time.Second},
+		callbacks: callbacks,
+		commands:  commands,
+	}
+}
+
+// Start запускает опрос в фоне; остановка — Stop или отмена ctx.
+func (p *UpdatesPoller) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.wg.Go(func() { p.run(ctx) })
+}
+
+// Stop прерывает текущий запрос и дожидается завершения опроса.
+func (p *UpdatesPoller) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+// run опрашивает getUpdates, пока жив ctx. После ошибки пауза удваивается до pollMaxRetryDelay,
+// а retry_after из ответа Bot API имеет приоритет.
+func (p *UpdatesPoller) run(ctx context.Context) {
+	delay := pollRetryDelay
+	for ctx.Err() == nil {
+		updates, err := p.getUpdates(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			wait := delay
+			var ra *retryAfterError
+			if errors.As(err, &ra) {
+				wait = ra.RetryAfter()
+			}
+			logger.Errorf("UpdatesPoller: getUpdates failed: %v (retry in %s)", err, wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			delay = min(delay*2, pollMaxRetryDelay)
+			continue
+		}
+		delay = pollRetryDelay
+		for _, upd := range updates {
+			p.offset = upd.UpdateID + 1
+			switch {
+			case upd.CallbackQuery != nil && p.callbacks != nil:
+				p.handleCallback(ctx, *upd.CallbackQuery)
+			case upd.Message != nil && p.commands != nil:
+				p.handleMessage(ctx, *upd.Message)
+			}
+		}
+	}
+}
+
+// getUpdates запрашивает новые апдейты, подтверждая предыдущие через offset.
+func (p *UpdatesPoller) getUpdates(ctx context.Context) ([]botUpdate, error) {
+	params := url.Values{}
+	params.Set("timeout", strconv.Itoa(pollTimeout))
+	params.Set("allowed_updates", p.allowedUpdates())
+	if p.offset != 0 {
+		params.Set("offset", strconv.FormatInt(p.offset, 10))
+	}
+	body, _, err := botGet(ctx, p.client, p.apiURL+"/getUpdates", params)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Result []botUpdate `json:"result"`
+	}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("bot api decode updates: %w", err)
+	}
+	return resp.Result, nil
+}
+
+// allowedUpdates возвращает JSON-список типов апдейтов, для которых задан обработчик.
+func (p *UpdatesPoller) allowedUpdates() string {
+	var kinds []string
+	if p.callbacks != nil {
+		kinds = append(kinds, "callback_query")
+	}
+	if p.commands != nil {
+		kinds = append(kinds, "message")
+	}
+	raw, _ := json.Marshal(kinds)
+	return string(raw)
+}
+
+// handleCallback выполняет действие нажатой кнопки и отвечает на callback_query: без ответа
+// клиент Telegram показывает индикатор загрузки на кнопке.
+func (p *UpdatesPoller) handleCallback(ctx context.Context, query callbackQuery) {
+	answer := p.callbacks.HandleCallback(ctx, query.From.ID, query.Data)
+
+	params := url.Values{}
+	params.Set("callback_query_id", query.ID)
+	params.Set("text", answer)
+	if _, _, err := botGet(ctx, p.client, p.apiURL+"/answerCallbackQuery", params); err != nil {
+		logger.Warnf("UpdatesPoller: answerCallbackQuery failed: %v", err)
+	}
+}
+
+// handleMessage выполняет команду из сообщения и отвечает на него в том же чате.
+// Команды принимаются только в личном чате администратора с ботом: ответы (очередь,
+// архив) не должны попадать участникам групп. Сообщения без отправителя (посты каналов),
+// без текста и из групп пропускаются.
+func (p *UpdatesPoller) handleMessage(ctx context.Context, msg botMessage) {
+	if msg.From == nil || msg.Text == "" {
+		return
+	}
+	if msg.Chat.Type != botChatPrivate || msg.Chat.ID != msg.From.ID {
+		return
+	}
+	reply, ok := p.commands.HandleCommand(ctx, msg.From.ID, msg.Text)
+	if !ok || reply == "" {
+		return
+	}
+	if runes := []rune(reply); len(runes) > commandReplyRunes {
+		reply = string(runes[:commandReplyRunes]) + "…"
+	}
+
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(msg.Chat.ID, 10))
+	params.Set("text", reply)
+	params.Set("reply_parameters", fmt.Sprintf(`{"message_id":%d,"allow_sending_without_reply":true}`, msg.MessageID))
+	if _, _, err := botGet(ctx, p.client, p.apiURL+"/sendMessage", params); err != nil {
+		logger.Warnf("UpdatesPoller: command reply failed: %v", err)
+	}
+}
@@ -3,18 +3,20 @@
 // остальными подсистемами: клиентом Telegram (core.ClientCore), очередью
 // уведомлений, кэшем Telegram и менеджером соединений. Поддерживается
 // корректная интеграция в lifecycle: Start/Stop идемпотентны.
+// Команды относятся к основному аккаунту, если аргумент @имя не выбирает другой (list @work).
 package cli
 
 import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"telegram-userbot/internal/adapters/commands"
 	"telegram-userbot/internal/adapters/telegram/core"
-	"telegram-userbot/internal/domain/filters"
 	"telegram-userbot/internal/domain/notifications"
 	"telegram-userbot/internal/infra/config"
 	"telegram-userbot/internal/infra/logger"
@@ -28,24 +30,23 @@ import (
 	"github.com/gotd/td/tg"
 )
 
-// commandDescriptor описывает одну CLI-команду: её имя и краткое описание для help.
+// commandDescriptor описывает одну CLI-команду: её имя, аргументы и краткое описание для help.
 type commandDescriptor struct {
 	name        string
+	args        string
 	description string
 }
 
-// commandDescriptors — реестр доступных команд. Рендерится в help и подсказки.
+// commandDescriptors — реестр команд, реализованных самой CLI. Рендерится в help и подсказки
+// вместе с общими командами пакета commands (см. cliCommands).
 // Важно: имена должны совпадать с кейсами в handleCommand().
 var (
 	commandDescriptors = []commandDescriptor{
 		{name: "help", description: "Show available commands with short descriptions"},
-		{name: "list", description: "Print cached dialogs (offline snapshot)"},
-		{name: "refresh dialogs", description: "Fetch dialogs from API and update cache"},
-		{name: "reload", description: "Reload filters.json and refresh filters"},
-		{name: "status", description: "Show queue status (sizes, last drain, next schedule"},
-		{name: "flush", description: "Drain regular queue immediately"},
-		{name: "test", description: "Send current time to admin for connectivity check"},
-		{name: "whoami", description: "Display information about the current account"},
+		{name: "list", args: "[@account]", description: "Print cached dialogs (offline snapshot)"},
+		{name: "refresh dialogs", args: "[@account]", description: "Fetch dialogs from API and update cache"},
+		{name: "test", args: "[@account]", description: "Send current time to admin for connectivity check"},
+		{name: "whoami", args: "[@account]", description: "Display information about the current account"},
 		{name: "version", description: "Print userbot version"},
 		{name: "exit", description: "Stop CLI and terminate the service"},
 	}
@@ -56,35 +57,40 @@ var (
 // и синхронно закрывается через Stop(). Потокобезопасность обеспечивается
 // дисциплиной запуска/остановки и отсутствием внешних мутаций.
 type Service struct {
-	cl        *core.ClientCore      // API-клиент Telegram (MTProto), нужен для команд теста/диагностики
-	stopApp   context.CancelFunc    // внешняя отмена приложения (используется для команды exit и Ctrl-C на пустой строке)
-	filters   *filters.FilterEngine // Движок фильтров: загрузка, хранение, матчи.
-	notif     *notifications.Queue  // очередь уведомлений; нужна для flush/status
-	peers     *peersmgr.Service     // peers-кэш, предоставляет офлайн-данные по диалогам
-	cancel    context.CancelFunc    // локальная отмена run-цикла CLI
-	wg        sync.WaitGroup        // ожидание завершения фоновой горутины run
-	onceStart sync.Once             // идемпотентный запуск
-	onceStop  sync.Once             // идемпотентная остановка
+	accounts  []Account          // аккаунты процесса; первый — основной
+	stopApp   context.CancelFunc // внешняя отмена приложения (используется для команды exit и Ctrl-C на пустой строке)
+	commands  *commands.Executor // общие команды (status, flush, reload, mute...), те же, что у бота
+	cancel    context.CancelFunc // локальная отмена run-цикла CLI
+	wg        sync.WaitGroup     // ожидание завершения фоновой горутины run
+	onceStart sync.Once          // идемпотентный запуск
+	onceStop  sync.Once          // идемпотентная остановка
+}
+
+// Account — аккаунт для команд CLI: состояние для общих команд (фильтры, очередь, архив,
+// backfill), клиент Telegram, peers-кэш и менеджеры соединения и статуса аккаунта.
+type Account struct {
+	commands.Account
+	Client   *core.ClientCore
+	Peers    *peersmgr.Service
+	Conn     *connection.Manager
+	Presence *status.StatusManager
 }
 
 const refreshDialogsTimeout = 30 * time.Second
 
-// NewService создаёт CLI-сервис. Параметр stopApp используется как «глобальная»
-// остановка приложения (команда exit, Ctrl-C на пустой строке). Если notif задан,
-// команда "flush" инициирует внеочередной слив регулярной очереди уведомлений.
-func NewService(
-	cl *core.ClientCore,
-	stopApp context.CancelFunc,
-	filterEngine *filters.FilterEngine,
-	notif *notifications.Queue,
-	peers *peersmgr.Service,
-) *Service {
+// NewService создаёт CLI-сервис над аккаунтами accounts (первый — основной). Параметр stopApp
+// используется как «глобальная» остановка приложения (команда exit, Ctrl-C на пустой строке).
+// Если у аккаунта нет очереди, общие команды очереди (flush, status, queue...) сообщают о её
+// недоступности; то же для архива (search, export) и заданий backfill.
+func NewService(stopApp context.CancelFunc, accounts []Account) *Service {
+	shared := make([]commands.Account, 0, len(accounts))
+	for _, acc := range accounts {
+		shared = append(shared, acc.Account)
+	}
 	return &Service{
-		cl:      cl,
-		stopApp: stopApp,
-		filters: filterEngine,
-		notif:   notif,
-		peers:   peers,
+		accounts: slices.Clone(accounts),
+		stopApp:  stopApp,
+		commands: commands.NewExecutor("cli", shared...),
 	}
 }
 
@@ -123,7 +129,7 @@ func (s *Service) run(ctx context.Context) {
 	logger.Debug("CLI run started")
 	pr.SetPrompt("> ")
 	// Устанавливаем промпт и выводим краткую справку, чтобы пользователь не блуждал в темноте.
-	pr.Println("CLI started. Enter commands:", joinCommandNames(commandDescriptors))
+	pr.Println("CLI started. Enter commands:", joinCommandNames(cliCommands()))
 	pr.Println("Press '?' or type 'help' for detailed descriptions.")
 	installKeyHandlers(s.stopApp)
 
@@ -201,7 +207,7 @@ func installKeyHandlers(stop context.CancelFunc) {
 
 // printCommandHelp печатает список поддерживаемых команд и их описания.
 func printCommandHelp() {
-	for _, text := range buildCommandHelpLines(commandDescriptors) {
+	for _, text := range buildCommandHelpLines(cliCommands()) {
 		pr.Println(text)
 	}
 }
@@ -209,41 +215,25 @@ func printCommandHelp() {
 // handleCommand разбирает введённую команду и выполняет соответствующее действие.
 // Возвращает true, если команда инициирует завершение CLI ("exit").
 func (s *Service) handleCommand(cmd string) bool {
-	switch cmd {
+	base, acc := s.selectAccount(cmd)
+	switch base {
 	case "help":
 		printCommandHelp()
 	case "list":
 		pr.Println("Fetching dialogs...")
-		s.listDialogs()
+		listDialogs(acc)
 	case "refresh dialogs":
-		s.handleRefreshDialogs()
-	case "reload":
-		// Перезагружаем фильтры и получателей с rollback при ошибке
-		if err := s.filters.Init(); err != nil {
-			pr.ErrPrintln("reload filters error:", err)
-			return false
-		}
-		pr.Println("recipients.json and filters.json reloaded")
+		handleRefreshDialogs(acc)
 	case "whoami":
-		if res, err := whoAmI(s.cl); err != nil {
+		if res, err := whoAmI(acc.Client); err != nil {
 			pr.ErrPrintln("whoami error:", err)
 		} else {
 			pr.Println(res)
 		}
 	case "test":
-		s.handleTest()
+		handleTest(acc)
 	case "version":
 		pr.ErrPrintln(fmt.Sprintf("%s v%s", versioninfo.Name, versioninfo.Version))
-	case "flush":
-		// Внеплановый слив регулярной очереди.
-		if s.notif != nil {
-			s.notif.FlushImmediately("cli flush")
-			pr.Println("Queue flush requested.")
-		} else {
-			pr.ErrPrintln("queue is not available")
-		}
-	case "status":
-		s.handleStatus()
 	case "exit":
 		if s.stopApp != nil {
 			s.stopApp()
@@ -252,34 +242,60 @@ func (s *Service) handleCommand(cmd string) bool {
 	case "":
 		// ignore
 	default:
-		pr.Println("unknown command:", cmd)
+		// Общие команды: та же реализация, что и у команд бота.
+		out, err := s.commands.Execute(cmd)
+		switch {
+		case errors.Is(err, commands.ErrUnknownCommand):
+			pr.Println("unknown command:", cmd)
+		case err != nil:
+			pr.ErrPrintln(err)
+		default:
+			pr.Println(out)
+		}
 	}
 	return false
 }
 
-func (s *Service) handleRefreshDialogs() {
-	if s.peers == nil {
+// selectAccount отделяет от команды токен @имя известного аккаунта и возвращает команду
+// без него и выбранный аккаунт (по умолчанию — основной). Общие команды разбирают @имя сами.
+func (s *Service) selectAccount(cmd string) (string, Account) {
+	fields := strings.Fields(cmd)
+	for i, field := range fields {
+		name, ok := strings.CutPrefix(field, "@")
+		if !ok {
+			continue
+		}
+		idx := slices.IndexFunc(s.accounts, func(a Account) bool { return a.Name == name })
+		if idx >= 0 {
+			return strings.Join(slices.Delete(fields, i, i+1), " "), s.accounts[idx]
+		}
+	}
+	return cmd, s.accounts[0]
+}
+
+func handleRefreshDialogs(acc Account) {
+	if acc.Peers == nil {
 		pr.ErrPrintln("peers manager is not available")
 		return
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), refreshDialogsTimeout)
 	defer cancel()
-	if err := s.peers.RefreshDialogs(ctx, s.cl.API); err != nil {
+	if err := acc.Peers.RefreshDialogs(ctx, acc.Client.API); err != nil {
 		pr.ErrPrintln("refresh dialogs error:", err)
 		return
 	}
 	pr.Println("Dialogs cache refreshed.")
 }
 
-// handleTest отправляет тестовое сообщение админу, чтобы проверить связность.
+// handleTest отправляет тестовое сообщение админу от аккаунта acc, чтобы проверить связность.
 // Логика:
-//  1. переводим статус в online (status.GoOnline),
+//  1. переводим статус в online (GoOnline),
 //  2. резолвим adminID из конфигурации и получаем InputPeer через кэш,
 //  3. ждём восстановления соединения (WaitOnline),
 //  4. готовим детерминированный random_id для идемпотентности,
 //  5. отправляем сообщение через MessagesSendMessage.
-func (s *Service) handleTest() {
-	logger.Info("CLI test command invoked")
+func handleTest(acc Account) {
+	logger.Infof("CLI test command invoked for account %s", acc.Name)
 
 	// const tens = 10
 	// ctx, cancel := context.WithTimeout(context.Background(), tens*time.Second)
@@ -289,14 +305,14 @@ func (s *Service) handleTest() {
 	// if err != nil {
 	// 	logger.Errorf("CLI test command: resolve admin peer failed: %v", err)
 	// }
-	// res, err := s.cl.API.MessagesSetTyping(ctx, &tg.MessagesSetTypingRequest{
+	// res, err := acc.Client.API.MessagesSetTyping(ctx, &tg.MessagesSetTypingRequest{
 	// 	Peer:   peer,
 	// 	Action: &tg.SendMessageTypingAction{},
 	// })
 	// connection.HandleError(err)
 	// pr.Printf("CLI test command resul: res=%#v, err=%#v\n", res, err)
 
-	status.GoOnline()
+	acc.Presence.GoOnline()
 
 	adminID := int64(config.Env().AdminUID)
 	if adminID <= 0 {
@@ -312,10 +328,10 @@ func (s *Service) handleTest() {
 		err  error
 	)
 	resolveCtx := context.Background()
-	if s.peers == nil {
+	if acc.Peers == nil {
 		err = errors.New("peers manager is not available")
 	} else {
-		peer, err = s.peers.InputPeerByKind(resolveCtx, notifications.RecipientTypeUser, adminID)
+		peer, err = acc.Peers.InputPeerByKind(resolveCtx, notifications.RecipientTypeUser, adminID)
 	}
 	if err != nil {
 		logger.Errorf("CLI test command: resolve admin peer failed: %v", err)
@@ -326,7 +342,7 @@ func (s *Service) handleTest() {
 	defer cancel()
 
 	logger.Info("CLI test command: waiting for connection readiness")
-	connection.WaitOnline(ctx)
+	acc.Conn.WaitOnline(ctx)
 
 	// Формируем получателя в терминах доменной модели уведомлений.
 	recipient := notifications.Recipient{Type: notifications.RecipientTypeUser, ID: adminID}
@@ -346,47 +362,24 @@ func (s *Service) handleTest() {
 	logger.Infof("CLI test command: sending message \"%s\"", message)
 
 	// if err := s.notif.Send(ctx, adminID, message); err != nil {
-	connection.WaitOnline(ctx)
-	_, err = s.cl.API.MessagesSendMessage(ctx, req)
+	acc.Conn.WaitOnline(ctx)
+	_, err = acc.Client.API.MessagesSendMessage(ctx, req)
 	if err != nil {
-		handled := connection.HandleError(err)
+		handled := acc.Conn.HandleError(err)
 		logger.Errorf("CLI test command: send failed (handled=%t): %v", handled, err)
 	}
 
 	logger.Info("CLI test command: complited")
 }
 
-// handleStatus печатает агрегированное состояние очереди уведомлений: размеры, метки времени
-// последнего дренирования и флаша, а также следующего планового тика. Временные метки
-// приводятся к локальной таймзоне, заданной в статистике очереди.
-func (s *Service) handleStatus() {
-	if s.notif == nil {
-		pr.ErrPrintln("queue is not available")
-		return
-	}
-	st := s.notif.Stats()
-	pr.Printf("Queue status: urgent=%d regular=%d\n", st.Urgent, st.Regular)
-	if !st.LastRegularDrainAt.IsZero() {
-		pr.Printf("Last regular drain: %s\n", st.LastRegularDrainAt.In(st.Location).Format(time.RFC3339))
-	} else {
-		pr.Println("Last regular drain: <never>")
-	}
-	if !st.LastFlushAt.IsZero() {
-		pr.Printf("Last persist: %s\n", st.LastFlushAt.In(st.Location).Format(time.RFC3339))
-	} else {
-		pr.Println("Last persist: <never>")
-	}
-	pr.Printf("Next schedule tick: %s\n", st.NextScheduleAt.In(st.Location).Format(time.RFC3339))
-}
-
-// listDialogs выводит офлайн-снимок диалогов без сетевых запросов.
-func (s *Service) listDialogs() {
-	if s.peers == nil {
+// listDialogs выводит офлайн-снимок диалогов аккаунта acc без сетевых запросов.
+func listDialogs(acc Account) {
+	if acc.Peers == nil {
 		pr.ErrPrintln("peers manager is not available")
 		return
 	}
 
-	dialogs := s.peers.Dialogs()
+	dialogs := acc.Peers.Dialogs()
 	if len(dialogs) == 0 {
 		pr.Println("No dialogs cached yet.")
 		return
@@ -394,20 +387,20 @@ func (s *Service) listDialogs() {
 
 	ctx := context.Background()
 	for _, item := range dialogs {
-		s.printDialog(ctx, item)
+		printDialog(ctx, acc.Peers, item)
 	}
 	pr.Printf("Total dialogs: %d\n", len(dialogs))
 }
 
-func (s *Service) printDialog(ctx context.Context, ref peersmgr.DialogRef) {
+func printDialog(ctx context.Context, peersSvc *peersmgr.Service, ref peersmgr.DialogRef) {
 	var (
 		rawUser    *tg.User
 		rawChat    *tg.Chat
 		rawChannel *tg.Channel
 	)
 
-	if s.peers != nil {
-		if resolved, ok, err := s.peers.ResolvePeer(ctx, ref.Kind, ref.ID); err != nil {
+	if peersSvc != nil {
+		if resolved, ok, err := peersSvc.ResolvePeer(ctx, ref.Kind, ref.ID); err != nil {
 			logger.Debugf("CLI list: resolve %s:%d failed: %v", ref.Kind, ref.ID, err)
 		} else if ok {
 			switch v := resolved.(type) {
@@ -423,11 +416,11 @@ func (s *Service) printDialog(ctx context.Context, ref peersmgr.DialogRef) {
 
 	switch ref.Kind {
 	case peersmgr.DialogKindUser:
-		s.printUser(ref.ID, rawUser)
+		printUser(ref.ID, rawUser)
 	case peersmgr.DialogKindChat:
-		s.printChat(ref.ID, rawChat)
+		printChat(ref.ID, rawChat)
 	case peersmgr.DialogKindChannel:
-		s.printChannel(ref.ID, rawChannel)
+		printChannel(ref.ID, rawChannel)
 	case peersmgr.DialogKindFolder:
 		pr.Printf("Folder: id: %d\n", ref.ID)
 	default:
@@ -435,7 +428,7 @@ func (s *Service) printDialog(ctx context.Context, ref peersmgr.DialogRef) {
 	}
 }
 
-func (s *Service) printUser(id int64, raw *tg.User) {
+func printUser(id int64, raw *tg.User) {
 	if raw == nil {
 		pr.Printf("User: id: %d (no cached metadata)\n", id)
 		return
@@ -453,7 +446,7 @@ func (s *Service) printUser(id int64, raw *tg.User) {
 	pr.Printf("User: '%s' (@%s) id: %d\n", fullName, username, id)
 }
 
-func (s *Service) printChat(id int64, raw *tg.Chat) {
+func printChat(id int64, raw *tg.Chat) {
 	if raw == nil {
 		pr.Printf("Chat: id: %d (no cached metadata)\n", id)
 		return
@@ -465,7 +458,7 @@ func (s *Service) printChat(id int64, raw *tg.Chat) {
 	pr.Printf("Chat: '%s' id: %d\n", title, id)
 }
 
-func (s *Service) printChannel(id int64, raw *tg.Channel) {
+func printChannel(id int64, raw *tg.Channel) {
 	if raw == nil {
 		pr.Printf("Channel: id: %d (no cached metadata)\n", id)
 		return
@@ -506,6 +499,15 @@ func whoAmI(cl *core.ClientCore) (string, error) {
 	return fmt.Sprintf("You are: %s, id=%d", fullname, self.ID), nil
 }
 
+// cliCommands возвращает команды CLI вместе с общими командами пакета commands.
+func cliCommands() []commandDescriptor {
+	all := slices.Clone(commandDescriptors)
+	for _, d := range commands.Descriptors() {
+		all = append(all, commandDescriptor{name: d.Name, args: d.Args, description: d.Description})
+	}
+	return all
+}
+
 // joinCommandNames собирает строку имён команд, разделённых запятыми, для короткой подсказки.
 func joinCommandNames(descriptors []commandDescriptor) string {
 	names := make([]string, 0, len(descriptors))
@@ -515,12 +517,13 @@ func joinCommandNames(descriptors []commandDescriptor) string {
 	return strings.Join(names, ", ")
 }
 
-// buildCommandHelpLines генерирует строки помощи вида "<name> - <description>".
+// buildCommandHelpLines генерирует строки помощи вида "<name> [args] - <description>".
 func buildCommandHelpLines(descriptors []commandDescriptor) []string {
 	lines := make([]string, 0, len(descriptors)+1)
 	lines = append(lines, "Available commands:")
 	for _, descriptor := range descriptors {
-		lines = append(lines, fmt.Sprintf("  %-8s - %s", descriptor.name, descriptor.description))
+		usage := strings.TrimSpace(descriptor.name + " " + descriptor.args)
+		lines = append(lines, fmt.Sprintf("  %-8s - %s", usage, descriptor.description))
 	}
 	return lines
 }
@@ -0,0 +1,158 @@
+// Package commands / файл archive.go — команды поиска и выгрузки архива совпавших сообщений.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-userbot/internal/domain/archive"
+)
+
+// Подсказки использования команд архива.
+const (
+	searchUsage = "usage: search <query> [--chat id] [--filter id] [--since 7d|2006-01-02] [--limit n]"
+	exportUsage = "usage: export <file.jsonl|file.csv> [query] [--chat id] [--filter id] [--since 7d|2006-01-02]"
+)
+
+// search ищет в архиве и перечисляет найденные записи, новые первыми.
+func (e *Executor) search(args string) (string, error) {
+	loc := e.location()
+	q, err := parseArchiveQuery(strings.Fields(args), loc)
+	if err != nil {
+		return "", err
+	}
+	if q.Text == "" && q.Chat == 0 && q.Filter == "" && q.Since.IsZero() {
+		return "", errors.New(searchUsage)
+	}
+	if q.Limit == 0 {
+		q.Limit = searchLimit
+	}
+	records, err := e.archive.Search(q)
+	if err != nil {
+		return "", fmt.Errorf("search archive: %w", err)
+	}
+	if len(records) == 0 {
+		return "Nothing found.", nil
+	}
+	lines := []string{fmt.Sprintf("Found: %d message(s)", len(records))}
+	for _, rec := range records {
+		chat := fmt.Sprintf("%s:%d", rec.ChatType, rec.ChatID)
+		if rec.ChatTitle != "" {
+			chat += " " + rec.ChatTitle
+		}
+		lines = append(lines, fmt.Sprintf("  %s %s [%s]: %s",
+			rec.Date.In(loc).Format(time.RFC3339), chat, strings.Join(rec.Filters, ","), preview(rec.Text)))
+		if rec.Link != "" {
+			lines = append(lines, "    "+rec.Link)
+		}
+	}
+	if len(records) == q.Limit {
+		lines = append(lines, fmt.Sprintf("  (limited to %d, use --limit for more)", q.Limit))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// export выгружает найденные записи (без ограничения числа) в файл JSONL или CSV.
+// Имя файла берётся относительно каталога выгрузок: команда доступна и удалённо (бот,
+// «Избранное»), поэтому абсолютные пути и выход через ".." отклоняются.
+func (e *Executor) export(args string) (string, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return "", errors.New(exportUsage)
+	}
+	name := fields[0]
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("export file %q must be a relative path inside the export directory", name)
+	}
+	if e.exportDir == "" {
+		return "", errors.New("export directory is not configured")
+	}
+	path := filepath.Join(e.exportDir, name)
+	if _, err := archive.FormatFromPath(path); err != nil {
+		return "", err
+	}
+	q, err := parseArchiveQuery(fields[1:], e.location())
+	if err != nil {
+		return "", err
+	}
+	records, err := e.archive.Search(q)
+	if err != nil {
+		return "", fmt.Errorf("search archive: %w", err)
+	}
+	if err := archive.ExportFile(path, records); err != nil {
+		return "", fmt.Errorf("export archive: %w", err)
+	}
+	return fmt.Sprintf("Exported %d message(s) to %s", len(records), path), nil
+}
+
+// location возвращает таймзону вывода: таймзону очереди, если она доступна.
+func (e *Executor) location() *time.Location {
+	if e.queue != nil {
+		return e.queue.Stats().Location
+	}
+	return time.Local
+}
+
+// parseArchiveQuery разбирает слова запроса и флаги --chat, --filter, --since и --limit.
+func parseArchiveQuery(fields []string, loc *time.Location) (archive.Query, error) {
+	var (
+		q     archive.Query
+		words []string
+	)
+	for i := 0; i < len(fields); i++ {
+		flag := fields[i]
+		if !strings.HasPrefix(flag, "--") {
+			words = append(words, flag)
+			continue
+		}
+		if i+1 >= len(fields) {
+			return q, fmt.Errorf("flag %s requires a value", flag)
+		}
+		i++
+		value := fields[i]
+		switch flag {
+		case "--chat":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return q, fmt.Errorf("invalid chat id %q", value)
+			}
+			q.Chat = id
+		case "--filter":
+			q.Filter = value
+		case "--since":
+			since, err := parseSince(value, loc)
+			if err != nil {
+				return q, err
+			}
+			q.Since = since
+		case "--limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return q, fmt.Errorf("invalid limit %q", value)
+			}
+			q.Limit = n
+		default:
+			return q, fmt.Errorf("unknown flag %s", flag)
+		}
+	}
+	q.Text = strings.Join(words, " ")
+	return q, nil
+}
+
+// parseSince разбирает нижнюю границу даты: дату 2006-01-02 (полночь в таймзоне loc) или
+// длительность назад от текущего момента (7d, 12h).
+func parseSince(raw string, loc *time.Location) (time.Time, error) {
+	if day, err := time.ParseInLocation(time.DateOnly, raw, loc); err == nil {
+		return day, nil
+	}
+	dur, err := parseDuration(raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q (use 7d, 12h or 2006-01-02)", raw)
+	}
+	return time.Now().Add(-dur), nil
+}
@@ -0,0 +1,149 @@
+// Package commands / файл backfill.go — команда backfill: прогон истории чатов через фильтры.
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-userbot/internal/domain/backfill"
+)
+
+// backfillUsage — подсказка использования команды backfill.
+const backfillUsage = "usage: backfill <chat|filter> [--limit n | --since 7d|2006-01-02] [--report]" +
+	" | backfill status | backfill cancel <job>"
+
+// backfillResolveTimeout ограничивает определение чатов цели при постановке заданий.
+const backfillResolveTimeout = 10 * time.Second
+
+// runBackfill ставит задания backfill, показывает их состояние или отменяет задание.
+func (e *Executor) runBackfill(args string) (string, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return "", errors.New(backfillUsage)
+	}
+	switch fields[0] {
+	case "status":
+		return e.backfillStatus(), nil
+	case "cancel":
+		if len(fields) != 2 {
+			return "", errors.New(backfillUsage)
+		}
+		id, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid job id %q", fields[1])
+		}
+		if err := e.backfill.Cancel(id); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Backfill job %d canceled.", id), nil
+	}
+
+	req, err := parseBackfillRequest(fields, e.location())
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backfillResolveTimeout)
+	defer cancel()
+	jobs, err := e.backfill.Submit(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if len(jobs) == 0 {
+		return "Nothing to do: every chat already has an unfinished backfill job.", nil
+	}
+	lines := []string{fmt.Sprintf("Backfill queued: %d job(s)", len(jobs))}
+	for _, job := range jobs {
+		lines = append(lines, "  "+describeBackfillJob(job, e.location()))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// backfillStatus перечисляет задания backfill в порядке создания и счётчики
+// восстановления пропусков.
+func (e *Executor) backfillStatus() string {
+	jobs := e.backfill.Jobs()
+	loc := e.location()
+	var lines []string
+	if gaps := e.backfill.Gaps(); gaps.Runs > 0 {
+		lines = append(lines, fmt.Sprintf("Gap recovery: %d run(s), %d message(s) recovered, %d matched, "+
+			"%d truncated, %d failed, last at %s",
+			gaps.Runs, gaps.Recovered, gaps.Matched, gaps.Truncated, gaps.Failed,
+			gaps.LastAt.In(loc).Format(time.RFC3339)))
+	}
+	if len(jobs) == 0 {
+		return strings.Join(append(lines, "No backfill jobs."), "\n")
+	}
+	lines = append(lines, fmt.Sprintf("Backfill: %d job(s)", len(jobs)))
+	for _, job := range jobs {
+		lines = append(lines, "  "+describeBackfillJob(job, loc))
+		if job.Error != "" {
+			lines = append(lines, "    error: "+job.Error)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeBackfillJob описывает задание одной строкой: чат, границы, прогресс и отчёт.
+func describeBackfillJob(job backfill.Job, loc *time.Location) string {
+	bound := fmt.Sprintf("last %d", job.Limit)
+	switch {
+	case job.Gap != "":
+		bound = fmt.Sprintf("gap (%s) after msg %d, up to %d", job.Gap, job.MinID, job.Limit)
+	case !job.Since.IsZero():
+		bound = "since " + job.Since.In(loc).Format(time.RFC3339)
+	}
+	line := fmt.Sprintf("job %d %s %s:%d %s: scanned=%d matched=%d",
+		job.ID, job.State, job.Chat.Type, job.Chat.ID, bound, job.Scanned, job.Matched)
+	if job.Filter != "" {
+		line += " filter=" + job.Filter
+	}
+	if job.Report {
+		line += " report=" + job.ReportFile
+	}
+	return line
+}
+
+// parseBackfillRequest разбирает цель и флаги --limit, --since и --report.
+func parseBackfillRequest(fields []string, loc *time.Location) (backfill.Request, error) {
+	req := backfill.Request{Target: fields[0]}
+	if strings.HasPrefix(req.Target, "--") {
+		return req, errors.New(backfillUsage)
+	}
+	for i := 1; i < len(fields); i++ {
+		flag := fields[i]
+		if flag == "--report" {
+			req.Report = true
+			continue
+		}
+		if i+1 >= len(fields) {
+			return req, fmt.Errorf("flag %s requires a value", flag)
+		}
+		i++
+		value := fields[i]
+		switch flag {
+		case "--limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return req, fmt.Errorf("invalid limit %q", value)
+			}
+			req.Limit = n
+		case "--since":
+			since, err := parseSince(value, loc)
+			if err != nil {
+				return req, err
+			}
+			req.Since = since
+		default:
+			return req, fmt.Errorf("unknown flag %s", flag)
+		}
+	}
+	if req.Limit > 0 && !req.Since.IsZero() {
+		return req, errors.New("use either --limit or --since, not both")
+	}
+	return req, nil
+}
@@ -0,0 +1,405 @@
+// Package commands — общие реализации команд управления userbot для всех фронтендов:
+// интерактивной CLI (adapters/cli) и команд в чате с ботом (см. router.go).
+// Команда получает строку аргументов и возвращает текст ответа, поэтому оба фронтенда
+// выполняют один и тот же код и выводят одно и то же. Когда процесс обслуживает несколько
+// аккаунтов, аргумент @имя выбирает аккаунт команды (status @work).
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-userbot/internal/domain/archive"
+	"telegram-userbot/internal/domain/backfill"
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+)
+
+// ErrUnknownCommand — команда не входит в общий набор (фронтенд может обработать её сам).
+var ErrUnknownCommand = errors.New("unknown command")
+
+// Ограничения вывода: число заданий в queue, записей в failed и длина текста в строке списка.
+const (
+	queueListLimit  = 20
+	failedListLimit = 10
+	searchLimit     = 20
+	previewRunes    = 60
+)
+
+// Descriptor описывает команду для help: имя, аргументы и краткое описание.
+type Descriptor struct {
+	Name        string
+	Args        string
+	Description string
+}
+
+// descriptors — реестр общих команд. Имена должны совпадать с кейсами в Executor.Execute.
+var descriptors = []Descriptor{
+	{Name: "status", Description: "Show queue status (sizes, last drain, next schedule, mutes)"},
+	{Name: "flush", Description: "Drain regular queue immediately"},
+	{Name: "reload", Description: "Reload filters.json and recipients.json"},
+	{Name: "queue", Description: "List pending notification jobs"},
+	{Name: "failed", Description: "Show recently failed deliveries"},
+	{Name: "mute", Args: "<filter> <dur|off>", Description: "Mute filter for all recipients (30m, 2h, 1d)"},
+	{Name: "try", Args: "<filter> <text>", Description: "Dry-run filter against text"},
+	{Name: "search", Args: "<query> [--chat id] [--filter id] [--since 7d|2006-01-02] [--limit n]",
+		Description: "Search archived matched messages"},
+	{Name: "export", Args: "<file.jsonl|file.csv> [query] [--chat id] [--filter id] [--since 7d|2006-01-02]",
+		Description: "Export archived messages to JSONL or CSV"},
+	{Name: "backfill", Args: "<chat|filter> [--limit n | --since 7d|2006-01-02] [--report] | status | cancel <job>",
+		Description: "Run filters over recent history of watched chats"},
+}
+
+// queueCommands — команды, которым нужна очередь уведомлений.
+var queueCommands = []string{"status", "flush", "queue", "failed", "mute"}
+
+// archiveCommands — команды, которым нужен архив сообщений.
+var archiveCommands = []string{"search", "export"}
+
+// Descriptors возвращает копию реестра общих команд.
+func Descriptors() []Descriptor {
+	return slices.Clone(descriptors)
+}
+
+// Account — состояние одного аккаунта для команд: фильтры, очередь уведомлений, архив и backfill.
+// Queue == nil — команды очереди недоступны, Archive == nil — поиск и выгрузка, Backfill == nil — backfill.
+// ExportDir — каталог, за пределы которого export не пишет.
+type Account struct {
+	Name      string
+	Filters   *filters.FilterEngine
+	Queue     *notifications.Queue
+	Archive   *archive.Archive
+	ExportDir string
+	Backfill  *backfill.Service
+}
+
+// Executor выполняет общие команды. origin — имя фронтенда для логов и причин (cli, bot).
+// Команда относится к аккаунту, указанному аргументом @имя, иначе — к первому (основному);
+// status и reload без @имени при нескольких аккаунтах выполняются для всех.
+type Executor struct {
+	origin   string
+	accounts []Account
+
+	// Аккаунт выполняемой команды (см. forAccount).
+	filters   *filters.FilterEngine
+	queue     *notifications.Queue
+	archive   *archive.Archive
+	exportDir string
+	backfill  *backfill.Service
+}
+
+// NewExecutor создаёт исполнитель команд фронтенда origin над аккаунтами accounts;
+// первый аккаунт — основной.
+func NewExecutor(origin string, accounts ...Account) *Executor {
+	e := &Executor{origin: origin, accounts: slices.Clone(accounts)}
+	if len(accounts) > 0 {
+		return e.forAccount(accounts[0])
+	}
+	return e
+}
+
+// forAccount возвращает копию исполнителя, выполняющую команды над аккаунтом acc.
+func (e *Executor) forAccount(acc Account) *Executor {
+	scoped := *e
+	scoped.filters = acc.Filters
+	scoped.queue = acc.Queue
+	scoped.archive = acc.Archive
+	scoped.exportDir = acc.ExportDir
+	scoped.backfill = acc.Backfill
+	return &scoped
+}
+
+// Execute выполняет строку команды вида "<имя> [аргументы] [@аккаунт]" и возвращает текст ответа.
+// ErrUnknownCommand — имя не из общего набора; прочие ошибки — ошибка выполнения команды.
+func (e *Executor) Execute(line string) (string, error) {
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	args, acc, selected := e.selectAccount(strings.TrimSpace(args))
+	if selected {
+		return e.forAccount(acc).execute(name, args)
+	}
+	if len(e.accounts) > 1 && (name == "status" || name == "reload") {
+		return e.forEachAccount(name, args)
+	}
+	return e.execute(name, args)
+}
+
+// selectAccount извлекает из аргументов токен @имя известного аккаунта. Прочие токены
+// с @ (например, упоминания в тексте try или search) остаются аргументами.
+func (e *Executor) selectAccount(args string) (string, Account, bool) {
+	fields := strings.Fields(args)
+	for i, field := range fields {
+		name, ok := strings.CutPrefix(field, "@")
+		if !ok {
+			continue
+		}
+		idx := slices.IndexFunc(e.accounts, func(a Account) bool { return a.Name == name })
+		if idx < 0 {
+			continue
+		}
+		return strings.Join(slices.Delete(fields, i, i+1), " "), e.accounts[idx], true
+	}
+	return args, Account{}, false
+}
+
+// forEachAccount выполняет команду для каждого аккаунта и объединяет ответы под заголовками @имя.
+func (e *Executor) forEachAccount(name, args string) (string, error) {
+	var (
+		sections []string
+		errs     []error
+	)
+	for _, acc := range e.accounts {
+		out, err := e.forAccount(acc).execute(name, args)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("@%s: %w", acc.Name, err))
+			continue
+		}
+		sections = append(sections, "@"+acc.Name+":\n"+out)
+	}
+	if len(errs) > 0 && len(sections) == 0 {
+		return "", errors.Join(errs...)
+	}
+	for _, err := range errs {
+		sections = append(sections, "Error: "+err.Error())
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// execute выполняет команду над аккаунтом исполнителя.
+func (e *Executor) execute(name, args string) (string, error) {
+	if e.queue == nil && slices.Contains(queueCommands, name) {
+		return "", errors.New("queue is not available")
+	}
+	if e.archive == nil && slices.Contains(archiveCommands, name) {
+		return "", errors.New("archive is not available")
+	}
+	if e.backfill == nil && name == "backfill" {
+		return "", errors.New("backfill is not available")
+	}
+
+	switch name {
+	case "status":
+		return e.status(), nil
+	case "flush":
+		// Внеплановый слив регулярной очереди.
+		e.queue.FlushImmediately(e.origin + " flush")
+		return "Queue flush requested.", nil
+	case "reload":
+		// Перезагружаем фильтры и получателей; при ошибке остаются прежние.
+		if err := e.filters.Init(); err != nil {
+			return "", fmt.Errorf("reload filters error: %w", err)
+		}
+		return "recipients.json and filters.json reloaded", nil
+	case "queue":
+		return e.pending(), nil
+	case "failed":
+		return e.failed()
+	case "mute":
+		return e.mute(args)
+	case "try":
+		return e.try(args)
+	case "search":
+		return e.search(args)
+	case "export":
+		return e.export(args)
+	case "backfill":
+		return e.runBackfill(args)
+	default:
+		return "", ErrUnknownCommand
+	}
+}
+
+// status описывает агрегированное состояние очереди уведомлений: размеры, метки времени
+// последнего дренирования и флаша, следующего планового тика, тихих часов получателей,
+// непрочитанных critical, отключений и ближайших ретраев. Временные метки
+// приводятся к локальной таймзоне, заданной в статистике очереди.
+func (e *Executor) status() string {
+	st := e.queue.Stats()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Queue status: urgent=%d regular=%d\n", st.Urgent, st.Regular)
+	if !st.LastRegularDrainAt.IsZero() {
+		fmt.Fprintf(&b, "Last regular drain: %s\n", st.LastRegularDrainAt.In(st.Location).Format(time.RFC3339))
+	} else {
+		b.WriteString("Last regular drain: <never>\n")
+	}
+	if !st.LastFlushAt.IsZero() {
+		fmt.Fprintf(&b, "Last persist: %s\n", st.LastFlushAt.In(st.Location).Format(time.RFC3339))
+	} else {
+		b.WriteString("Last persist: <never>\n")
+	}
+	fmt.Fprintf(&b, "Next schedule tick: %s\n", st.NextScheduleAt.In(st.Location).Format(time.RFC3339))
+	for _, qi := range st.Quiet {
+		fmt.Fprintf(&b, "Quiet hours: %s (%s:%d) until %s, held=%d\n",
+			qi.Name, qi.Recipient.Type, qi.Recipient.ID, qi.Until.In(st.Location).Format(time.RFC3339), qi.Held)
+	}
+	if st.Escalations > 0 {
+		fmt.Fprintf(&b, "Critical awaiting read: %d\n", st.Escalations)
+	}
+	for _, m := range st.Mutes {
+		fmt.Fprintf(&b, "Muted: %s for %s until %s\n",
+			muteTarget(m), muteRecipient(m), m.Until.In(st.Location).Format(time.RFC3339))
+	}
+	if st.Retrying > 0 {
+		fmt.Fprintf(&b, "Retrying: %d job(s)\n", st.Retrying)
+		for _, r := range st.Retries {
+			fmt.Fprintf(&b, "  job %d (urgent=%t %s:%d) attempt %d/%d, next at %s: %s\n",
+				r.JobID, r.Urgent, r.Recipient.Type, r.Recipient.ID, r.Attempts, st.MaxAttempts,
+				r.NextAttemptAt.In(st.Location).Format(time.RFC3339), r.LastError)
+		}
+		if hidden := st.Retrying - len(st.Retries); hidden > 0 {
+			fmt.Fprintf(&b, "  ... and %d more\n", hidden)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// pending перечисляет ожидающие задания (не больше queueListLimit) в порядке доставки.
+func (e *Executor) pending() string {
+	jobs := e.queue.Pending()
+	if len(jobs) == 0 {
+		return "Queue is empty."
+	}
+	loc := e.queue.Stats().Location
+	lines := []string{fmt.Sprintf("Pending: %d job(s)", len(jobs))}
+	for _, job := range jobs[:min(len(jobs), queueListLimit)] {
+		var ids []string
+		if job.Source != nil {
+			ids = job.Source.Filters()
+		}
+		lines = append(lines, fmt.Sprintf("  job %d %s %s:%d created %s [%s]: %s",
+			job.ID, job.EffectivePriority(), job.Recipient.Type, job.Recipient.ID,
+			job.CreatedAt.In(loc).Format(time.RFC3339), strings.Join(ids, ","), preview(job.Payload.Text)))
+	}
+	if hidden := len(jobs) - queueListLimit; hidden > 0 {
+		lines = append(lines, fmt.Sprintf("  ... and %d more", hidden))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// failed перечисляет последние окончательно провалившиеся задания, новые первыми.
+func (e *Executor) failed() (string, error) {
+	records, err := e.queue.Failed()
+	if err != nil {
+		return "", fmt.Errorf("load failed jobs: %w", err)
+	}
+	if len(records) == 0 {
+		return "No failed jobs.", nil
+	}
+	loc := e.queue.Stats().Location
+	lines := []string{fmt.Sprintf("Failed: %d job(s)", len(records))}
+	for i := len(records) - 1; i >= max(len(records)-failedListLimit, 0); i-- {
+		rec := records[i]
+		lines = append(lines, fmt.Sprintf("  job %d %s:%d at %s: %s",
+			rec.Job.ID, rec.Job.Recipient.Type, rec.Job.Recipient.ID,
+			rec.FailedAt.In(loc).Format(time.RFC3339), rec.Error))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// mute отключает фильтр для всех получателей на заданный срок; "off" снимает отключения фильтра.
+func (e *Executor) mute(args string) (string, error) {
+	filterID, rawDur, _ := strings.Cut(args, " ")
+	rawDur = strings.TrimSpace(rawDur)
+	if filterID == "" || rawDur == "" {
+		return "", errors.New("usage: mute <filter> <dur|off>")
+	}
+	if _, ok := e.filter(filterID); !ok {
+		return "", fmt.Errorf("unknown filter %q", filterID)
+	}
+	if strings.EqualFold(rawDur, "off") {
+		return fmt.Sprintf("Filter %s unmuted (%d mute(s) removed)", filterID, e.queue.Unmute(filterID)), nil
+	}
+	dur, err := parseDuration(rawDur)
+	if err != nil {
+		return "", err
+	}
+	// Срок считается по часам очереди, как у кнопок отключения под уведомлениями.
+	mute := notifications.Mute{FilterID: filterID, Until: e.queue.Now().Add(dur)}
+	dropped := e.queue.Mute(mute)
+	// Действующее отключение могло оказаться длиннее: Mute не сокращает срок.
+	until := mute.Until
+	for _, m := range e.queue.Mutes() {
+		if m.FilterID == filterID && m.Recipient == mute.Recipient && m.Chat == mute.Chat {
+			until = m.Until
+		}
+	}
+	return fmt.Sprintf("Filter %s muted until %s (%d pending job(s) dropped)",
+		filterID, until.In(e.queue.Stats().Location).Format(time.RFC3339), dropped), nil
+}
+
+// try прогоняет текст через фильтр без постановки уведомлений и описывает результат.
+func (e *Executor) try(args string) (string, error) {
+	filterID, text, _ := strings.Cut(args, " ")
+	if filterID == "" {
+		return "", errors.New("usage: try <filter> <text>")
+	}
+	f, ok := e.filter(filterID)
+	if !ok {
+		return "", fmt.Errorf("unknown filter %q", filterID)
+	}
+	res := filters.MatchMessage(text, f)
+	lines := []string{fmt.Sprintf("Filter %s: %s (matched=%t)", f.ID, res.ResultType, res.Matched)}
+	if terms := res.MatchedNode.Terms(); len(terms) > 0 {
+		lines = append(lines, "Terms: "+strings.Join(terms, ", "))
+	}
+	if res.Matched {
+		priority := notifications.FilterPriority(f.Notify)
+		lines = append(lines, fmt.Sprintf("Would notify %s with priority %s",
+			strings.Join(f.Notify.Recipients, ", "), priority))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// filter ищет загруженный фильтр по ID.
+func (e *Executor) filter(id string) (filters.Filter, bool) {
+	all := e.filters.GetFilters()
+	idx := slices.IndexFunc(all, func(f filters.Filter) bool { return f.ID == id })
+	if idx < 0 {
+		return filters.Filter{}, false
+	}
+	return all[idx], true
+}
+
+// parseDuration разбирает длительность в формате time.ParseDuration с дополнительным суффиксом d (сутки).
+func parseDuration(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", raw)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	dur, err := time.ParseDuration(raw)
+	if err != nil || dur <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	return dur, nil
+}
+
+// muteTarget описывает, что отключено: фильтр или чат-источник.
+func muteTarget(m notifications.Mute) string {
+	if m.FilterID != "" {
+		return "filter " + m.FilterID
+	}
+	return fmt.Sprintf("chat %s:%d", m.Chat.Type, m.Chat.ID)
+}
+
+// muteRecipient описывает, для кого действует отключение.
+func muteRecipient(m notifications.Mute) string {
+	if m.Recipient == (notifications.Recipient{}) {
+		return "all recipients"
+	}
+	return fmt.Sprintf("%s:%d", m.Recipient.Type, m.Recipient.ID)
+}
+
+// preview возвращает первую строку текста, обрезанную до previewRunes символов.
+func preview(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if runes := []rune(line); len(runes) > previewRunes {
+		return string(runes[:previewRunes]) + "…"
+	}
+	return line
+}
@@ -0,0 +1,69 @@
+// Package commands / файл router.go — фронтенд общих команд для чата с ботом.
+// Сообщение вида "/mute f1 2h" (или "/mute@botname f1 2h" в группе) превращается в строку
+// команды Executor. Команды принимаются только от администраторов: сообщения остальных
+// игнорируются без ответа, чтобы не раскрывать наличие управления.
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Router разбирает команды бота и выполняет их через общий Executor.
+type Router struct {
+	exec   *Executor
+	admins []int64
+}
+
+// NewRouter создаёт маршрутизатор команд; admins — Telegram ID пользователей с доступом.
+func NewRouter(exec *Executor, admins []int64) *Router {
+	return &Router{exec: exec, admins: slices.Clone(admins)}
+}
+
+// HandleCommand выполняет команду text пользователя userID и возвращает ответ.
+// ok=false — сообщение не команда или отправитель не администратор: отвечать не нужно.
+func (r *Router) HandleCommand(_ context.Context, userID int64, text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", false
+	}
+	if !slices.Contains(r.admins, userID) {
+		logger.Warnf("Commands: user %d is not an admin, %q ignored", userID, text)
+		return "", false
+	}
+	head, args, _ := strings.Cut(text[1:], " ")
+	name, _, _ := strings.Cut(head, "@")
+	logger.Infof("Commands: user %d requested /%s", userID, name)
+
+	if name == "help" || name == "start" {
+		return helpText(), true
+	}
+	out, err := r.exec.Execute(name + " " + args)
+	switch {
+	case errors.Is(err, ErrUnknownCommand):
+		return fmt.Sprintf("Unknown command /%s. Send /help for the list.", name), true
+	case err != nil:
+		return "Error: " + err.Error(), true
+	default:
+		return out, true
+	}
+}
+
+// helpText перечисляет команды бота с аргументами и описаниями.
+func helpText() string {
+	lines := []string{"Available commands:"}
+	for _, d := range descriptors {
+		usage := "/" + d.Name
+		if d.Args != "" {
+			usage += " " + d.Args
+		}
+		lines = append(lines, fmt.Sprintf("%s - %s", usage, d.Description))
+	}
+	return strings.Join(lines, "\n")
+}
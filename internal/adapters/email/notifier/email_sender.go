@@ -0,0 +1,292 @@
+// Package emailnotifier предоставляет реализацию PreparedSender для доставки по SMTP.
+//
+// В этом файле (email_sender.go):
+//   - адрес берётся из описания получателя type=email в recipients.json;
+//   - задание (или дайджест заданий) рендерится в письмо multipart/alternative:
+//     text/plain и text/html со ссылкой на исходное сообщение (см. message.go);
+//   - соединение устанавливается с STARTTLS или неявным TLS, при заданном логине — AUTH PLAIN;
+//   - отправка идёт через общий троттлер;
+//   - ответы SMTP 5xx считаются постоянной ошибкой получателя (SendOutcome.PermanentFailures),
+//     4xx и сетевые сбои — временной.
+//
+// EmailSender реализует notifications.DigestSender: регулярные задания одного получателя,
+// готовые к окну расписания, уходят одним письмом.
+
+package emailnotifier
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/infra/throttle"
+)
+
+// smtpTimeout — таймаут на установку соединения и весь SMTP-диалог одного письма.
+const smtpTimeout = 30 * time.Second
+
+// throttleMaxRetries ограничивает повторы внутри троттлера: дальше задание откладывает
+// политика повторов очереди, не блокируя остальные.
+const throttleMaxRetries = 2
+
+// Режимы защиты соединения (SMTP_SECURITY).
+const (
+	SecurityStartTLS = "starttls"
+	SecurityTLS      = "tls"
+	SecurityNone     = "none"
+)
+
+// SMTPOptions — параметры SMTP-сервера.
+//
+// Поля:
+//   - Host/Port — адрес сервера;
+//   - Username/Password — учётные данные AUTH PLAIN (пустой Username — без авторизации);
+//   - From — адрес отправителя (допускается форма "Name <addr>");
+//   - Security — starttls|tls|none.
+type SMTPOptions struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Security string
+}
+
+// EmailSender реализует notifications.PreparedSender и notifications.DigestSender поверх SMTP.
+//
+// Поля:
+//   - recipients — справочник получателей (адрес по синтетическому peer_id);
+//   - opts       — параметры SMTP-сервера;
+//   - from       — разобранный адрес отправителя;
+//   - limiter    — общий троттлер;
+//   - now        — источник времени для заголовков Date и Message-ID.
+type EmailSender struct {
+	recipients *filters.FilterEngine
+	opts       SMTPOptions
+	from       *mail.Address
+	limiter    *throttle.Throttler
+	now        func() time.Time
+}
+
+// NewEmailSender создаёт PreparedSender для получателей type=email.
+// Возвращает ошибку, если адрес отправителя не разбирается или пароль пришлось бы
+// передавать открытым текстом (AUTH без TLS к удалённому серверу).
+func NewEmailSender(recipients *filters.FilterEngine, opts SMTPOptions, rps int) (*EmailSender, error) {
+	from, err := mail.ParseAddress(opts.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM %q: %w", opts.From, err)
+	}
+	if opts.Security == SecurityNone && opts.Username != "" && opts.Host != "localhost" && opts.Host != "127.0.0.1" {
+		return nil, errors.New("SMTP auth requires SMTP_SECURITY=starttls or tls for a remote server")
+	}
+	return &EmailSender{
+		recipients: recipients,
+		opts:       opts,
+		from:       from,
+		limiter:    throttle.New(rps, throttle.WithMaxRetries(throttleMaxRetries)),
+		now:        time.Now,
+	}, nil
+}
+
+// WithRecipients возвращает отправителя со справочником получателей recipients,
+// разделяющего с s настройки SMTP и троттлер (у каждого аккаунта свой справочник).
+func (s *EmailSender) WithRecipients(recipients *filters.FilterEngine) *EmailSender {
+	view := *s
+	view.recipients = recipients
+	return &view
+}
+
+// Start подключает троттлер к жизненному циклу очереди.
+func (s *EmailSender) Start(ctx context.Context) {
+	if s.limiter != nil {
+		s.limiter.Start(ctx)
+	}
+}
+
+// Stop завершает фоновые горутины троттлера.
+func (s *EmailSender) Stop() {
+	if s.limiter != nil {
+		s.limiter.Stop()
+	}
+}
+
+// Deliver отправляет одно задание отдельным письмом.
+func (s *EmailSender) Deliver(ctx context.Context, job notifications.Job) (notifications.SendOutcome, error) {
+	return s.DeliverDigest(ctx, []notifications.Job{job})
+}
+
+// Digest сообщает, что задания e-mail получателей собираются в дайджест.
+func (s *EmailSender) Digest(recipient notifications.Recipient) bool {
+	return recipient.Type == notifications.RecipientTypeEmail
+}
+
+// DeliverDigest отправляет задания одного получателя одним письмом.
+func (s *EmailSender) DeliverDigest(ctx context.Context, jobs []notifications.Job) (notifications.SendOutcome, error) {
+	var outcome notifications.SendOutcome
+	if len(jobs) == 0 {
+		return outcome, nil
+	}
+	recipient := jobs[0].Recipient
+
+	rcpt, ok := s.recipients.RecipientByPeer(notifications.RecipientTypeEmail, recipient.ID)
+	if !ok {
+		outcome.PermanentFailures = []notifications.Recipient{recipient}
+		outcome.PermanentError = fmt.Errorf("email recipient %d is not configured", recipient.ID)
+		return outcome, nil
+	}
+	to, err := mail.ParseAddress(rcpt.Email)
+	if err != nil {
+		outcome.PermanentFailures = []notifications.Recipient{recipient}
+		outcome.PermanentError = fmt.Errorf("email recipient %s: %w", rcpt.ID, err)
+		return outcome, nil
+	}
+
+	msg, err := buildMessage(s.from, to, jobs, s.now())
+	if err != nil {
+		outcome.PermanentFailures = []notifications.Recipient{recipient}
+		outcome.PermanentError = fmt.Errorf("email render: %w", err)
+		return outcome, nil
+	}
+
+	permanent, err := s.send(ctx, to.Address, msg)
+	if err != nil {
+		if permanent {
+			outcome.PermanentFailures = []notifications.Recipient{recipient}
+			outcome.PermanentError = err
+			return outcome, nil
+		}
+		outcome.Retry = true
+		return outcome, err
+	}
+	return outcome, nil
+}
+
+// send выполняет отправку под троттлером. Возвращает (permanent, err) по правилам Deliver.
+func (s *EmailSender) send(ctx context.Context, to string, msg []byte) (bool, error) {
+	if s.limiter == nil {
+		return s.performSend(ctx, to, msg)
+	}
+
+	var (
+		permanent  bool
+		requestErr error
+	)
+	err := s.limiter.Do(ctx, func() error {
+		var errDo error
+		permanent, errDo = s.performSend(ctx, to, msg)
+		requestErr = errDo
+		if errDo != nil && permanent {
+			return &stopRetryError{err: errDo}
+		}
+		return errDo
+	})
+	if err != nil {
+		if permanent {
+			return true, requestErr
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// performSend проводит один SMTP-диалог: соединение (TLS/STARTTLS), AUTH, MAIL, RCPT, DATA, QUIT.
+func (s *EmailSender) performSend(ctx context.Context, to string, msg []byte) (bool, error) {
+	addr := net.JoinHostPort(s.opts.Host, strconv.Itoa(s.opts.Port))
+	tlsConfig := &tls.Config{ServerName: s.opts.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.opts.Security == SecurityTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return false, fmt.Errorf("smtp dial %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, s.opts.Host)
+	if err != nil {
+		_ = conn.Close()
+		return classify("smtp greeting", err)
+	}
+	defer client.Close()
+
+	if s.opts.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return true, errors.New("smtp server does not support STARTTLS")
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return classify("smtp starttls", err)
+		}
+	}
+	if s.opts.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return true, errors.New("smtp server does not support AUTH")
+		}
+		auth := smtp.PlainAuth("", s.opts.Username, s.opts.Password, s.opts.Host)
+		if err = client.Auth(auth); err != nil {
+			return classify("smtp auth", err)
+		}
+	}
+
+	if err = client.Mail(s.from.Address); err != nil {
+		return classify("smtp mail from", err)
+	}
+	if err = client.Rcpt(to); err != nil {
+		return classify("smtp rcpt to", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return classify("smtp data", err)
+	}
+	if _, err = w.Write(msg); err != nil {
+		_ = w.Close()
+		return classify("smtp write", err)
+	}
+	if err = w.Close(); err != nil {
+		return classify("smtp data end", err)
+	}
+	// Письмо уже принято сервером: ошибка QUIT на доставку не влияет.
+	_ = client.Quit()
+	return false, nil
+}
+
+// classify оборачивает ошибку шага SMTP-диалога: ответы 5xx — постоянные, остальное — временное.
+func classify(step string, err error) (bool, error) {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 500, fmt.Errorf("%s: %d %s", step, protoErr.Code, protoErr.Msg)
+	}
+	return false, fmt.Errorf("%s: %w", step, err)
+}
+
+// stopRetryError — маркер для прекращения ретраев троттлера при постоянной ошибке.
+type stopRetryError struct {
+	err error
+}
+
+func (e *stopRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stopRetryError) Unwrap() error {
+	return e.err
+}
+
+func (e *stopRetryError) StopRetry() bool {
+	return true
+}
@@ -0,0 +1,171 @@
+package emailnotifier
+
+// Package emailnotifier — рендеринг письма. Одно или несколько заданий превращаются
+// в сообщение MIME multipart/alternative (text/plain + text/html, UTF-8, quoted-printable).
+// Для каждого задания: текст уведомления, цитата исходного сообщения и ссылка на него.
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"telegram-userbot/internal/domain/notifications"
+)
+
+// subjectMaxRunes ограничивает длину темы письма с одним уведомлением.
+const subjectMaxRunes = 80
+
+// buildMessage собирает письмо с заголовками и телом из заданий jobs.
+func buildMessage(from, to *mail.Address, jobs []notifications.Job, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := writePart(mw, "text/plain", renderText(jobs)); err != nil {
+		return nil, err
+	}
+	if err := writePart(mw, "text/html", renderHTML(jobs)); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) { fmt.Fprintf(&msg, "%s: %s\r\n", name, value) }
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject(jobs)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID(from, jobs[0].ID, now))
+	header("MIME-Version", "1.0")
+	header("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", mw.Boundary()))
+	if urgent(jobs) {
+		header("X-Priority", "1")
+		header("Importance", "high")
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// writePart добавляет часть multipart в кодировке quoted-printable.
+func writePart(mw *multipart.Writer, contentType, content string) error {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", contentType+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err = qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// subject — первая строка уведомления для одного задания, число уведомлений для дайджеста.
+func subject(jobs []notifications.Job) string {
+	if len(jobs) > 1 {
+		return fmt.Sprintf("%d notifications", len(jobs))
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(jobs[0].Payload.Text), "\n")
+	if line == "" {
+		return "Notification"
+	}
+	if utf8.RuneCountInString(line) > subjectMaxRunes {
+		line = string([]rune(line)[:subjectMaxRunes-1]) + "…"
+	}
+	return line
+}
+
+// messageID строит уникальный Message-ID в домене отправителя.
+func messageID(from *mail.Address, jobID int64, now time.Time) string {
+	domain := "localhost"
+	if _, d, ok := strings.Cut(from.Address, "@"); ok && d != "" {
+		domain = d
+	}
+	return fmt.Sprintf("<notify-%d.%d@%s>", jobID, now.UnixNano(), domain)
+}
+
+// urgent сообщает, есть ли в письме уведомления приоритета high и выше.
+func urgent(jobs []notifications.Job) bool {
+	for _, job := range jobs {
+		if job.EffectivePriority().Immediate() {
+			return true
+		}
+	}
+	return false
+}
+
+// renderText формирует text/plain: уведомления через разделитель, исходный текст цитатой.
+func renderText(jobs []notifications.Job) string {
+	var b strings.Builder
+	for i, job := range jobs {
+		if i > 0 {
+			b.WriteString("\n\n---\n\n")
+		}
+		b.WriteString(strings.TrimSpace(job.Payload.Text))
+		if orig := originalText(job); orig != "" {
+			b.WriteString("\n\n")
+			for line := range strings.SplitSeq(orig, "\n") {
+				b.WriteString("> " + line + "\n")
+			}
+		}
+		if link := sourceLink(job); link != "" {
+			b.WriteString("\nSource: " + link)
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// renderHTML формирует text/html с теми же блоками, что и текстовая часть.
+func renderHTML(jobs []notifications.Job) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><body>")
+	for i, job := range jobs {
+		if i > 0 {
+			b.WriteString("<hr>")
+		}
+		b.WriteString("<p>" + htmlLines(strings.TrimSpace(job.Payload.Text)) + "</p>")
+		if orig := originalText(job); orig != "" {
+			b.WriteString(`<blockquote style="border-left:3px solid #ccc;margin:0;padding-left:8px">` +
+				htmlLines(orig) + "</blockquote>")
+		}
+		if link := sourceLink(job); link != "" {
+			escaped := html.EscapeString(link)
+			b.WriteString(`<p><a href="` + escaped + `">` + escaped + "</a></p>")
+		}
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
+// htmlLines экранирует текст и заменяет переводы строк на <br>.
+func htmlLines(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>\n")
+}
+
+// originalText возвращает исходный текст сообщения (если очередь его приложила).
+func originalText(job notifications.Job) string {
+	if job.Payload.Copy == nil {
+		return ""
+	}
+	return strings.TrimSpace(job.Payload.Copy.Text)
+}
+
+// sourceLink возвращает ссылку на исходное сообщение.
+func sourceLink(job notifications.Job) string {
+	if job.Source == nil {
+		return ""
+	}
+	return job.Source.Link
+}
@@ -40,9 +40,10 @@ func (t TerminalAuthenticator) Phone(_ context.Context) (string, error) {
 }
 
 // Code запрашивает код подтверждения у пользователя и возвращает его без пробелов по краям.
-// sentCode содержит метаданные от Telegram и здесь не используется.
+// sentCode содержит метаданные от Telegram и здесь не используется. Номер в подсказке
+// различает аккаунты, когда процесс обслуживает несколько.
 func (t TerminalAuthenticator) Code(_ context.Context, sentCode *tg.AuthSentCode) (string, error) {
-	return readLine("Enter the code from Telegram: ")
+	return readLine("Enter the code from Telegram for " + t.PhoneNumber + ": ")
 }
 
 // Password считывает пароль двухфакторной аутентификации без отображения вводимых символов.
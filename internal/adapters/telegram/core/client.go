@@ -19,28 +19,30 @@ import (
 )
 
 // ClientCore — тонкая обёртка над gotd, объединяющая сетевой клиент и RPC‑клиента.
-// Хранит снимок конфигурации окружения, необходимый для интерактивной авторизации и управления сессией.
+// Хранит описание аккаунта, необходимое для интерактивной авторизации и управления сессией.
 type ClientCore struct {
-	Client *telegram.Client // Сетевой клиент gotd: держит MTProto‑соединение, прокачивает апдейты, управляет сессией
-	API    *tg.Client       // Тонкий RPC‑клиент для вызовов Telegram (Auth, Messages, Users и т.д.)
-	cfg    config.EnvConfig // Снимок конфигурации (API‑параметры, номер телефона, путь к сессии). ДОЛЖЕН быть установлен.
+	Client  *telegram.Client // Сетевой клиент gotd: держит MTProto‑соединение, прокачивает апдейты, управляет сессией
+	API     *tg.Client       // Тонкий RPC‑клиент для вызовов Telegram (Auth, Messages, Users и т.д.)
+	account config.Account   // Аккаунт клиента: имя, номер телефона и путь к файлу сессии.
 }
 
-// New создаёт ClientCore и инициализирует gotd‑клиент на основе текущего Env.
+// New создаёт ClientCore аккаунта account и инициализирует gotd‑клиент с API ID/Hash из Env.
 // dispatcher передан для совместимости с вызывающим кодом, сам New не назначает его —
 // ожидается, что UpdateHandler уже указан в options.UpdateHandler.
-// Важно: поле cfg в возвращаемом ClientCore должно быть заполнено (например, через присваивание
-// config.Env()) до вызовов Login/Logout, иначе интерактивная авторизация и очистка сессии
-// не смогут использовать номер телефона и путь к файлу сессии.
-func New(dispatcher telegram.UpdateHandler, options telegram.Options) (*ClientCore, error) {
+func New(dispatcher telegram.UpdateHandler, options telegram.Options, account config.Account) (*ClientCore, error) {
 	// Создаём сетевой клиент gotd, используя API ID/Hash из Env и переданные options.
 	client := telegram.NewClient(config.Env().APIID, config.Env().APIHash, options)
 
 	return &ClientCore{
-		Client: client,
-		API:    client.API(),
+		Client:  client,
+		API:     client.API(),
+		account: account,
 	}, nil
-	// NOTE: cfg не инициализируется здесь. Заполните c.cfg снаружи (например, c.cfg = config.Env()).
+}
+
+// Account возвращает имя аккаунта клиента.
+func (c *ClientCore) Account() string {
+	return c.account.Name
 }
 
 // Login выполняет интерактивную авторизацию:
@@ -48,7 +50,7 @@ func New(dispatcher telegram.UpdateHandler, options telegram.Options) (*ClientCo
 //  2. если не авторизованы — запускает auth.Flow с TerminalAuthenticator,
 //  3. при необходимости обрабатывает ввод кода/2FA и приём условий использования.
 //
-// Требования: c.cfg.PhoneNumber должен быть установлен. Возвращает ошибку сети/авторизации.
+// Номер телефона берётся из описания аккаунта. Возвращает ошибку сети/авторизации.
 func (c *ClientCore) Login(ctx context.Context) error {
 	// 1) Быстрая проверка: есть ли валидная сессия.
 	status, err := c.Client.Auth().Status(ctx)
@@ -62,9 +64,9 @@ func (c *ClientCore) Login(ctx context.Context) error {
 		return nil
 	}
 
-	// 2) Готовим интерактивный сценарий: TerminalAuthenticator читает номер из c.cfg.PhoneNumber.
+	// 2) Готовим интерактивный сценарий: TerminalAuthenticator читает номер аккаунта.
 	flow := auth.NewFlow(
-		TerminalAuthenticator{PhoneNumber: c.cfg.PhoneNumber},
+		TerminalAuthenticator{PhoneNumber: c.account.PhoneNumber},
 		auth.SendCodeOptions{},
 	)
 
@@ -73,14 +75,14 @@ func (c *ClientCore) Login(ctx context.Context) error {
 }
 
 // Logout завершает серверную сессию и очищает локальный файл сессии.
-// Требования: c.cfg.SessionFile должен указывать на путь к файлу сессии. Игнорирует отсутствие файла.
+// Путь к файлу сессии берётся из описания аккаунта. Игнорирует отсутствие файла.
 func (c *ClientCore) Logout(ctx context.Context) error {
 	// 1) Закрываем серверную сессию через RPC.
 	if _, err := c.API.AuthLogOut(ctx); err != nil {
 		return fmt.Errorf("logout failed: %w", err)
 	}
 	// 2) Удаляем локальный файл сессии; отсутствие файла не считается ошибкой.
-	if err := os.Remove(c.cfg.SessionFile); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(c.account.SessionFile); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove session file: %w", err)
 	}
 	// 3) Сообщаем пользователю об успешном выходе.
@@ -71,15 +71,15 @@ func ensureStateJSON(path string) (persisted, error) {
 	}
 
 	// Пробуем прочитать текущий файл состояния.
-	bytes, err := os.ReadFile(clean)
-	if os.IsNotExist(err) || len(bytes) == 0 {
+	bytes, err := storage.ReadSealedFile(clean)
+	if os.IsNotExist(err) || (err == nil && len(bytes) == 0) {
 		// Файл отсутствует или пуст — инициализируем дефолтной структурой и пишем атомарно.
 		p := persisted{States: map[int64]updates.State{}, Channels: map[int64]map[int64]int{}}
 		enc, mErr := json.MarshalIndent(p, "", "  ")
 		if mErr != nil {
 			return persisted{}, fmt.Errorf("encode default state: %w", mErr)
 		}
-		if wErr := storage.AtomicWriteFile(clean, enc); wErr != nil {
+		if wErr := storage.AtomicWriteSealedFile(clean, enc); wErr != nil {
 			return persisted{}, fmt.Errorf("init state file: %w", wErr)
 		}
 		logger.Debugf("StateStorage: created initial file %s", clean)
@@ -99,7 +99,7 @@ func ensureStateJSON(path string) (persisted, error) {
 		if mErr != nil {
 			return persisted{}, fmt.Errorf("encode default state: %w", mErr)
 		}
-		if wErr := storage.AtomicWriteFile(clean, enc); wErr != nil {
+		if wErr := storage.AtomicWriteSealedFile(clean, enc); wErr != nil {
 			return persisted{}, fmt.Errorf("rewrite default state: %w", wErr)
 		}
 		return p, nil
@@ -120,7 +120,7 @@ func ensureStateJSON(path string) (persisted, error) {
 		if mErr != nil {
 			return p, fmt.Errorf("encode fixed state: %w", mErr)
 		}
-		if wErr := storage.AtomicWriteFile(clean, enc); wErr != nil {
+		if wErr := storage.AtomicWriteSealedFile(clean, enc); wErr != nil {
 			return p, fmt.Errorf("persist fixed state: %w", wErr)
 		}
 	}
@@ -152,7 +152,7 @@ func (f *fileStorage) persist() error {
 	if err != nil {
 		return err
 	}
-	return storage.AtomicWriteFile(f.path, enc)
+	return storage.AtomicWriteSealedFile(f.path, enc)
 }
 
 // GetState возвращает сохранённое состояние пользователя и флаг его наличия.
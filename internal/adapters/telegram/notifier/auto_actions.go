@@ -0,0 +1,115 @@
+// Package telegramnotifier / файл auto_actions.go — исполнение автоматических действий
+// фильтров (internal/domain/actions) от имени аккаунта. Все вызовы идут через общий
+// троттлер ClientSender, поэтому действия и уведомления делят один бюджет запросов,
+// а FLOOD_WAIT выдерживается одинаково. Отправки используют random_id из ключа
+// идемпотентности задачи, чтобы ретраи не создавали дублей.
+
+package telegramnotifier
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+
+	"telegram-userbot/internal/domain/actions"
+	"telegram-userbot/internal/domain/filters"
+
+	"github.com/gotd/td/tg"
+)
+
+// Perform выполняет действие task. Постоянные ошибки Telegram (4xx) не повторяются.
+func (s *ClientSender) Perform(ctx context.Context, task actions.Task) error {
+	if task.Action.Type == filters.ActionMarkRead {
+		return s.MarkRead(ctx, task.Peer, slices.Max(task.MessageIDs))
+	}
+
+	peer, err := s.peers.InputPeerByKind(ctx, task.Peer.Type, task.Peer.ID)
+	if err != nil {
+		return fmt.Errorf("resolve source peer %s:%d: %w", task.Peer.Type, task.Peer.ID, err)
+	}
+	s.conn.WaitOnline(ctx)
+
+	switch task.Action.Type {
+	case filters.ActionReply:
+		s.presence.DoTypingWaitChars(ctx, peer, task.Text)
+		return s.callAction(ctx, func() error {
+			_, errSend := s.api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+				Peer:     peer,
+				Message:  task.Text,
+				RandomID: task.RandomID(0),
+				ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: task.MessageID},
+			})
+			return errSend
+		})
+	case filters.ActionReact:
+		return s.callAction(ctx, func() error {
+			_, errReact := s.api.MessagesSendReaction(ctx, &tg.MessagesSendReactionRequest{
+				Peer:     peer,
+				MsgID:    task.MessageID,
+				Reaction: []tg.ReactionClass{&tg.ReactionEmoji{Emoticon: task.Action.Emoji}},
+			})
+			return errReact
+		})
+	case filters.ActionForwardTo:
+		target, errTarget := s.peers.InputPeerByKind(ctx, task.Target.Type, task.Target.ID)
+		if errTarget != nil {
+			return fmt.Errorf("resolve target peer %s:%d: %w", task.Target.Type, task.Target.ID, errTarget)
+		}
+		return s.forwardAction(ctx, task, peer, target)
+	case filters.ActionSave:
+		return s.forwardAction(ctx, task, peer, &tg.InputPeerSelf{})
+	case filters.ActionPin:
+		return s.callAction(ctx, func() error {
+			_, errPin := s.api.MessagesUpdatePinnedMessage(ctx, &tg.MessagesUpdatePinnedMessageRequest{
+				Silent: true,
+				Peer:   peer,
+				ID:     task.MessageID,
+			})
+			return errPin
+		})
+	case filters.ActionMuteChat:
+		// mute_until — unix-время; без срока — максимальное значение («навсегда»).
+		until := math.MaxInt32
+		if !task.Until.IsZero() {
+			until = int(task.Until.Unix())
+		}
+		return s.callAction(ctx, func() error {
+			_, errMute := s.api.AccountUpdateNotifySettings(ctx, &tg.AccountUpdateNotifySettingsRequest{
+				Peer:     &tg.InputNotifyPeer{Peer: peer},
+				Settings: tg.InputPeerNotifySettings{MuteUntil: until},
+			})
+			return errMute
+		})
+	default:
+		return fmt.Errorf("unsupported action type %q", task.Action.Type)
+	}
+}
+
+// forwardAction пересылает сообщения задачи (все части альбома) в to.
+func (s *ClientSender) forwardAction(ctx context.Context, task actions.Task, from, to tg.InputPeerClass) error {
+	randomIDs := make([]int64, len(task.MessageIDs))
+	for i := range task.MessageIDs {
+		randomIDs[i] = task.RandomID(i)
+	}
+	return s.callAction(ctx, func() error {
+		_, errFwd := s.api.MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+			FromPeer: from,
+			ID:       task.MessageIDs,
+			RandomID: randomIDs,
+			ToPeer:   to,
+		})
+		return errFwd
+	})
+}
+
+// callAction выполняет вызов API под троттлером; постоянные ошибки прекращают повторы.
+func (s *ClientSender) callAction(ctx context.Context, call func() error) error {
+	return s.limiter.Do(ctx, func() error {
+		err := call()
+		if err != nil && isPermanentRPCError(err) {
+			return &stopRetryError{err: err, reason: stopRetryReasonPermanent}
+		}
+		return err
+	})
+}
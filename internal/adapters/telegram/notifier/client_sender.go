@@ -4,7 +4,7 @@
 // классифицирует ошибки и поддерживает повторные попытки. В рамках файла
 // client_sender.go реализована доставка текста и опциональный ре-форвард
 // исходных сообщений с детерминированными random_id, чтобы ретраи не
-// создавали дубликатов.
+// создавали дубликатов, а также правка ранее отправленных уведомлений.
 package telegramnotifier
 
 import (
@@ -25,6 +25,10 @@ import (
 	"github.com/gotd/td/tgerr"
 )
 
+// throttleMaxRetries ограничивает повторы и паузы FLOOD_WAIT внутри троттлера: дальше
+// задание откладывает политика повторов очереди, не блокируя остальные.
+const throttleMaxRetries = 2
+
 // stopRetryReason используется для высокоуровневой классификации причин
 // остановки ретраев. Значение вкладывается в stopRetryError и считывается
 // внешней логикой Deliver/троттлером.
@@ -58,30 +62,45 @@ func (e *stopRetryError) Reason() stopRetryReason { return e.reason }
 // ClientSender реализует notifications.PreparedSender поверх MTProto-клиента.
 // Поля:
 //   - api — клиент Telegram;
-//   - limiter — троттлер запросов (token bucket) с поддержкой FLOOD_WAIT.
+//   - limiter — троттлер запросов (token bucket) с поддержкой FLOOD_WAIT;
+//   - conn, presence — соединение и онлайн-статус аккаунта клиента.
 type ClientSender struct {
-	api     *tg.Client
-	limiter *throttle.Throttler
-	peers   *peersmgr.Service
+	api      *tg.Client
+	limiter  *throttle.Throttler
+	peers    *peersmgr.Service
+	conn     *connection.Manager
+	presence *status.StatusManager
 }
 
 // NewClientSender создаёт PreparedSender, оборачивая tg.Client троттлером.
 // Параметр rps задаёт целевую среднюю частоту запросов. Подключён
-// FloodWaitExtractor для корректной паузы при FLOOD_WAIT/FLOOD_PREMIUM_WAIT.
-func NewClientSender(api *tg.Client, rps int, peers *peersmgr.Service) *ClientSender {
+// FloodWaitExtractor для корректной паузы при FLOOD_WAIT/FLOOD_PREMIUM_WAIT; повторы и паузы
+// ограничены throttleMaxRetries, после чего Deliver возвращает исход с Retry.
+// conn и presence — менеджеры соединения и статуса аккаунта (nil — менеджеры по умолчанию).
+func NewClientSender(
+	api *tg.Client,
+	rps int,
+	peers *peersmgr.Service,
+	conn *connection.Manager,
+	presence *status.StatusManager,
+) *ClientSender {
 	if peers == nil {
 		panic("ClientSender: peers manager must not be nil")
 	}
 	// Троттлер ограничивает RPS и умеет извлекать обязательные паузы из FLOOD_WAIT.
 	throttler := throttle.New(
 		rps,
+		throttle.WithMaxRetries(throttleMaxRetries),
+		throttle.WithMaxWaits(throttleMaxRetries),
 		throttle.WithWaitExtractors(FloodWaitExtractor()),
 	)
 
 	return &ClientSender{
-		api:     api,
-		limiter: throttler,
-		peers:   peers,
+		api:      api,
+		limiter:  throttler,
+		peers:    peers,
+		conn:     conn,
+		presence: presence,
 	}
 }
 
@@ -106,7 +125,7 @@ func (s *ClientSender) Stop() {
 //  2. небольшую случайную паузу для «очеловечивания» активности.
 func (s *ClientSender) BeforeDrain(ctx context.Context) {
 	// 1) Перейти в онлайн (чтобы MTProto-аккаунт считался активным для собеседников).
-	status.GoOnline()
+	s.presence.GoOnline()
 
 	// 2) Случайная задержка для «очеловечивания» (если у вас такая политика).
 	// Неблокирующая отмена через ctx.
@@ -116,11 +135,11 @@ func (s *ClientSender) BeforeDrain(ctx context.Context) {
 // Deliver выполняет одно задание: для получателя в job:
 //  1. резолвит peer через локальный кэш;
 //  2. ждёт онлайна и имитирует набор текста;
-//  3. отправляет текст; при необходимости — пересылает оригиналы;
+//  3. отправляет текст (или правит ранее отправленный при EditOf); при необходимости — пересылает оригиналы;
 //  4. классифицирует ошибки: permanent → пропуск адресата, network → выход,
 //     прочие → возврат с флагом Retry.
 //
-// Возвращает SendOutcome и ошибку, если требуется прерывание дренирования.
+// Возвращает SendOutcome (с ID отправленного текста) и ошибку, если требуется прерывание дренирования.
 func (s *ClientSender) Deliver(ctx context.Context, job notifications.Job) (notifications.SendOutcome, error) {
 	var outcome notifications.SendOutcome
 
@@ -138,21 +157,27 @@ func (s *ClientSender) Deliver(ctx context.Context, job notifications.Job) (noti
 		return outcome, nil
 	}
 
+	// Правка ранее доставленного уведомления: без «typing» и без пересылки.
+	if job.Payload.EditOf != 0 {
+		s.conn.WaitOnline(ctx)
+		_, retErr := s.handleAPIErr(s.apiEditMessage(ctx, job, recipient, peer), recipient, &outcome)
+		return outcome, retErr
+	}
+
 	// Убеждаемся, что соединение живо, и показываем «typing».
-	connection.WaitOnline(ctx)
-	status.DoTypingWaitChars(ctx, peer, job.Payload.Text)
+	s.conn.WaitOnline(ctx)
+	s.presence.DoTypingWaitChars(ctx, peer, job.Payload.Text)
 
 	if hasText {
-		skip, retErr := s.handleAPIErr(
-			s.apiSendMessage(ctx, job, recipient, peer),
-			recipient, &outcome,
-		)
+		sentID, errSend := s.apiSendMessage(ctx, job, recipient, peer)
+		skip, retErr := s.handleAPIErr(errSend, recipient, &outcome)
 		if skip {
 			return outcome, nil
 		}
 		if retErr != nil {
 			return outcome, retErr
 		}
+		outcome.SentMessageID = sentID
 	}
 
 	if needForward {
@@ -207,16 +232,19 @@ func (s *ClientSender) handleAPIErr(
 	return false, err
 }
 
-// apiSendMessage отправляет подготовленный текст конкретному получателю.
+// apiSendMessage отправляет подготовленный текст конкретному получателю и возвращает
+// ID отправленного сообщения (0, если Telegram его не сообщил).
 // Использует детерминированный random_id (jobID+recipient), чтобы повторы
 // не создавали дубликаты. При активном форварде отключает предпросмотр ссылок
 // (NoWebpage=true), чтобы текст и форвард не конфликтовали визуально.
+// Payload.ReplyTo превращается в ответ на ранее доставленное уведомление;
+// задания низкого приоритета и в тихие часы (политика silent) уходят без звука.
 func (s *ClientSender) apiSendMessage(
 	ctx context.Context,
 	job notifications.Job,
 	recipient notifications.Recipient,
 	peer tg.InputPeerClass,
-) error {
+) (int, error) {
 	// Детерминированный random_id: одинаков для всех ретраев этой пары (recipient).
 	randomID := notifications.RandomIDForMessage(job, recipient)
 
@@ -224,20 +252,26 @@ func (s *ClientSender) apiSendMessage(
 		Peer:     peer,
 		Message:  job.Payload.Text,
 		RandomID: randomID,
+		Silent:   job.SilentDelivery(),
 	}
 	if job.Payload.Forward != nil && job.Payload.Forward.Enabled {
 		// При включённом форварде убираем превью ссылок в тексте, чтобы избежать «перемешивания» содержимого.
 		req.NoWebpage = true
 	}
+	if job.Payload.ReplyTo != 0 {
+		req.ReplyTo = &tg.InputReplyToMessage{ReplyToMsgID: job.Payload.ReplyTo}
+	}
 
 	logger.Debugf(
 		"ClientSender: send message job=%d recipient=%d random_id=%d",
 		job.ID, recipient.ID, randomID,
 	)
 
-	return s.limiter.Do(ctx, func() error {
-		_, err := s.api.MessagesSendMessage(ctx, req)
+	var sentID int
+	err := s.limiter.Do(ctx, func() error {
+		updates, err := s.api.MessagesSendMessage(ctx, req)
 		if err == nil {
+			sentID = sentMessageID(updates, randomID)
 			return nil
 		}
 
@@ -247,7 +281,7 @@ func (s *ClientSender) apiSendMessage(
 		)
 
 		// Сетевые/MTProto-сбои: просим внешний цикл подождать восстановления соединения.
-		if connection.HandleError(err) {
+		if s.conn.HandleError(err) {
 			return &stopRetryError{err: err, reason: stopRetryReasonNetwork}
 		}
 		// Постоянные ошибки (4xx/PEER_FLOOD и т.п.): ретраить бессмысленно, пометим адресата.
@@ -256,11 +290,89 @@ func (s *ClientSender) apiSendMessage(
 		}
 		return err
 	})
+	return sentID, err
+}
+
+// apiEditMessage заменяет текст ранее отправленного уведомления (Payload.EditOf).
+// MESSAGE_NOT_MODIFIED считается успехом: нужный текст уже на месте.
+func (s *ClientSender) apiEditMessage(
+	ctx context.Context,
+	job notifications.Job,
+	recipient notifications.Recipient,
+	peer tg.InputPeerClass,
+) error {
+	req := &tg.MessagesEditMessageRequest{
+		Peer:      peer,
+		ID:        job.Payload.EditOf,
+		NoWebpage: true,
+	}
+	req.SetMessage(job.Payload.Text)
+
+	logger.Debugf(
+		"ClientSender: edit message job=%d recipient=%d message_id=%d",
+		job.ID, recipient.ID, job.Payload.EditOf,
+	)
+
+	return s.limiter.Do(ctx, func() error {
+		_, err := s.api.MessagesEditMessage(ctx, req)
+		if err == nil || tgerr.Is(err, "MESSAGE_NOT_MODIFIED") {
+			return nil
+		}
+
+		logger.Debugf(
+			"ClientSender: edit message failed job=%d recipient=%d message_id=%d err=%v",
+			job.ID, recipient.ID, job.Payload.EditOf, err,
+		)
+
+		if s.conn.HandleError(err) {
+			return &stopRetryError{err: err, reason: stopRetryReasonNetwork}
+		}
+		if isPermanentRPCError(err) {
+			return &stopRetryError{err: err, reason: stopRetryReasonPermanent}
+		}
+		return err
+	})
+}
+
+// sentMessageID извлекает ID отправленного сообщения из ответа messages.sendMessage:
+// UpdateShortSentMessage несёт его напрямую, в Updates ищем UpdateMessageID по random_id
+// и, как запасной вариант, первое новое сообщение.
+func sentMessageID(updates tg.UpdatesClass, randomID int64) int {
+	var list []tg.UpdateClass
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		return u.ID
+	case *tg.Updates:
+		list = u.Updates
+	case *tg.UpdatesCombined:
+		list = u.Updates
+	default:
+		return 0
+	}
+
+	fallback := 0
+	for _, upd := range list {
+		switch v := upd.(type) {
+		case *tg.UpdateMessageID:
+			if v.RandomID == randomID {
+				return v.ID
+			}
+		case *tg.UpdateNewMessage:
+			if fallback == 0 {
+				fallback = v.Message.GetID()
+			}
+		case *tg.UpdateNewChannelMessage:
+			if fallback == 0 {
+				fallback = v.Message.GetID()
+			}
+		}
+	}
+	return fallback
 }
 
 // apiForwardMessages повторно пересылает оригинальные сообщения после успешной доставки текста.
 // Резолвит fromPeer, генерирует per-message random_id и делает глубокую копию ID,
-// чтобы избежать случайной мутации исходного слайса при ретраях.
+// чтобы избежать случайной мутации исходного слайса при ретраях. Silent — как у текста.
 func (s *ClientSender) apiForwardMessages(
 	ctx context.Context,
 	job notifications.Job,
@@ -293,6 +405,7 @@ func (s *ClientSender) apiForwardMessages(
 		ID:       append([]int(nil), fwd.MessageIDs...),
 		ToPeer:   toPeer,
 		RandomID: randomIDs,
+		Silent:   job.SilentDelivery(),
 	}
 
 	return s.limiter.Do(ctx, func() error {
@@ -307,7 +420,7 @@ func (s *ClientSender) apiForwardMessages(
 		)
 
 		// Сетевые/MTProto-сбои при форварде: просим подождать восстановление.
-		if connection.HandleError(errFwd) {
+		if s.conn.HandleError(errFwd) {
 			return &stopRetryError{err: errFwd, reason: stopRetryReasonNetwork}
 		}
 		// Постоянная RPC-ошибка — пропускаем адресата, повторять нет смысла.
@@ -0,0 +1,99 @@
+package telegramnotifier
+
+// Package telegramnotifier / файл history.go — постраничное чтение истории чата для
+// backfill (см. internal/domain/backfill). ClientSender реализует backfill.HistoryFetcher:
+// messages.getHistory под общим троттлером, сущности страницы собираются в tg.Entities,
+// чтобы фильтры и ссылки работали так же, как для живых апдейтов. GetMessages перечитывает
+// отдельные сообщения под тем же троттлером (части альбома при правке, updates.MessageReader).
+
+import (
+	"context"
+	"fmt"
+
+	"telegram-userbot/internal/domain/notifications"
+
+	"github.com/gotd/td/tg"
+)
+
+// GetMessages перечитывает сообщения ids чата peer; отсутствующие и служебные пропускаются.
+func (s *ClientSender) GetMessages(
+	ctx context.Context,
+	peer notifications.Recipient,
+	ids []int,
+) ([]*tg.Message, error) {
+	input, err := s.peers.InputPeerByKind(ctx, peer.Type, peer.ID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve peer %s:%d: %w", peer.Type, peer.ID, err)
+	}
+	return s.getMessages(ctx, input, ids)
+}
+
+// GetHistory возвращает до limit сообщений чата peer старше offsetID (0 — с самого нового),
+// новые первыми, сущности (пользователи, чаты, каналы) этой страницы и наименьший ID на
+// странице с учётом служебных сообщений (0 — страница пуста, история закончилась).
+// Служебные и пустые сообщения в результат не попадают, но сдвигают nextOffset.
+func (s *ClientSender) GetHistory(
+	ctx context.Context,
+	peer notifications.Recipient,
+	offsetID, limit int,
+) ([]*tg.Message, tg.Entities, int, error) {
+	input, err := s.peers.InputPeerByKind(ctx, peer.Type, peer.ID)
+	if err != nil {
+		return nil, tg.Entities{}, 0, fmt.Errorf("resolve history peer %s:%d: %w", peer.Type, peer.ID, err)
+	}
+
+	var res tg.MessagesMessagesClass
+	err = s.limiter.Do(ctx, func() error {
+		var errGet error
+		res, errGet = s.api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+			Peer:     input,
+			OffsetID: offsetID,
+			Limit:    limit,
+		})
+		if errGet != nil && isPermanentRPCError(errGet) {
+			return &stopRetryError{err: errGet, reason: stopRetryReasonPermanent}
+		}
+		return errGet
+	})
+	if err != nil {
+		return nil, tg.Entities{}, 0, fmt.Errorf("get history of %s:%d: %w", peer.Type, peer.ID, err)
+	}
+
+	modified, ok := res.AsModified()
+	if !ok {
+		return nil, tg.Entities{}, 0, fmt.Errorf("get history of %s:%d: unexpected messages.messagesNotModified",
+			peer.Type, peer.ID)
+	}
+	entities := tg.Entities{
+		Users:    make(map[int64]*tg.User),
+		Chats:    make(map[int64]*tg.Chat),
+		Channels: make(map[int64]*tg.Channel),
+	}
+	for _, u := range modified.GetUsers() {
+		if user, isUser := u.(*tg.User); isUser {
+			entities.Users[user.ID] = user
+		}
+	}
+	for _, c := range modified.GetChats() {
+		switch chat := c.(type) {
+		case *tg.Chat:
+			entities.Chats[chat.ID] = chat
+		case *tg.Channel:
+			entities.Channels[chat.ID] = chat
+		}
+	}
+
+	var (
+		messages   []*tg.Message
+		nextOffset int
+	)
+	for _, m := range modified.GetMessages() {
+		if id := m.GetID(); id > 0 && (nextOffset == 0 || id < nextOffset) {
+			nextOffset = id
+		}
+		if msg, isMsg := m.(*tg.Message); isMsg {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, entities, nextOffset, nil
+}
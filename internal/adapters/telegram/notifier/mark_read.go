@@ -0,0 +1,37 @@
+package telegramnotifier
+
+// Package telegramnotifier / файл mark_read.go — пометка исходных сообщений прочитанными
+// по кнопке уведомления (см. notifications.ActionHandler). ClientSender реализует
+// notifications.SourceReader: channels.readHistory для каналов, messages.readHistory иначе.
+
+import (
+	"context"
+	"fmt"
+
+	"telegram-userbot/internal/domain/notifications"
+
+	"github.com/gotd/td/tg"
+)
+
+// MarkRead помечает прочитанными сообщения чата peer до maxID включительно под общим троттлером.
+func (s *ClientSender) MarkRead(ctx context.Context, peer notifications.Recipient, maxID int) error {
+	input, err := s.peers.InputPeerByKind(ctx, peer.Type, peer.ID)
+	if err != nil {
+		return fmt.Errorf("resolve source peer %s:%d: %w", peer.Type, peer.ID, err)
+	}
+	return s.limiter.Do(ctx, func() error {
+		var errRead error
+		if ch, ok := input.(*tg.InputPeerChannel); ok {
+			_, errRead = s.api.ChannelsReadHistory(ctx, &tg.ChannelsReadHistoryRequest{
+				Channel: &tg.InputChannel{ChannelID: ch.ChannelID, AccessHash: ch.AccessHash},
+				MaxID:   maxID,
+			})
+		} else {
+			_, errRead = s.api.MessagesReadHistory(ctx, &tg.MessagesReadHistoryRequest{Peer: input, MaxID: maxID})
+		}
+		if errRead != nil && isPermanentRPCError(errRead) {
+			return &stopRetryError{err: errRead, reason: stopRetryReasonPermanent}
+		}
+		return errRead
+	})
+}
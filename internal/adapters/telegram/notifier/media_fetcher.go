@@ -0,0 +1,264 @@
+package telegramnotifier
+
+// Package telegramnotifier / файл media_fetcher.go — скачивание медиа исходных сообщений
+// для транспортов без доступа к исходному чату (Bot API) и для архива медиа. ClientSender
+// реализует notifications.MediaFetcher: перечитывает сообщения (свежий file_reference), выбирает
+// фото наибольшего размера или документ, проверяет лимиты загрузки Bot API и скачивает
+// файлы через upload.getFile во временный каталог под общим троттлером. DownloadMedia —
+// то же скачивание с произвольными лимитами в заданный каталог (mediaarchive.Downloader).
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/infra/logger"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+)
+
+// Лимиты Bot API на загрузку файлов multipart-запросом.
+const (
+	botPhotoMaxSize = 10 << 20
+	botFileMaxSize  = 50 << 20
+)
+
+// mediaTempPattern — шаблон имени временного каталога для файлов одного задания.
+const mediaTempPattern = "userbot-media-*"
+
+// FetchMedia скачивает медиа сообщений messageIDs чата from во временный каталог.
+// Сообщения без медиа и файлы сверх лимитов Bot API пропускаются. При ошибке каталог удаляется.
+func (s *ClientSender) FetchMedia(
+	ctx context.Context,
+	from notifications.Recipient,
+	messageIDs []int,
+) (notifications.MediaBundle, error) {
+	dir, err := os.MkdirTemp("", mediaTempPattern)
+	if err != nil {
+		return notifications.MediaBundle{}, fmt.Errorf("create media temp dir: %w", err)
+	}
+	bundle := notifications.MediaBundle{Dir: dir}
+
+	bundle.Files, err = s.DownloadMedia(ctx, from, messageIDs, dir, func(file notifications.MediaFile) bool {
+		limit := int64(botFileMaxSize)
+		if file.Kind == notifications.MediaKindPhoto {
+			limit = botPhotoMaxSize
+		}
+		return file.Size <= limit
+	})
+	if err != nil {
+		_ = bundle.Cleanup()
+		return notifications.MediaBundle{}, err
+	}
+	return bundle, nil
+}
+
+// DownloadMedia скачивает медиа сообщений messageIDs чата from в каталог dir (файлы
+// "<msgID>_<имя>"). accept решает по описанию файла (вид, размер, MIME), скачивать ли его;
+// отклонённые файлы и сообщения без медиа пропускаются. Сообщения перечитываются, поэтому
+// file_reference всегда свежий.
+func (s *ClientSender) DownloadMedia(
+	ctx context.Context,
+	from notifications.Recipient,
+	messageIDs []int,
+	dir string,
+	accept func(notifications.MediaFile) bool,
+) ([]notifications.MediaFile, error) {
+	peer, err := s.peers.InputPeerByKind(ctx, from.Type, from.ID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve media peer %s:%d: %w", from.Type, from.ID, err)
+	}
+	messages, err := s.getMessages(ctx, peer, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []notifications.MediaFile
+	for _, msg := range messages {
+		file, location, ok := describeMedia(msg)
+		if !ok {
+			continue
+		}
+		if accept != nil && !accept(file) {
+			logger.Warnf("ClientSender: media of message %d skipped: %s %s of %d bytes is not accepted",
+				msg.ID, file.Kind, file.MimeType, file.Size)
+			continue
+		}
+		file.Path = filepath.Join(dir, fmt.Sprintf("%d_%s", msg.ID, file.FileName))
+		if err = s.download(ctx, location, file.Path); err != nil {
+			return nil, fmt.Errorf("download media of message %d: %w", msg.ID, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// getMessages перечитывает сообщения чата (channels.getMessages для каналов) в порядке ID.
+func (s *ClientSender) getMessages(ctx context.Context, peer tg.InputPeerClass, ids []int) ([]*tg.Message, error) {
+	input := make([]tg.InputMessageClass, 0, len(ids))
+	for _, id := range ids {
+		input = append(input, &tg.InputMessageID{ID: id})
+	}
+
+	var res tg.MessagesMessagesClass
+	err := s.limiter.Do(ctx, func() error {
+		var errGet error
+		if ch, ok := peer.(*tg.InputPeerChannel); ok {
+			res, errGet = s.api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+				Channel: &tg.InputChannel{ChannelID: ch.ChannelID, AccessHash: ch.AccessHash},
+				ID:      input,
+			})
+		} else {
+			res, errGet = s.api.MessagesGetMessages(ctx, input)
+		}
+		if errGet != nil && isPermanentRPCError(errGet) {
+			return &stopRetryError{err: errGet, reason: stopRetryReasonPermanent}
+		}
+		return errGet
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get source messages: %w", err)
+	}
+
+	modified, ok := res.AsModified()
+	if !ok {
+		return nil, errors.New("get source messages: unexpected messages.messagesNotModified")
+	}
+	var out []*tg.Message
+	for _, m := range modified.GetMessages() {
+		if msg, isMsg := m.(*tg.Message); isMsg {
+			out = append(out, msg)
+		}
+	}
+	slices.SortFunc(out, func(a, b *tg.Message) int { return a.ID - b.ID })
+	return out, nil
+}
+
+// download скачивает файл по location в path под троттлером.
+func (s *ClientSender) download(ctx context.Context, location tg.InputFileLocationClass, path string) error {
+	return s.limiter.Do(ctx, func() error {
+		_, err := downloader.NewDownloader().Download(s.api, location).ToPath(ctx, path)
+		if err != nil && isPermanentRPCError(err) {
+			return &stopRetryError{err: err, reason: stopRetryReasonPermanent}
+		}
+		return err
+	})
+}
+
+// describeMedia определяет вид, имя, MIME и размер медиа сообщения и его file location.
+// ok=false — медиа нет или оно не скачиваемое (гео, опросы, веб-превью и т. п.).
+func describeMedia(msg *tg.Message) (notifications.MediaFile, tg.InputFileLocationClass, bool) {
+	switch media := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		photo, ok := media.Photo.(*tg.Photo)
+		if !ok {
+			return notifications.MediaFile{}, nil, false
+		}
+		sizeType, size := largestPhotoSize(photo.Sizes)
+		if sizeType == "" {
+			return notifications.MediaFile{}, nil, false
+		}
+		file := notifications.MediaFile{
+			Kind:     notifications.MediaKindPhoto,
+			FileName: fmt.Sprintf("photo_%d.jpg", msg.ID),
+			MimeType: "image/jpeg",
+			Size:     int64(size),
+		}
+		return file, &tg.InputPhotoFileLocation{
+			ID:            photo.ID,
+			AccessHash:    photo.AccessHash,
+			FileReference: photo.FileReference,
+			ThumbSize:     sizeType,
+		}, true
+	case *tg.MessageMediaDocument:
+		doc, ok := media.Document.(*tg.Document)
+		if !ok {
+			return notifications.MediaFile{}, nil, false
+		}
+		file := notifications.MediaFile{
+			Kind:     documentKind(doc),
+			FileName: documentFileName(doc, msg.ID),
+			MimeType: doc.MimeType,
+			Size:     doc.Size,
+		}
+		return file, &tg.InputDocumentFileLocation{
+			ID:            doc.ID,
+			AccessHash:    doc.AccessHash,
+			FileReference: doc.FileReference,
+		}, true
+	default:
+		return notifications.MediaFile{}, nil, false
+	}
+}
+
+// largestPhotoSize выбирает размер фото с наибольшей площадью; возвращает его тип и объём в байтах.
+func largestPhotoSize(sizes []tg.PhotoSizeClass) (string, int) {
+	var (
+		bestType string
+		bestArea int
+		bestSize int
+	)
+	for _, sz := range sizes {
+		var (
+			typ        string
+			area, size int
+		)
+		switch v := sz.(type) {
+		case *tg.PhotoSize:
+			typ, area, size = v.Type, v.W*v.H, v.Size
+		case *tg.PhotoSizeProgressive:
+			if len(v.Sizes) == 0 {
+				continue
+			}
+			typ, area, size = v.Type, v.W*v.H, slices.Max(v.Sizes)
+		default:
+			continue
+		}
+		if area > bestArea {
+			bestType, bestArea, bestSize = typ, area, size
+		}
+	}
+	return bestType, bestSize
+}
+
+// documentKind определяет вид документа по атрибутам: голосовое, аудио, GIF, видео или файл.
+func documentKind(doc *tg.Document) string {
+	kind := notifications.MediaKindDocument
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeAudio:
+			if a.Voice {
+				return notifications.MediaKindVoice
+			}
+			kind = notifications.MediaKindAudio
+		case *tg.DocumentAttributeAnimated:
+			return notifications.MediaKindAnimation
+		case *tg.DocumentAttributeVideo:
+			kind = notifications.MediaKindVideo
+		case *tg.DocumentAttributeSticker:
+			return notifications.MediaKindDocument
+		}
+	}
+	return kind
+}
+
+// documentFileName берёт имя из атрибута документа или строит его из ID сообщения и MIME.
+func documentFileName(doc *tg.Document, msgID int) string {
+	for _, attr := range doc.Attributes {
+		if a, ok := attr.(*tg.DocumentAttributeFilename); ok && strings.TrimSpace(a.FileName) != "" {
+			return filepath.Base(a.FileName)
+		}
+	}
+	ext := ""
+	if exts, err := mime.ExtensionsByType(doc.MimeType); err == nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+	return fmt.Sprintf("file_%d%s", msgID, ext)
+}
@@ -0,0 +1,343 @@
+// Package webhooknotifier предоставляет реализацию PreparedSender для внешних HTTP-сервисов.
+//
+// В этом файле (webhook_sender.go):
+//   - адрес и ключ подписи берутся из описания получателя type=webhook в recipients.json;
+//   - задание превращается в JSON-конверт (Envelope) и отправляется POST-запросом;
+//   - тело подписывается HMAC-SHA256 (заголовки X-Userbot-Timestamp и X-Userbot-Signature);
+//   - запросы идут через общий троттлер с экстрактором Retry-After;
+//   - ответы классифицируются: 2xx — успех, 408/429/5xx и сетевые сбои — повтор,
+//     прочие 4xx — постоянная ошибка получателя (SendOutcome.PermanentFailures).
+//
+// Правки уже доставленных уведомлений невозможны: у сервиса нет ID сообщения, поэтому
+// SentMessageID всегда 0, и очередь не планирует для webhook правок и пометок.
+
+package webhooknotifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/infra/throttle"
+)
+
+// httpClientTimeout — таймаут HTTP-клиента, секунды.
+const httpClientTimeout = 15
+
+// throttleMaxRetries ограничивает повторы внутри троттлера: дальше задание откладывает
+// политика повторов очереди, не блокируя остальные.
+const throttleMaxRetries = 2
+
+// responseBodyLimit ограничивает чтение тела ответа: сервису достаточно кода статуса,
+// а текст нужен только для сообщения об ошибке.
+const responseBodyLimit = 4096
+
+// Заголовки запроса webhook.
+const (
+	HeaderJobID     = "X-Userbot-Job-Id"
+	HeaderTimestamp = "X-Userbot-Timestamp"
+	HeaderSignature = "X-Userbot-Signature"
+)
+
+// Envelope — JSON-конверт уведомления, который получает сервис.
+//
+// Поля:
+//   - JobID — ID задания (одинаков при повторах, годится как ключ идемпотентности);
+//   - Account — аккаунт-источник; ID заданий уникальны в пределах аккаунта, поэтому
+//     при нескольких аккаунтах ключ идемпотентности — пара (account, job_id);
+//   - Recipient — ID получателя из recipients.json;
+//   - Notification — отрендеренный текст уведомления;
+//   - Text/Entities — исходный текст сообщения и его entities (смещения в UTF-16);
+//   - Terms — сработавшие ключевые слова и паттерны фильтров.
+type Envelope struct {
+	JobID        int64                      `json:"job_id"`
+	Account      string                     `json:"account,omitempty"`
+	CreatedAt    time.Time                  `json:"created_at"`
+	Recipient    string                     `json:"recipient"`
+	Priority     string                     `json:"priority"`
+	FilterIDs    []string                   `json:"filter_ids,omitempty"`
+	Source       *EnvelopeSource            `json:"source,omitempty"`
+	Notification string                     `json:"notification"`
+	Text         string                     `json:"text,omitempty"`
+	Entities     []notifications.CopyEntity `json:"entities,omitempty"`
+	Terms        []string                   `json:"terms,omitempty"`
+	Link         string                     `json:"link,omitempty"`
+	EscalationOf int64                      `json:"escalation_of,omitempty"`
+}
+
+// EnvelopeSource — исходный чат и сообщения (для альбома — все части).
+type EnvelopeSource struct {
+	Peer       notifications.Recipient `json:"peer"`
+	MessageIDs []int                   `json:"message_ids"`
+}
+
+// WebhookSender реализует notifications.PreparedSender поверх HTTP POST.
+//
+// Поля:
+//   - recipients — справочник получателей (url и secret по синтетическому peer_id);
+//   - secret     — ключ подписи по умолчанию для получателей без secret;
+//   - client     — HTTP-клиент с таймаутом;
+//   - limiter    — общий троттлер с экстрактором Retry-After;
+//   - now        — источник времени для метки подписи.
+type WebhookSender struct {
+	recipients *filters.FilterEngine
+	secret     string
+	client     *http.Client
+	limiter    *throttle.Throttler
+	now        func() time.Time
+}
+
+// NewWebhookSender создаёт PreparedSender для получателей type=webhook.
+// secret — ключ подписи по умолчанию (пустой — без подписи, если у получателя нет своего).
+func NewWebhookSender(recipients *filters.FilterEngine, secret string, rps int) *WebhookSender {
+	limiter := throttle.New(
+		rps,
+		throttle.WithMaxRetries(throttleMaxRetries),
+		throttle.WithWaitExtractors(RetryAfterExtractor()),
+	)
+	return &WebhookSender{
+		recipients: recipients,
+		secret:     secret,
+		client: &http.Client{
+			Timeout: httpClientTimeout * time.Second,
+		},
+		limiter: limiter,
+		now:     time.Now,
+	}
+}
+
+// WithRecipients возвращает отправителя со справочником получателей recipients,
+// разделяющего с s HTTP-клиент и троттлер (у каждого аккаунта свой справочник).
+func (s *WebhookSender) WithRecipients(recipients *filters.FilterEngine) *WebhookSender {
+	view := *s
+	view.recipients = recipients
+	return &view
+}
+
+// Start подключает троттлер к жизненному циклу очереди.
+func (s *WebhookSender) Start(ctx context.Context) {
+	if s.limiter != nil {
+		s.limiter.Start(ctx)
+	}
+}
+
+// Stop завершает фоновые горутины троттлера.
+func (s *WebhookSender) Stop() {
+	if s.limiter != nil {
+		s.limiter.Stop()
+	}
+}
+
+// Deliver отправляет конверт задания на url получателя.
+// Постоянные ошибки (неизвестный получатель, 4xx) возвращаются в PermanentFailures,
+// временные — как Retry=true с ошибкой для политики повторов очереди.
+func (s *WebhookSender) Deliver(ctx context.Context, job notifications.Job) (notifications.SendOutcome, error) {
+	var outcome notifications.SendOutcome
+
+	rcpt, ok := s.recipients.RecipientByPeer(notifications.RecipientTypeWebhook, job.Recipient.ID)
+	if !ok {
+		outcome.PermanentFailures = []notifications.Recipient{job.Recipient}
+		outcome.PermanentError = fmt.Errorf("webhook recipient %d is not configured", job.Recipient.ID)
+		return outcome, nil
+	}
+	secret := rcpt.Secret
+	if secret == "" {
+		secret = s.secret
+	}
+
+	body, err := json.Marshal(buildEnvelope(job, string(rcpt.ID)))
+	if err != nil {
+		outcome.PermanentFailures = []notifications.Recipient{job.Recipient}
+		outcome.PermanentError = fmt.Errorf("webhook encode envelope: %w", err)
+		return outcome, nil
+	}
+
+	permanent, err := s.post(ctx, rcpt.URL, secret, job.ID, body)
+	if err != nil {
+		if permanent {
+			outcome.PermanentFailures = []notifications.Recipient{job.Recipient}
+			outcome.PermanentError = err
+			return outcome, nil
+		}
+		outcome.Retry = true
+		return outcome, err
+	}
+	return outcome, nil
+}
+
+// buildEnvelope собирает конверт из задания. Исходный текст берётся из Payload.Copy.
+func buildEnvelope(job notifications.Job, recipientID string) Envelope {
+	env := Envelope{
+		JobID:        job.ID,
+		CreatedAt:    job.CreatedAt,
+		Recipient:    recipientID,
+		Priority:     string(job.EffectivePriority()),
+		Notification: job.Payload.Text,
+		EscalationOf: job.EscalationOf,
+	}
+	if job.Payload.Copy != nil {
+		env.Text = job.Payload.Copy.Text
+		env.Entities = job.Payload.Copy.Entities
+	}
+	if src := job.Source; src != nil {
+		env.Account = src.Account
+		env.FilterIDs = src.Filters()
+		env.Source = &EnvelopeSource{Peer: src.Peer, MessageIDs: src.MessageIDs}
+		env.Terms = src.Terms
+		env.Link = src.Link
+	}
+	return env
+}
+
+// Sign вычисляет подпись тела: hex(HMAC-SHA256(secret, timestamp + "." + body)).
+// Метка времени входит в подпись, чтобы сервис мог отвергать повторно присланные запросы.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post выполняет запрос под троттлером. Возвращает (permanent, err) по правилам Deliver.
+func (s *WebhookSender) post(ctx context.Context, endpoint, secret string, jobID int64, body []byte) (bool, error) {
+	if s.limiter == nil {
+		return s.performPost(ctx, endpoint, secret, jobID, body)
+	}
+
+	var (
+		permanent  bool
+		requestErr error
+	)
+	err := s.limiter.Do(ctx, func() error {
+		var errDo error
+		permanent, errDo = s.performPost(ctx, endpoint, secret, jobID, body)
+		requestErr = errDo
+		if errDo != nil && permanent {
+			return &stopRetryError{err: errDo}
+		}
+		return errDo
+	})
+	if err != nil {
+		if permanent {
+			return true, requestErr
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// performPost выполняет один POST без троттлера и классифицирует ответ.
+func (s *WebhookSender) performPost(
+	ctx context.Context, endpoint, secret string, jobID int64, body []byte,
+) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return true, fmt.Errorf("webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderJobID, strconv.FormatInt(jobID, 10))
+	if secret != "" {
+		timestamp := strconv.FormatInt(s.now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("webhook post: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, responseBodyLimit))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return handleHTTPError(resp, respBody)
+}
+
+// handleHTTPError нормализует не-2xx ответы в (permanent, error).
+// 408/429 и 5xx — временные (с Retry-After, если сервис его прислал); прочие 4xx — постоянные.
+func handleHTTPError(resp *http.Response, body []byte) (bool, error) {
+	status := resp.StatusCode
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+
+	switch {
+	case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500:
+		baseErr := fmt.Errorf("webhook temporary error (%d): %s", status, msg)
+		if wait := parseRetryAfterHeader(resp.Header.Get("Retry-After")); wait > 0 {
+			return false, &retryAfterError{err: baseErr, wait: wait}
+		}
+		return false, baseErr
+	case status >= 400:
+		return true, fmt.Errorf("webhook client error (%d): %s", status, msg)
+	default:
+		return true, fmt.Errorf("webhook unexpected status (%d): %s", status, msg)
+	}
+}
+
+// parseRetryAfterHeader парсит Retry-After: число секунд или HTTP-дата. 0 — значения нет.
+func parseRetryAfterHeader(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if ts, err := http.ParseTime(value); err == nil {
+		if delta := time.Until(ts); delta > 0 {
+			return delta
+		}
+	}
+	return 0
+}
+
+// retryAfterError — ошибка-носитель Retry-After для экстрактора ожиданий.
+type retryAfterError struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+func (e *retryAfterError) RetryAfter() time.Duration {
+	return e.wait
+}
+
+// stopRetryError — маркер для прекращения ретраев троттлера при постоянной ошибке.
+type stopRetryError struct {
+	err error
+}
+
+func (e *stopRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stopRetryError) Unwrap() error {
+	return e.err
+}
+
+func (e *stopRetryError) StopRetry() bool {
+	return true
+}
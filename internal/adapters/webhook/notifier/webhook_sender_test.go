@@ -0,0 +1,228 @@
+package webhooknotifier
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+)
+
+// testSecret — ключ подписи тестового получателя.
+const testSecret = "test-secret"
+
+// testFilters — минимальный набор фильтров: движок не загружается без валидных фильтров.
+const testFilters = `{"filters": [{
+	"id": "f1",
+	"chats": [1],
+	"rules": {"allow": {"type": "kw", "value": "match"}},
+	"notify": {"recipients": ["svc"]}
+}]}`
+
+// newTestSender создаёт отправителя с единственным получателем type=webhook на url
+// и возвращает задание для него. Троттлер запущен на время теста.
+func newTestSender(t *testing.T, url string) (*WebhookSender, notifications.Job) {
+	t.Helper()
+	dir := t.TempDir()
+	recipientsPath := filepath.Join(dir, "recipients.json")
+	filtersPath := filepath.Join(dir, "filters.json")
+	recipients, err := json.Marshal([]map[string]string{
+		{"id": "svc", "type": "webhook", "url": url, "secret": testSecret},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(recipientsPath, recipients, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filtersPath, []byte(testFilters), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine := filters.NewFilterEngine(filtersPath, recipientsPath)
+	if err = engine.Init(); err != nil {
+		t.Fatal(err)
+	}
+	rcpt, ok := engine.RecipientByID("svc")
+	if !ok {
+		t.Fatal("webhook recipient is not loaded")
+	}
+
+	sender := NewWebhookSender(engine, "", 100)
+	sender.Start(t.Context())
+	t.Cleanup(sender.Stop)
+
+	job := notifications.Job{
+		ID:        42,
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Recipient: notifications.Recipient{Type: notifications.RecipientTypeWebhook, ID: int64(rcpt.PeerID)},
+		Payload:   notifications.Payload{Text: "match"},
+	}
+	return sender, job
+}
+
+func TestDeliverSignsBody(t *testing.T) {
+	var (
+		gotBody      []byte
+		gotTimestamp string
+		gotSignature string
+		gotJobID     string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotTimestamp = r.Header.Get(HeaderTimestamp)
+		gotSignature = r.Header.Get(HeaderSignature)
+		gotJobID = r.Header.Get(HeaderJobID)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sender, job := newTestSender(t, srv.URL)
+	outcome, err := sender.Deliver(t.Context(), job)
+	if err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if outcome.Retry || len(outcome.PermanentFailures) > 0 {
+		t.Fatalf("2xx must count as delivered, got %+v", outcome)
+	}
+
+	if gotJobID != strconv.FormatInt(job.ID, 10) {
+		t.Errorf("job id header = %q, want %d", gotJobID, job.ID)
+	}
+	if gotTimestamp == "" {
+		t.Fatal("timestamp header is missing")
+	}
+	// Сервис пересчитывает HMAC-SHA256 над "timestamp.body" своим ключом.
+	if want := Sign(testSecret, gotTimestamp, gotBody); gotSignature != want {
+		t.Errorf("signature = %q, want %q", gotSignature, want)
+	}
+	var env Envelope
+	if err = json.Unmarshal(gotBody, &env); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	if env.JobID != job.ID || env.Recipient != "svc" || env.Notification != "match" {
+		t.Errorf("unexpected envelope: %+v", env)
+	}
+}
+
+func TestDeliverPermanentClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				calls.Add(1)
+				http.Error(w, "rejected", status)
+			}))
+			defer srv.Close()
+
+			sender, job := newTestSender(t, srv.URL)
+			outcome, err := sender.Deliver(t.Context(), job)
+			if err != nil {
+				t.Fatalf("permanent failure must not return an error, got %v", err)
+			}
+			if len(outcome.PermanentFailures) != 1 || outcome.PermanentFailures[0] != job.Recipient {
+				t.Fatalf("PermanentFailures = %v, want [%v]", outcome.PermanentFailures, job.Recipient)
+			}
+			if outcome.Retry {
+				t.Error("permanent failure must not be retried")
+			}
+			if n := calls.Load(); n != 1 {
+				t.Errorf("server called %d times, want 1", n)
+			}
+		})
+	}
+}
+
+func TestDeliverRetriesTemporaryErrors(t *testing.T) {
+	statuses := []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusServiceUnavailable,
+	}
+	for _, status := range statuses {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if calls.Add(1) == 1 {
+					http.Error(w, "try later", status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			sender, job := newTestSender(t, srv.URL)
+			outcome, err := sender.Deliver(t.Context(), job)
+			if err != nil {
+				t.Fatalf("Deliver: %v", err)
+			}
+			if outcome.Retry || len(outcome.PermanentFailures) > 0 {
+				t.Fatalf("retried delivery must succeed, got %+v", outcome)
+			}
+			if n := calls.Load(); n != 2 {
+				t.Errorf("server called %d times, want 2", n)
+			}
+		})
+	}
+}
+
+func TestDeliverHonorsRetryAfter(t *testing.T) {
+	const retryAfter = 2 * time.Second
+	var (
+		calls  atomic.Int32
+		first  time.Time
+		second time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		second = time.Now()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sender, job := newTestSender(t, srv.URL)
+	if _, err := sender.Deliver(t.Context(), job); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("server called %d times, want 2", n)
+	}
+	// Без Retry-After первый повтор случился бы примерно через секунду (backoff троттлера).
+	if gap := second.Sub(first); gap < retryAfter {
+		t.Errorf("retry after %s, want at least %s", gap, retryAfter)
+	}
+}
+
+func TestRetryAfterExtractor(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "7")
+	permanent, err := handleHTTPError(resp, nil)
+	if permanent {
+		t.Fatal("503 must be temporary")
+	}
+	wait, ok := RetryAfterExtractor()(err)
+	if !ok || wait != 7*time.Second {
+		t.Errorf("extracted (%s, %t), want (7s, true)", wait, ok)
+	}
+
+	resp.Header.Del("Retry-After")
+	_, err = handleHTTPError(resp, nil)
+	if _, ok = RetryAfterExtractor()(err); ok {
+		t.Error("error without Retry-After must not carry a wait")
+	}
+}
@@ -0,0 +1,35 @@
+package webhooknotifier
+
+// Package webhooknotifier — экстрактор ожиданий для общего троттлера: извлекает
+// Retry-After из ошибок webhook и возвращает паузу, указанную сервисом, без джиттера.
+
+import (
+	"errors"
+	"time"
+
+	"telegram-userbot/internal/infra/throttle"
+)
+
+// retryAfterProvider — контракт ошибок, несущих Retry-After.
+type retryAfterProvider interface {
+	RetryAfter() time.Duration
+}
+
+// RetryAfterExtractor создаёт throttle.WaitExtractor, извлекающий Retry-After из ошибки.
+// Возвращает (delay, true) при положительном значении; иначе (0, false), и троттлер
+// применит общую стратегию backoff.
+func RetryAfterExtractor() throttle.WaitExtractor {
+	return func(err error) (time.Duration, bool) {
+		if err == nil {
+			return 0, false
+		}
+		var provider retryAfterProvider
+		if !errors.As(err, &provider) {
+			return 0, false
+		}
+		if wait := provider.RetryAfter(); wait > 0 {
+			return wait, true
+		}
+		return 0, false
+	}
+}
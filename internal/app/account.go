@@ -0,0 +1,325 @@
+// Package app / файл account.go — сборка одного аккаунта Telegram.
+//
+// Каждый аккаунт процесса держит собственные MTProto-клиент, сессию, state.json, базу пиров,
+// FilterEngine, менеджер апдейтов, менеджеры соединения и статуса, очередь уведомлений, архивы
+// и задания backfill. Общие для аккаунтов транспорты уведомлений (бот, webhook, email) и опрос
+// апдейтов бота собираются в app.go.
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"telegram-userbot/internal/adapters/cli"
+	"telegram-userbot/internal/adapters/commands"
+	"telegram-userbot/internal/adapters/telegram/core"
+	telegramnotifier "telegram-userbot/internal/adapters/telegram/notifier"
+	"telegram-userbot/internal/domain/actions"
+	"telegram-userbot/internal/domain/archive"
+	"telegram-userbot/internal/domain/backfill"
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/mediaarchive"
+	"telegram-userbot/internal/domain/notifications"
+	domainupdates "telegram-userbot/internal/domain/updates"
+	"telegram-userbot/internal/infra/concurrency"
+	"telegram-userbot/internal/infra/config"
+	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
+	"telegram-userbot/internal/infra/telegram/connection"
+	"telegram-userbot/internal/infra/telegram/peersmgr"
+	"telegram-userbot/internal/infra/telegram/session"
+	"telegram-userbot/internal/infra/telegram/status"
+
+	contribstorage "github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/dcs"
+	tgupdates "github.com/gotd/td/telegram/updates"
+	updhook "github.com/gotd/td/telegram/updates/hook"
+	"github.com/gotd/td/tg"
+)
+
+// account агрегирует зависимости одного аккаунта. Его узлы lifecycle живут в поддереве
+// с именем аккаунта (см. runner.go).
+type account struct {
+	cfg          config.Account                 // Имя, номер и файлы состояния аккаунта.
+	cl           *core.ClientCore               // Авторизованный клиент gotd и его API-обёртка (Self, вызовы tg).
+	dispatch     *tg.UpdateDispatcher           // Маршрутизатор апдейтов gotd: OnNewMessage/OnEdit/etc.
+	updMgr       *tgupdates.Manager             // Менеджер апдейтов gotd: поток событий и локальное состояние.
+	peers        *peersmgr.Service              // Менеджер пиров + persist storage.
+	filters      *filters.FilterEngine          // Движок фильтров аккаунта; получатели общие (RECIPIENTS_FILE).
+	conn         *connection.Manager            // Состояние соединения клиента аккаунта.
+	presence     *status.StatusManager          // Статусы online/offline/typing аккаунта.
+	clientSender *telegramnotifier.ClientSender // userbot-транспорт; через его троттлер идут чтения истории.
+	router       *notifications.RouterSender    // Транспорты уведомлений аккаунта (общие — через RegisterShared).
+	notif        *notifications.Queue           // Очередь уведомлений аккаунта.
+	actions      *notifications.ActionHandler   // Кнопки действий под уведомлениями (nil — выключены).
+	archive      *archive.Archive               // Архив совпавших сообщений (поиск и выгрузка).
+	backfill     *backfill.Service              // Прогон истории отслеживаемых чатов через фильтры.
+	cache        *storage.TTLDB                 // bbolt-база кэшей идемпотентности (dedup, notified).
+	dupCache     *concurrency.Deduplicator      // Фильтр повторов за заданное окно.
+	debouncer    *concurrency.Debouncer         // Сглаживание бурстов (частые правки одного сообщения и т.п.).
+	handlers     *domainupdates.Handlers        // Доменные обработчики апдейтов и фоновые задачи.
+}
+
+// newAccount создаёт MTProto-клиент аккаунта cfg, его менеджеры соединения и статуса, пиров,
+// менеджер апдейтов и фильтры. Очередь и обработчики собираются в initServices, когда готовы
+// общие транспорты уведомлений.
+func newAccount(ctx context.Context, cfg config.Account) (*account, error) {
+	acc := &account{cfg: cfg}
+	acc.dispatch = func(d tg.UpdateDispatcher) *tg.UpdateDispatcher { return &d }(tg.NewUpdateDispatcher())
+	var updateFunc func(context.Context, tg.UpdatesClass) error
+	updateHandlerProxy := telegram.UpdateHandlerFunc(func(handlerCtx context.Context, updates tg.UpdatesClass) error {
+		if updateFunc != nil {
+			return updateFunc(handlerCtx, updates)
+		}
+		if acc.updMgr != nil {
+			return acc.updMgr.Handle(handlerCtx, updates)
+		}
+		return nil
+	})
+
+	// Опции MTProto‑клиента: сессии, хуки апдейтов, поведение при dead‑соединении и паспорт устройства.
+	// Менеджер соединения создаётся после клиента, поэтому хранилище сессии получает его ниже.
+	sessionStorage := &session.NotifyStorage{Path: cfg.SessionFile}
+	options := telegram.Options{
+		SessionStorage: sessionStorage,
+		UpdateHandler:  updateHandlerProxy,
+		Middlewares: []telegram.Middleware{
+			updhook.UpdateHook(func(mwCtx context.Context, updates tg.UpdatesClass) error {
+				return updateHandlerProxy.Handle(mwCtx, updates)
+			}),
+		},
+		// При сообщении от gotd о «мертвом» соединении отмечаем отключение для зависимых узлов.
+		OnDead: func() {
+			acc.conn.MarkDisconnected()
+		},
+		Device: telegram.DeviceConfig{
+			DeviceModel:   "MacBookPro18,1",
+			SystemVersion: "macOS v15.6.1 build 24G90",
+			AppVersion:    "v5.5.0",
+		},
+	}
+
+	// Для тестовых окружений используем DC тестового стенда Telegram.
+	if config.Env().TestDC {
+		options.DCList = dcs.Test()
+	}
+
+	cl, err := core.New(acc.dispatch, options, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("init client: %w", err)
+	}
+	acc.cl = cl
+	acc.conn = connection.New(cl.Client)
+	sessionStorage.Conn = acc.conn
+	acc.presence = status.New(cl.API, acc.conn)
+
+	peersSvc, err := peersmgr.New(cl.API, cfg.PeersCacheFile)
+	if err != nil {
+		return nil, fmt.Errorf("init peers manager: %w", err)
+	}
+	if err = peersSvc.LoadFromStorage(ctx); err != nil {
+		return nil, fmt.Errorf("load peers storage: %w", err)
+	}
+	acc.peers = peersSvc
+
+	updConfig := tgupdates.Config{
+		Handler:      acc.dispatch,
+		Storage:      core.NewFileStorage(cfg.StateFile),
+		AccessHasher: peersSvc.Mgr,
+		// Канал отстал дальше окна разницы: пропущенное догружается из истории (см. backfill/gap.go).
+		OnChannelTooLong: func(channelID int64) {
+			if acc.backfill != nil {
+				acc.backfill.RecoverChannel(channelID)
+			}
+		},
+	}
+	acc.updMgr = tgupdates.New(updConfig)
+	updateFunc = contribstorage.UpdateHook(peersSvc.Mgr.UpdateHook(acc.updMgr), peersSvc.Store()).Handle
+
+	// Инициализация filters (внутри загружает recipients)
+	acc.filters = filters.NewFilterEngine(cfg.FiltersFile, config.Env().RecipientsFile)
+	if filtersErr := acc.filters.Init(); filtersErr != nil {
+		return nil, fmt.Errorf("load filters: %w", filtersErr)
+	}
+	logger.Infof("Account %s: filters loaded: %d total, %d unique chats",
+		cfg.Name, len(acc.filters.GetFilters()), len(acc.filters.GetUniqueChats()))
+
+	return acc, nil
+}
+
+// initServices собирает подсистемы аккаунта поверх клиента: маршрутизатор транспортов (client свой,
+// bot, webhook и email — общие shared), очередь уведомлений, архивы, backfill, кэши и доменные
+// обработчики. stop инициирует общий shutdown процесса.
+func (acc *account) initServices(
+	stop context.CancelFunc,
+	shared *sharedTransports,
+	loc *time.Location,
+	escalation notifications.EscalationPolicy,
+) error {
+	cfg := acc.cfg
+
+	// Подсистема уведомлений: файловые сторы для очереди и неудачных отправок.
+	queueStore, err := notifications.NewQueueStore(cfg.NotifyQueueFile, time.Second)
+	if err != nil {
+		return fmt.Errorf("init queue store: %w", err)
+	}
+	failedStore, err := notifications.NewFailedStore(cfg.NotifyFailedFile)
+	if err != nil {
+		return fmt.Errorf("init failed store: %w", err)
+	}
+
+	// Транспорты уведомлений: client (userbot аккаунта) доступен всегда, bot (Bot API) — при заданном
+	// BOT_TOKEN, webhook — для получателей type=webhook, email — при заданном SMTP_HOST.
+	// Маршрутизатор выбирает транспорт по полю transport получателя, иначе NOTIFIER.
+	router := notifications.NewRouterSender([]string{config.Env().Notifier}, acc.filters)
+	acc.clientSender = telegramnotifier.NewClientSender(
+		acc.cl.API, config.Env().ThrottleRPS, acc.peers, acc.conn, acc.presence)
+	router.Register(notifications.TransportClient, acc.clientSender)
+	// Медиа исходных сообщений общий бот получает через MTProto-клиент аккаунта (см. bot_media.go),
+	// а общие webhook и email читают получателей из его фильтров.
+	shared.register(router, acc.filters, acc.clientSender)
+	acc.router = router
+
+	// Сборка очереди уведомлений: транспорт, сторы, расписание, таймзона, часы.
+	queue, err := notifications.NewQueue(notifications.QueueOptions{
+		Sender:      router,
+		Store:       queueStore,
+		Failed:      failedStore,
+		Schedule:    config.Env().NotifySchedule,
+		Location:    loc,
+		Clock:       time.Now,
+		Peers:       acc.peers,
+		MarkDeleted: config.Env().NotifyMarkDeleted,
+		EditPolicy:  config.Env().NotifyEditPolicy,
+		Retry: notifications.RetryPolicy{
+			MaxAttempts: config.Env().RetryMaxAttempts,
+			BaseDelay:   time.Duration(config.Env().RetryBaseSec) * time.Second,
+			MaxDelay:    time.Duration(config.Env().RetryMaxSec) * time.Second,
+		},
+		DefaultTTL:    time.Duration(config.Env().JobTTLHours) * time.Hour,
+		ExpiredPolicy: config.Env().ExpiredPolicy,
+		Recipients:    acc.filters,
+		QuietPolicy:   config.Env().QuietPolicy,
+		Escalation:    escalation,
+		Account:       cfg.Name,
+		Conn:          acc.conn,
+	})
+	if err != nil {
+		return fmt.Errorf("init notifications queue: %w", err)
+	}
+	acc.notif = queue
+
+	// Кнопки действий под уведомлениями бота меняют очередь аккаунта, а источник помечают
+	// прочитанным через его userbot-транспорт.
+	if config.Env().BotToken != "" && config.Env().BotActions {
+		acc.actions = notifications.NewActionHandler(queue, acc.filters, acc.clientSender)
+	}
+
+	// Архив совпавших сообщений с полнотекстовым индексом живёт в отдельной bbolt-базе:
+	// он растёт с каждым совпадением и чистится по своему сроку хранения.
+	messages, err := archive.Open(cfg.ArchiveDBFile,
+		time.Duration(config.Env().ArchiveDays)*24*time.Hour, acc.peers)
+	if err != nil {
+		return fmt.Errorf("open archive db: %w", err)
+	}
+	acc.archive = messages
+
+	// Backfill читает историю через троттлер userbot-транспорта; обработчик сообщений
+	// (доменные Handlers) подключается после их создания, см. SetProcessor ниже. Он же
+	// восстанавливает пропуски в отслеживаемых чатах после простоя.
+	history, err := backfill.New(acc.clientSender, acc.filters, acc.peers, cfg.BackfillDir,
+		config.Env().GapRecoveryMax)
+	if err != nil {
+		return fmt.Errorf("init backfill: %w", err)
+	}
+	acc.backfill = history
+
+	// Защита от дублей и бурстов правок. Кэши идемпотентности живут в отдельной bbolt-базе,
+	// чтобы рестарт внутри окна дедупликации не приводил к повторной обработке.
+	cache, err := storage.OpenTTLDB(cfg.CacheDBFile)
+	if err != nil {
+		return fmt.Errorf("open cache db: %w", err)
+	}
+	acc.cache = cache
+	dupCache, err := concurrency.NewDeduplicator(config.Env().DedupWindowSec, cache)
+	if err != nil {
+		return fmt.Errorf("init deduplicator: %w", err)
+	}
+	acc.dupCache = dupCache
+	acc.debouncer = concurrency.NewDebouncer(config.Env().DebounceEditMS, config.Env().DebounceMaxWaitMS)
+
+	// Доменные обработчики. Команды из «Избранного» выполняются той же реализацией, что и команды
+	// CLI и бота, но только для своего аккаунта; автоматические действия фильтров и загрузки
+	// архива медиа идут через троттлер userbot-транспорта.
+	selfCommands := commands.NewExecutor("self", acc.commandsAccount())
+	autoActions, err := actions.NewService(acc.clientSender, acc.filters, cache,
+		cfg.ActionsAuditFile, config.Env().ActionsDryRun)
+	if err != nil {
+		return fmt.Errorf("init actions: %w", err)
+	}
+	media, err := mediaarchive.New(acc.clientSender, acc.peers, mediaarchive.Options{
+		Dir:       cfg.MediaArchiveDir,
+		QueueFile: cfg.MediaQueueFile,
+		MaxSize:   int64(config.Env().MediaMaxMB) << 20,
+		Types:     config.Env().MediaTypes,
+		Workers:   config.Env().MediaWorkers,
+	})
+	if err != nil {
+		return fmt.Errorf("init media archive: %w", err)
+	}
+	h, err := domainupdates.NewHandlers(
+		acc.cl.API, acc.filters, acc.notif, acc.dupCache, acc.debouncer, cache, stop, acc.peers, selfCommands,
+		autoActions, acc.archive, media, acc.backfill, domainupdates.Account{
+			Conn:              acc.conn,
+			Presence:          acc.presence,
+			NotifiedCacheFile: cfg.NotifiedCacheFile,
+			Reader:            acc.clientSender,
+		})
+	if err != nil {
+		return fmt.Errorf("init handlers: %w", err)
+	}
+	acc.handlers = h
+	acc.backfill.SetProcessor(h)
+
+	// Маршрутизация апдейтов на доменные обработчики.
+	acc.dispatch.OnNewMessage(h.OnNewMessage)
+	acc.dispatch.OnNewChannelMessage(h.OnNewChannelMessage)
+	acc.dispatch.OnEditMessage(h.OnEditMessage)
+	acc.dispatch.OnEditChannelMessage(h.OnEditChannelMessage)
+	acc.dispatch.OnDeleteMessages(h.OnDeleteMessages)
+	acc.dispatch.OnDeleteChannelMessages(h.OnDeleteChannelMessages)
+	acc.dispatch.OnReadHistoryOutbox(h.OnReadHistoryOutbox)
+	acc.dispatch.OnReadChannelOutbox(h.OnReadChannelOutbox)
+
+	return nil
+}
+
+// commandsAccount возвращает состояние аккаунта для общих команд (CLI, бот, «Избранное»).
+func (acc *account) commandsAccount() commands.Account {
+	return commands.Account{
+		Name:      acc.cfg.Name,
+		Filters:   acc.filters,
+		Queue:     acc.notif,
+		Archive:   acc.archive,
+		ExportDir: acc.cfg.ExportDir,
+		Backfill:  acc.backfill,
+	}
+}
+
+// cliAccount возвращает аккаунт для CLI: общие команды плюс клиент, пиры и соединение.
+func (acc *account) cliAccount() cli.Account {
+	return cli.Account{
+		Account:  acc.commandsAccount(),
+		Client:   acc.cl,
+		Peers:    acc.peers,
+		Conn:     acc.conn,
+		Presence: acc.presence,
+	}
+}
+
+// node возвращает имя узла lifecycle в поддереве аккаунта.
+func (acc *account) node(name string) string {
+	return acc.cfg.Name + "/" + name
+}
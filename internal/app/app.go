@@ -7,49 +7,36 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	botapionotifier "telegram-userbot/internal/adapters/botapi/notifier"
-	"telegram-userbot/internal/adapters/telegram/core"
-	telegramnotifier "telegram-userbot/internal/adapters/telegram/notifier"
+	"telegram-userbot/internal/adapters/commands"
+	emailnotifier "telegram-userbot/internal/adapters/email/notifier"
+	webhooknotifier "telegram-userbot/internal/adapters/webhook/notifier"
 	"telegram-userbot/internal/domain/filters"
 	"telegram-userbot/internal/domain/notifications"
-	domainupdates "telegram-userbot/internal/domain/updates"
-	"telegram-userbot/internal/infra/concurrency"
 	"telegram-userbot/internal/infra/config"
 	"telegram-userbot/internal/infra/logger"
 	"telegram-userbot/internal/infra/telegram/connection"
-	"telegram-userbot/internal/infra/telegram/peersmgr"
-	"telegram-userbot/internal/infra/telegram/session"
-
-	contribstorage "github.com/gotd/contrib/storage"
-	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/telegram/dcs"
-	tgupdates "github.com/gotd/td/telegram/updates"
-	updhook "github.com/gotd/td/telegram/updates/hook"
-	"github.com/gotd/td/tg"
+	"telegram-userbot/internal/infra/telegram/status"
 )
 
-// App агрегирует зависимости userbot и управляет их связью.
+// App агрегирует аккаунты userbot и общие для них подсистемы и управляет их связью.
 // Отвечает за:
-//   - конфигурацию и телеграм‑клиента (авторизация, API),
-//   - подсистему уведомлений и её хранилища, расписание и таймзону,
-//   - защиту от дублей и сглаживание частых правок,
-//   - маршрутизацию апдейтов и регистрацию доменных обработчиков,
+//   - конфигурацию и аккаунты (у каждого свои клиент, сессия, фильтры, очередь и кэши, см. account.go),
+//   - общие транспорты уведомлений (бот, webhook, email), расписание и таймзону,
+//   - опрос апдейтов бота, который обслуживает кнопки и команды всех аккаунтов,
 //   - запуск Runner, который оркестрирует жизненный цикл и graceful shutdown.
 type App struct {
-	cl        *core.ClientCore          // Авторизованный клиент gotd и его API-обёртка (Self, вызовы tg).
-	filters   *filters.FilterEngine     // Движок фильтров: загрузка, хранение, матчи.
-	notif     *notifications.Queue      // Асинхронная очередь уведомлений: транспорт client/bot, график, ретраи.
-	dupCache  *concurrency.Deduplicator // Фильтр повторов за заданное окно (идемпотентность на уровне событий).
-	debouncer *concurrency.Debouncer    // Сглаживание бурстов (частые правки одного сообщения и т.п.).
-	handlers  *domainupdates.Handlers   // Доменные обработчики апдейтов и фоновые задачи.
-	dispatch  *tg.UpdateDispatcher      // Маршрутизатор апдейтов gotd: OnNewMessage/OnEdit/etc.
-	runner    *Runner                   // Оркестратор жизненного цикла и CLI.
-	updMgr    *tgupdates.Manager        // Менеджер апдейтов gotd: поток событий и локальное состояние.
-	peers     *peersmgr.Service         // Менеджер пиров + persist storage.
-	ctx       context.Context           // Внешний контекст приложения (отменяется по сигналам/CLI).
-	stop      context.CancelFunc        // Инициирует общий shutdown.
+	accounts   []*account        // Аккаунты процесса; первый — основной.
+	transports *sharedTransports // Транспорты уведомлений, общие для очередей всех аккаунтов.
+	runner     *Runner           // Оркестратор жизненного цикла и CLI.
+	ctx        context.Context   // Внешний контекст приложения (отменяется по сигналам/CLI).
+	stop       context.CancelFunc
+
+	// Опрос апдейтов бота: кнопки уведомлений и команды (nil — бот не принимает апдейты).
+	botUpdates *botapionotifier.UpdatesPoller
 }
 
 // CleanPeriodHours — периодичность очистки внутренних фильтров/кэшей уведомлений (часы),
@@ -66,11 +53,11 @@ func NewApp() *App {
 }
 
 // Init связывает компоненты приложения и подготавливает их к запуску:
-//  1. создаёт tgupdates.Manager и диспетчер апдейтов,
-//  2. настраивает telegram.Options (сессионное хранилище, хуки, DeviceConfig, DCList),
-//  3. инициализирует MTProto‑клиент, кэш пиров, очередь уведомлений и таймзону,
-//  4. поднимает защиту от дублей и дебаунсер,
-//  5. регистрирует доменные обработчики и конструирует Runner.
+//  0. включает шифрование файлов состояния, если задан секрет (см. encryption.go),
+//  1. для каждого аккаунта создаёт MTProto‑клиент, кэш пиров, менеджер апдейтов и фильтры,
+//  2. собирает общие транспорты уведомлений (бот, webhook, email),
+//  3. поднимает у аккаунтов очереди уведомлений, архивы, кэши и доменные обработчики,
+//  4. настраивает опрос апдейтов бота и конструирует Runner.
 //
 // Возвращает ошибку, если какой-либо этап не удался.
 func (a *App) Init(ctx context.Context, stop context.CancelFunc) error {
@@ -78,142 +65,193 @@ func (a *App) Init(ctx context.Context, stop context.CancelFunc) error {
 
 	a.ctx = ctx
 	a.stop = stop
-	a.dispatch = func(d tg.UpdateDispatcher) *tg.UpdateDispatcher { return &d }(tg.NewUpdateDispatcher())
-	var updateFunc func(context.Context, tg.UpdatesClass) error
-	updateHandlerProxy := telegram.UpdateHandlerFunc(func(handlerCtx context.Context, updates tg.UpdatesClass) error {
-		if updateFunc != nil {
-			return updateFunc(handlerCtx, updates)
-		}
-		if a.updMgr != nil {
-			return a.updMgr.Handle(handlerCtx, updates)
-		}
-		return nil
-	})
-
-	// 1) Опции MTProto‑клиента: сессии, хуки апдейтов, поведение при dead‑соединении и паспорт устройства.
-	options := telegram.Options{
-		SessionStorage: &session.NotifyStorage{Path: config.Env().SessionFile},
-		UpdateHandler:  updateHandlerProxy,
-		Middlewares: []telegram.Middleware{
-			updhook.UpdateHook(func(mwCtx context.Context, updates tg.UpdatesClass) error {
-				return updateHandlerProxy.Handle(mwCtx, updates)
-			}),
-			// connstate.Middleware(updhook.UpdateHook(a.updMgr.Handle)),
-		},
-		// При сообщении от gotd о «мертвом» соединении отмечаем отключение для зависимых узлов.
-		OnDead: func() {
-			// logger.Debug("MTProto client reported dead connection, scheduling reconnect")
-			connection.MarkDisconnected()
-		},
-		Device: telegram.DeviceConfig{
-			DeviceModel:   "MacBookPro18,1",
-			SystemVersion: "macOS v15.6.1 build 24G90",
-			AppVersion:    "v5.5.0",
-		},
-		// Logger: logger.Logger().Named("MTProto_Client"),
-	}
-
-	// Для тестовых окружений используем DC тестового стенда Telegram.
-	if config.Env().TestDC {
-		options.DCList = dcs.Test()
-	}
-
-	// 3) Инициализация клиента gotd на основе диспетчера апдейтов и опций.
-	cl, clErr := core.New(a.dispatch, options)
-	if clErr != nil {
-		return fmt.Errorf("init client: %w", clErr)
-	}
-	a.cl = cl
-
-	peersSvc, err := peersmgr.New(cl.API, config.Env().PeersCacheFile)
-	if err != nil {
-		return fmt.Errorf("init peers manager: %w", err)
+
+	if config.Env().Notifier != notifierClient && config.Env().Notifier != notifierBot {
+		return errors.New(`invalid NOTIFIER option in .env (must be "client" or "bot")`)
 	}
-	if err = peersSvc.LoadFromStorage(ctx); err != nil {
-		return fmt.Errorf("load peers storage: %w", err)
+	// Таймзона для расписания уведомлений берётся из конфигурации.
+	loc, err := config.ParseLocation(config.Env().NotifyTimezone)
+	if err != nil {
+		return fmt.Errorf("load notify timezone: %w", err)
 	}
-	a.peers = peersSvc
-
-	updConfig := tgupdates.Config{
-		Handler:      a.dispatch,
-		Storage:      core.NewFileStorage(config.Env().StateFile),
-		AccessHasher: peersSvc.Mgr,
-		// Logger:  logger.Logger().Named("Update_Manager"),
+	// Ключ шифрования нужен до открытия сессий, состояний и очередей аккаунтов.
+	if err = setupEncryption(false); err != nil {
+		return err
 	}
-	a.updMgr = tgupdates.New(updConfig)
-	updateFunc = contribstorage.UpdateHook(peersSvc.Mgr.UpdateHook(a.updMgr), peersSvc.Store()).Handle
 
-	// Инициализация filters (внутри загружает recipients)
-	a.filters = filters.NewFilterEngine(config.Env().FiltersFile, config.Env().RecipientsFile)
-	if filtersErr := a.filters.Init(); filtersErr != nil {
-		return fmt.Errorf("load filters: %w", filtersErr)
+	for _, cfg := range config.Accounts() {
+		acc, accErr := newAccount(ctx, cfg)
+		if accErr != nil {
+			return fmt.Errorf("account %s: %w", cfg.Name, accErr)
+		}
+		a.accounts = append(a.accounts, acc)
 	}
-	logger.Infof("Filters loaded: %d total, %d unique chats",
-		len(a.filters.GetFilters()), len(a.filters.GetUniqueChats()))
+	// Пакетные функции connection и status (без явного менеджера) относятся к основному аккаунту.
+	primary := a.accounts[0]
+	connection.SetDefault(primary.conn)
+	status.SetDefault(primary.presence)
 
-	// Подсистема уведомлений: файловые сторы для очереди и неудачных отправок.
-	queueStore, err := notifications.NewQueueStore(config.Env().NotifyQueueFile, time.Second)
+	// Транспорты вне аккаунтов (бот, webhook, email) создаются один раз на процесс;
+	// справочник получателей и источник медиа каждый аккаунт подставляет свои (см. register).
+	transports, err := newSharedTransports()
 	if err != nil {
-		return fmt.Errorf("init queue store: %w", err)
+		return err
 	}
-	failedStore, err := notifications.NewFailedStore(config.Env().NotifyFailedFile)
-	if err != nil {
-		return fmt.Errorf("init failed store: %w", err)
+	a.transports = transports
+
+	// Эскалация непрочитанных critical опирается на ID отправленных сообщений и апдейты
+	// прочтения, которые видит только userbot-транспорт: отслеживаются его доставки.
+	var escalation notifications.EscalationPolicy
+	if config.Env().EscalateAfterMin > 0 {
+		escalation = notifications.EscalationPolicy{
+			After:      time.Duration(config.Env().EscalateAfterMin) * time.Minute,
+			MaxResends: config.Env().EscalateResends,
+			Transport:  notifications.TransportClient,
+		}
 	}
 
-	// Таймзона для расписания уведомлений берётся из конфигурации.
-	loc, err := config.ParseLocation(config.Env().NotifyTimezone)
-	if err != nil {
-		return fmt.Errorf("load notify timezone: %w", err)
+	for _, acc := range a.accounts {
+		if err = acc.initServices(a.stop, a.transports, loc, escalation); err != nil {
+			return fmt.Errorf("account %s: %w", acc.cfg.Name, err)
+		}
 	}
+	warnUnavailableTransports(primary)
 
-	// Выбор транспорта уведомлений: client (userbot) или bot (Bot API).
-	var sender notifications.PreparedSender
-	switch config.Env().Notifier {
-	case notifierClient:
-		sender = telegramnotifier.NewClientSender(a.cl.API, config.Env().ThrottleRPS, a.peers)
-	case notifierBot:
-		sender = botapionotifier.NewBotSender(config.Env().BotToken, config.Env().TestDC, config.Env().ThrottleRPS)
-	default:
-		return errors.New(`invalid NOTIFIER option in .env (must be "client" or "bot")`)
+	// Апдейты бота принимает один опрос getUpdates на все аккаунты: нажатия кнопок действий под
+	// уведомлениями (кнопка несёт имя аккаунта, см. notifications.ActionRouter) и команды
+	// администраторов, которые выполняются той же реализацией, что и команды CLI.
+	if config.Env().BotToken != "" {
+		var callbacks botapionotifier.CallbackHandler
+		if config.Env().BotActions {
+			actionRouter := notifications.NewActionRouter()
+			for _, acc := range a.accounts {
+				actionRouter.Register(acc.cfg.Name, acc.actions)
+			}
+			callbacks = actionRouter
+		}
+		var router botapionotifier.CommandHandler
+		if admins := botAdmins(); len(admins) > 0 {
+			router = commands.NewRouter(commands.NewExecutor("bot", a.commandsAccounts()...), admins)
+		}
+		if callbacks != nil || router != nil {
+			a.botUpdates = botapionotifier.NewUpdatesPoller(config.Env().BotToken, config.Env().TestDC,
+				callbacks, router)
+		}
 	}
 
-	// Сборка очереди уведомлений: транспорт, сторы, расписание, таймзона, часы.
-	queue, err := notifications.NewQueue(notifications.QueueOptions{
-		Sender:   sender,
-		Store:    queueStore,
-		Failed:   failedStore,
-		Schedule: config.Env().NotifySchedule,
-		Location: loc,
-		Clock:    time.Now,
-		Peers:    a.peers,
-	})
-	if err != nil {
-		return fmt.Errorf("init notifications queue: %w", err)
+	// Конструируем Runner, который запустит аккаунты и обеспечит корректный shutdown.
+	a.runner = NewRunner(a.ctx, a.stop, a.accounts, a.transports, a.botUpdates)
+
+	return nil
+}
+
+// Run делегирует запуск основного цикла Runner’у.
+func (a *App) Run() error {
+	return a.runner.Run()
+}
+
+// commandsAccounts возвращает состояние всех аккаунтов для общих команд.
+func (a *App) commandsAccounts() []commands.Account {
+	out := make([]commands.Account, 0, len(a.accounts))
+	for _, acc := range a.accounts {
+		out = append(out, acc.commandsAccount())
 	}
-	a.notif = queue
+	return out
+}
 
-	// 5) Защита от дублей и бурстов правок.
-	a.dupCache = concurrency.NewDeduplicator(config.Env().DedupWindowSec)
-	a.debouncer = concurrency.NewDebouncer(config.Env().DebounceEditMS)
+// sharedTransports — транспорты уведомлений, общие для всех аккаунтов: один бот (BOT_TOKEN),
+// webhook и email — одни лимиты и соединения на процесс. Маршрутизаторы аккаунтов регистрируют
+// их через RegisterShared, а запуском и остановкой управляет узел notify_transports (см. runner.go).
+type sharedTransports struct {
+	bot     *botapionotifier.BotSender // nil — BOT_TOKEN не задан
+	webhook *webhooknotifier.WebhookSender
+	email   *emailnotifier.EmailSender // nil — SMTP_HOST не задан
+}
 
-	// 6) Регистрация доменных обработчиков, которым нужны API клиента и инфраструктура.
-	h := domainupdates.NewHandlers(cl.API, a.filters, a.notif, a.dupCache, a.debouncer, a.stop, a.peers)
-	a.handlers = h
+// newSharedTransports создаёт общие транспорты без справочника получателей и источника медиа:
+// их подставляет каждый аккаунт при регистрации (см. register).
+func newSharedTransports() (*sharedTransports, error) {
+	t := &sharedTransports{
+		webhook: webhooknotifier.NewWebhookSender(nil, config.Env().WebhookSecret, config.Env().ThrottleRPS),
+	}
+	if config.Env().BotToken != "" {
+		t.bot = botapionotifier.NewBotSender(config.Env().BotToken, config.Env().TestDC,
+			config.Env().ThrottleRPS, nil, config.Env().BotActions)
+	}
+	if config.Env().SMTPHost != "" {
+		emailSender, err := emailnotifier.NewEmailSender(nil, emailnotifier.SMTPOptions{
+			Host:     config.Env().SMTPHost,
+			Port:     config.Env().SMTPPort,
+			Username: config.Env().SMTPUsername,
+			Password: config.Env().SMTPPassword,
+			From:     config.Env().SMTPFrom,
+			Security: config.Env().SMTPSecurity,
+		}, config.Env().ThrottleRPS)
+		if err != nil {
+			return nil, fmt.Errorf("init email sender: %w", err)
+		}
+		t.email = emailSender
+	}
+	return t, nil
+}
 
-	// Маршрутизация апдейтов на доменные обработчики.
-	a.dispatch.OnNewMessage(h.OnNewMessage)
-	a.dispatch.OnNewChannelMessage(h.OnNewChannelMessage)
-	a.dispatch.OnEditMessage(h.OnEditMessage)
-	a.dispatch.OnEditChannelMessage(h.OnEditChannelMessage)
+// register добавляет общие транспорты в маршрутизатор аккаунта: recipients — справочник
+// получателей аккаунта, media — его источник медиа исходных сообщений для копий бота.
+func (t *sharedTransports) register(
+	router *notifications.RouterSender, recipients *filters.FilterEngine, media notifications.MediaFetcher,
+) {
+	if t.bot != nil {
+		router.RegisterShared(notifications.TransportBot, t.bot.WithMedia(media))
+	}
+	router.RegisterShared(notifications.TransportWebhook, t.webhook.WithRecipients(recipients))
+	if t.email != nil {
+		router.RegisterShared(notifications.TransportEmail, t.email.WithRecipients(recipients))
+	}
+}
 
-	// 7) Конструируем Runner, который запустит цикл и обеспечит корректный shutdown.
-	a.runner = NewRunner(a.ctx, a.stop, a.cl, a.filters, a.notif, a.dupCache, a.debouncer, a.handlers, a.peers)
+// start запускает лимитеры общих транспортов.
+func (t *sharedTransports) start(ctx context.Context) {
+	if t.bot != nil {
+		t.bot.Start(ctx)
+	}
+	t.webhook.Start(ctx)
+	if t.email != nil {
+		t.email.Start(ctx)
+	}
+}
 
-	return nil
+// stop останавливает общие транспорты.
+func (t *sharedTransports) stop() {
+	if t.bot != nil {
+		t.bot.Stop()
+	}
+	t.webhook.Stop()
+	if t.email != nil {
+		t.email.Stop()
+	}
 }
 
-// Run делегирует запуск основного цикла Runner’у с уже сконфигурированным менеджером апдейтов.
-func (a *App) Run() error {
-	return a.runner.Run(a.updMgr)
+// warnUnavailableTransports предупреждает о получателях, чьи транспорты не настроены.
+// Набор транспортов у всех аккаунтов одинаков, поэтому проверяется основной.
+func warnUnavailableTransports(acc *account) {
+	for _, rcpt := range acc.filters.GetRecipients() {
+		if rcpt.Type == filters.RecipientTypeEmail && !acc.router.Has(notifications.TransportEmail) {
+			logger.Warnf("Recipient %q: email transport is not configured (SMTP_HOST is empty)", rcpt.ID)
+		}
+		for _, name := range rcpt.Transport {
+			if !acc.router.Has(name) {
+				logger.Warnf("Recipient %q: transport %q is not available, it will be skipped", rcpt.ID, name)
+			}
+		}
+	}
+}
+
+// botAdmins возвращает Telegram ID пользователей, которым доступны команды бота:
+// ADMIN_UID (если задан) и список BOT_ADMINS.
+func botAdmins() []int64 {
+	admins := slices.Clone(config.Env().BotAdmins)
+	if uid := int64(config.Env().AdminUID); uid > 0 && !slices.Contains(admins, uid) {
+		admins = append(admins, uid)
+	}
+	return admins
 }
@@ -0,0 +1,129 @@
+// Package app / файл encryption.go — включение шифрования файлов состояния и их миграция.
+//
+// Секрет берётся (по приоритету) из ENCRYPTION_KEY, из файла ENCRYPTION_KEY_FILE или
+// запрашивается в терминале при ENCRYPTION_PROMPT=true. Без секрета файлы пишутся открыто,
+// как раньше. Ключ выводится через scrypt (см. storage.DeriveKey) и действует на весь процесс:
+// сессию, состояние апдейтов, очередь и журнал провалов уведомлений, JSON notified и
+// значения базы пиров всех аккаунтов.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"telegram-userbot/internal/infra/config"
+	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/pr"
+	"telegram-userbot/internal/infra/storage"
+	"telegram-userbot/internal/infra/telegram/peersmgr"
+
+	"golang.org/x/term"
+)
+
+// setupEncryption выводит ключ из настроенного секрета и включает шифрование.
+// required=true требует секрет (миграция без ключа невозможна).
+func setupEncryption(required bool) error {
+	secret, source, err := encryptionSecret()
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		if required {
+			return errors.New("encryption secret is not configured " +
+				"(set ENCRYPTION_KEY, ENCRYPTION_KEY_FILE or ENCRYPTION_PROMPT=true)")
+		}
+		return nil
+	}
+	var stateFiles []string
+	for _, acc := range config.Accounts() {
+		stateFiles = append(stateFiles, accountStateFiles(acc)...)
+	}
+	key, err := storage.DeriveKey(secret, config.Env().EncryptionMeta, stateFiles)
+	if err != nil {
+		return fmt.Errorf("derive encryption key: %w", err)
+	}
+	if err := storage.SetKey(key); err != nil {
+		return err
+	}
+	logger.Infof("Storage encryption enabled (secret from %s)", source)
+	return nil
+}
+
+// encryptionSecret возвращает секрет и его источник; nil — шифрование не настроено.
+func encryptionSecret() ([]byte, string, error) {
+	env := config.Env()
+	if env.EncryptionKey != "" {
+		return []byte(env.EncryptionKey), "ENCRYPTION_KEY", nil
+	}
+	if env.EncryptionKeyFile != "" {
+		data, err := os.ReadFile(env.EncryptionKeyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("read ENCRYPTION_KEY_FILE: %w", err)
+		}
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return nil, "", fmt.Errorf("ENCRYPTION_KEY_FILE %s is empty", env.EncryptionKeyFile)
+		}
+		return []byte(secret), "ENCRYPTION_KEY_FILE", nil
+	}
+	if env.EncryptionPrompt {
+		// Безэховый ввод, как пароль 2FA в core.TerminalAuthenticator.
+		pr.Print("Enter storage passphrase: ")
+		secret, err := term.ReadPassword(syscall.Stdin)
+		pr.Println()
+		if err != nil {
+			return nil, "", fmt.Errorf("read storage passphrase: %w", err)
+		}
+		if len(secret) == 0 {
+			return nil, "", errors.New("storage passphrase is empty")
+		}
+		return secret, "prompt", nil
+	}
+	return nil, "", nil
+}
+
+// accountStateFiles возвращает файлы состояния аккаунта, которые шифруются целиком.
+func accountStateFiles(acc config.Account) []string {
+	return []string{
+		acc.SessionFile,
+		acc.StateFile,
+		acc.NotifyQueueFile,
+		acc.NotifyFailedFile,
+		acc.NotifiedCacheFile,
+	}
+}
+
+// MigrateStorage переводит файлы состояния всех аккаунтов в зашифрованный (encrypt=true)
+// или открытый вид. Запускается без подключения к Telegram при остановленном боте: база
+// пиров открывается эксклюзивно. Уже переведённые файлы пропускаются.
+func MigrateStorage(encrypt bool) error {
+	if err := setupEncryption(true); err != nil {
+		return err
+	}
+	for _, acc := range config.Accounts() {
+		rewritten := 0
+		for _, path := range accountStateFiles(acc) {
+			changed, err := storage.ResealFile(path, encrypt)
+			if err != nil {
+				return fmt.Errorf("account %s: %w", acc.Name, err)
+			}
+			if changed {
+				rewritten++
+			}
+		}
+		records := 0
+		if _, statErr := os.Stat(acc.PeersCacheFile); statErr == nil {
+			n, err := peersmgr.ResealDB(acc.PeersCacheFile, encrypt)
+			if err != nil {
+				return fmt.Errorf("account %s: %w", acc.Name, err)
+			}
+			records = n
+		}
+		logger.Infof("Account %s: storage migrated (files rewritten: %d, peers records: %d)",
+			acc.Name, rewritten, records)
+	}
+	return nil
+}
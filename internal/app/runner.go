@@ -9,110 +9,103 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	botapionotifier "telegram-userbot/internal/adapters/botapi/notifier"
 	"telegram-userbot/internal/adapters/cli"
-	"telegram-userbot/internal/adapters/telegram/core"
-	"telegram-userbot/internal/domain/filters"
-	"telegram-userbot/internal/domain/notifications"
-	domainupdates "telegram-userbot/internal/domain/updates"
-	"telegram-userbot/internal/infra/concurrency"
 	"telegram-userbot/internal/infra/config"
 	"telegram-userbot/internal/infra/lifecycle"
 	"telegram-userbot/internal/infra/logger"
-	"telegram-userbot/internal/infra/telegram/connection"
-	"telegram-userbot/internal/infra/telegram/peersmgr"
-
-	"telegram-userbot/internal/infra/telegram/status"
 
 	tgupdates "github.com/gotd/td/telegram/updates"
 	"github.com/gotd/td/tg"
 	"go.uber.org/zap"
 )
 
-// Runner инкапсулирует сценарий запуска и остановки Telegram‑клиента и связанных подсистем.
+// Runner инкапсулирует сценарий запуска и остановки аккаунтов и связанных подсистем.
 // Отвечает за:
-//   - авторизацию и идентификацию текущего пользователя (self),
-//   - сборку и запуск узлов через lifecycle.Manager с учётом зависимостей,
-//   - корректное завершение: сначала останавливаются узлы (статусы/очереди), затем гасится MTProto‑движок,
+//   - авторизацию и идентификацию каждого аккаунта (self),
+//   - сборку и запуск узлов через lifecycle.Manager: у каждого аккаунта своё поддерево с его именем,
+//     общие узлы (транспорты уведомлений, опрос бота, CLI) живут в корне,
+//   - корректное завершение: сначала останавливаются узлы (статусы/очереди), затем гасятся MTProto‑движки,
 //   - интеграцию с CLI и доменными обработчиками обновлений.
 type Runner struct {
-	cl      *core.ClientCore          // Обёртка над MTProto‑клиентом и API: логин, Self(), API-интерфейс.
-	filters *filters.FilterEngine     // Движок фильтров: загрузка, хранение, матчи.
-	notif   *notifications.Queue      // Асинхронная очередь нотификаций (доставка сообщений администратору/сервисам).
-	dedup   *concurrency.Deduplicator // Защита от повторной обработки событий (идемпотентность на уровне сигналов).
-	deb     *concurrency.Debouncer    // Сглаживание/слияние частых событий (например, всплесков апдейтов).
-	h       *domainupdates.Handlers   // Композиция доменных обработчиков апдейтов Telegram.
-	ctx     context.Context           // Внешний контекст процесса: отменяется по Ctrl+C/сигналам.
-	stop    context.CancelFunc        // Функция, инициирующая общий shutdown (используется из узлов).
-	peers   *peersmgr.Service         // Сервис пиров (peers.Manager + persist storage).
+	accounts   []*account         // Аккаунты процесса; первый — основной.
+	transports *sharedTransports  // Общие транспорты уведомлений (бот, webhook, email).
+	ctx        context.Context    // Внешний контекст процесса: отменяется по Ctrl+C/сигналам.
+	stop       context.CancelFunc // Функция, инициирующая общий shutdown (используется из узлов).
+	// Опрос апдейтов бота: кнопки уведомлений и команды (nil — бот не принимает апдейты).
+	botUpdates *botapionotifier.UpdatesPoller
+
+	errMu  sync.Mutex
+	runErr error // Ошибки клиентов, завершившихся не по shutdown.
 }
 
-// NewRunner подготавливает Runner с переданными зависимостями: ядро клиента, очередь уведомлений,
-// утилиты конкуррентности и доменные обработчики. Возвращает объект, готовый к запуску Run().
+// NewRunner подготавливает Runner для аккаунтов accounts и общих подсистем.
+// Возвращает объект, готовый к запуску Run().
 func NewRunner(
 	ctx context.Context,
 	stop context.CancelFunc,
-	cl *core.ClientCore,
-	filters *filters.FilterEngine,
-	notif *notifications.Queue,
-	dedup *concurrency.Deduplicator,
-	debouncer *concurrency.Debouncer,
-	handlers *domainupdates.Handlers,
-	peers *peersmgr.Service,
+	accounts []*account,
+	transports *sharedTransports,
+	botUpdates *botapionotifier.UpdatesPoller,
 ) *Runner {
 	return &Runner{
-		ctx:     ctx,
-		stop:    stop,
-		cl:      cl,
-		filters: filters,
-		notif:   notif,
-		dedup:   dedup,
-		deb:     debouncer,
-		h:       handlers,
-		peers:   peers,
+		ctx:        ctx,
+		stop:       stop,
+		accounts:   accounts,
+		transports: transports,
+		botUpdates: botUpdates,
 	}
 }
 
-// Run — главный цикл userbot. Выполняет логин, сборку и запуск узлов, стартует updates.Manager
-// и управляет корректным завершением. Блокируется до завершения клиентского контекста.
-// Важно: используется отдельный контекст для MTProto‑движка, чтобы дать шанс статусам/очередям
-// корректно завершиться до гашения сетевого уровня.
-func (r *Runner) Run(updmgr *tgupdates.Manager) error {
-	clientCtx, clientCancel := context.WithCancel(context.Background())
-	defer clientCancel()
-
-	return r.cl.Client.Run(clientCtx, func(ctx context.Context) error {
-		logger.Info("Userbot running...")
-
-		self, loginErr := r.loginSelf(ctx)
-		if loginErr != nil {
-			return loginErr
-		}
+// Run — главный цикл userbot. Собирает и запускает граф узлов (узел аккаунта выполняет логин),
+// блокируется до отмены внешнего контекста и гасит узлы в обратном порядке.
+// Важно: MTProto‑движок аккаунта живёт в отдельном контексте и останавливается последним в его
+// поддереве, чтобы статусы/очереди успели корректно завершиться до гашения сетевого уровня.
+func (r *Runner) Run() error {
+	lc := lifecycle.New(context.Background())
+	if err := r.registerNodes(lc); err != nil {
+		return err
+	}
+	if err := lc.StartAll(); err != nil {
+		_ = lc.Shutdown()
+		return errors.Join(err, r.err())
+	}
 
-		if err := r.initPeersIfNeeded(ctx); err != nil {
-			return err
-		}
+	<-r.ctx.Done()
+	if err := lc.Shutdown(); err != nil {
+		logger.Errorf("shutdown: %v", err)
+	}
+	return r.err()
+}
 
-		lc, err := r.buildLifecycle(ctx, updmgr, self.ID)
-		if err != nil {
-			return err
-		}
+// fail запоминает ошибку аккаунта, которую вернёт Run.
+func (r *Runner) fail(err error) {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	r.runErr = errors.Join(r.runErr, err)
+}
 
-		return r.runLifecycleLoop(ctx, lc, clientCancel)
-	})
+func (r *Runner) err() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.runErr
 }
 
-func (r *Runner) loginSelf(ctx context.Context) (*tg.User, error) {
-	if err := r.cl.Login(ctx); err != nil {
+func (r *Runner) loginSelf(ctx context.Context, acc *account) (*tg.User, error) {
+	if err := acc.cl.Login(ctx); err != nil {
 		return nil, err
 	}
-	self, err := r.cl.Client.Self(ctx)
+	self, err := acc.cl.Client.Self(ctx)
 	if err != nil {
 		return nil, err
 	}
 	logger.Logger().Info("Logged in as:",
+		zap.String("Account", acc.cfg.Name),
 		zap.String("FirstName", self.FirstName),
 		zap.String("Username", self.Username),
 		zap.Int64("ID", self.ID),
@@ -120,119 +113,225 @@ func (r *Runner) loginSelf(ctx context.Context) (*tg.User, error) {
 	return self, nil
 }
 
-func (r *Runner) initPeersIfNeeded(ctx context.Context) error {
-	if r.peers == nil {
+func (r *Runner) initPeersIfNeeded(ctx context.Context, acc *account) error {
+	if acc.peers == nil {
 		return nil
 	}
 
-	if err := r.peers.Mgr.Init(ctx); err != nil {
-		logger.Errorf("failed to init peers manager: %v", err)
+	if err := acc.peers.Mgr.Init(ctx); err != nil {
+		logger.Errorf("account %s: failed to init peers manager: %v", acc.cfg.Name, err)
 		if config.Env().Notifier == notifierClient {
 			return err
 		}
 	}
 
-	if err := r.peers.LoadFromStorage(ctx); err != nil {
-		logger.Errorf("failed to load peers from storage: %v", err)
+	if err := acc.peers.LoadFromStorage(ctx); err != nil {
+		logger.Errorf("account %s: failed to load peers from storage: %v", acc.cfg.Name, err)
 	}
 
-	if err := r.peers.WarmupIfEmpty(ctx, r.cl.API); err != nil {
-		logger.Errorf("failed to warm up peers manager: %v", err)
+	if err := acc.peers.WarmupIfEmpty(ctx, acc.cl.API); err != nil {
+		logger.Errorf("account %s: failed to warm up peers manager: %v", acc.cfg.Name, err)
 		if config.Env().Notifier == notifierClient {
 			logger.Error("peers warmup error, cant use client notifier")
 			return err
 		}
 	}
 
-	logger.Debug("Peers warmup complete")
+	logger.Debugf("Account %s: peers warmup complete", acc.cfg.Name)
 	return nil
 }
 
-func (r *Runner) buildLifecycle(
-	ctx context.Context,
-	updmgr *tgupdates.Manager,
-	selfID int64,
-) (*lifecycle.Manager, error) {
-	lc := lifecycle.New(ctx)
-	if err := r.registerClientNodes(ctx, lc, updmgr, selfID); err != nil {
-		return nil, err
-	}
-	if err := lc.StartAll(); err != nil {
-		_ = lc.Shutdown()
-		return nil, err
+// handleUpdatesManagerStart возвращает хук, который updates.Manager аккаунта вызывает при старте
+// обработки апдейтов. Здесь выполняем действия, зависящие от готовности подписки на обновления:
+//   - переключение в online-статус при конфигурации notifier=="client",
+//   - отправка сервисного уведомления (оставлено закомментированным, но готово к использованию).
+func (r *Runner) handleUpdatesManagerStart(acc *account) func(context.Context) {
+	return func(ctx context.Context) {
+		// переходим в онлайн, если notifier == "client"
+		if config.Env().Notifier == "client" {
+			acc.presence.GoOnline()
+		}
+
+		logger.Debugf("Account %s: updates manager started", acc.cfg.Name)
+
+		// Отправляем администратору уведомление о старте сервиса, чтобы зафиксировать успешный запуск.
+		// if config.Env().AdminUID > 0 {
+		// 	if err := acc.notif.Send(
+		// 		ctx,
+		// 		int64(config.Env().AdminUID),
+		// 		fmt.Sprintf("%s v%s started", versioninfo.Name, versioninfo.Version),
+		// 	); err != nil {
+		// 		logger.Errorf("failed to send message on start: %v", err)
+		// 	}
+		// }
 	}
-	return lc, nil
 }
 
-func (r *Runner) runLifecycleLoop(ctx context.Context, lc *lifecycle.Manager, clientCancel context.CancelFunc) error {
-	var wg sync.WaitGroup
-	shutdownTriggered := make(chan struct{})
-
-	wg.Go(func() {
-		<-r.ctx.Done()
-		_ = lc.Shutdown()
-		clientCancel()
-		close(shutdownTriggered)
-	})
-
-	<-ctx.Done()
-
-	select {
-	case <-shutdownTriggered:
-	default:
-		_ = lc.Shutdown()
+// registerNodes описывает граф узлов lifecycle.Manager: поддеревья аккаунтов и общие узлы.
+//   - notify_transports запускается до очередей всех аккаунтов и останавливается после них;
+//   - bot_updates обслуживает кнопки и команды всех аккаунтов, поэтому зависит от их очередей;
+//   - CLI запускается отдельно и не блокирует основной цикл.
+func (r *Runner) registerNodes(lc *lifecycle.Manager) error {
+	// Узел: notify_transports
+	// Общие транспорты уведомлений (бот, webhook, email): маршрутизаторы аккаунтов их не запускают.
+	if err := lc.Register(
+		"notify_transports",
+		"",
+		nil,
+		func(nodeCtx context.Context) (context.Context, error) {
+			r.transports.start(nodeCtx)
+			return nodeCtx, nil
+		},
+		func(context.Context) error {
+			r.transports.stop()
+			return nil
+		},
+	); err != nil {
+		return err
 	}
 
-	wg.Wait()
-	return ctx.Err()
-}
+	for _, acc := range r.accounts {
+		if err := r.registerAccountNodes(lc, acc); err != nil {
+			return err
+		}
+	}
 
-// handleUpdatesManagerStart вызывается updates.Manager при старте обработки апдейтов.
-// Здесь выполняем действия, зависящие от готовности подписки на обновления:
-//   - переключение в online-статус при конфигурации notifier=="client",
-//   - отправка сервисного уведомления (оставлено закомментированным, но готово к использованию).
-func (r *Runner) handleUpdatesManagerStart(ctx context.Context) {
-	// переходим в онлайн, если notifier == "client"
-	if config.Env().Notifier == "client" {
-		status.GoOnline()
+	// Узел: bot_updates
+	// Опрос апдейтов бота: нажатия кнопок под уведомлениями и команды администраторов. Действия
+	// и команды меняют состояние очередей, а кнопки помечают источник прочитанным через клиента
+	// аккаунта, поэтому узел стартует после очередей и соединений всех аккаунтов.
+	if r.botUpdates != nil {
+		var deps []string
+		for _, acc := range r.accounts {
+			deps = append(deps,
+				acc.node("notifications_queue"), acc.node("connection_manager"), acc.node("archive_store"))
+		}
+		if err := lc.Register(
+			"bot_updates",
+			"",
+			deps,
+			func(nodeCtx context.Context) (context.Context, error) {
+				r.botUpdates.Start(nodeCtx)
+				return nodeCtx, nil
+			},
+			func(context.Context) error {
+				r.botUpdates.Stop()
+				return nil
+			},
+		); err != nil {
+			return err
+		}
 	}
 
-	logger.Debug("Updates manager started")
-
-	// Отправляем администратору уведомление о старте сервиса, чтобы зафиксировать успешный запуск.
-	// if config.Env().AdminUID > 0 {
-	// 	if err := r.notif.Send(
-	// 		ctx,
-	// 		int64(config.Env().AdminUID),
-	// 		fmt.Sprintf("%s v%s started", versioninfo.Name, versioninfo.Version),
-	// 	); err != nil {
-	// 		logger.Errorf("failed to send message on start: %v", err)
-	// 	}
-	// }
+	// Узел: cli
+	// Сервис интерактивных команд. Не блокирует основную петлю, но может инициировать shutdown через r.stop().
+	cliAccounts := make([]cli.Account, 0, len(r.accounts))
+	var cliDeps []string
+	for _, acc := range r.accounts {
+		cliAccounts = append(cliAccounts, acc.cliAccount())
+		cliDeps = append(cliDeps, acc.node("archive_store"))
+	}
+	cliService := cli.NewService(r.stop, cliAccounts)
+	return lc.Register(
+		"cli",
+		"",
+		cliDeps,
+		func(nodeCtx context.Context) (context.Context, error) {
+			cliService.Start(nodeCtx)
+			return nodeCtx, nil
+		},
+		func(context.Context) error {
+			cliService.Stop()
+			return nil
+		},
+	)
 }
 
-// registerClientNodes описывает граф узлов lifecycle.Manager, их зависимости и процедуры
-// запуска/остановки. Важные моменты порядка:
+// registerAccountNodes описывает поддерево аккаунта acc. Корень поддерева (узел с именем аккаунта)
+// запускает MTProto‑клиент и выполняет логин; его контекст — контекст работающего клиента, поэтому
+// обрыв клиента гасит всё поддерево. Важные моменты порядка:
 //   - connection_manager должен стартовать до status_manager и очередей, т.к. им нужен живой клиент;
 //   - notifications_queue и domain_handlers зависят от соединения, чтобы гарантировать доставку;
-//   - updates_manager стартует после status_manager, чтобы иметь возможность перейти online в OnStart;
-//   - CLI запускается отдельно и не блокирует основной цикл.
-func (r *Runner) registerClientNodes(
-	_ context.Context,
-	lc *lifecycle.Manager,
-	updmgr *tgupdates.Manager,
-	selfID int64,
-) error {
-	if r.peers != nil {
+//   - updates_manager стартует после status_manager, чтобы иметь возможность перейти online в OnStart.
+func (r *Runner) registerAccountNodes(lc *lifecycle.Manager, acc *account) error {
+	name := acc.cfg.Name
+	var selfID int64
+
+	var (
+		clientCancel context.CancelFunc
+		clientWG     sync.WaitGroup
+		stopping     atomic.Bool
+	)
+	clientStart := func(context.Context) (context.Context, error) {
+		// Отдельный контекст MTProto‑движка: он гасится только в stop узла, после всего поддерева.
+		clientCtx, cancel := context.WithCancel(context.Background())
+		clientCancel = cancel
+		ready := make(chan context.Context, 1)
+		runErr := make(chan error, 1)
+		clientWG.Go(func() {
+			runErr <- acc.cl.Client.Run(clientCtx, func(ctx context.Context) error {
+				logger.Infof("Account %s: userbot running...", name)
+
+				self, loginErr := r.loginSelf(ctx, acc)
+				if loginErr != nil {
+					return loginErr
+				}
+				if err := r.initPeersIfNeeded(ctx, acc); err != nil {
+					return err
+				}
+				selfID = self.ID
+
+				ready <- ctx
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		})
+
+		select {
+		case runCtx := <-ready:
+			// Клиент, завершившийся не по shutdown, останавливает процесс.
+			clientWG.Go(func() {
+				err := <-runErr
+				if stopping.Load() {
+					return
+				}
+				logger.Errorf("account %s: client stopped: %v", name, err)
+				r.fail(fmt.Errorf("account %s: %w", name, err))
+				r.stop()
+			})
+			return runCtx, nil
+		case err := <-runErr:
+			cancel()
+			return nil, fmt.Errorf("account %s: %w", name, err)
+		case <-r.ctx.Done():
+			cancel()
+			clientWG.Wait()
+			return nil, r.ctx.Err()
+		}
+	}
+	clientStop := func(context.Context) error {
+		stopping.Store(true)
+		clientCancel()
+		clientWG.Wait()
+		return nil
+	}
+
+	// Узел: <аккаунт>
+	// MTProto‑клиент аккаунта: логин, прогрев пиров, работающий движок. Родитель всех узлов аккаунта.
+	if err := lc.Register(name, "", nil, clientStart, clientStop); err != nil {
+		return err
+	}
+
+	if acc.peers != nil {
 		if err := lc.Register(
-			"peers_manager",
-			"",
+			acc.node("peers_manager"),
+			name,
 			nil,
 			func(nodeCtx context.Context) (context.Context, error) {
 				return nodeCtx, nil
 			},
 			func(context.Context) error {
-				return r.peers.Close()
+				return acc.peers.Close()
 			},
 		); err != nil {
 			return err
@@ -240,18 +339,17 @@ func (r *Runner) registerClientNodes(
 	}
 
 	// Узел: connection_manager
-	// Инициализирует и публикует текущее соединение/контекст клиента для других подсистем.
-	// Без зависимостей, так как сам предоставляет базовую инфраструктуру.
+	// Отслеживает соединение клиента аккаунта и публикует его состояние для других подсистем.
 	if err := lc.Register(
-		"connection_manager",
-		"",
+		acc.node("connection_manager"),
+		name,
 		nil,
 		func(nodeCtx context.Context) (context.Context, error) {
-			connection.Init(nodeCtx, r.cl.Client)
+			acc.conn.Start(nodeCtx)
 			return nodeCtx, nil
 		},
 		func(context.Context) error {
-			connection.Shutdown()
+			acc.conn.Shutdown()
 			return nil
 		},
 	); err != nil {
@@ -262,33 +360,67 @@ func (r *Runner) registerClientNodes(
 	// Управляет статусами аккаунта (online/offline/typing). Зависит от connection_manager,
 	// поскольку отправляет методы, требующие живого API и корректного контекста соединения.
 	if err := lc.Register(
-		"status_manager",
-		"connection_manager",
+		acc.node("status_manager"),
+		acc.node("connection_manager"),
 		nil,
 		func(nodeCtx context.Context) (context.Context, error) {
-			status.Init(nodeCtx, r.cl.API)
+			acc.presence.Start(nodeCtx)
 			return nodeCtx, nil
 		},
 		func(context.Context) error {
-			status.Shutdown()
+			acc.presence.Shutdown()
 			return nil
 		},
 	); err != nil {
 		return err
 	}
 
-	// Узел: deduplicator
-	// Глобальный фильтр повторов. Не зависит от соединения, но должен жить пока обрабатываем апдейты.
+	// Узел: cache_store
+	// bbolt-база кэшей идемпотентности. Закрывается последней среди потребителей (dedup, handlers).
 	if err := lc.Register(
-		"deduplicator",
-		"",
+		acc.node("cache_store"),
+		name,
 		nil,
 		func(nodeCtx context.Context) (context.Context, error) {
-			r.dedup.Start(nodeCtx)
 			return nodeCtx, nil
 		},
 		func(context.Context) error {
-			r.dedup.Stop()
+			return acc.cache.Close()
+		},
+	); err != nil {
+		return err
+	}
+
+	// Узел: archive_store
+	// bbolt-база архива совпавших сообщений и её очистка по сроку хранения. Закрывается после
+	// всех, кто пишет в архив или ищет по нему (handlers, bot_updates, cli).
+	if err := lc.Register(
+		acc.node("archive_store"),
+		name,
+		nil,
+		func(nodeCtx context.Context) (context.Context, error) {
+			acc.archive.Start(nodeCtx)
+			return nodeCtx, nil
+		},
+		func(context.Context) error {
+			return acc.archive.Close()
+		},
+	); err != nil {
+		return err
+	}
+
+	// Узел: deduplicator
+	// Фильтр повторов аккаунта. Не зависит от соединения, но должен жить пока обрабатываем апдейты.
+	if err := lc.Register(
+		acc.node("deduplicator"),
+		name,
+		[]string{acc.node("cache_store")},
+		func(nodeCtx context.Context) (context.Context, error) {
+			acc.dupCache.Start(nodeCtx)
+			return nodeCtx, nil
+		},
+		func(context.Context) error {
+			acc.dupCache.Stop()
 			return nil
 		},
 	); err != nil {
@@ -298,15 +430,15 @@ func (r *Runner) registerClientNodes(
 	// Узел: debouncer
 	// Сглаживание всплесков событий (например, батчи typing/online). Похож по жизненному циклу на deduplicator.
 	if err := lc.Register(
-		"debouncer",
-		"",
+		acc.node("debouncer"),
+		name,
 		nil,
 		func(nodeCtx context.Context) (context.Context, error) {
-			r.deb.Start(nodeCtx)
+			acc.debouncer.Start(nodeCtx)
 			return nodeCtx, nil
 		},
 		func(context.Context) error {
-			r.deb.Stop()
+			acc.debouncer.Stop()
 			return nil
 		},
 	); err != nil {
@@ -315,20 +447,21 @@ func (r *Runner) registerClientNodes(
 
 	// Узел: notifications_queue
 	// Асинхронная доставка сообщений (админу/сервисам). Зависит от соединения, чтобы иметь возможность
-	// отправить накопленное перед выключением. На остановке ждёт до queueShutdownTimeout.
+	// отправить накопленное перед выключением, и от общих транспортов. На остановке ждёт до
+	// queueShutdownTimeout.
 	const queueShutdownTimeout = 15 * time.Second
 	if err := lc.Register(
-		"notifications_queue",
-		"connection_manager",
-		nil,
+		acc.node("notifications_queue"),
+		acc.node("connection_manager"),
+		[]string{"notify_transports"},
 		func(nodeCtx context.Context) (context.Context, error) {
-			r.notif.Start(nodeCtx)
+			acc.notif.Start(nodeCtx)
 			return nodeCtx, nil
 		},
 		func(context.Context) error {
 			shutdownCtx, cancel := context.WithTimeout(context.Background(), queueShutdownTimeout)
 			defer cancel()
-			return r.notif.Close(shutdownCtx)
+			return acc.notif.Close(shutdownCtx)
 		},
 	); err != nil {
 		return err
@@ -338,18 +471,20 @@ func (r *Runner) registerClientNodes(
 	// Композиция бизнес‑обработчиков апдейтов телеграма. Запускается после очереди нотификаций,
 	// а также после инфраструктурных фильтров (dedup/debounce). При остановке аккуратно гасится.
 	if err := lc.Register(
-		"domain_handlers",
-		"notifications_queue",
-		[]string{"deduplicator", "debouncer"},
+		acc.node("domain_handlers"),
+		acc.node("notifications_queue"),
+		[]string{acc.node("deduplicator"), acc.node("debouncer"), acc.node("cache_store"), acc.node("archive_store")},
 		func(nodeCtx context.Context) (context.Context, error) {
-			if r.h != nil {
-				r.h.Start(nodeCtx, CleanPeriodHours*time.Hour)
+			if acc.handlers != nil {
+				// ID аккаунта нужен каналу команд из «Избранного».
+				acc.handlers.SetSelfID(selfID)
+				acc.handlers.Start(nodeCtx, CleanPeriodHours*time.Hour)
 			}
 			return nodeCtx, nil
 		},
 		func(context.Context) error {
-			if r.h != nil {
-				r.h.Stop()
+			if acc.handlers != nil {
+				acc.handlers.Stop()
 			}
 			return nil
 		},
@@ -357,65 +492,60 @@ func (r *Runner) registerClientNodes(
 		return err
 	}
 
+	// Узел: backfill
+	// Задания прогона истории через фильтры. Читает историю через соединение и ставит совпадения
+	// в очередь через доменные обработчики, поэтому живёт внутри notifications_queue и
+	// останавливается раньше handlers. Прерванное задание продолжится после рестарта.
+	if err := lc.Register(
+		acc.node("backfill"),
+		acc.node("notifications_queue"),
+		[]string{acc.node("domain_handlers")},
+		func(nodeCtx context.Context) (context.Context, error) {
+			acc.backfill.Start(nodeCtx)
+			return nodeCtx, nil
+		},
+		func(context.Context) error {
+			acc.backfill.Stop()
+			return nil
+		},
+	); err != nil {
+		return err
+	}
+
 	var updatesWG sync.WaitGroup
 	updatesStart := func(nodeCtx context.Context) (context.Context, error) {
 		// Узел: updates_manager (старт)
-		// Запускаем updates.Manager из gotd. Передаём OnStart хук, который переводит систему в online
+		// Запускаем updates.Manager из gotd. Передаём OnStart хук, который переводит аккаунт в online
 		// и выполняет прогрев/уведомления. Ошибки, отличные от context.Canceled, логируем.
 		// После завершения менеджера (по ошибке или отмене) инициируем общий shutdown через r.stop().
 		updatesWG.Go(func() {
-			logger.Debug("updates_manager node: Run started")
-			mgrErr := updmgr.Run(nodeCtx, r.cl.API, selfID, tgupdates.AuthOptions{
+			logger.Debugf("%s node: Run started", acc.node("updates_manager"))
+			mgrErr := acc.updMgr.Run(nodeCtx, acc.cl.API, selfID, tgupdates.AuthOptions{
 				Forget:  false,
-				OnStart: r.handleUpdatesManagerStart,
+				OnStart: r.handleUpdatesManagerStart(acc),
 			})
 			if mgrErr != nil && !errors.Is(mgrErr, context.Canceled) {
-				logger.Errorf("updmgr.Run return: %v", mgrErr)
+				logger.Errorf("account %s: updmgr.Run return: %v", name, mgrErr)
 			}
-			logger.Debugf("updates_manager node: Run finished (err=%v)", mgrErr)
+			logger.Debugf("%s node: Run finished (err=%v)", acc.node("updates_manager"), mgrErr)
 			// По завершении обновлений инициируем общий shutdown.
 			r.stop()
 		})
 		return nodeCtx, nil
 	}
 	updatesStop := func(context.Context) error {
-		// logger.Debug("updates_manager node: waiting for goroutine to finish")
 		updatesWG.Wait()
-		// logger.Debug("updates_manager node: stopped")
 		return nil
 	}
 
 	// Узел: updates_manager
 	// Источник событий Telegram. Должен стартовать, когда уже готовы статус и очередь, чтобы
 	// корректно обрабатывать online и исходящие.
-	if err := lc.Register(
-		"updates_manager",
-		"notifications_queue",
-		[]string{"status_manager"},
+	return lc.Register(
+		acc.node("updates_manager"),
+		acc.node("notifications_queue"),
+		[]string{acc.node("status_manager")},
 		updatesStart,
 		updatesStop,
-	); err != nil {
-		return err
-	}
-
-	// Узел: cli
-	// Сервис интерактивных команд. Не блокирует основную петлю, но может инициировать shutdown через r.stop().
-	cliService := cli.NewService(r.cl, r.stop, r.filters, r.notif, r.peers)
-	if err := lc.Register(
-		"cli",
-		"",
-		nil,
-		func(nodeCtx context.Context) (context.Context, error) {
-			cliService.Start(nodeCtx)
-			return nodeCtx, nil
-		},
-		func(context.Context) error {
-			cliService.Stop()
-			return nil
-		},
-	); err != nil {
-		return err
-	}
-
-	return nil
+	)
 }
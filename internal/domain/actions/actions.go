@@ -0,0 +1,275 @@
+// Package actions исполняет автоматические действия фильтров (filters.Action) над
+// совпавшими сообщениями: ответ, реакция, пересылка в архив, «Избранное», закрепление,
+// отметка прочитанным и отключение уведомлений чата.
+//
+// Ключевые свойства:
+//   - действия одного сообщения выполняются последовательно в фоне и не задерживают
+//     обработку апдейтов (ответ может ждать Delay);
+//   - сетевые вызовы делает Performer — MTProto-клиент с общим троттлером уведомлений;
+//   - у каждого действия детерминированный ключ идемпотентности: выполненные ключи хранятся
+//     в bbolt-бакете, а random_id отправок выводится из ключа, поэтому повтор после
+//     рестарта или ретрая не дублирует действие;
+//   - каждое действие (выполненное, пропущенное, проваленное, пробное) пишется в журнал аудита;
+//   - dry-run (глобально ACTIONS_DRY_RUN или dry_run у действия) только пишет журнал.
+package actions
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/domain/tgutil"
+	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
+
+	"github.com/gotd/td/tg"
+)
+
+// Параметры журнала выполненных действий: срок хранения ключей и предельный размер бакета.
+const (
+	doneTTL        = 7 * 24 * time.Hour
+	doneMaxEntries = 50000
+)
+
+// Task — одно действие над конкретным сообщением.
+//   - Key — ключ идемпотентности (источник, сообщение, фильтр, позиция и тип действия);
+//   - MessageIDs — сообщение (все части альбома); первое — представитель для ответа и реакции;
+//   - Text — готовый текст ответа (reply), Target — получатель пересылки (forward_to),
+//     Until — срок отключения уведомлений (mute_chat, нулевой — навсегда).
+type Task struct {
+	Key        string
+	FilterID   string
+	Action     filters.Action
+	Peer       notifications.Recipient
+	MessageID  int
+	MessageIDs []int
+	Text       string
+	Target     notifications.Recipient
+	Until      time.Time
+}
+
+// RandomID возвращает детерминированный random_id i-го отправления задачи: Telegram
+// отбрасывает повтор с тем же random_id, поэтому ретрай не создаёт дубль.
+func (t Task) RandomID(i int) int64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(t.Key))
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(i)) // #nosec G115
+	_, _ = hasher.Write(buf[:])
+	// Требование Telegram: random_id ∈ [1, 2^63-1].
+	if value := int64(hasher.Sum64() & (1<<63 - 1)); value != 0 { // #nosec G115
+		return value
+	}
+	return 1
+}
+
+// Performer выполняет действие через Telegram. Ошибка означает, что действие не выполнено.
+type Performer interface {
+	Perform(ctx context.Context, task Task) error
+}
+
+// RecipientResolver ищет получателя из recipients.json по ID (цель forward_to).
+type RecipientResolver interface {
+	RecipientByID(id filters.RecipientID) (filters.Recipient, bool)
+}
+
+// Service планирует и исполняет действия фильтров.
+type Service struct {
+	performer  Performer
+	recipients RecipientResolver
+	done       *storage.TTLBucket
+	audit      *auditLog
+	dryRun     bool
+
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewService создаёт исполнитель действий. Журнал выполненных ключей хранится в бакете
+// "actions" базы cache, журнал аудита — в файле auditFile (JSON Lines).
+func NewService(
+	performer Performer,
+	recipients RecipientResolver,
+	cache *storage.TTLDB,
+	auditFile string,
+	dryRun bool,
+) (*Service, error) {
+	done, err := cache.Bucket("actions", doneMaxEntries)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		performer:  performer,
+		recipients: recipients,
+		done:       done,
+		audit:      &auditLog{path: auditFile},
+		dryRun:     dryRun,
+	}, nil
+}
+
+// Start разрешает исполнение действий и запускает очистку журнала выполненных ключей.
+func (s *Service) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	runCtx := s.ctx
+	s.wg.Go(func() { s.runCleaner(runCtx) })
+}
+
+// Stop прерывает ожидающие действия и дожидается завершения фоновых горутин.
+func (s *Service) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Run планирует действия всех совпавших фильтров для сообщения msg; messageIDs — само
+// сообщение или все части альбома. Действия выполняются в фоне в порядке фильтров и
+// порядке действий внутри фильтра.
+func (s *Service) Run(msg *tg.Message, messageIDs []int, results []filters.FilterMatchResult) {
+	if msg == nil {
+		return
+	}
+	tasks := s.plan(msg, messageIDs, results)
+	if len(tasks) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil || s.ctx.Err() != nil {
+		logger.Warnf("Actions: service is not running, %d action(s) for message %d dropped", len(tasks), msg.ID)
+		return
+	}
+	ctx := s.ctx
+	s.wg.Go(func() {
+		for _, task := range tasks {
+			s.execute(ctx, task)
+		}
+	})
+}
+
+// plan строит задачи для совпавших фильтров. Действие forward_to с неизвестным получателем
+// (справочник перечитан после загрузки фильтров) сразу пишется в аудит как failed.
+func (s *Service) plan(msg *tg.Message, messageIDs []int, results []filters.FilterMatchResult) []Task {
+	peer := notifications.Recipient{Type: tgutil.GetPeerKind(msg.PeerID), ID: tgutil.GetPeerID(msg.PeerID)}
+	if len(messageIDs) == 0 {
+		messageIDs = []int{msg.ID}
+	}
+	var tasks []Task
+	for _, res := range results {
+		for i, action := range res.Filter.Actions {
+			task := Task{
+				Key:        fmt.Sprintf("%s:%d:%d:%s:%d:%s", peer.Type, peer.ID, msg.ID, res.Filter.ID, i, action.Type),
+				FilterID:   res.Filter.ID,
+				Action:     action,
+				Peer:       peer,
+				MessageID:  msg.ID,
+				MessageIDs: slices.Clone(messageIDs),
+			}
+			switch action.Type {
+			case filters.ActionReply:
+				task.Text = renderReply(action.Text, res)
+			case filters.ActionForwardTo:
+				target, ok := s.recipients.RecipientByID(filters.RecipientID(action.To))
+				if !ok {
+					// Настроенное действие не выполнится: это должно остаться в журнале аудита.
+					s.record(task, statusFailed, fmt.Errorf("unknown forward_to recipient %q", action.To))
+					continue
+				}
+				task.Target = notifications.Recipient{Type: string(target.Type), ID: int64(target.PeerID)}
+			case filters.ActionMuteChat:
+				if action.ForDuration > 0 {
+					task.Until = time.Now().Add(action.ForDuration)
+				}
+			}
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// execute выполняет задачу с учётом идемпотентности, задержки и dry-run и пишет журнал аудита.
+func (s *Service) execute(ctx context.Context, task Task) {
+	key := []byte(task.Key)
+	if done, err := s.done.Has(key); err != nil {
+		logger.Errorf("Actions: ledger lookup for %s failed: %v", task.Key, err)
+	} else if done {
+		s.record(task, statusDuplicate, nil)
+		return
+	}
+	if s.dryRun || task.Action.DryRun {
+		s.record(task, statusDryRun, nil)
+		return
+	}
+	if task.Action.DelayDuration > 0 {
+		select {
+		case <-ctx.Done():
+			s.record(task, statusFailed, ctx.Err())
+			return
+		case <-time.After(task.Action.DelayDuration):
+		}
+	}
+	if err := s.performer.Perform(ctx, task); err != nil {
+		s.record(task, statusFailed, err)
+		return
+	}
+	if err := s.done.Put(key, doneTTL); err != nil {
+		logger.Errorf("Actions: ledger write for %s failed: %v", task.Key, err)
+	}
+	s.record(task, statusDone, nil)
+}
+
+// record пишет результат действия в лог и журнал аудита.
+func (s *Service) record(task Task, status string, err error) {
+	if err != nil {
+		logger.Errorf("Actions: %s by filter %s on %s:%d/%d failed: %v",
+			task.Action.Type, task.FilterID, task.Peer.Type, task.Peer.ID, task.MessageID, err)
+	} else {
+		logger.Infof("Actions: %s by filter %s on %s:%d/%d: %s",
+			task.Action.Type, task.FilterID, task.Peer.Type, task.Peer.ID, task.MessageID, status)
+	}
+	s.audit.append(newAuditRecord(task, status, err))
+}
+
+// runCleaner раз в час удаляет просроченные ключи выполненных действий.
+func (s *Service) runCleaner(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed, err := s.done.Cleanup(); err != nil {
+				logger.Errorf("Actions: ledger cleanup failed: %v", err)
+			} else if removed > 0 {
+				logger.Debugf("Actions: ledger cleanup removed %d entries", removed)
+			}
+		}
+	}
+}
+
+// renderReply подставляет в шаблон ответа плейсхолдеры {{filter}} и {{terms}}.
+func renderReply(tmpl string, res filters.FilterMatchResult) string {
+	return strings.NewReplacer(
+		"{{filter}}", res.Filter.ID,
+		"{{terms}}", strings.Join(res.Result.MatchedNode.Terms(), ", "),
+	).Replace(tmpl)
+}
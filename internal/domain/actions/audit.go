@@ -0,0 +1,86 @@
+// Package actions / файл audit.go — журнал аудита автоматических действий.
+// Каждая запись — одна строка JSON (JSON Lines) в файле ACTIONS_AUDIT_FILE: файл только
+// дописывается, поэтому его удобно читать tail/jq и ротировать внешними средствами.
+
+package actions
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
+)
+
+// Итоги действия в журнале аудита.
+const (
+	statusDone      = "done"      // действие выполнено
+	statusDryRun    = "dry_run"   // пробный режим: действие только записано
+	statusDuplicate = "duplicate" // ключ уже выполнен ранее, повтор пропущен
+	statusFailed    = "failed"    // выполнить не удалось
+)
+
+// auditRecord — строка журнала аудита.
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Key       string    `json:"key"`
+	Filter    string    `json:"filter"`
+	Action    string    `json:"action"`
+	Peer      string    `json:"peer"`
+	PeerID    int64     `json:"peer_id"`
+	MessageID int       `json:"message_id"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// newAuditRecord описывает итог задачи task.
+func newAuditRecord(task Task, status string, err error) auditRecord {
+	rec := auditRecord{
+		Time:      time.Now().UTC(),
+		Key:       task.Key,
+		Filter:    task.FilterID,
+		Action:    task.Action.Type,
+		Peer:      task.Peer.Type,
+		PeerID:    task.Peer.ID,
+		MessageID: task.MessageID,
+		Status:    status,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	return rec
+}
+
+// auditLog дописывает записи в файл path. Ошибки записи только логируются:
+// недоступный журнал не должен останавливать действия.
+type auditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// append дописывает запись в конец журнала.
+func (l *auditLog) append(rec auditRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		logger.Errorf("Actions: audit encode failed: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err = storage.EnsureDir(l.path); err != nil {
+		logger.Errorf("Actions: audit dir: %v", err)
+		return
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		logger.Errorf("Actions: open audit log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		logger.Errorf("Actions: write audit log: %v", err)
+	}
+}
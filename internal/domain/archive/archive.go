@@ -0,0 +1,388 @@
+// Package archive — локальный архив совпавших сообщений с полнотекстовым поиском.
+//
+// Каждое сообщение, совпавшее хотя бы с одним фильтром, сохраняется в отдельную bbolt-базу:
+// текст с форматированием, отправитель, чат, дата, ID сработавших фильтров и ссылка.
+// Устройство базы:
+//   - messages — записи Record в JSON по возрастающему порядковому ID (порядок архивации);
+//   - by_msg — ключ сообщения "<тип>:<id чата>:<id сообщения>" → ID записи: правка или
+//     повторное совпадение обновляют запись, а не плодят дубли;
+//   - index — инвертированный индекс "<токен>\x00<ID записи>" → пусто; поиск по префиксу
+//     токена находит и словоформы ("заказ" → "заказы", "заказчик").
+//
+// Записи старше срока хранения (ARCHIVE_RETENTION_DAYS, 0 — бессрочно) удаляются раз в час.
+package archive
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/domain/tgutil"
+	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
+	"telegram-userbot/internal/infra/telegram/peersmgr"
+
+	"github.com/gotd/td/tg"
+	"go.etcd.io/bbolt"
+)
+
+// Имена бакетов базы архива.
+var (
+	bucketMessages = []byte("messages")
+	bucketByMsg    = []byte("by_msg")
+	bucketIndex    = []byte("index")
+)
+
+// Параметры базы: ожидание файловой блокировки и период очистки по сроку хранения.
+const (
+	openTimeout     = time.Second
+	cleanupInterval = time.Hour
+)
+
+// Record — заархивированное сообщение.
+//   - ChatType/ChatID — источник ("user", "chat", "channel"), ChatTitle — его название;
+//   - MessageIDs — все части альбома (первая — MessageID);
+//   - Entities — форматирование текста в формате Bot API;
+//   - Filters — ID сработавших фильтров (накапливаются при повторных совпадениях);
+//   - ArchivedAt — момент первой архивации, по нему считается срок хранения.
+type Record struct {
+	ID         uint64                     `json:"id"`
+	ChatType   string                     `json:"chat_type"`
+	ChatID     int64                      `json:"chat_id"`
+	ChatTitle  string                     `json:"chat_title,omitempty"`
+	MessageID  int                        `json:"message_id"`
+	MessageIDs []int                      `json:"message_ids,omitempty"`
+	SenderID   int64                      `json:"sender_id,omitempty"`
+	SenderName string                     `json:"sender_name,omitempty"`
+	Date       time.Time                  `json:"date"`
+	EditDate   time.Time                  `json:"edit_date,omitzero"`
+	Text       string                     `json:"text"`
+	Entities   []notifications.CopyEntity `json:"entities,omitempty"`
+	Filters    []string                   `json:"filters"`
+	Link       string                     `json:"link,omitempty"`
+	ArchivedAt time.Time                  `json:"archived_at"`
+}
+
+// Query — условия поиска. Пустые поля не ограничивают выборку.
+//   - Text — слова запроса; запись должна содержать все слова (как префиксы токенов);
+//   - Chat — ID чата-источника, Filter — ID фильтра, Since — нижняя граница даты сообщения;
+//   - Limit — максимум записей (0 — без ограничения).
+type Query struct {
+	Text   string
+	Chat   int64
+	Filter string
+	Since  time.Time
+	Limit  int
+}
+
+// Archive — база архива. Потокобезопасен: сериализацию записей обеспечивает bbolt.
+type Archive struct {
+	db        *bbolt.DB
+	peers     *peersmgr.Service
+	retention time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Open открывает (или создаёт) базу архива по пути path. retention — срок хранения
+// записей (0 — бессрочно); peers нужен для построения ссылок на сообщения.
+func Open(path string, retention time.Duration, peers *peersmgr.Service) (*Archive, error) {
+	path = filepath.Clean(strings.TrimSpace(path))
+	if path == "" || path == "." {
+		return nil, errors.New("archive: db path is empty")
+	}
+	if err := storage.EnsureDir(path); err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("archive: open %q: %w", path, err)
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{bucketMessages, bucketByMsg, bucketIndex} {
+			if _, errCreate := tx.CreateBucketIfNotExists(name); errCreate != nil {
+				return errCreate
+			}
+		}
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("archive: create buckets: %w", err)
+	}
+	return &Archive{db: db, peers: peers, retention: retention}, nil
+}
+
+// Start запускает фоновую очистку записей старше срока хранения. Повторный вызов игнорируется.
+func (a *Archive) Start(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil || a.retention <= 0 {
+		return
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	a.cancel = cancel
+	a.wg.Go(func() { a.runCleaner(runCtx) })
+}
+
+// Close останавливает очистку и закрывает базу. Повторный вызов безопасен.
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	cancel := a.cancel
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	a.wg.Wait()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.db == nil {
+		return nil
+	}
+	err := a.db.Close()
+	a.db = nil
+	return err
+}
+
+// Add архивирует сообщение msg, совпавшее с фильтрами results; messageIDs — все части
+// альбома (nil — только само сообщение). Уже заархивированное сообщение обновляется:
+// текст заменяется, а список фильтров дополняется.
+func (a *Archive) Add(
+	entities tg.Entities,
+	msg *tg.Message,
+	messageIDs []int,
+	results []filters.FilterMatchResult,
+) error {
+	if msg == nil || len(results) == 0 {
+		return nil
+	}
+	rec := a.newRecord(entities, msg, messageIDs, results)
+	msgKey := []byte(fmt.Sprintf("%s:%d:%d", rec.ChatType, rec.ChatID, rec.MessageID))
+
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		messages := tx.Bucket(bucketMessages)
+		byMsg := tx.Bucket(bucketByMsg)
+		index := tx.Bucket(bucketIndex)
+
+		if id := byMsg.Get(msgKey); id != nil {
+			var prev Record
+			if err := json.Unmarshal(messages.Get(id), &prev); err == nil {
+				if err := unindex(index, prev); err != nil {
+					return err
+				}
+				rec.ID = prev.ID
+				rec.ArchivedAt = prev.ArchivedAt
+				rec.Filters = mergeFilters(prev.Filters, rec.Filters)
+			}
+		}
+		if rec.ID == 0 {
+			seq, err := messages.NextSequence()
+			if err != nil {
+				return err
+			}
+			rec.ID = seq
+		}
+
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		id := encodeID(rec.ID)
+		if err := messages.Put(id, data); err != nil {
+			return err
+		}
+		if err := byMsg.Put(msgKey, id); err != nil {
+			return err
+		}
+		for _, token := range tokenize(rec.Text) {
+			if err := index.Put(indexKey(token, rec.ID), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Search возвращает записи, удовлетворяющие запросу q, новые первыми.
+func (a *Archive) Search(q Query) ([]Record, error) {
+	terms := tokenize(q.Text)
+	var out []Record
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		messages := tx.Bucket(bucketMessages)
+		if len(terms) == 0 {
+			// Без слов запроса — просмотр всего архива от новых записей к старым.
+			c := messages.Cursor()
+			for k, v := c.Last(); k != nil; k, v = c.Prev() {
+				if done := collect(&out, v, q); done {
+					break
+				}
+			}
+			return nil
+		}
+
+		ids := matchTerms(tx.Bucket(bucketIndex), terms)
+		slices.SortFunc(ids, func(x, y uint64) int { return cmp.Compare(y, x) })
+		for _, id := range ids {
+			if done := collect(&out, messages.Get(encodeID(id)), q); done {
+				break
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Cleanup удаляет записи, заархивированные раньше срока хранения. Возвращает число удалённых.
+func (a *Archive) Cleanup() (int, error) {
+	if a.retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-a.retention)
+	removed := 0
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		messages := tx.Bucket(bucketMessages)
+		byMsg := tx.Bucket(bucketByMsg)
+		index := tx.Bucket(bucketIndex)
+
+		// ID выдаются по порядку архивации, поэтому просроченные записи лежат в начале.
+		var stale []Record
+		c := messages.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var rec Record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				rec.ID = binary.BigEndian.Uint64(k)
+			} else if !rec.ArchivedAt.Before(cutoff) {
+				break
+			}
+			stale = append(stale, rec)
+		}
+		for _, rec := range stale {
+			if err := unindex(index, rec); err != nil {
+				return err
+			}
+			if rec.ChatType != "" {
+				msgKey := []byte(fmt.Sprintf("%s:%d:%d", rec.ChatType, rec.ChatID, rec.MessageID))
+				if err := byMsg.Delete(msgKey); err != nil {
+					return err
+				}
+			}
+			if err := messages.Delete(encodeID(rec.ID)); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return nil
+	})
+	return removed, err
+}
+
+// runCleaner периодически удаляет записи старше срока хранения.
+func (a *Archive) runCleaner(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed, err := a.Cleanup(); err != nil {
+				logger.Errorf("Archive: cleanup failed: %v", err)
+			} else if removed > 0 {
+				logger.Infof("Archive: cleanup removed %d record(s)", removed)
+			}
+		}
+	}
+}
+
+// newRecord собирает запись архива из сообщения и результатов фильтров.
+func (a *Archive) newRecord(
+	entities tg.Entities,
+	msg *tg.Message,
+	messageIDs []int,
+	results []filters.FilterMatchResult,
+) Record {
+	copyText := notifications.BuildCopyTextFromTG(msg)
+	rec := Record{
+		ChatType:   tgutil.GetPeerKind(msg.PeerID),
+		ChatID:     tgutil.GetPeerID(msg.PeerID),
+		ChatTitle:  tgutil.GetPeerTitle(entities, msg.PeerID),
+		MessageID:  msg.ID,
+		Date:       time.Unix(int64(msg.Date), 0).UTC(),
+		Text:       copyText.Text,
+		Entities:   copyText.Entities,
+		Link:       notifications.BuildMessageLink(a.peers, entities, msg),
+		ArchivedAt: time.Now().UTC(),
+	}
+	if len(messageIDs) > 1 {
+		rec.MessageIDs = slices.Clone(messageIDs)
+	}
+	if msg.EditDate > 0 {
+		rec.EditDate = time.Unix(int64(msg.EditDate), 0).UTC()
+	}
+	if from, ok := msg.GetFromID(); ok {
+		rec.SenderID = tgutil.GetPeerID(from)
+		rec.SenderName = tgutil.GetPeerTitle(entities, from)
+	} else if user, isUser := msg.PeerID.(*tg.PeerUser); isUser {
+		// В личке отправитель входящего сообщения — сам собеседник.
+		rec.SenderID = user.UserID
+		rec.SenderName = rec.ChatTitle
+	}
+	for _, res := range results {
+		rec.Filters = append(rec.Filters, res.Filter.ID)
+	}
+	return rec
+}
+
+// collect декодирует запись и добавляет её в out, если она подходит под фильтры запроса.
+// Возвращает true, когда набран Limit.
+func collect(out *[]Record, data []byte, q Query) bool {
+	if data == nil {
+		return false
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		logger.Warnf("Archive: skip broken record: %v", err)
+		return false
+	}
+	if q.Chat != 0 && rec.ChatID != q.Chat {
+		return false
+	}
+	if q.Filter != "" && !slices.Contains(rec.Filters, q.Filter) {
+		return false
+	}
+	if !q.Since.IsZero() && rec.Date.Before(q.Since) {
+		return false
+	}
+	*out = append(*out, rec)
+	return q.Limit > 0 && len(*out) >= q.Limit
+}
+
+// mergeFilters дополняет список фильтров prev новыми ID без повторов.
+func mergeFilters(prev, next []string) []string {
+	out := slices.Clone(prev)
+	for _, id := range next {
+		if !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// encodeID кодирует ID записи в 8 байт big-endian: порядок ключей совпадает с порядком ID.
+func encodeID(id uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, id)
+	return buf
+}
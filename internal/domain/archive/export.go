@@ -0,0 +1,98 @@
+// Package archive / файл export.go — выгрузка записей архива в JSON Lines и CSV.
+
+package archive
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-userbot/internal/infra/storage"
+)
+
+// Форматы выгрузки.
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// csvHeader — колонки CSV-выгрузки (форматирование текста в CSV не попадает).
+var csvHeader = []string{
+	"id", "date", "chat_type", "chat_id", "chat_title", "message_id",
+	"sender_id", "sender_name", "filters", "link", "text",
+}
+
+// FormatFromPath определяет формат выгрузки по расширению файла (.jsonl/.json или .csv).
+func FormatFromPath(path string) (string, error) {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".jsonl"), strings.HasSuffix(lower, ".json"):
+		return FormatJSONL, nil
+	case strings.HasSuffix(lower, ".csv"):
+		return FormatCSV, nil
+	default:
+		return "", fmt.Errorf("unknown export format of %q (use .jsonl or .csv)", path)
+	}
+}
+
+// ExportFile записывает записи в файл path в формате, определённом по расширению.
+// Файл заменяется атомарно.
+func ExportFile(path string, records []Record) error {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if err := Export(&b, format, records); err != nil {
+		return err
+	}
+	if err := storage.EnsureDir(path); err != nil {
+		return err
+	}
+	return storage.AtomicWriteFile(path, []byte(b.String()))
+}
+
+// Export пишет записи в w в формате format (FormatJSONL или FormatCSV).
+func Export(w io.Writer, format string, records []Record) error {
+	switch format {
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if err := cw.Write([]string{
+				strconv.FormatUint(rec.ID, 10),
+				rec.Date.Format(time.RFC3339),
+				rec.ChatType,
+				strconv.FormatInt(rec.ChatID, 10),
+				rec.ChatTitle,
+				strconv.Itoa(rec.MessageID),
+				strconv.FormatInt(rec.SenderID, 10),
+				rec.SenderName,
+				strings.Join(rec.Filters, ","),
+				rec.Link,
+				rec.Text,
+			}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
@@ -0,0 +1,107 @@
+// Package archive / файл index.go — полнотекстовый индекс архива.
+//
+// Токен — непрерывная последовательность букв и цифр в нижнем регистре (Unicode), не короче
+// minTokenRunes. Ключ индекса — токен, нулевой байт-разделитель и ID записи (8 байт), поэтому
+// все записи с токенами, начинающимися на слово запроса, лежат подряд и находятся
+// одним проходом курсора по префиксу.
+
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode"
+
+	"go.etcd.io/bbolt"
+)
+
+// Ограничения токенов: более короткие не индексируются, более длинные обрезаются.
+const (
+	minTokenRunes = 2
+	maxTokenBytes = 64
+)
+
+// tokenize разбивает текст на уникальные токены в нижнем регистре в порядке появления.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]struct{}, len(fields))
+	tokens := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if len([]rune(field)) < minTokenRunes {
+			continue
+		}
+		field = truncateToken(field)
+		if _, dup := seen[field]; dup {
+			continue
+		}
+		seen[field] = struct{}{}
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
+
+// truncateToken обрезает токен до maxTokenBytes по границе символа.
+func truncateToken(token string) string {
+	if len(token) <= maxTokenBytes {
+		return token
+	}
+	cut := 0
+	for i := range token {
+		if i > maxTokenBytes {
+			break
+		}
+		cut = i
+	}
+	return token[:cut]
+}
+
+// indexKey строит ключ индекса "<токен>\x00<ID записи>".
+func indexKey(token string, id uint64) []byte {
+	key := make([]byte, 0, len(token)+1+8)
+	key = append(key, token...)
+	key = append(key, 0)
+	return binary.BigEndian.AppendUint64(key, id)
+}
+
+// matchTerms возвращает ID записей, содержащих все термы (как префиксы токенов).
+func matchTerms(index *bbolt.Bucket, terms []string) []uint64 {
+	var matched map[uint64]struct{}
+	for _, term := range terms {
+		ids := make(map[uint64]struct{})
+		prefix := []byte(term)
+		c := index.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if len(k) < len(prefix)+1+8 {
+				continue
+			}
+			id := binary.BigEndian.Uint64(k[len(k)-8:])
+			if matched == nil {
+				ids[id] = struct{}{}
+			} else if _, ok := matched[id]; ok {
+				ids[id] = struct{}{}
+			}
+		}
+		matched = ids
+		if len(matched) == 0 {
+			return nil
+		}
+	}
+	out := make([]uint64, 0, len(matched))
+	for id := range matched {
+		out = append(out, id)
+	}
+	return out
+}
+
+// unindex удаляет токены записи rec из индекса.
+func unindex(index *bbolt.Bucket, rec Record) error {
+	for _, token := range tokenize(rec.Text) {
+		if err := index.Delete(indexKey(token, rec.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
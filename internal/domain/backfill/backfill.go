@@ -0,0 +1,561 @@
+// Package backfill прогоняет через фильтры историю отслеживаемых чатов: после добавления
+// чата в фильтр показывает, что уже было пропущено.
+//
+// Ключевые свойства:
+//   - история читается страницами messages.getHistory через общий троттлер (HistoryFetcher),
+//     от новых сообщений к старым, до лимита числа сообщений или нижней границы даты;
+//   - каждое сообщение обрабатывает Processor (обработчики апдейтов): совпадения идут
+//     обычным путём notified → очередь уведомлений, либо, в режиме отчёта, только
+//     записываются в JSONL-отчёт без уведомлений;
+//   - задания выполняются по одному в фоне; прогресс (offset_id и счётчики) сохраняется
+//     в файл состояния после каждой страницы, поэтому прерванный backfill продолжается
+//     после рестарта с последней сохранённой страницы;
+//   - те же задания восстанавливают пропуски в отслеживаемых чатах после долгого простоя,
+//     см. gap.go.
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
+	"telegram-userbot/internal/infra/telegram/peersmgr"
+
+	"github.com/gotd/td/tg"
+)
+
+// Состояния задания.
+const (
+	StatePending  = "pending"
+	StateRunning  = "running"
+	StateDone     = "done"
+	StateFailed   = "failed"
+	StateCanceled = "canceled"
+)
+
+// Параметры выполнения: размер страницы истории, лимит по умолчанию и число хранимых
+// завершённых заданий в файле состояния.
+const (
+	pageSize         = 100
+	DefaultLimit     = 100
+	keepFinishedJobs = 50
+	stateFileName    = "state.json"
+)
+
+// HistoryFetcher читает историю чата страницами (реализация — telegramnotifier.ClientSender).
+// Кроме обычных сообщений страницы возвращает nextOffset — наименьший ID на ней с учётом
+// служебных сообщений: страница из одних служебных не означает конец истории (0 — конец).
+type HistoryFetcher interface {
+	GetHistory(
+		ctx context.Context,
+		peer notifications.Recipient,
+		offsetID, limit int,
+	) (messages []*tg.Message, entities tg.Entities, nextOffset int, err error)
+}
+
+// Processor прогоняет сообщение истории через фильтры и возвращает новые совпадения;
+// report=true — без уведомлений и отметок notified (реализация — updates.Handlers).
+type Processor interface {
+	ProcessHistory(entities tg.Entities, msg *tg.Message, report bool) []filters.FilterMatchResult
+}
+
+// Request — запрос backfill: Target — ID фильтра (все его чаты) или числовой ID чата;
+// Limit — сколько последних сообщений просмотреть, Since — нижняя граница даты
+// (задаётся одно из двух), Report — режим отчёта без уведомлений.
+type Request struct {
+	Target string
+	Limit  int
+	Since  time.Time
+	Report bool
+}
+
+// Job — задание backfill одного чата и его прогресс. Для восстановления пропуска Gap —
+// причина (startup, too_long), MinID — последнее обработанное до пропуска сообщение.
+// ReportSize — размер отчёта на момент сохранения OffsetID: продолжение задания пишет с него.
+type Job struct {
+	ID         int                     `json:"id"`
+	Chat       notifications.Recipient `json:"chat"`
+	Filter     string                  `json:"filter,omitempty"`
+	Limit      int                     `json:"limit,omitempty"`
+	Since      time.Time               `json:"since,omitzero"`
+	Report     bool                    `json:"report,omitempty"`
+	ReportFile string                  `json:"report_file,omitempty"`
+	ReportSize int64                   `json:"report_size,omitempty"`
+	Gap        string                  `json:"gap,omitempty"`
+	MinID      int                     `json:"min_id,omitempty"`
+	State      string                  `json:"state"`
+	OffsetID   int                     `json:"offset_id,omitempty"`
+	Scanned    int                     `json:"scanned"`
+	Matched    int                     `json:"matched"`
+	Error      string                  `json:"error,omitempty"`
+	CreatedAt  time.Time               `json:"created_at"`
+	UpdatedAt  time.Time               `json:"updated_at"`
+}
+
+// Finished сообщает, завершено ли задание (успешно, с ошибкой или отменено).
+func (j Job) Finished() bool {
+	return j.State == StateDone || j.State == StateFailed || j.State == StateCanceled
+}
+
+// snapshot — содержимое файла состояния.
+type snapshot struct {
+	NextID int      `json:"next_id"`
+	Jobs   []*Job   `json:"jobs"`
+	Gaps   GapStats `json:"gaps"`
+}
+
+// Service — очередь заданий backfill.
+type Service struct {
+	fetcher HistoryFetcher
+	filters *filters.FilterEngine
+	peers   *peersmgr.Service
+	dir     string
+	gapMax  int
+
+	mu        sync.Mutex
+	processor Processor
+	jobs      []*Job
+	nextID    int
+	gapStats  GapStats
+	lastSeen  map[int64]seenChat
+	bootSeen  map[int64]seenChat
+	seenDirty bool
+	wake      chan struct{}
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// New создаёт сервис backfill с файлами в каталоге dir (состояние, отчёты, последние
+// обработанные сообщения) и загружает сохранённые задания. gapMax — предел сообщений
+// одного восстановления пропуска (0 — восстановление выключено). Processor задаётся
+// позже через SetProcessor.
+func New(
+	fetcher HistoryFetcher,
+	filterEngine *filters.FilterEngine,
+	peers *peersmgr.Service,
+	dir string,
+	gapMax int,
+) (*Service, error) {
+	s := &Service{
+		fetcher:  fetcher,
+		filters:  filterEngine,
+		peers:    peers,
+		dir:      dir,
+		gapMax:   gapMax,
+		nextID:   1,
+		lastSeen: make(map[int64]seenChat),
+		wake:     make(chan struct{}, 1),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.loadLastSeen(); err != nil {
+		return nil, err
+	}
+	s.bootSeen = maps.Clone(s.lastSeen)
+	return s, nil
+}
+
+// SetProcessor задаёт обработчик сообщений истории. До вызова задания не выполняются.
+func (s *Service) SetProcessor(p Processor) {
+	s.mu.Lock()
+	s.processor = p
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Start запускает выполнение заданий; прерванные в прошлый раз задания продолжаются.
+// Повторный вызов игнорируется.
+func (s *Service) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	resumed := 0
+	for _, job := range s.jobs {
+		if !job.Finished() {
+			job.State = StatePending
+			resumed++
+		}
+	}
+	if resumed > 0 {
+		logger.Infof("Backfill: resuming %d job(s)", resumed)
+	}
+	s.recoverStartupGapsLocked()
+	s.wg.Go(func() { s.run(runCtx) })
+	s.wg.Go(func() { s.flushLastSeenLoop(runCtx) })
+}
+
+// Stop прерывает текущее задание и дожидается фоновых горутин. Прогресс и последние
+// обработанные сообщения сохранены.
+func (s *Service) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+	s.flushLastSeen()
+}
+
+// Submit ставит задания backfill для чатов цели req.Target и возвращает их копии.
+// Чаты, для которых уже есть незавершённое задание, пропускаются.
+func (s *Service) Submit(ctx context.Context, req Request) ([]Job, error) {
+	if req.Limit > 0 && !req.Since.IsZero() {
+		return nil, errors.New("use either limit or since, not both")
+	}
+	if req.Limit <= 0 && req.Since.IsZero() {
+		req.Limit = DefaultLimit
+	}
+	chats, filterID, err := s.resolveTarget(ctx, req.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	now := time.Now().UTC()
+	var created []Job
+	for _, chat := range chats {
+		busy := slices.ContainsFunc(s.jobs, func(j *Job) bool { return j.Chat == chat && !j.Finished() })
+		if busy {
+			logger.Warnf("Backfill: %s:%d already has an unfinished job, skipped", chat.Type, chat.ID)
+			continue
+		}
+		job := &Job{
+			ID:        s.nextID,
+			Chat:      chat,
+			Filter:    filterID,
+			Limit:     req.Limit,
+			Since:     req.Since,
+			Report:    req.Report,
+			State:     StatePending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if req.Report {
+			job.ReportFile = filepath.Join(s.dir, fmt.Sprintf("report_%d.jsonl", job.ID))
+		}
+		s.nextID++
+		s.jobs = append(s.jobs, job)
+		created = append(created, *job)
+	}
+	err = s.persistLocked()
+	s.mu.Unlock()
+
+	if err != nil {
+		return created, fmt.Errorf("persist backfill state: %w", err)
+	}
+	s.notify()
+	return created, nil
+}
+
+// Jobs возвращает копии заданий в порядке создания.
+func (s *Service) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		out = append(out, *job)
+	}
+	return out
+}
+
+// Cancel отменяет незавершённое задание id; выполняемое останавливается после текущего
+// сообщения (проверка — перед каждым сообщением страницы).
+func (s *Service) Cancel(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := slices.IndexFunc(s.jobs, func(j *Job) bool { return j.ID == id })
+	if idx < 0 {
+		return fmt.Errorf("unknown backfill job %d", id)
+	}
+	job := s.jobs[idx]
+	if job.Finished() {
+		return fmt.Errorf("backfill job %d is already %s", id, job.State)
+	}
+	job.State = StateCanceled
+	job.UpdatedAt = time.Now().UTC()
+	return s.persistLocked()
+}
+
+// resolveTarget превращает цель в список чатов: ID фильтра — все чаты фильтра,
+// число — один чат, вид которого определяется по кэшу пиров.
+func (s *Service) resolveTarget(ctx context.Context, target string) ([]notifications.Recipient, string, error) {
+	var (
+		ids      []int64
+		filterID string
+	)
+	all := s.filters.GetFilters()
+	if idx := slices.IndexFunc(all, func(f filters.Filter) bool { return f.ID == target }); idx >= 0 {
+		ids, filterID = all[idx].Chats, target
+	} else if id, err := strconv.ParseInt(target, 10, 64); err == nil {
+		ids = []int64{id}
+	} else {
+		return nil, "", fmt.Errorf("%q is neither a filter ID nor a chat ID", target)
+	}
+
+	chats := make([]notifications.Recipient, 0, len(ids))
+	for _, id := range ids {
+		kind, ok, err := s.peers.KindByID(ctx, id)
+		if err != nil {
+			return nil, "", fmt.Errorf("resolve chat %d: %w", id, err)
+		}
+		if !ok {
+			return nil, "", fmt.Errorf("chat %d is unknown (not in dialogs or peers cache)", id)
+		}
+		chats = append(chats, notifications.Recipient{Type: string(kind), ID: id})
+	}
+	return chats, filterID, nil
+}
+
+// notify будит фоновую горутину.
+func (s *Service) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run выполняет задания по одному до отмены контекста.
+func (s *Service) run(ctx context.Context) {
+	for {
+		job, processor := s.nextJob()
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			}
+			continue
+		}
+		s.runJob(ctx, job, processor)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// nextJob выбирает первое ожидающее задание и помечает его выполняемым.
+func (s *Service) nextJob() (*Job, Processor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.processor == nil {
+		return nil, nil
+	}
+	for _, job := range s.jobs {
+		if job.State == StatePending {
+			job.State = StateRunning
+			job.UpdatedAt = time.Now().UTC()
+			if err := s.persistLocked(); err != nil {
+				logger.Errorf("Backfill: persist state failed: %v", err)
+			}
+			return job, s.processor
+		}
+	}
+	return nil, nil
+}
+
+// runJob читает историю чата задания страницами и обрабатывает сообщения.
+// После каждой страницы прогресс сохраняется в файл состояния.
+func (s *Service) runJob(ctx context.Context, job *Job, processor Processor) {
+	s.mu.Lock()
+	chat, limit, since, report := job.Chat, job.Limit, job.Since, job.Report
+	offsetID, scanned, minID, gap := job.OffsetID, job.Scanned, job.MinID, job.Gap != ""
+	reportFile, reportBytes, legacyReport := job.ReportFile, job.ReportSize, job.ReportSize == 0 && job.Matched > 0
+	s.mu.Unlock()
+	logger.Infof("Backfill: job %d for %s:%d started at offset %d", job.ID, chat.Type, chat.ID, offsetID)
+	if report && legacyReport {
+		// Задание сохранено до учёта размера отчёта: продолжаем с конца файла.
+		size, err := reportSize(reportFile)
+		if err != nil {
+			s.finish(job, StateFailed, fmt.Errorf("stat report: %w", err))
+			return
+		}
+		reportBytes = size
+	}
+
+	for {
+		size := pageSize
+		if limit > 0 {
+			size = min(pageSize, limit-scanned)
+		}
+		if size <= 0 {
+			s.finish(job, StateDone, nil)
+			return
+		}
+		messages, entities, nextOffset, err := s.fetcher.GetHistory(ctx, chat, offsetID, size)
+		if err != nil {
+			if ctx.Err() != nil {
+				// Остановка сервиса: задание продолжится после рестарта.
+				return
+			}
+			s.finish(job, StateFailed, err)
+			return
+		}
+
+		var (
+			lines    []reportLine
+			matched  int
+			reached  bool
+			canceled bool
+		)
+		for _, msg := range messages {
+			// Отмена проверяется перед каждым сообщением: после неё ничего не уведомляется.
+			if canceled = s.isCanceled(job); canceled {
+				break
+			}
+			if (!since.IsZero() && time.Unix(int64(msg.Date), 0).Before(since)) || msg.ID <= minID {
+				reached = true
+				break
+			}
+			fresh := processor.ProcessHistory(entities, msg, report)
+			if gap {
+				s.Observe(msg)
+			}
+			scanned++
+			offsetID = msg.ID
+			if len(fresh) > 0 {
+				matched++
+				if report {
+					lines = append(lines, s.newReportLine(entities, msg, fresh))
+				}
+			}
+		}
+		// Страница просмотрена целиком: следующая начинается ниже её последнего (в том числе
+		// служебного) сообщения. Граница MinID проверяется и по служебным сообщениям.
+		if !reached && !canceled && nextOffset > 0 {
+			offsetID = nextOffset
+			reached = nextOffset <= minID
+		}
+		if len(lines) > 0 {
+			// Отчёт пишется до сохранения прогресса, но с размера на прошлой странице:
+			// если сохранить прогресс не успели, повтор страницы перезапишет эти строки.
+			if reportBytes, err = appendReport(reportFile, reportBytes, lines); err != nil {
+				s.finish(job, StateFailed, fmt.Errorf("write report: %w", err))
+				return
+			}
+		}
+
+		if canceled := s.checkpoint(job, offsetID, scanned, matched, reportBytes); canceled {
+			logger.Infof("Backfill: job %d canceled after %d message(s)", job.ID, scanned)
+			return
+		}
+		if reached || nextOffset == 0 || (limit > 0 && scanned >= limit) {
+			s.finish(job, StateDone, nil)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// isCanceled сообщает, отменено ли задание.
+func (s *Service) isCanceled(job *Job) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return job.State == StateCanceled
+}
+
+// checkpoint сохраняет прогресс задания и размер его отчёта; возвращает true, если задание отменили.
+func (s *Service) checkpoint(job *Job, offsetID, scanned, matched int, reportBytes int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.OffsetID = offsetID
+	job.Scanned = scanned
+	job.Matched += matched
+	job.ReportSize = reportBytes
+	job.UpdatedAt = time.Now().UTC()
+	if err := s.persistLocked(); err != nil {
+		logger.Errorf("Backfill: persist state failed: %v", err)
+	}
+	return job.State == StateCanceled
+}
+
+// finish переводит задание в конечное состояние и сохраняет его.
+func (s *Service) finish(job *Job, state string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.State == StateCanceled {
+		return
+	}
+	job.State = state
+	job.UpdatedAt = time.Now().UTC()
+	if job.Gap != "" {
+		s.recordGapLocked(job, err)
+	}
+	if err != nil {
+		job.Error = err.Error()
+		logger.Errorf("Backfill: job %d for %s:%d failed: %v", job.ID, job.Chat.Type, job.Chat.ID, err)
+	} else {
+		logger.Infof("Backfill: job %d for %s:%d done: %d message(s) scanned, %d matched",
+			job.ID, job.Chat.Type, job.Chat.ID, job.Scanned, job.Matched)
+	}
+	if errPersist := s.persistLocked(); errPersist != nil {
+		logger.Errorf("Backfill: persist state failed: %v", errPersist)
+	}
+}
+
+// load читает файл состояния; отсутствие файла — пустой список заданий.
+func (s *Service) load() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, stateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read backfill state: %w", err)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("parse backfill state: %w", err)
+	}
+	s.jobs = snap.Jobs
+	s.nextID = max(snap.NextID, 1)
+	s.gapStats = snap.Gaps
+	return nil
+}
+
+// persistLocked атомарно записывает состояние, оставляя не больше keepFinishedJobs
+// завершённых заданий. Вызывается под s.mu.
+func (s *Service) persistLocked() error {
+	finished := 0
+	for _, job := range s.jobs {
+		if job.Finished() {
+			finished++
+		}
+	}
+	if drop := finished - keepFinishedJobs; drop > 0 {
+		s.jobs = slices.DeleteFunc(s.jobs, func(j *Job) bool {
+			if drop > 0 && j.Finished() {
+				drop--
+				return true
+			}
+			return false
+		})
+	}
+	data, err := json.MarshalIndent(snapshot{NextID: s.nextID, Jobs: s.jobs, Gaps: s.gapStats}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, stateFileName)
+	if err := storage.EnsureDir(path); err != nil {
+		return err
+	}
+	return storage.AtomicWriteFile(path, data)
+}
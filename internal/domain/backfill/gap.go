@@ -0,0 +1,239 @@
+// Package backfill / файл gap.go — восстановление пропусков в отслеживаемых чатах.
+//
+// Если процесс простоял дольше окна разницы Telegram, updates.Manager получает
+// channelDifferenceTooLong и пропущенные сообщения молча теряются. Поэтому:
+//   - для каждого отслеживаемого чата (FilterEngine.GetUniqueChats) запоминается ID
+//     последнего обработанного входящего сообщения (Observe); снимок сбрасывается в
+//     BACKFILL_DIR/last_seen.json раз в lastSeenFlushInterval и при остановке;
+//   - при старте для каждого такого чата ставится задание восстановления: история
+//     читается от новых сообщений к старым до сохранённого ID (но не больше gapMax);
+//   - то же задание ставится по сигналу updates.Manager о слишком длинной разнице канала;
+//   - сообщения идут через обработчики с дедупликацией и отметками notified, поэтому
+//     то, что успело прийти живыми апдейтами, повторно не уведомляется;
+//   - итоги попадают в лог и в счётчики GapStats (backfill status).
+
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/domain/tgutil"
+	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
+
+	"github.com/gotd/td/tg"
+)
+
+// Причины восстановления пропуска.
+const (
+	GapStartup = "startup"
+	GapTooLong = "too_long"
+)
+
+// Параметры снимка последних обработанных сообщений.
+const (
+	lastSeenFileName      = "last_seen.json"
+	lastSeenFlushInterval = 30 * time.Second
+)
+
+// seenChat — последнее обработанное входящее сообщение отслеживаемого чата.
+type seenChat struct {
+	Kind   string `json:"kind"`
+	LastID int    `json:"last_id"`
+}
+
+// GapStats — счётчики восстановления пропусков с момента создания файла состояния.
+type GapStats struct {
+	Runs      int       `json:"runs"`
+	Recovered int       `json:"recovered"`
+	Matched   int       `json:"matched"`
+	Truncated int       `json:"truncated"`
+	Failed    int       `json:"failed"`
+	LastAt    time.Time `json:"last_at,omitzero"`
+}
+
+// Observe запоминает сообщение как последнее обработанное в его чате, если чат отслеживается
+// фильтрами. Вызывается обработчиками для каждого нового входящего сообщения.
+func (s *Service) Observe(msg *tg.Message) {
+	if msg == nil || s.gapMax <= 0 {
+		return
+	}
+	peerID := tgutil.GetPeerID(msg.PeerID)
+	if !slices.Contains(s.filters.GetUniqueChats(), peerID) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, ok := s.lastSeen[peerID]; ok && prev.LastID >= msg.ID {
+		return
+	}
+	s.lastSeen[peerID] = seenChat{Kind: tgutil.GetPeerKind(msg.PeerID), LastID: msg.ID}
+	s.seenDirty = true
+}
+
+// RecoverChannel ставит восстановление пропуска канала channelID, для которого
+// updates.Manager не смог получить разницу. Неотслеживаемые каналы пропускаются.
+func (s *Service) RecoverChannel(channelID int64) {
+	if s.gapMax <= 0 {
+		return
+	}
+	if !slices.Contains(s.filters.GetUniqueChats(), channelID) {
+		logger.Debugf("Gap recovery: difference too long for channel %d, not watched", channelID)
+		return
+	}
+	logger.Warnf("Gap recovery: difference too long for channel %d, fetching history", channelID)
+	s.mu.Lock()
+	seen, ok := s.lastSeen[channelID]
+	if !ok {
+		// Последнее сообщение неизвестно: просматриваем до gapMax последних.
+		seen = seenChat{Kind: notifications.RecipientTypeChannel}
+	}
+	queued := s.enqueueGapLocked(channelID, seen, GapTooLong)
+	if queued {
+		if err := s.persistLocked(); err != nil {
+			logger.Errorf("Backfill: persist state failed: %v", err)
+		}
+	}
+	s.mu.Unlock()
+	if queued {
+		s.notify()
+	}
+}
+
+// Gaps возвращает счётчики восстановления пропусков.
+func (s *Service) Gaps() GapStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gapStats
+}
+
+// recoverStartupGapsLocked ставит восстановление для отслеживаемых чатов по снимку
+// последних сообщений, загруженному при создании сервиса: живые апдейты могут прийти
+// раньше Start и сдвинуть текущий снимок за пропуск. Вызывается под s.mu.
+func (s *Service) recoverStartupGapsLocked() {
+	if s.gapMax <= 0 || len(s.bootSeen) == 0 {
+		return
+	}
+	queued := 0
+	for _, id := range s.filters.GetUniqueChats() {
+		if chat, ok := s.bootSeen[id]; ok && s.enqueueGapLocked(id, chat, GapStartup) {
+			queued++
+		}
+	}
+	if queued == 0 {
+		return
+	}
+	if err := s.persistLocked(); err != nil {
+		logger.Errorf("Backfill: persist state failed: %v", err)
+	}
+	logger.Infof("Gap recovery: checking %d watched chat(s) for messages missed while offline", queued)
+}
+
+// enqueueGapLocked ставит задание восстановления чата id после сообщения seen.LastID.
+// Возвращает false, если у чата уже есть незавершённое задание. Вызывается под s.mu.
+func (s *Service) enqueueGapLocked(id int64, seen seenChat, reason string) bool {
+	chat := notifications.Recipient{Type: seen.Kind, ID: id}
+	if slices.ContainsFunc(s.jobs, func(j *Job) bool { return j.Chat == chat && !j.Finished() }) {
+		return false
+	}
+	now := time.Now().UTC()
+	s.jobs = append(s.jobs, &Job{
+		ID:        s.nextID,
+		Chat:      chat,
+		Limit:     s.gapMax,
+		Gap:       reason,
+		MinID:     seen.LastID,
+		State:     StatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	s.nextID++
+	return true
+}
+
+// recordGapLocked учитывает завершённое задание восстановления в счётчиках и логе.
+// Вызывается под s.mu.
+func (s *Service) recordGapLocked(job *Job, err error) {
+	st := &s.gapStats
+	st.Runs++
+	st.Recovered += job.Scanned
+	st.Matched += job.Matched
+	st.LastAt = time.Now().UTC()
+	if err != nil {
+		st.Failed++
+		return
+	}
+	if job.Scanned >= job.Limit {
+		st.Truncated++
+		logger.Warnf("Gap recovery: %s:%d missed more than %d message(s), older ones were skipped",
+			job.Chat.Type, job.Chat.ID, job.Limit)
+	}
+	if job.Scanned > 0 {
+		logger.Infof("Gap recovery: %s:%d recovered %d message(s) after msg %d (%s), %d matched",
+			job.Chat.Type, job.Chat.ID, job.Scanned, job.MinID, job.Gap, job.Matched)
+	}
+}
+
+// loadLastSeen читает снимок последних сообщений; отсутствие файла — пустой снимок.
+func (s *Service) loadLastSeen() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, lastSeenFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read last seen messages: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.lastSeen); err != nil {
+		return fmt.Errorf("parse last seen messages: %w", err)
+	}
+	return nil
+}
+
+// flushLastSeenLoop периодически сбрасывает снимок последних сообщений на диск.
+func (s *Service) flushLastSeenLoop(ctx context.Context) {
+	ticker := time.NewTicker(lastSeenFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flushLastSeen()
+		}
+	}
+}
+
+// flushLastSeen атомарно записывает снимок последних сообщений, если он изменился.
+func (s *Service) flushLastSeen() {
+	s.mu.Lock()
+	if !s.seenDirty {
+		s.mu.Unlock()
+		return
+	}
+	seen := maps.Clone(s.lastSeen)
+	s.seenDirty = false
+	s.mu.Unlock()
+
+	data, err := json.Marshal(seen)
+	if err == nil {
+		path := filepath.Join(s.dir, lastSeenFileName)
+		if err = storage.EnsureDir(path); err == nil {
+			err = storage.AtomicWriteFile(path, data)
+		}
+	}
+	if err != nil {
+		logger.Errorf("Gap recovery: persist last seen messages failed: %v", err)
+		s.mu.Lock()
+		s.seenDirty = true
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,96 @@
+// Package backfill / файл report.go — JSONL-отчёт режима report: одна строка на сообщение
+// истории, совпавшее хотя бы с одним фильтром. Уведомления в этом режиме не отправляются.
+
+package backfill
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/domain/tgutil"
+	"telegram-userbot/internal/infra/storage"
+
+	"github.com/gotd/td/tg"
+)
+
+// reportLine — строка отчёта backfill.
+type reportLine struct {
+	ChatType  string    `json:"chat_type"`
+	ChatID    int64     `json:"chat_id"`
+	ChatTitle string    `json:"chat_title,omitempty"`
+	MessageID int       `json:"message_id"`
+	Date      time.Time `json:"date"`
+	Filters   []string  `json:"filters"`
+	Link      string    `json:"link,omitempty"`
+	Text      string    `json:"text,omitempty"`
+}
+
+// newReportLine собирает строку отчёта из сообщения и совпавших фильтров.
+func (s *Service) newReportLine(entities tg.Entities, msg *tg.Message, results []filters.FilterMatchResult) reportLine {
+	line := reportLine{
+		ChatType:  tgutil.GetPeerKind(msg.PeerID),
+		ChatID:    tgutil.GetPeerID(msg.PeerID),
+		ChatTitle: tgutil.GetPeerTitle(entities, msg.PeerID),
+		MessageID: msg.ID,
+		Date:      time.Unix(int64(msg.Date), 0).UTC(),
+		Link:      notifications.BuildMessageLink(s.peers, entities, msg),
+		Text:      msg.Message,
+	}
+	for _, res := range results {
+		line.Filters = append(line.Filters, res.Filter.ID)
+	}
+	return line
+}
+
+// appendReport дописывает строки в файл отчёта path с позиции size — размера отчёта на
+// последней сохранённой странице — и возвращает новый размер. Строки, записанные после
+// неё (страница, прерванная до сохранения прогресса), отбрасываются: повторный проход
+// страницы после рестарта не дублирует их.
+func appendReport(path string, size int64, lines []reportLine) (int64, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return size, err
+		}
+	}
+	if err := storage.EnsureDir(path); err != nil {
+		return size, err
+	}
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return size, fmt.Errorf("open report: %w", err)
+	}
+	if err = f.Truncate(size); err != nil {
+		_ = f.Close()
+		return size, fmt.Errorf("truncate report: %w", err)
+	}
+	if _, err = f.WriteAt(buf.Bytes(), size); err != nil {
+		_ = f.Close()
+		return size, err
+	}
+	if err = f.Close(); err != nil {
+		return size, err
+	}
+	return size + int64(buf.Len()), nil
+}
+
+// reportSize возвращает текущий размер файла отчёта (0 — файла нет).
+func reportSize(path string) (int64, error) {
+	info, err := os.Stat(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
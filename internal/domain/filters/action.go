@@ -0,0 +1,87 @@
+// action.go описывает автоматические действия фильтра: что аккаунт делает с совпавшим
+// сообщением помимо уведомления (ответить, поставить реакцию, переслать в архив и т. п.).
+// Здесь только конфигурация и её валидация; исполнение — internal/domain/actions.
+package filters
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Типы автоматических действий фильтра.
+const (
+	ActionReply     = "reply"      // ответить на сообщение текстом из шаблона
+	ActionReact     = "react"      // поставить реакцию-эмодзи
+	ActionForwardTo = "forward_to" // переслать сообщение получателю (например, в архивный канал)
+	ActionSave      = "save"       // переслать сообщение в «Избранное»
+	ActionPin       = "pin"        // закрепить сообщение без уведомления участников
+	ActionMarkRead  = "mark_read"  // пометить чат прочитанным до сообщения
+	ActionMuteChat  = "mute_chat"  // отключить уведомления Telegram о чате
+)
+
+// Action — автоматическое действие при совпадении фильтра.
+//   - Text — шаблон ответа для reply: {{filter}} — ID фильтра, {{terms}} — совпавшие термы;
+//   - Delay — пауза перед действием ("30s"); ответ после паузы ещё и «печатает»;
+//   - Emoji — реакция для react;
+//   - To — ID получателя из recipients.json для forward_to;
+//   - For — срок для mute_chat ("8h"); пусто — навсегда;
+//   - DryRun — только записать действие в журнал, не выполняя его.
+type Action struct {
+	Type   string `json:"type"`
+	Text   string `json:"text,omitempty"`
+	Delay  string `json:"delay,omitempty"`
+	Emoji  string `json:"emoji,omitempty"`
+	To     string `json:"to,omitempty"`
+	For    string `json:"for,omitempty"`
+	DryRun bool   `json:"dry_run,omitempty"`
+
+	DelayDuration time.Duration `json:"-"`
+	ForDuration   time.Duration `json:"-"`
+}
+
+// validate проверяет обязательные поля действия по его типу и разбирает длительности.
+func (a *Action) validate() error {
+	switch a.Type {
+	case ActionReply:
+		if strings.TrimSpace(a.Text) == "" {
+			return fmt.Errorf("action %s requires text", a.Type)
+		}
+	case ActionReact:
+		if strings.TrimSpace(a.Emoji) == "" {
+			return fmt.Errorf("action %s requires emoji", a.Type)
+		}
+	case ActionForwardTo:
+		if strings.TrimSpace(a.To) == "" {
+			return fmt.Errorf("action %s requires to", a.Type)
+		}
+	case ActionSave, ActionPin, ActionMarkRead, ActionMuteChat:
+	default:
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+
+	var err error
+	if a.DelayDuration, err = parseActionDuration(a.Delay); err != nil {
+		return fmt.Errorf("action %s has invalid delay: %w", a.Type, err)
+	}
+	if a.ForDuration, err = parseActionDuration(a.For); err != nil {
+		return fmt.Errorf("action %s has invalid for: %w", a.Type, err)
+	}
+	return nil
+}
+
+// parseActionDuration разбирает необязательную положительную длительность; пусто — 0.
+func parseActionDuration(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", raw)
+	}
+	return d, nil
+}
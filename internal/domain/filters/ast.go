@@ -2,7 +2,38 @@
 // абстрактного синтаксического дерева (AST) для фильтров сообщений.
 package filters
 
-import "telegram-userbot/internal/infra/logger"
+import (
+	"slices"
+
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Terms возвращает значения листьев поддерева (ключевые слова и паттерны) без повторов.
+// Ветки NOT пропускаются: их листья описывают то, чего в тексте нет.
+func (n Node) Terms() []string {
+	var out []string
+	var walk func(node Node)
+	walk = func(node Node) {
+		switch node.Op {
+		case "NOT":
+			return
+		case "AND", "OR", "AT_LEAST":
+			for _, arg := range node.Args {
+				walk(arg)
+			}
+			return
+		}
+		term := node.Value
+		if term == "" {
+			term = node.Pattern
+		}
+		if term != "" && !slices.Contains(out, term) {
+			out = append(out, term)
+		}
+	}
+	walk(n)
+	return out
+}
 
 // evalNode вычисляет результат узла AST с учетом нормализованного текста
 func evalNode(node *Node, text string) (bool, *Node) {
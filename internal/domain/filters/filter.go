@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
+
 	"telegram-userbot/internal/infra/logger"
 )
 
@@ -31,18 +33,27 @@ type FilterRule struct {
 	Allow *Node `json:"allow,omitempty"`
 }
 
+// Notify описывает доставку уведомлений фильтра. TTL — срок актуальности регулярного
+// уведомления в формате time.ParseDuration ("6h", "90m"); пусто — глобальный NOTIFY_JOB_TTL_HOURS.
+// Priority — low|normal|high|critical; пусто — по устаревшему Urgent (true → high, иначе normal).
 type Notify struct {
 	Urgent     bool     `json:"urgent"`
+	Priority   string   `json:"priority,omitempty"`
 	Forward    bool     `json:"forward"`
 	Recipients []string `json:"recipients"`
 	Template   string   `json:"template"`
+	TTL        string   `json:"ttl,omitempty"`
+
+	TTLDuration time.Duration `json:"-"`
 }
 
 type Filter struct {
-	ID     string     `json:"id"`
-	Chats  []int64    `json:"chats"`
-	Rules  FilterRule `json:"rules"`
-	Notify Notify     `json:"notify"`
+	ID           string        `json:"id"`
+	Chats        []int64       `json:"chats"`
+	Rules        FilterRule    `json:"rules"`
+	Notify       Notify        `json:"notify"`
+	Actions      []Action      `json:"actions,omitempty"`
+	ArchiveMedia *MediaArchive `json:"archive_media,omitempty"`
 }
 
 // FiltersConfig — обертка для корневого JSON: { "filters": [...] }.
@@ -181,10 +192,36 @@ func (f *Filter) ValidateFilter() error {
 		}
 	}
 
-	// Проверяем notify секцию
-	if len(f.Notify.Recipients) == 0 {
+	// Проверяем notify секцию; фильтру только с действиями или архивированием медиа получатели не нужны
+	if len(f.Notify.Recipients) == 0 && len(f.Actions) == 0 && f.ArchiveMedia == nil {
 		logger.Warnf("filter %s has no recipients", f.ID)
 	}
+	switch strings.ToLower(strings.TrimSpace(f.Notify.Priority)) {
+	case "", "low", "normal", "high", "critical":
+	default:
+		return fmt.Errorf("filter %s has invalid notify.priority %q", f.ID, f.Notify.Priority)
+	}
+	if ttl := strings.TrimSpace(f.Notify.TTL); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("filter %s has invalid notify.ttl %q", f.ID, f.Notify.TTL)
+		}
+		f.Notify.TTLDuration = d
+	}
+
+	// Проверяем автоматические действия
+	for i := range f.Actions {
+		if err := f.Actions[i].validate(); err != nil {
+			return fmt.Errorf("filter %s has invalid action %d: %w", f.ID, i, err)
+		}
+	}
+
+	// Проверяем архивирование медиа
+	if f.ArchiveMedia != nil {
+		if err := f.ArchiveMedia.validate(); err != nil {
+			return fmt.Errorf("filter %s has invalid archive_media: %w", f.ID, err)
+		}
+	}
 
 	return nil
 }
@@ -5,6 +5,7 @@ package filters
 import (
 	"fmt"
 	"slices"
+	"strings"
 	"sync"
 	"telegram-userbot/internal/domain/tgutil"
 	"telegram-userbot/internal/infra/logger"
@@ -59,6 +60,15 @@ func (fe *FilterEngine) Init() error {
 				break
 			}
 		}
+		for _, action := range f.Actions {
+			if action.Type != ActionForwardTo || !allRecipientsKnown {
+				continue
+			}
+			if _, ok := recipientsMap[RecipientID(action.To)]; !ok {
+				logger.Errorf("filter %s forwards to unknown recipient %s, skipping filter", f.ID, action.To)
+				allRecipientsKnown = false
+			}
+		}
 		if allRecipientsKnown {
 			validFilters = append(validFilters, f)
 		}
@@ -70,6 +80,24 @@ func (fe *FilterEngine) Init() error {
 		for _, recID := range f.Notify.Recipients {
 			usedRecipients[RecipientID(recID)] = struct{}{}
 		}
+		for _, action := range f.Actions {
+			if action.Type == ActionForwardTo {
+				usedRecipients[RecipientID(action.To)] = struct{}{}
+			}
+		}
+	}
+	for recID, r := range recipientsMap {
+		for _, next := range r.Escalate {
+			usedRecipients[next] = struct{}{}
+			target, ok := recipientsMap[next]
+			switch {
+			case !ok:
+				logger.Errorf("recipient %s escalates to unknown recipient %s, step ignored", recID, next)
+			case target.Type == RecipientTypeWebhook || target.Type == RecipientTypeEmail:
+				// Повтор идёт через MTProto-клиента и ждёт прочтения: webhook и email так не умеют.
+				logger.Errorf("recipient %s escalates to %s recipient %s, step ignored", recID, target.Type, next)
+			}
+		}
 	}
 	for recID := range recipientsMap {
 		if _, used := usedRecipients[recID]; !used {
@@ -113,6 +141,38 @@ func (fe *FilterEngine) GetFilters() []Filter {
 	return fe.filters
 }
 
+// GetRecipients возвращает копию списка получателей, упорядоченную по ID.
+func (fe *FilterEngine) GetRecipients() []Recipient {
+	fe.mu.RLock()
+	defer fe.mu.RUnlock()
+	out := make([]Recipient, 0, len(fe.recipientsMap))
+	for _, r := range fe.recipientsMap {
+		out = append(out, r)
+	}
+	slices.SortFunc(out, func(a, b Recipient) int { return strings.Compare(string(a.ID), string(b.ID)) })
+	return out
+}
+
+// RecipientByPeer ищет получателя по типу и Telegram peer_id.
+func (fe *FilterEngine) RecipientByPeer(kind string, peerID int64) (Recipient, bool) {
+	fe.mu.RLock()
+	defer fe.mu.RUnlock()
+	for _, r := range fe.recipientsMap {
+		if string(r.Type) == kind && int64(r.PeerID) == peerID {
+			return r, true
+		}
+	}
+	return Recipient{}, false
+}
+
+// RecipientByID ищет получателя по ID из recipients.json.
+func (fe *FilterEngine) RecipientByID(id RecipientID) (Recipient, bool) {
+	fe.mu.RLock()
+	defer fe.mu.RUnlock()
+	r, ok := fe.recipientsMap[id]
+	return r, ok
+}
+
 // GetUniqueChats возвращает копию множества всех чатов, встречающихся во всех
 // фильтрах. Отдаётся новый срез, чтобы внешний код не мог модифицировать кеш.
 func (fe *FilterEngine) GetUniqueChats() []int64 {
@@ -0,0 +1,34 @@
+// media.go описывает архивирование медиа совпавших сообщений на диск (archive_media фильтра).
+// Здесь только конфигурация и её валидация; скачивание и хранение — internal/domain/mediaarchive.
+package filters
+
+import (
+	"fmt"
+	"slices"
+)
+
+// MediaArchiveKinds — виды медиа, которые можно указать в archive_media.types
+// (совпадают с notifications.MediaKind*).
+var MediaArchiveKinds = []string{"photo", "video", "animation", "audio", "voice", "document"}
+
+// MediaArchive — настройки архивирования медиа фильтра. Наличие секции включает архивирование.
+//   - Types — виды медиа для сохранения (пусто — все, см. MediaArchiveKinds);
+//   - MaxSizeMB — предельный размер файла в мегабайтах (0 — глобальный MEDIA_ARCHIVE_MAX_MB,
+//     больше глобального предела значение не поднимает).
+type MediaArchive struct {
+	Types     []string `json:"types,omitempty"`
+	MaxSizeMB int      `json:"max_size_mb,omitempty"`
+}
+
+// validate проверяет виды медиа и предел размера.
+func (m *MediaArchive) validate() error {
+	for _, kind := range m.Types {
+		if !slices.Contains(MediaArchiveKinds, kind) {
+			return fmt.Errorf("unknown media type %q", kind)
+		}
+	}
+	if m.MaxSizeMB < 0 {
+		return fmt.Errorf("max_size_mb must not be negative, got %d", m.MaxSizeMB)
+	}
+	return nil
+}
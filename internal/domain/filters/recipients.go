@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"net/mail"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -29,19 +32,21 @@ func (rid *RecipientID) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// RecipientType определяет тип получателя: пользователь, чат или канал
+// RecipientType определяет тип получателя: пользователь, чат, канал, внешний HTTP-сервис или e-mail
 type RecipientType string
 
 const (
 	RecipientTypeUser    RecipientType = "user"
 	RecipientTypeChat    RecipientType = "chat"
 	RecipientTypeChannel RecipientType = "channel"
+	RecipientTypeWebhook RecipientType = "webhook"
+	RecipientTypeEmail   RecipientType = "email"
 )
 
 // IsValid проверяет, что RecipientType имеет допустимое значение
 func (rt *RecipientType) IsValid() bool {
 	switch *rt {
-	case RecipientTypeUser, RecipientTypeChat, RecipientTypeChannel:
+	case RecipientTypeUser, RecipientTypeChat, RecipientTypeChannel, RecipientTypeWebhook, RecipientTypeEmail:
 		return true
 	default:
 		return false
@@ -66,6 +71,18 @@ func (rt *RecipientType) UnmarshalJSON(data []byte) error {
 
 type RecipientPeerID int64
 
+// syntheticPeerID выводит стабильный синтетический peer_id получателя вне Telegram (webhook, email)
+// из его ID: задания очереди адресуются парой (type, id), а у таких получателей peer_id нет.
+func syntheticPeerID(id RecipientID) RecipientPeerID {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(id))
+	v := int64(h.Sum64() >> 1) // #nosec G115 -- сдвиг оставляет 63 бита
+	if v == 0 {
+		v = 1
+	}
+	return RecipientPeerID(v)
+}
+
 func (rp *RecipientPeerID) UnmarshalJSON(data []byte) error {
 	var id int64
 	if err := json.Unmarshal(data, &id); err != nil {
@@ -128,14 +145,122 @@ func (rs *RecipientSchedule) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// RecipientQuietWindow — окно «не беспокоить» в таймзоне получателя, задаётся строкой
+// "HH:MM-HH:MM". Окно может переходить через полночь ("23:00-07:00").
+type RecipientQuietWindow struct {
+	Start int // минуты от начала суток
+	End   int // минуты от начала суток
+	Label string
+}
+
+// UnmarshalJSON реализует кастомную десериализацию для RecipientQuietWindow
+func (qw *RecipientQuietWindow) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	s = strings.TrimSpace(s)
+	from, to, ok := strings.Cut(s, "-")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || !IsValidScheduleEntry(from) || !IsValidScheduleEntry(to) || from == to {
+		return fmt.Errorf("invalid quiet window: %s", s)
+	}
+	*qw = RecipientQuietWindow{
+		Start: minutesOfDay(from),
+		End:   minutesOfDay(to),
+		Label: s,
+	}
+	return nil
+}
+
+// contains сообщает, попадает ли момент m (минуты от начала суток) в окно.
+func (qw RecipientQuietWindow) contains(m int) bool {
+	if qw.Start < qw.End {
+		return m >= qw.Start && m < qw.End
+	}
+	return m >= qw.Start || m < qw.End
+}
+
+// RecipientTransports — транспорты получателя в порядке предпочтения. В JSON задаётся
+// строкой ("bot") или массивом (["bot", "client"]).
+type RecipientTransports []string
+
+// UnmarshalJSON реализует кастомную десериализацию для RecipientTransports
+func (rt *RecipientTransports) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		var single string
+		if errSingle := json.Unmarshal(data, &single); errSingle != nil {
+			return errors.New("transport must be a string or an array of strings")
+		}
+		list = []string{single}
+	}
+	out := make([]string, 0, len(list))
+	for _, name := range list {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			return errors.New("transport name cannot be empty")
+		}
+		out = append(out, name)
+	}
+	*rt = out
+	return nil
+}
+
 // Recipient — полное описание получателя из recipients.json
 type Recipient struct {
-	ID       RecipientID         `json:"id"`       // Уникальный ID получателя (обяазателен)
-	Type     RecipientType       `json:"type"`     // user|chat|channel (обязателен)
-	PeerID   RecipientPeerID     `json:"peer_id"`  // Telegram peer_id (обязателен)
-	Note     string              `json:"note"`     // Заметка для получателя (необязательна)
-	TZ       RecipientTZ         `json:"tz"`       // IANA-таймзона или UTC-смещение (необязательна)
-	Schedule []RecipientSchedule `json:"schedule"` // Строка с расписанием в формате HH:MM[,HH:MM,...] (необязательна)
+	ID        RecipientID            `json:"id"`        // Уникальный ID получателя (обяазателен)
+	Type      RecipientType          `json:"type"`      // user|chat|channel (обязателен)
+	PeerID    RecipientPeerID        `json:"peer_id"`   // Telegram peer_id (обязателен)
+	Note      string                 `json:"note"`      // Заметка для получателя (необязательна)
+	TZ        RecipientTZ            `json:"tz"`        // IANA-таймзона или UTC-смещение (необязательна)
+	Schedule  []RecipientSchedule    `json:"schedule"`  // Расписание в формате HH:MM[,HH:MM,...] (необязательна)
+	Quiet     []RecipientQuietWindow `json:"quiet"`     // Окна «не беспокоить» HH:MM-HH:MM в tz (необязательна)
+	Escalate  []RecipientID          `json:"escalate"`  // Цепочка эскалации непрочитанных critical (необязательна)
+	Transport RecipientTransports    `json:"transport"` // Транспорты в порядке fallback: client|bot (необязательна)
+	URL       string                 `json:"url"`       // Адрес webhook (обязателен для type=webhook)
+	Secret    string                 `json:"secret"`    // Ключ HMAC-подписи webhook (необязателен)
+	Email     string                 `json:"email"`     // Адрес e-mail (обязателен для type=email)
+}
+
+// Location возвращает таймзону получателя; при пустой или невалидной tz — fallback.
+func (r Recipient) Location(fallback *time.Location) *time.Location {
+	if r.TZ != "" {
+		if loc, err := ParseLocation(string(r.TZ)); err == nil {
+			return loc
+		}
+	}
+	if fallback == nil {
+		return time.UTC
+	}
+	return fallback
+}
+
+// QuietUntil сообщает, находится ли получатель в окне «не беспокоить» в момент now,
+// и возвращает момент окончания окна. fallback — таймзона для получателя без tz.
+func (r Recipient) QuietUntil(now time.Time, fallback *time.Location) (time.Time, bool) {
+	if len(r.Quiet) == 0 {
+		return time.Time{}, false
+	}
+	local := now.In(r.Location(fallback))
+	m := local.Hour()*minutesInHour + local.Minute()
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+
+	var until time.Time
+	for _, qw := range r.Quiet {
+		if !qw.contains(m) {
+			continue
+		}
+		end := midnight.Add(time.Duration(qw.End) * time.Minute)
+		if qw.End <= m {
+			// Окно через полночь: конец уже завтра.
+			end = end.AddDate(0, 0, 1)
+		}
+		if end.After(until) {
+			until = end
+		}
+	}
+	return until, !until.IsZero()
 }
 
 // UnmarshalJSON проверка обязательных полей Recipient
@@ -151,6 +276,20 @@ func (r *Recipient) UnmarshalJSON(data []byte) error {
 	if aux.Type == "" {
 		return errors.New("recipient type is required")
 	}
+	if aux.Type == RecipientTypeWebhook {
+		u, err := url.Parse(aux.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("recipient %s: webhook url must be an absolute http(s) URL", aux.ID)
+		}
+	}
+	if aux.Type == RecipientTypeEmail {
+		if _, err := mail.ParseAddress(aux.Email); err != nil {
+			return fmt.Errorf("recipient %s: invalid email %q: %w", aux.ID, aux.Email, err)
+		}
+	}
+	if (aux.Type == RecipientTypeWebhook || aux.Type == RecipientTypeEmail) && aux.PeerID == 0 {
+		aux.PeerID = syntheticPeerID(aux.ID)
+	}
 	if aux.PeerID == 0 {
 		return errors.New("recipient peer_id is required")
 	}
@@ -173,6 +312,13 @@ func LoadRecipients(filePath string) ([]Recipient, error) {
 	return recipients, nil
 }
 
+// minutesOfDay переводит валидную строку HH:MM в минуты от начала суток.
+func minutesOfDay(value string) int {
+	hour, _ := strconv.Atoi(value[:2])
+	minute, _ := strconv.Atoi(value[3:])
+	return hour*minutesInHour + minute
+}
+
 // IsValidScheduleEntry проверяет формат времени HH:MM и диапазоны часов/минут.
 // Это копия функции из config пакета
 func IsValidScheduleEntry(value string) bool {
@@ -219,6 +365,7 @@ func ParseLocation(value string) (*time.Location, error) {
 const (
 	secondsInMinute = 60
 	secondsInHour   = secondsInMinute * 60
+	minutesInHour   = 60
 )
 
 // parseUTCOffsetToLocation парсит строки вида "+03:00", "-0700", "UTC+3", "GMT-04:30" или "Z".
@@ -0,0 +1,412 @@
+// Package mediaarchive сохраняет на диск медиа (фото, документы, видео…) сообщений,
+// совпавших с фильтрами, у которых задана секция archive_media. Каналы часто удаляют
+// файлы, поэтому копии скачиваются сразу после совпадения.
+//
+// Ключевые свойства:
+//   - скачивание идёт через MTProto-клиент (Downloader) под общим троттлером уведомлений,
+//     параллельно не более чем в MEDIA_ARCHIVE_WORKERS потоков;
+//   - лимиты: вид медиа и размер файла (archive_media фильтра в пределах глобальных
+//     MEDIA_ARCHIVE_TYPES и MEDIA_ARCHIVE_MAX_MB); неподходящие файлы не скачиваются;
+//   - очередь загрузок персистентна (MEDIA_ARCHIVE_QUEUE_FILE): задание удаляется только после
+//     сохранения файла, поэтому после рестарта незавершённые загрузки продолжаются;
+//   - ошибки повторяются с экспоненциальной паузой, после maxAttempts задание отбрасывается;
+//   - хранилище адресуется содержимым (см. store.go): одинаковые файлы хранятся один раз.
+package mediaarchive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/domain/tgutil"
+	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
+	"telegram-userbot/internal/infra/telegram/peersmgr"
+
+	"github.com/gotd/td/tg"
+)
+
+// Параметры повторов: число попыток и границы экспоненциальной паузы между ними.
+const (
+	maxAttempts  = 5
+	retryBase    = time.Minute
+	retryMax     = time.Hour
+	idleInterval = time.Minute
+)
+
+// tmpDirName — каталог незавершённых загрузок внутри корня архива (тот же том, что и
+// итоговые файлы, поэтому перенос в хранилище — атомарный rename).
+const tmpDirName = ".tmp"
+
+// Downloader скачивает медиа сообщений через Telegram (реализация — telegramnotifier.ClientSender).
+type Downloader interface {
+	DownloadMedia(
+		ctx context.Context,
+		from notifications.Recipient,
+		messageIDs []int,
+		dir string,
+		accept func(notifications.MediaFile) bool,
+	) ([]notifications.MediaFile, error)
+}
+
+// Options — глобальные настройки архива медиа.
+//   - Dir — корень хранилища, QueueFile — файл персистентной очереди загрузок;
+//   - MaxSize — предельный размер файла в байтах, Types — допустимые виды (пусто — все);
+//   - Workers — число параллельных загрузок.
+type Options struct {
+	Dir       string
+	QueueFile string
+	MaxSize   int64
+	Types     []string
+	Workers   int
+}
+
+// Task — загрузка медиа одного сообщения. Лимиты вычисляются при постановке из настроек
+// сработавших фильтров и сохраняются вместе с заданием.
+type Task struct {
+	Source    Source    `json:"source"`
+	Types     []string  `json:"types,omitempty"`
+	MaxSize   int64     `json:"max_size"`
+	Attempts  int       `json:"attempts,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	NextAt    time.Time `json:"next_at,omitzero"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// key — ключ задания: сообщение в чате.
+func (t *Task) key() string {
+	return fmt.Sprintf("%s:%d:%d", t.Source.ChatType, t.Source.ChatID, t.Source.MessageID)
+}
+
+// accept сообщает, укладывается ли файл в лимиты задания.
+func (t *Task) accept(file notifications.MediaFile) bool {
+	if len(t.Types) > 0 && !slices.Contains(t.Types, file.Kind) {
+		return false
+	}
+	return t.MaxSize <= 0 || file.Size <= t.MaxSize
+}
+
+// Service — очередь и воркеры архива медиа.
+type Service struct {
+	downloader Downloader
+	peers      *peersmgr.Service
+	opts       Options
+	store      *store
+
+	mu       sync.Mutex
+	pending  map[string]*Task // pending — незавершённые задания по ключу (персистятся)
+	inFlight map[string]bool  // inFlight — задания, которые сейчас скачиваются
+	wake     chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New создаёт архив медиа и загружает незавершённые задания из opts.QueueFile.
+func New(downloader Downloader, peers *peersmgr.Service, opts Options) (*Service, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	s := &Service{
+		downloader: downloader,
+		peers:      peers,
+		opts:       opts,
+		store:      &store{root: opts.Dir},
+		pending:    make(map[string]*Task),
+		inFlight:   make(map[string]bool),
+		wake:       make(chan struct{}, opts.Workers),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start запускает воркеры загрузки. Повторный вызов игнорируется.
+func (s *Service) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	if n := len(s.pending); n > 0 {
+		logger.Infof("Media archive: resuming %d pending download(s)", n)
+	}
+	for range s.opts.Workers {
+		s.wg.Go(func() { s.worker(runCtx) })
+	}
+}
+
+// Stop прерывает загрузки и дожидается воркеров. Прерванные задания остаются в очереди.
+func (s *Service) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Enqueue ставит в очередь загрузку медиа сообщения msg, если среди совпавших фильтров
+// results есть фильтры с archive_media; messageIDs — все части альбома (nil — только msg).
+func (s *Service) Enqueue(
+	entities tg.Entities,
+	msg *tg.Message,
+	messageIDs []int,
+	results []filters.FilterMatchResult,
+) {
+	if msg == nil || msg.Media == nil {
+		return
+	}
+	types, maxSize, filterIDs := s.limits(results)
+	if len(filterIDs) == 0 {
+		return
+	}
+	if len(messageIDs) == 0 {
+		messageIDs = []int{msg.ID}
+	}
+
+	base := Source{
+		ChatType:  tgutil.GetPeerKind(msg.PeerID),
+		ChatID:    tgutil.GetPeerID(msg.PeerID),
+		ChatTitle: tgutil.GetPeerTitle(entities, msg.PeerID),
+		Date:      time.Unix(int64(msg.Date), 0).UTC(),
+		Text:      msg.Message,
+		Filters:   filterIDs,
+	}
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	added := 0
+	for _, id := range messageIDs {
+		src := base
+		src.MessageID = id
+		if id == msg.ID {
+			src.Link = notifications.BuildMessageLink(s.peers, entities, msg)
+		}
+		task := &Task{Source: src, Types: types, MaxSize: maxSize, AddedAt: now}
+		if _, dup := s.pending[task.key()]; dup {
+			continue
+		}
+		s.pending[task.key()] = task
+		added++
+	}
+	err := s.persistLocked()
+	s.mu.Unlock()
+
+	if err != nil {
+		logger.Errorf("Media archive: persist queue failed: %v", err)
+	}
+	for range added {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// limits объединяет настройки archive_media совпавших фильтров: виды — объединение (пустой
+// список у любого фильтра — все виды), размер — наибольший; глобальные лимиты ограничивают итог.
+func (s *Service) limits(results []filters.FilterMatchResult) ([]string, int64, []string) {
+	var (
+		types     []string
+		allTypes  bool
+		maxSize   int64
+		filterIDs []string
+	)
+	for _, res := range results {
+		cfg := res.Filter.ArchiveMedia
+		if cfg == nil {
+			continue
+		}
+		filterIDs = append(filterIDs, res.Filter.ID)
+		if len(cfg.Types) == 0 {
+			allTypes = true
+		}
+		for _, kind := range cfg.Types {
+			if !slices.Contains(types, kind) {
+				types = append(types, kind)
+			}
+		}
+		size := s.opts.MaxSize
+		if cfg.MaxSizeMB > 0 {
+			size = min(int64(cfg.MaxSizeMB)<<20, s.opts.MaxSize)
+		}
+		maxSize = max(maxSize, size)
+	}
+	if allTypes {
+		types = nil
+	}
+	if len(s.opts.Types) > 0 {
+		if types == nil {
+			types = slices.Clone(s.opts.Types)
+		} else {
+			types = slices.DeleteFunc(types, func(kind string) bool { return !slices.Contains(s.opts.Types, kind) })
+			if len(types) == 0 {
+				return nil, 0, nil
+			}
+		}
+	}
+	return types, maxSize, filterIDs
+}
+
+// worker забирает готовые задания и выполняет их до отмены контекста.
+func (s *Service) worker(ctx context.Context) {
+	for {
+		task, wait := s.next()
+		if task == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-s.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+		s.process(ctx, task)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// next выбирает самое старое готовое задание и помечает его выполняемым. Если готовых нет,
+// возвращает паузу до ближайшего повтора.
+func (s *Service) next() (*Task, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var (
+		best *Task
+		wait = idleInterval
+	)
+	for key, task := range s.pending {
+		if s.inFlight[key] {
+			continue
+		}
+		if task.NextAt.After(now) {
+			wait = min(wait, task.NextAt.Sub(now))
+			continue
+		}
+		if best == nil || task.AddedAt.Before(best.AddedAt) {
+			best = task
+		}
+	}
+	if best == nil {
+		return nil, wait
+	}
+	s.inFlight[best.key()] = true
+	copied := *best
+	return &copied, 0
+}
+
+// process скачивает медиа задания во временный каталог и переносит файлы в хранилище.
+func (s *Service) process(ctx context.Context, task *Task) {
+	key := task.key()
+	tmp := filepath.Join(s.opts.Dir, tmpDirName, strings.ReplaceAll(key, ":", "_"))
+	err := s.download(ctx, task, tmp)
+	if removeErr := os.RemoveAll(tmp); removeErr != nil {
+		logger.Warnf("Media archive: cleanup %s failed: %v", tmp, removeErr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, key)
+	current, ok := s.pending[key]
+	if !ok {
+		return
+	}
+	switch {
+	case err == nil:
+		delete(s.pending, key)
+	case ctx.Err() != nil:
+		// Остановка сервиса: задание остаётся в очереди и продолжится после рестарта.
+		return
+	default:
+		current.Attempts++
+		current.LastError = err.Error()
+		if current.Attempts >= maxAttempts {
+			logger.Errorf("Media archive: %s dropped after %d attempt(s): %v", key, current.Attempts, err)
+			delete(s.pending, key)
+			break
+		}
+		delay := min(retryBase<<(current.Attempts-1), retryMax)
+		current.NextAt = time.Now().Add(delay).UTC()
+		logger.Warnf("Media archive: %s attempt %d/%d failed, retry in %s: %v",
+			key, current.Attempts, maxAttempts, delay, err)
+	}
+	if errPersist := s.persistLocked(); errPersist != nil {
+		logger.Errorf("Media archive: persist queue failed: %v", errPersist)
+	}
+}
+
+// download скачивает файлы задания в tmp и сохраняет их в хранилище.
+func (s *Service) download(ctx context.Context, task *Task, tmp string) error {
+	if err := os.MkdirAll(tmp, 0o700); err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+	from := notifications.Recipient{Type: task.Source.ChatType, ID: task.Source.ChatID}
+	files, err := s.downloader.DownloadMedia(ctx, from, []int{task.Source.MessageID}, tmp, task.accept)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		path, errPut := s.store.put(file, task.Source)
+		if errPut != nil {
+			return fmt.Errorf("store %s: %w", file.FileName, errPut)
+		}
+		logger.Infof("Media archive: %s:%d/%d saved to %s (%d bytes)",
+			task.Source.ChatType, task.Source.ChatID, task.Source.MessageID, path, file.Size)
+	}
+	return nil
+}
+
+// load восстанавливает незавершённые задания из файла очереди. Отсутствие файла — пустая очередь.
+func (s *Service) load() error {
+	data, err := os.ReadFile(filepath.Clean(s.opts.QueueFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read media archive queue: %w", err)
+	}
+	var tasks []*Task
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return fmt.Errorf("parse media archive queue: %w", err)
+	}
+	for _, task := range tasks {
+		s.pending[task.key()] = task
+	}
+	return nil
+}
+
+// persistLocked атомарно записывает очередь заданий в порядке постановки. Вызывается под s.mu.
+func (s *Service) persistLocked() error {
+	tasks := make([]*Task, 0, len(s.pending))
+	for _, task := range s.pending {
+		tasks = append(tasks, task)
+	}
+	slices.SortFunc(tasks, func(a, b *Task) int { return a.AddedAt.Compare(b.AddedAt) })
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := storage.EnsureDir(s.opts.QueueFile); err != nil {
+		return err
+	}
+	return storage.AtomicWriteFile(s.opts.QueueFile, data)
+}
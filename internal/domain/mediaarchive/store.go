@@ -0,0 +1,147 @@
+// Package mediaarchive / файл store.go — хранилище файлов, адресуемое содержимым.
+//
+// Файл сохраняется по SHA-256 содержимого: <root>/<ab>/<cd>/<sha256><.ext>, рядом —
+// JSON-сайдкар <то же имя>.json с метаданными файла и списком сообщений-источников.
+// Повторное появление того же файла (репост в другом канале, повтор после рестарта)
+// не создаёт копию, а только дополняет список источников в сайдкаре.
+
+package mediaarchive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/infra/storage"
+)
+
+// maxExtLen — предельная длина расширения файла в хранилище (вместе с точкой).
+const maxExtLen = 16
+
+// Source — сообщение, в котором встретился файл.
+type Source struct {
+	ChatType   string    `json:"chat_type"`
+	ChatID     int64     `json:"chat_id"`
+	ChatTitle  string    `json:"chat_title,omitempty"`
+	MessageID  int       `json:"message_id"`
+	Date       time.Time `json:"date"`
+	Text       string    `json:"text,omitempty"`
+	Filters    []string  `json:"filters"`
+	Link       string    `json:"link,omitempty"`
+	ArchivedAt time.Time `json:"archived_at,omitzero"`
+}
+
+// Sidecar — метаданные сохранённого файла.
+type Sidecar struct {
+	SHA256   string   `json:"sha256"`
+	Size     int64    `json:"size"`
+	Kind     string   `json:"kind"`
+	MimeType string   `json:"mime_type,omitempty"`
+	FileName string   `json:"file_name,omitempty"`
+	Sources  []Source `json:"sources"`
+}
+
+// store раскладывает скачанные файлы по дереву каталогов и ведёт сайдкары.
+type store struct {
+	root string
+	mu   sync.Mutex // сериализует перенос файла и обновление сайдкара
+}
+
+// put переносит скачанный файл file в хранилище и добавляет src в сайдкар.
+// Возвращает путь файла в хранилище.
+func (st *store) put(file notifications.MediaFile, src Source) (string, error) {
+	sum, size, err := hashFile(file.Path)
+	if err != nil {
+		return "", err
+	}
+	name := sum + storeExt(file.FileName)
+	path := filepath.Join(st.root, sum[:2], sum[2:4], name)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if err := storage.EnsureDir(path); err != nil {
+		return "", err
+	}
+	if _, statErr := os.Stat(path); errors.Is(statErr, os.ErrNotExist) {
+		if err := os.Rename(file.Path, path); err != nil {
+			return "", fmt.Errorf("move into store: %w", err)
+		}
+	} else if statErr != nil {
+		return "", statErr
+	}
+
+	sidecarPath := path + ".json"
+	sidecar := Sidecar{SHA256: sum, Size: size, Kind: file.Kind, MimeType: file.MimeType, FileName: file.FileName}
+	if data, readErr := os.ReadFile(filepath.Clean(sidecarPath)); readErr == nil {
+		if err := json.Unmarshal(data, &sidecar); err != nil {
+			return "", fmt.Errorf("parse sidecar %s: %w", sidecarPath, err)
+		}
+	} else if !errors.Is(readErr, os.ErrNotExist) {
+		return "", readErr
+	}
+
+	src.ArchivedAt = time.Now().UTC()
+	idx := slices.IndexFunc(sidecar.Sources, func(s Source) bool {
+		return s.ChatType == src.ChatType && s.ChatID == src.ChatID && s.MessageID == src.MessageID
+	})
+	if idx >= 0 {
+		// Тот же источник (повтор после рестарта или правки) — только дополняем фильтры.
+		for _, id := range src.Filters {
+			if !slices.Contains(sidecar.Sources[idx].Filters, id) {
+				sidecar.Sources[idx].Filters = append(sidecar.Sources[idx].Filters, id)
+			}
+		}
+	} else {
+		sidecar.Sources = append(sidecar.Sources, src)
+	}
+
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := storage.AtomicWriteFile(sidecarPath, data); err != nil {
+		return "", fmt.Errorf("write sidecar: %w", err)
+	}
+	return path, nil
+}
+
+// hashFile считает SHA-256 и размер файла.
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = f.Close() }()
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// storeExt возвращает расширение имени файла в нижнем регистре, если оно короткое и
+// состоит из букв и цифр; иначе пустую строку.
+func storeExt(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if len(ext) < 2 || len(ext) > maxExtLen {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
@@ -0,0 +1,201 @@
+// Package notifications / файл actions.go описывает действия над доставленным уведомлением,
+// которые получатель выбирает кнопками под ним (inline-клавиатура Bot API):
+//   - Open source — ссылка на исходное сообщение (URL-кнопка без обратного вызова);
+//   - Mark read — пометить источник прочитанным от имени userbot;
+//   - Mute filter / Mute chat — отключить фильтры уведомления или чат-источник (см. mute.go);
+//   - Snooze — повторить уведомление в ближайшем окне расписания.
+//
+// Нажатие приходит обратным вызовом с данными "<действие>:<ID задания>[@<аккаунт>]". ActionHandler
+// проверяет, что нажавший — получатель-пользователь из recipients.json, находит задание
+// в журнале доставленных (State.Delivered) и применяет действие к состоянию очереди.
+// У каждого аккаунта своя очередь и свой счётчик ID заданий, поэтому ActionRouter
+// передаёт нажатие обработчику аккаунта из данных кнопки.
+
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Коды действий в данных обратного вызова (Bot API ограничивает callback_data 64 байтами).
+const (
+	ActionMarkRead   = "rd"
+	ActionMuteFilter = "mf"
+	ActionMuteChat   = "mc"
+	ActionSnooze     = "sz"
+)
+
+// ActionRef — доставленное задание, к которому относятся кнопки действий, ссылка на источник
+// и аккаунт, в очереди которого задание.
+type ActionRef struct {
+	JobID   int64  `json:"job_id"`
+	Link    string `json:"link,omitempty"`
+	Account string `json:"account,omitempty"`
+}
+
+// ActionButton — кнопка действия: URL открывает ссылку, Data уходит обратным вызовом.
+type ActionButton struct {
+	Text string
+	URL  string
+	Data string
+}
+
+// SourceReader помечает прочитанными сообщения чата-источника до maxID включительно.
+type SourceReader interface {
+	MarkRead(ctx context.Context, peer Recipient, maxID int) error
+}
+
+// ActionRef возвращает задание, кнопки которого транспорт прикрепляет к сообщению:
+// само уведомление с источником или ранее доставленное уведомление, которое правит job.
+// false — служебное задание без кнопок (ответы, пометки, эскалации).
+func (j Job) ActionRef() (ActionRef, bool) {
+	if j.Payload.Actions != nil {
+		return *j.Payload.Actions, true
+	}
+	if j.Source == nil || j.Payload.EditOf != 0 || j.Payload.ReplyTo != 0 || j.EscalationOf != 0 {
+		return ActionRef{}, false
+	}
+	return ActionRef{JobID: j.ID, Link: j.Source.Link, Account: j.Source.Account}, true
+}
+
+// actionRef возвращает кнопки действий доставленного уведомления для правок.
+func (r DeliveredRecord) actionRef() *ActionRef {
+	return &ActionRef{JobID: r.JobID, Link: r.Source.Link, Account: r.Source.Account}
+}
+
+// ActionKeyboard раскладывает кнопки действий по строкам клавиатуры.
+func ActionKeyboard(ref ActionRef) [][]ActionButton {
+	suffix := ""
+	if ref.Account != "" {
+		suffix = "@" + ref.Account
+	}
+	data := func(action string) string { return action + ":" + strconv.FormatInt(ref.JobID, 10) + suffix }
+	first := []ActionButton{{Text: "Mark read", Data: data(ActionMarkRead)}}
+	if ref.Link != "" {
+		first = slices.Insert(first, 0, ActionButton{Text: "Open source", URL: ref.Link})
+	}
+	return [][]ActionButton{
+		first,
+		{
+			{Text: "Mute filter 1h", Data: data(ActionMuteFilter)},
+			{Text: "Mute chat 24h", Data: data(ActionMuteChat)},
+		},
+		{{Text: "Snooze until next window", Data: data(ActionSnooze)}},
+	}
+}
+
+// ActionHandler применяет действия, выбранные кнопками уведомлений.
+type ActionHandler struct {
+	queue      *Queue
+	recipients *filters.FilterEngine
+	reader     SourceReader
+}
+
+// NewActionHandler создаёт обработчик действий; reader == nil отключает «Mark read».
+func NewActionHandler(queue *Queue, recipients *filters.FilterEngine, reader SourceReader) *ActionHandler {
+	return &ActionHandler{queue: queue, recipients: recipients, reader: reader}
+}
+
+// HandleCallback выполняет действие data, выбранное пользователем userID, и возвращает
+// короткий ответ для всплывающего уведомления. Нажимать кнопки могут только получатели
+// типа user из recipients.json, а кнопки личного уведомления — только его получатель.
+func (h *ActionHandler) HandleCallback(ctx context.Context, userID int64, data string) string {
+	action, rawID, _ := strings.Cut(data, ":")
+	rawID, _, _ = strings.Cut(rawID, "@")
+	jobID, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return "Unknown action"
+	}
+	if _, ok := h.recipients.RecipientByPeer(string(filters.RecipientTypeUser), userID); !ok {
+		logger.Warnf("Actions: user %d is not a recipient, action %q rejected", userID, data)
+		return "You are not allowed to do this"
+	}
+	rec, ok := h.queue.Delivered(jobID)
+	if !ok {
+		return "Notification is too old"
+	}
+	if rec.Recipient.Type == RecipientTypeUser && rec.Recipient.ID != userID {
+		logger.Warnf("Actions: user %d pressed %q on notification of %s:%d, rejected",
+			userID, data, rec.Recipient.Type, rec.Recipient.ID)
+		return "You are not allowed to do this"
+	}
+	logger.Infof("Actions: user %d requested %q for job %d", userID, action, jobID)
+
+	switch action {
+	case ActionMarkRead:
+		return h.markRead(ctx, rec)
+	case ActionMuteFilter:
+		ids := rec.Source.Filters()
+		if len(ids) == 0 {
+			return "Nothing to mute"
+		}
+		until := h.queue.now().Add(MuteFilterFor)
+		for _, id := range ids {
+			h.queue.Mute(Mute{Recipient: rec.Recipient, FilterID: id, Until: until})
+		}
+		return fmt.Sprintf("Muted %s for %dh", strings.Join(ids, ", "), int(MuteFilterFor.Hours()))
+	case ActionMuteChat:
+		h.queue.Mute(Mute{Recipient: rec.Recipient, Chat: rec.Source.Peer, Until: h.queue.now().Add(MuteChatFor)})
+		return fmt.Sprintf("Chat muted for %dh", int(MuteChatFor.Hours()))
+	case ActionSnooze:
+		if _, added := h.queue.Snooze(rec); !added {
+			return "Already snoozed"
+		}
+		return "Snoozed until next window"
+	default:
+		return "Unknown action"
+	}
+}
+
+// markRead помечает прочитанными исходные сообщения уведомления rec.
+func (h *ActionHandler) markRead(ctx context.Context, rec DeliveredRecord) string {
+	if h.reader == nil || len(rec.Source.MessageIDs) == 0 {
+		return "Not available"
+	}
+	if err := h.reader.MarkRead(ctx, rec.Source.Peer, slices.Max(rec.Source.MessageIDs)); err != nil {
+		logger.Errorf("Actions: mark read %s:%d failed: %v", rec.Source.Peer.Type, rec.Source.Peer.ID, err)
+		return "Failed to mark read"
+	}
+	return "Source marked read"
+}
+
+// ActionRouter передаёт нажатия кнопок обработчику аккаунта, в очереди которого задание.
+// Кнопки без аккаунта (созданные до нескольких аккаунтов) обрабатывает основной аккаунт.
+type ActionRouter struct {
+	primary  string
+	handlers map[string]*ActionHandler
+}
+
+// NewActionRouter создаёт пустой маршрутизатор действий.
+func NewActionRouter() *ActionRouter {
+	return &ActionRouter{handlers: make(map[string]*ActionHandler)}
+}
+
+// Register добавляет обработчик аккаунта account. Первый зарегистрированный аккаунт — основной.
+func (r *ActionRouter) Register(account string, handler *ActionHandler) {
+	if len(r.handlers) == 0 {
+		r.primary = account
+	}
+	r.handlers[account] = handler
+}
+
+// HandleCallback выбирает обработчик по аккаунту из данных кнопки и передаёт ему нажатие.
+func (r *ActionRouter) HandleCallback(ctx context.Context, userID int64, data string) string {
+	account := r.primary
+	if _, name, ok := strings.Cut(data, "@"); ok {
+		account = name
+	}
+	handler, ok := r.handlers[account]
+	if !ok {
+		logger.Warnf("Actions: user %d pressed %q of unknown account %q", userID, data, account)
+		return "Unknown action"
+	}
+	return handler.HandleCallback(ctx, userID, data)
+}
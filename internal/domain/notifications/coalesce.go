@@ -0,0 +1,94 @@
+// Package notifications / файл coalesce.go объединяет совпадения нескольких фильтров
+// по одному сообщению. Раньше каждый FilterMatchResult давал отдельное задание, и получатель,
+// подписанный на три сработавших фильтра, получал три текста и три пересылки одного сообщения.
+// Теперь совпадения группируются по получателю и дают одно задание:
+//   - текст — тексты всех фильтров получателя (без повторов) через пустую строку;
+//   - приоритет — максимальный среди фильтров (см. priority.go);
+//   - пересылка — одна, если её запросил хотя бы один фильтр;
+//   - Source.FilterIDs — все фильтры, вошедшие в задание.
+
+package notifications
+
+import (
+	"slices"
+	"strings"
+
+	"telegram-userbot/internal/domain/filters"
+)
+
+// matchTextSeparator разделяет тексты разных фильтров в объединённом уведомлении.
+const matchTextSeparator = "\n\n"
+
+// recipientMatches — совпадения фильтров, адресованные одному получателю.
+type recipientMatches struct {
+	recipient Recipient
+	results   []filters.FilterMatchResult
+}
+
+// groupByRecipient раскладывает совпадения по получателям, сохраняя порядок первого
+// появления получателя и порядок фильтров. Повтор получателя внутри фильтра игнорируется.
+func groupByRecipient(results []filters.FilterMatchResult) []recipientMatches {
+	var groups []recipientMatches
+	index := make(map[Recipient]int)
+	for _, res := range results {
+		for _, r := range res.Recipients {
+			rcpt := Recipient{Type: string(r.Type), ID: int64(r.PeerID)}
+			i, ok := index[rcpt]
+			if !ok {
+				i = len(groups)
+				index[rcpt] = i
+				groups = append(groups, recipientMatches{recipient: rcpt})
+			}
+			group := &groups[i]
+			if slices.ContainsFunc(group.results, func(prev filters.FilterMatchResult) bool {
+				return prev.Filter.ID == res.Filter.ID
+			}) {
+				continue
+			}
+			group.results = append(group.results, res)
+		}
+	}
+	return groups
+}
+
+// composeMatchText рендерит шаблоны всех совпадений и склеивает непустые различные тексты.
+func composeMatchText(results []filters.FilterMatchResult, link string) string {
+	var parts []string
+	for _, res := range results {
+		text := strings.TrimSpace(RenderTemplate(res.Filter.Notify.Template, res.Result, link))
+		if text == "" || slices.Contains(parts, text) {
+			continue
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, matchTextSeparator)
+}
+
+// matchFilterIDs возвращает ID фильтров совпадений в исходном порядке.
+func matchFilterIDs(results []filters.FilterMatchResult) []string {
+	ids := make([]string, 0, len(results))
+	for _, res := range results {
+		ids = append(ids, res.Filter.ID)
+	}
+	return ids
+}
+
+// matchTerms собирает сработавшие термины всех совпадений без повторов.
+func matchTerms(results []filters.FilterMatchResult) []string {
+	var terms []string
+	for _, res := range results {
+		for _, term := range res.Result.MatchedNode.Terms() {
+			if !slices.Contains(terms, term) {
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// anyForward сообщает, запросило ли пересылку оригинала хотя бы одно совпадение.
+func anyForward(results []filters.FilterMatchResult) bool {
+	return slices.ContainsFunc(results, func(res filters.FilterMatchResult) bool {
+		return res.Filter.Notify.Forward
+	})
+}
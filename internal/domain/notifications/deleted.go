@@ -0,0 +1,149 @@
+// Package notifications / файл deleted.go отвечает за реакцию очереди на удаление
+// исходных сообщений. Частый сценарий — спам или ошибочный пост удаляют до окна
+// расписания, и получатель видит уведомление со ссылкой «в никуда». Поэтому:
+//   - ожидающие задания с удалённым источником снимаются с очереди вместе с ожиданиями
+//     прочтения (эскалациями) и ещё не отправленными шагами эскалации;
+//   - доставленные задания фиксируются в ограниченном журнале State.Delivered
+//     (он же sent-ledger для правок, см. edited.go);
+//   - при включённой опции по журналу получатели получают пометку «(deleted)».
+
+package notifications
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Ограничения журнала доставленных заданий: держим только свежие записи,
+// чтобы файл очереди не разрастался. Удаления и правки старше суток почти не встречаются.
+const (
+	deliveredLedgerMax = 500
+	deliveredLedgerTTL = 24 * time.Hour
+)
+
+// deletedMarkPrefix — префикс служебной пометки об удалённом источнике.
+const deletedMarkPrefix = "(deleted)"
+
+// DropDeleted обрабатывает удаление исходных сообщений.
+// channelID != 0 — удаление в канале/мегагруппе (UpdateDeleteChannelMessages);
+// channelID == 0 — удаление в личке или обычной группе (UpdateDeleteMessages), где
+// ID сообщений уникальны в пределах аккаунта и чат в апдейте не передаётся.
+// Возвращает число снятых ожидающих заданий и число отправленных пометок «(deleted)».
+func (q *Queue) DropDeleted(channelID int64, messageIDs []int) (int, int) {
+	if len(messageIDs) == 0 {
+		return 0, 0
+	}
+	deleted := make(map[int]struct{}, len(messageIDs))
+	for _, id := range messageIDs {
+		deleted[id] = struct{}{}
+	}
+	matches := func(src SourceRef) bool {
+		if channelID != 0 {
+			if src.Peer.Type != RecipientTypeChannel || src.Peer.ID != channelID {
+				return false
+			}
+		} else if src.Peer.Type == RecipientTypeChannel {
+			return false
+		}
+		return slices.ContainsFunc(src.MessageIDs, func(id int) bool {
+			_, ok := deleted[id]
+			return ok
+		})
+	}
+
+	q.mu.Lock()
+	// Ожидания прочтения удалённого сообщения снимаются: повторять его бессмысленно.
+	escalated := make(map[int64]struct{})
+	q.state.Escalations = slices.DeleteFunc(q.state.Escalations, func(esc Escalation) bool {
+		if esc.Source == nil || !matches(*esc.Source) {
+			return false
+		}
+		escalated[esc.JobID] = struct{}{}
+		return true
+	})
+	pending := func(job Job) bool {
+		if _, ok := escalated[job.EscalationOf]; ok && job.EscalationOf != 0 {
+			return true
+		}
+		return job.Source != nil && matches(*job.Source)
+	}
+	before := len(q.state.Regular) + len(q.state.Urgent)
+	q.state.Regular = slices.DeleteFunc(q.state.Regular, pending)
+	q.state.Urgent = slices.DeleteFunc(q.state.Urgent, pending)
+	removed := before - len(q.state.Regular) - len(q.state.Urgent)
+
+	var marks []DeliveredRecord
+	if q.markDeleted {
+		q.state.Delivered = slices.DeleteFunc(q.state.Delivered, func(rec DeliveredRecord) bool {
+			if !matches(rec.Source) {
+				return false
+			}
+			marks = append(marks, rec)
+			return true
+		})
+	}
+	if removed > 0 || len(marks) > 0 || len(escalated) > 0 {
+		q.persistLocked()
+	}
+	q.mu.Unlock()
+
+	if removed > 0 {
+		logger.Infof("Queue: dropped %d pending job(s) for deleted messages %v", removed, messageIDs)
+	}
+	if len(escalated) > 0 {
+		logger.Infof("Queue: dropped %d escalation(s) for deleted messages %v", len(escalated), messageIDs)
+	}
+	for _, rec := range marks {
+		jobID := q.enqueue(Job{
+			Urgent:    true,
+			Recipient: rec.Recipient,
+			Payload:   Payload{Text: deletedMarkText(rec.Source), ReplyTo: rec.MessageID},
+			Transport: rec.Transport,
+		})
+		logger.Debugf("Queue: deleted mark job %d enqueued for job %d (recipient=%s:%d)",
+			jobID, rec.JobID, rec.Recipient.Type, rec.Recipient.ID)
+	}
+	return removed, len(marks)
+}
+
+// recordDelivered добавляет доставленное задание с источником в журнал вместе с ID
+// отправленного уведомления и транспортом и подрезает журнал по возрасту и размеру.
+// Служебные задания без Source (пометки, правки, ответы) не журналируются.
+func (q *Queue) recordDelivered(job Job, outcome SendOutcome) {
+	if job.Source == nil {
+		return
+	}
+	now := q.now().UTC()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.state.Delivered = slices.DeleteFunc(q.state.Delivered, func(rec DeliveredRecord) bool {
+		return now.Sub(rec.DeliveredAt) > deliveredLedgerTTL
+	})
+	q.state.Delivered = append(q.state.Delivered, DeliveredRecord{
+		JobID:       job.ID,
+		Recipient:   job.Recipient,
+		Source:      *cloneSourceRef(job.Source),
+		MessageID:   outcome.SentMessageID,
+		Text:        job.Payload.Text,
+		DeliveredAt: now,
+		Transport:   outcome.Transport,
+	})
+	if extra := len(q.state.Delivered) - deliveredLedgerMax; extra > 0 {
+		q.state.Delivered = slices.Delete(q.state.Delivered, 0, extra)
+	}
+	q.persistLocked()
+}
+
+// deletedMarkText формирует текст пометки: ссылка на источник, если она была, иначе peer и ID.
+func deletedMarkText(src SourceRef) string {
+	if src.Link != "" {
+		return fmt.Sprintf("%s source message was removed: %s", deletedMarkPrefix, src.Link)
+	}
+	return fmt.Sprintf("%s source message was removed: %s:%d/%v",
+		deletedMarkPrefix, src.Peer.Type, src.Peer.ID, src.MessageIDs)
+}
@@ -0,0 +1,73 @@
+// Package notifications / файл digest.go реализует доставку дайджестом.
+// Для транспортов вроде e-mail отдельное письмо на каждое совпадение — шум: регулярная
+// очередь и так копит задания до окна расписания. Если транспорт реализует DigestSender
+// и поддерживает получателя, при регулярном дренировании все готовые задания этого
+// получателя снимаются разом и уходят одним сообщением (одно письмо на окно).
+// Исход дайджеста применяется к каждому заданию по отдельности (повтор, dead-letter, журнал).
+
+package notifications
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"telegram-userbot/internal/infra/logger"
+)
+
+// DigestSender — необязательное расширение PreparedSender: доставка нескольких заданий
+// одного получателя одним сообщением.
+type DigestSender interface {
+	// Digest сообщает, собирать ли задания получателя в дайджест.
+	Digest(recipient Recipient) bool
+	// DeliverDigest доставляет задания (все — одному получателю) одним сообщением.
+	DeliverDigest(ctx context.Context, jobs []Job) (SendOutcome, error)
+}
+
+// popDigest дополняет снятое регулярное задание остальными готовыми заданиями того же
+// получателя, если транспорт доставляет его дайджестом. Порядок — по ID (порядок постановки).
+// deferredOnly ограничивает выборку отложенными заданиями, как в popRegular.
+func (q *Queue) popDigest(first Job, deferredOnly bool) []Job {
+	jobs := []Job{first}
+	ds, ok := q.sender.(DigestSender)
+	if !ok || first.Urgent || !ds.Digest(first.Recipient) {
+		return jobs
+	}
+
+	q.mu.Lock()
+	now := q.now()
+	q.state.Regular = slices.DeleteFunc(q.state.Regular, func(job Job) bool {
+		if job.Recipient != first.Recipient || !job.isDue(now) || (deferredOnly && !job.deferred()) {
+			return false
+		}
+		jobs = append(jobs, job)
+		return true
+	})
+	if len(jobs) > 1 {
+		q.persistLocked()
+	}
+	q.mu.Unlock()
+
+	slices.SortFunc(jobs, func(a, b Job) int { return cmp.Compare(a.ID, b.ID) })
+	return jobs
+}
+
+// handleDigest доставляет задания одним сообщением и применяет исход к каждому из них.
+// Возвращает true, если выборку нужно прервать (см. handleJob).
+func (q *Queue) handleDigest(jobs []Job) bool {
+	start := q.now()
+	recipient := jobs[0].Recipient
+	logger.Debugf("Queue: delivering digest of %d job(s) (recipient=%s:%d)",
+		len(jobs), recipient.Type, recipient.ID)
+
+	result, err := q.sender.(DigestSender).DeliverDigest(q.ctx, jobs)
+	if q.interrupted(jobs, result, err) {
+		return true
+	}
+	for _, job := range jobs {
+		q.settle(job, result, err)
+	}
+
+	logger.Debugf("Queue: digest of %d job(s) processed in %s", len(jobs), q.now().Sub(start))
+	return false
+}
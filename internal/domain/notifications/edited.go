@@ -0,0 +1,169 @@
+// Package notifications / файл edited.go отвечает за реакцию очереди на правку
+// исходного сообщения. Автор часто исправляет цену или время уже после того, как
+// уведомление ушло, и получатель остаётся со старым текстом. Поэтому:
+//   - у ожидающих заданий по этому источнику просто обновляется текст;
+//   - по sent-ledger (State.Delivered) находятся доставленные уведомления и, в
+//     зависимости от политики, их текст заменяется (edit) или им отправляется
+//     ответ с разницей (reply); политика ignore сохраняет прежнее поведение.
+
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/infra/logger"
+
+	"github.com/gotd/td/tg"
+)
+
+// Политики реакции на правку источника доставленного уведомления.
+const (
+	// EditPolicyEdit — заменить текст доставленного уведомления.
+	EditPolicyEdit = "edit"
+	// EditPolicyReply — ответить на доставленное уведомление сообщением с разницей.
+	EditPolicyReply = "reply"
+	// EditPolicyIgnore — не трогать уже поставленные и доставленные уведомления.
+	EditPolicyIgnore = "ignore"
+)
+
+// editedReplyPrefix — заголовок ответа с разницей при политике reply.
+const editedReplyPrefix = "(edited)"
+
+// normalizeEditPolicy приводит значение политики к одной из известных; пустое — edit.
+func normalizeEditPolicy(policy string) string {
+	switch p := strings.ToLower(strings.TrimSpace(policy)); p {
+	case EditPolicyEdit, EditPolicyReply, EditPolicyIgnore:
+		return p
+	case "":
+		return EditPolicyEdit
+	default:
+		logger.Warnf("Queue: unknown edit policy %q, using %q", policy, EditPolicyEdit)
+		return EditPolicyEdit
+	}
+}
+
+// NotifyEdited обновляет уведомления, уже созданные по сообщению msg фильтрами из results.
+// Текст каждого уведомления пересобирается из тех совпадений, фильтры которых в нём объединены.
+// Ожидающим заданиям заменяется текст; для доставленных по sent-ledger ставятся срочные
+// задания правки (EditOf) или ответа с разницей (ReplyTo) согласно политике очереди.
+// Возвращает число затронутых уведомлений.
+func (q *Queue) NotifyEdited(
+	entities tg.Entities,
+	msg *tg.Message,
+	results []filters.FilterMatchResult,
+) (int, error) {
+	if msg == nil {
+		return 0, errors.New("notifications queue: nil message")
+	}
+	if q.editPolicy == EditPolicyIgnore || len(results) == 0 {
+		return 0, nil
+	}
+	peer, err := peerToRecipient(msg.PeerID)
+	if err != nil {
+		return 0, fmt.Errorf("notifications queue: edited message %d: %w", msg.ID, err)
+	}
+
+	link := BuildMessageLink(q.peers, entities, msg)
+	// editedText возвращает новый текст уведомления с источником src; ok=false — источник
+	// не относится к msg или ни один из его фильтров не среди results.
+	editedText := func(src SourceRef) (string, bool) {
+		if src.Peer != peer || !slices.Contains(src.MessageIDs, msg.ID) {
+			return "", false
+		}
+		var own []filters.FilterMatchResult
+		for _, id := range src.Filters() {
+			if i := slices.IndexFunc(results, func(res filters.FilterMatchResult) bool {
+				return res.Filter.ID == id
+			}); i >= 0 {
+				own = append(own, results[i])
+			}
+		}
+		if len(own) == 0 {
+			return "", false
+		}
+		return composeMatchText(own, link), true
+	}
+
+	q.mu.Lock()
+	updated := 0
+	for _, list := range [][]Job{q.state.Urgent, q.state.Regular} {
+		for i := range list {
+			job := &list[i]
+			if job.Source == nil {
+				continue
+			}
+			text, ok := editedText(*job.Source)
+			if !ok || job.Payload.Text == text {
+				continue
+			}
+			job.Payload.Text = text
+			if job.Payload.Copy != nil && job.Payload.Forward != nil {
+				job.Payload.Copy = BuildCopyTextFromTG(msg)
+			}
+			updated++
+		}
+	}
+
+	var followUps []Job
+	for i := range q.state.Delivered {
+		rec := &q.state.Delivered[i]
+		if rec.MessageID == 0 {
+			continue
+		}
+		text, ok := editedText(rec.Source)
+		if !ok || rec.Text == text {
+			continue
+		}
+		// Правка сохраняет кнопки действий исходного уведомления (Bot API снимает их без reply_markup).
+		payload := Payload{Text: text, EditOf: rec.MessageID, Actions: rec.actionRef()}
+		if q.editPolicy == EditPolicyReply {
+			payload = Payload{Text: editedReplyText(rec.Text, text), ReplyTo: rec.MessageID}
+		}
+		followUps = append(followUps, Job{
+			Urgent:    true,
+			Recipient: rec.Recipient,
+			Payload:   payload,
+			Transport: rec.Transport,
+		})
+		// Текст в журнале обновляем сразу: повторная правка должна сравниваться с новым текстом.
+		rec.Text = text
+	}
+	if updated > 0 || len(followUps) > 0 {
+		q.persistLocked()
+	}
+	q.mu.Unlock()
+
+	for _, job := range followUps {
+		jobID := q.enqueue(job)
+		logger.Debugf("Queue: edit follow-up job %d enqueued (policy=%s recipient=%s:%d message=%d)",
+			jobID, q.editPolicy, job.Recipient.Type, job.Recipient.ID, job.Payload.EditOf+job.Payload.ReplyTo)
+	}
+	return updated + len(followUps), nil
+}
+
+// editedReplyText строит построчную разницу старого и нового текста: удалённые строки
+// помечаются «-», добавленные — «+». Порядок строк сохраняется.
+func editedReplyText(oldText, newText string) string {
+	oldLines := strings.Split(oldText, "\n")
+	newLines := strings.Split(newText, "\n")
+
+	var b strings.Builder
+	b.WriteString(editedReplyPrefix)
+	for _, line := range oldLines {
+		if !slices.Contains(newLines, line) {
+			b.WriteString("\n- ")
+			b.WriteString(line)
+		}
+	}
+	for _, line := range newLines {
+		if !slices.Contains(oldLines, line) {
+			b.WriteString("\n+ ")
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,238 @@
+// Package notifications / файл escalation.go реализует эскалацию непрочитанных
+// critical-уведомлений. Для дежурных алертов важно, что человек действительно увидел
+// сообщение, поэтому:
+//   - после доставки critical-уведомления через транспорт EscalationPolicy.Transport
+//     (client сообщает ID сообщения и видит прочтения) очередь заводит ожидание прочтения
+//     (State.Escalations, сохраняется вместе с очередью);
+//   - прочтение приходит апдейтом UpdateReadHistoryOutbox/UpdateReadChannelOutbox (AckRead);
+//   - если за EscalationPolicy.After уведомление не прочитано, оно отправляется следующему
+//     получателю из цепочки escalate в recipients.json, а без цепочки — повторно тому же
+//     получателю (не больше MaxResends раз);
+//   - ожидание снимается при прочтении любой из отправленных копий или исчерпании цепочки.
+
+package notifications
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/infra/logger"
+
+	"github.com/gotd/td/tg"
+)
+
+// escalationCheckInterval — период проверки ожиданий прочтения.
+const escalationCheckInterval = 15 * time.Second
+
+// escalationPrefix — заголовок повторной отправки непрочитанного уведомления.
+const escalationPrefix = "(unread, escalation"
+
+// EscalationPolicy задаёт эскалацию непрочитанных critical-уведомлений.
+// After == 0 отключает эскалацию; MaxResends ограничивает повторы получателю без цепочки.
+// Transport — транспорт, доставки которого отслеживаются и через который идут повторы
+// (пусто — любой: очередь работает с единственным транспортом без маршрутизации).
+type EscalationPolicy struct {
+	After      time.Duration
+	MaxResends int
+	Transport  string
+}
+
+// EscalationSent — отправленная копия уведомления, прочтение которой подтверждает эскалацию.
+type EscalationSent struct {
+	Recipient Recipient `json:"recipient"`
+	MessageID int       `json:"message_id"`
+}
+
+// Escalation — ожидание прочтения critical-уведомления: исходное задание и получатель,
+// текст для повторной отправки, отправленные копии, номер шага и момент следующего шага.
+// Source — исходное сообщение: его удаление снимает ожидание (см. DropDeleted).
+type Escalation struct {
+	JobID     int64            `json:"job_id"`
+	Recipient Recipient        `json:"recipient"`
+	Source    *SourceRef       `json:"source,omitempty"`
+	Text      string           `json:"text"`
+	Sent      []EscalationSent `json:"sent"`
+	Step      int              `json:"step"`
+	NextAt    time.Time        `json:"next_at"`
+}
+
+// cloneEscalations копирует ожидания прочтения вместе со списками отправленных копий.
+func cloneEscalations(in []Escalation) []Escalation {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]Escalation, len(in))
+	for i, esc := range in {
+		out[i] = esc
+		out[i].Sent = slices.Clone(esc.Sent)
+		if esc.Source != nil {
+			src := *esc.Source
+			src.MessageIDs = slices.Clone(esc.Source.MessageIDs)
+			out[i].Source = &src
+		}
+	}
+	return out
+}
+
+// trackEscalation вызывается после успешной доставки: заводит ожидание прочтения для
+// critical-уведомления или добавляет копию, отправленную шагом эскалации.
+func (q *Queue) trackEscalation(job Job, outcome SendOutcome) {
+	if q.escalation.After <= 0 || outcome.SentMessageID == 0 {
+		return
+	}
+	if q.escalation.Transport != "" && outcome.Transport != "" && outcome.Transport != q.escalation.Transport {
+		return
+	}
+	sentMessageID := outcome.SentMessageID
+	sent := EscalationSent{Recipient: job.Recipient, MessageID: sentMessageID}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job.EscalationOf != 0 {
+		idx := slices.IndexFunc(q.state.Escalations, func(esc Escalation) bool { return esc.JobID == job.EscalationOf })
+		if idx >= 0 {
+			q.state.Escalations[idx].Sent = append(q.state.Escalations[idx].Sent, sent)
+			q.persistLocked()
+		}
+		return
+	}
+	if job.Source == nil || job.EffectivePriority() != PriorityCritical {
+		return
+	}
+	q.state.Escalations = append(q.state.Escalations, Escalation{
+		JobID:     job.ID,
+		Recipient: job.Recipient,
+		Source:    job.Source,
+		Text:      job.Payload.Text,
+		Sent:      []EscalationSent{sent},
+		NextAt:    q.now().Add(q.escalation.After).UTC(),
+	})
+	q.persistLocked()
+	logger.Debugf("Queue: waiting for read of critical job %d (recipient=%s:%d message=%d)",
+		job.ID, job.Recipient.Type, job.Recipient.ID, sentMessageID)
+}
+
+// AckRead обрабатывает прочтение исходящих сообщений в чате peer до maxID включительно:
+// снимает ожидания, у которых прочитана хотя бы одна отправленная копия.
+// Возвращает число подтверждённых эскалаций.
+func (q *Queue) AckRead(peer tg.PeerClass, maxID int) int {
+	reader, err := peerToRecipient(peer)
+	if err != nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var acked []int64
+	q.state.Escalations = slices.DeleteFunc(q.state.Escalations, func(esc Escalation) bool {
+		read := slices.ContainsFunc(esc.Sent, func(s EscalationSent) bool {
+			return s.Recipient == reader && s.MessageID <= maxID
+		})
+		if read {
+			acked = append(acked, esc.JobID)
+		}
+		return read
+	})
+	if len(acked) == 0 {
+		return 0
+	}
+	q.persistLocked()
+	logger.Infof("Queue: critical job(s) %v acknowledged by %s:%d", acked, reader.Type, reader.ID)
+	return len(acked)
+}
+
+// escalationLoop периодически выполняет шаги эскалации; работает, пока жив контекст очереди.
+func (q *Queue) escalationLoop() {
+	ticker := time.NewTicker(escalationCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+			q.escalateDue()
+		}
+	}
+}
+
+// escalateDue выполняет очередной шаг для просроченных ожиданий: ставит срочное задание
+// следующему адресату или снимает ожидание, если адресаты исчерпаны.
+func (q *Queue) escalateDue() {
+	now := q.now()
+	var jobs []Job
+
+	q.mu.Lock()
+	before := len(q.state.Escalations)
+	q.state.Escalations = slices.DeleteFunc(q.state.Escalations, func(esc Escalation) bool {
+		return !now.Before(esc.NextAt) && q.escalationTarget(esc, esc.Step+1) == nil
+	})
+	changed := len(q.state.Escalations) != before
+	for i := range q.state.Escalations {
+		esc := &q.state.Escalations[i]
+		if now.Before(esc.NextAt) {
+			continue
+		}
+		esc.Step++
+		esc.NextAt = now.Add(q.escalation.After).UTC()
+		jobs = append(jobs, Job{
+			Urgent:       true,
+			Priority:     PriorityCritical,
+			Recipient:    *q.escalationTarget(*esc, esc.Step),
+			Payload:      Payload{Text: fmt.Sprintf("%s %d)\n%s", escalationPrefix, esc.Step, esc.Text)},
+			EscalationOf: esc.JobID,
+			Transport:    q.escalation.Transport,
+		})
+		changed = true
+	}
+	if changed {
+		q.persistLocked()
+	}
+	q.mu.Unlock()
+
+	for _, job := range jobs {
+		jobID := q.enqueue(job)
+		logger.Warnf("Queue: critical job %d unread, escalation job %d enqueued (recipient=%s:%d)",
+			job.EscalationOf, jobID, job.Recipient.Type, job.Recipient.ID)
+	}
+}
+
+// escalationTarget возвращает адресата шага step (с 1): получатель из цепочки escalate
+// исходного получателя, а без цепочки — сам получатель, пока не исчерпан MaxResends.
+// nil — шагов больше нет. Вызывать под q.mu.
+func (q *Queue) escalationTarget(esc Escalation, step int) *Recipient {
+	chain := q.escalationChain(esc.Recipient)
+	switch {
+	case len(chain) > 0 && step <= len(chain):
+		return &chain[step-1]
+	case len(chain) == 0 && step <= q.escalation.MaxResends:
+		target := esc.Recipient
+		return &target
+	default:
+		logger.Warnf("Queue: escalation for critical job %d exhausted after %d step(s)", esc.JobID, step-1)
+		return nil
+	}
+}
+
+// escalationChain разворачивает цепочку escalate получателя из recipients.json. Шаги на
+// webhook и email пропускаются: повтор уходит транспортом эскалации и ждёт прочтения в Telegram.
+func (q *Queue) escalationChain(r Recipient) []Recipient {
+	if q.recipients == nil {
+		return nil
+	}
+	rcpt, ok := q.recipients.RecipientByPeer(r.Type, r.ID)
+	if !ok {
+		return nil
+	}
+	var chain []Recipient
+	for _, id := range rcpt.Escalate {
+		next, found := q.recipients.RecipientByID(id)
+		if !found || next.Type == filters.RecipientTypeWebhook || next.Type == filters.RecipientTypeEmail {
+			continue
+		}
+		chain = append(chain, Recipient{Type: string(next.Type), ID: int64(next.PeerID)})
+	}
+	return chain
+}
@@ -0,0 +1,112 @@
+// Package notifications / файл expired.go снимает устаревшие регулярные задания.
+// Если сервис простоял выходные, ближайшее окно расписания разослало бы сотни
+// уведомлений о давно неактуальных предложениях. Поэтому у регулярного задания есть
+// срок актуальности (Job.ExpiresAt: notify.ttl фильтра или глобальный дефолт), и перед
+// дренированием, а также при старте просроченные задания снимаются с очереди:
+//   - политика drop — молча;
+//   - политика summary — получателю уходит одна сводка «N expired notification(s) skipped».
+
+package notifications
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Политики обработки просроченных заданий.
+const (
+	// ExpiredPolicyDrop — снять просроченные задания без уведомления получателя.
+	ExpiredPolicyDrop = "drop"
+	// ExpiredPolicySummary — снять и отправить получателю сводку с числом пропущенных.
+	ExpiredPolicySummary = "summary"
+)
+
+// normalizeExpiredPolicy приводит значение политики к одной из известных; пустое — summary.
+func normalizeExpiredPolicy(policy string) string {
+	switch p := strings.ToLower(strings.TrimSpace(policy)); p {
+	case ExpiredPolicyDrop, ExpiredPolicySummary:
+		return p
+	case "":
+		return ExpiredPolicySummary
+	default:
+		logger.Warnf("Queue: unknown expired policy %q, using %q", policy, ExpiredPolicySummary)
+		return ExpiredPolicySummary
+	}
+}
+
+// jobTTL вычисляет срок актуальности объединённого задания: фильтр без notify.ttl
+// получает глобальный дефолт; берётся максимальный срок, а 0 (без ограничения) у любого
+// из фильтров отключает истечение.
+func (q *Queue) jobTTL(results []filters.FilterMatchResult) time.Duration {
+	var ttl time.Duration
+	for _, res := range results {
+		d := res.Filter.Notify.TTLDuration
+		if d <= 0 {
+			d = q.defaultTTL
+		}
+		if d <= 0 {
+			return 0
+		}
+		ttl = max(ttl, d)
+	}
+	return ttl
+}
+
+// isExpired сообщает, истёк ли срок актуальности задания к моменту now.
+func (j Job) isExpired(now time.Time) bool {
+	return !j.ExpiresAt.IsZero() && !now.Before(j.ExpiresAt)
+}
+
+// dropExpired снимает просроченные регулярные задания и, при политике summary,
+// ставит получателям сводки. Возвращает число снятых заданий.
+func (q *Queue) dropExpired(reason string) int {
+	now := q.now()
+
+	q.mu.Lock()
+	counts := make(map[Recipient]int)
+	var order []Recipient
+	q.state.Regular = slices.DeleteFunc(q.state.Regular, func(job Job) bool {
+		if !job.isExpired(now) {
+			return false
+		}
+		if counts[job.Recipient] == 0 {
+			order = append(order, job.Recipient)
+		}
+		counts[job.Recipient]++
+		return true
+	})
+	removed := 0
+	for _, n := range counts {
+		removed += n
+	}
+	if removed > 0 {
+		q.persistLocked()
+	}
+	q.mu.Unlock()
+
+	if removed == 0 {
+		return 0
+	}
+	logger.Infof("Queue: dropped %d expired regular job(s) for %d recipient(s) (%s, policy=%s)",
+		removed, len(order), reason, q.expiredPolicy)
+
+	if q.expiredPolicy != ExpiredPolicySummary {
+		return removed
+	}
+	for _, rcpt := range order {
+		job := Job{
+			Priority:  PriorityLow,
+			Recipient: rcpt,
+			Payload:   Payload{Text: fmt.Sprintf("%d expired notification(s) skipped", counts[rcpt])},
+		}
+		jobID := q.enqueue(job)
+		logger.Debugf("Queue: expired summary job %d enqueued (recipient=%s:%d skipped=%d)",
+			jobID, rcpt.Type, rcpt.ID, counts[rcpt])
+	}
+	return removed
+}
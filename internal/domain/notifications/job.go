@@ -5,7 +5,10 @@
 
 package notifications
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 // Recipient описывает получателя уведомления: тип peer и его числовой идентификатор.
 // Тип хранится как человекочитаемая строка (user/chat/channel), чтобы JSON был стабилен,
@@ -23,6 +26,10 @@ const (
 	RecipientTypeChat = "chat"
 	// RecipientTypeChannel маркирует каналы и мегагруппы, требующие InputPeerChannel.
 	RecipientTypeChannel = "channel"
+	// RecipientTypeWebhook — внешний HTTP-сервис; ID синтетический (см. filters.Recipient).
+	RecipientTypeWebhook = "webhook"
+	// RecipientTypeEmail — адрес электронной почты; ID синтетический (см. filters.Recipient).
+	RecipientTypeEmail = "email"
 )
 
 // ForwardSpec описывает пересылку оригинального сообщения вместе с уведомлением.
@@ -37,32 +44,107 @@ type ForwardSpec struct {
 // Payload содержит финальный текст уведомления и опциональную спецификацию пересылки/копии.
 // Текст уже отрендерен по шаблону и не требует постобработки у транспорта.
 // Поле Copy используется, когда пересылка недоступна или нежелательна; тип CopyText определяется в пакете отправителя.
+// EditOf != 0 — не отправлять новое сообщение, а заменить текст ранее доставленного уведомления
+// с этим ID; ReplyTo != 0 — отправить текст ответом на ранее доставленное уведомление.
+// Actions — кнопки действий исходного уведомления, которые правка EditOf должна сохранить.
 type Payload struct {
 	Text    string       `json:"text"`
 	Forward *ForwardSpec `json:"forward,omitempty"`
 	Copy    *CopyText    `json:"copy,omitempty"`
+	EditOf  int          `json:"edit_of,omitempty"`
+	ReplyTo int          `json:"reply_to,omitempty"`
+	Actions *ActionRef   `json:"actions,omitempty"`
+}
+
+// SourceRef ссылается на исходное сообщение, по которому создан job: чат и ID сообщения
+// (для альбома — все части) и сработавшие фильтры. Нужен, чтобы отозвать задание, если
+// источник удалили, и обновить уведомление, если источник отредактировали.
+// FilterIDs — все фильтры, совпадения которых объединены в задании (см. coalesce.go);
+// FilterID заполнен только у заданий, сохранённых до объединения совпадений.
+// Link — ссылка на источник на момент постановки, используется в служебных пометках.
+// Terms — сработавшие ключевые слова и паттерны фильтров (передаются во webhook).
+// Account — аккаунт, увидевший сообщение (пусто у заданий, сохранённых до нескольких аккаунтов).
+type SourceRef struct {
+	Peer       Recipient `json:"peer"`
+	MessageIDs []int     `json:"message_ids"`
+	FilterIDs  []string  `json:"filter_ids,omitempty"`
+	FilterID   string    `json:"filter_id,omitempty"`
+	Link       string    `json:"link,omitempty"`
+	Terms      []string  `json:"terms,omitempty"`
+	Account    string    `json:"account,omitempty"`
+}
+
+// Filters возвращает ID фильтров источника с учётом устаревшего поля FilterID.
+func (s SourceRef) Filters() []string {
+	if len(s.FilterIDs) == 0 && s.FilterID != "" {
+		return []string{s.FilterID}
+	}
+	return s.FilterIDs
 }
 
 // Job — единица работы очереди уведомлений. Один job адресуется одному получателю.
 // Идентификатор ID монотонно растёт и используется, среди прочего, для детерминированного random_id.
-// Порядок доставки получателям — FIFO.
+// Порядок доставки получателям — FIFO. Source отсутствует у служебных заданий (Send, пометки).
+// Attempts/LastError/NextAttemptAt описывают ретраи: задание с NextAttemptAt в будущем
+// пропускается выборкой и не блокирует задания за ним (см. retry.go).
+// ExpiresAt — срок актуальности регулярного задания; просроченные снимаются (см. expired.go).
+// Priority — уровень приоритета (см. priority.go); Urgent выводится из него и выбирает очередь.
+// HeldUntil — до какого момента задание удерживается тихими часами получателя (см. quiet.go);
+// Silent — доставить без звука независимо от приоритета (политика тихих часов silent).
+// EscalationOf — ID critical-задания, повтор которого выполняет это задание (см. escalation.go).
+// Transport — закрепляет задание за транспортом (см. router.go); пусто — маршрут получателя.
 type Job struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Urgent    bool      `json:"urgent"`
-	Recipient Recipient `json:"recipient"`
-	Payload   Payload   `json:"payload"`
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Urgent        bool       `json:"urgent"`
+	Priority      Priority   `json:"priority,omitempty"`
+	Recipient     Recipient  `json:"recipient"`
+	Payload       Payload    `json:"payload"`
+	Source        *SourceRef `json:"source,omitempty"`
+	Attempts      int        `json:"attempts,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at,omitzero"`
+	ExpiresAt     time.Time  `json:"expires_at,omitzero"`
+	HeldUntil     time.Time  `json:"held_until,omitzero"`
+	Silent        bool       `json:"silent,omitempty"`
+	EscalationOf  int64      `json:"escalation_of,omitempty"`
+	Transport     string     `json:"transport,omitempty"`
+}
+
+// SilentDelivery сообщает транспорту, доставлять ли задание без звука.
+func (j Job) SilentDelivery() bool {
+	return j.Silent || j.EffectivePriority().Silent()
+}
+
+// DeliveredRecord — запись журнала отправленных заданий (sent-ledger): кому и по какому
+// источнику ушло уведомление, ID сообщения-уведомления у получателя и его текущий текст.
+// MessageID = 0, если транспорт не сообщил ID (тогда правка невозможна).
+// Transport — транспорт, отправивший уведомление: правки и ответы идут через него же.
+// Журнал ограничен по размеру и возрасту (см. deliveredLedgerMax/TTL).
+type DeliveredRecord struct {
+	JobID       int64     `json:"job_id"`
+	Recipient   Recipient `json:"recipient"`
+	Source      SourceRef `json:"source"`
+	MessageID   int       `json:"message_id,omitempty"`
+	Text        string    `json:"text,omitempty"`
+	DeliveredAt time.Time `json:"delivered_at"`
+	Transport   string    `json:"transport,omitempty"`
 }
 
 // State — сериализуемый снимок очереди: бэклоги urgent/regular, счётчик NextID и метки времени.
 // LastRegularDrainAt помогает определить пропущенное окно расписания после рестарта.
+// Delivered — ограниченный журнал недавно доставленных заданий с источником.
+// Mutes — отключённые получателями фильтры и чаты (см. mute.go).
 // Все времени хранятся в UTC.
 type State struct {
-	LastFlushAt        time.Time `json:"last_flush_at"`
-	LastRegularDrainAt time.Time `json:"last_regular_drain_at"`
-	NextID             int64     `json:"next_id"`
-	Regular            []Job     `json:"regular"`
-	Urgent             []Job     `json:"urgent"`
+	LastFlushAt        time.Time         `json:"last_flush_at"`
+	LastRegularDrainAt time.Time         `json:"last_regular_drain_at"`
+	NextID             int64             `json:"next_id"`
+	Regular            []Job             `json:"regular"`
+	Urgent             []Job             `json:"urgent"`
+	Delivered          []DeliveredRecord `json:"delivered,omitempty"`
+	Escalations        []Escalation      `json:"escalations,omitempty"`
+	Mutes              []Mute            `json:"mutes,omitempty"`
 }
 
 // FailedRecord фиксирует окончательно провалившуюся доставку: полный снимок job
@@ -84,6 +166,7 @@ func DefaultState() State {
 func (j Job) Clone() Job {
 	clone := j
 	clone.Payload = clonePayload(j.Payload)
+	clone.Source = cloneSourceRef(j.Source)
 	return clone
 }
 
@@ -92,6 +175,9 @@ func (s State) Clone() State {
 	clone := s
 	clone.Regular = cloneJobs(s.Regular)
 	clone.Urgent = cloneJobs(s.Urgent)
+	clone.Delivered = cloneDelivered(s.Delivered)
+	clone.Escalations = cloneEscalations(s.Escalations)
+	clone.Mutes = slices.Clone(s.Mutes)
 	return clone
 }
 
@@ -120,6 +206,10 @@ func clonePayload(in Payload) Payload {
 	if in.Forward != nil {
 		clone.Forward = cloneForwardSpec(in.Forward)
 	}
+	if in.Actions != nil {
+		actions := *in.Actions
+		clone.Actions = &actions
+	}
 	return clone
 }
 
@@ -132,3 +222,30 @@ func cloneForwardSpec(in *ForwardSpec) *ForwardSpec {
 	clone.MessageIDs = append([]int(nil), in.MessageIDs...)
 	return &clone
 }
+
+// cloneSourceRef делает независимую копию SourceRef и её срезов.
+func cloneSourceRef(in *SourceRef) *SourceRef {
+	if in == nil {
+		return nil
+	}
+	clone := *in
+	clone.MessageIDs = append([]int(nil), in.MessageIDs...)
+	clone.FilterIDs = append([]string(nil), in.FilterIDs...)
+	clone.Terms = append([]string(nil), in.Terms...)
+	return &clone
+}
+
+// cloneDelivered копирует журнал доставленных заданий вместе с вложенными срезами.
+func cloneDelivered(in []DeliveredRecord) []DeliveredRecord {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]DeliveredRecord, len(in))
+	for i, rec := range in {
+		out[i] = rec
+		out[i].Source.MessageIDs = append([]int(nil), rec.Source.MessageIDs...)
+		out[i].Source.FilterIDs = append([]string(nil), rec.Source.FilterIDs...)
+		out[i].Source.Terms = append([]string(nil), rec.Source.Terms...)
+	}
+	return out
+}
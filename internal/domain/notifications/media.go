@@ -0,0 +1,53 @@
+// Package notifications / файл media.go описывает мост медиа между транспортами.
+// Бот не состоит в отслеживаемых чатах и не может переслать оригинал, поэтому вместо
+// пересылки он отправляет копию: текст (CopyText) и — через MediaFetcher — файлы,
+// скачанные MTProto-клиентом во временный каталог. Файлы живут только на время
+// доставки одного задания: вызывающий обязан вызвать MediaBundle.Cleanup.
+
+package notifications
+
+import (
+	"context"
+	"os"
+)
+
+// Виды медиа, различаемые при повторной загрузке через Bot API.
+const (
+	MediaKindPhoto     = "photo"
+	MediaKindVideo     = "video"
+	MediaKindAnimation = "animation"
+	MediaKindAudio     = "audio"
+	MediaKindVoice     = "voice"
+	MediaKindDocument  = "document"
+)
+
+// MediaFile — скачанный файл исходного сообщения.
+type MediaFile struct {
+	Kind     string // см. MediaKind*
+	Path     string // путь к временному файлу
+	FileName string // имя для загрузки (из атрибутов документа или сгенерированное)
+	MimeType string
+	Size     int64
+}
+
+// MediaBundle — файлы медиа исходных сообщений (для альбома — по файлу на часть) в порядке ID.
+// Dir — временный каталог, удаляемый Cleanup.
+type MediaBundle struct {
+	Files []MediaFile
+	Dir   string
+}
+
+// Cleanup удаляет временный каталог с файлами. Безопасен для пустого bundle.
+func (b MediaBundle) Cleanup() error {
+	if b.Dir == "" {
+		return nil
+	}
+	return os.RemoveAll(b.Dir)
+}
+
+// MediaFetcher скачивает медиа исходных сообщений from/messageIDs во временный каталог.
+// Файлы, превышающие лимиты загрузки транспорта, пропускаются; сообщения без медиа
+// в bundle не попадают. Пустой bundle без ошибки — медиа нет.
+type MediaFetcher interface {
+	FetchMedia(ctx context.Context, from Recipient, messageIDs []int) (MediaBundle, error)
+}
@@ -0,0 +1,187 @@
+// Package notifications / файл mute.go реализует временное отключение уведомлений
+// (кнопки бота, см. actions.go, и команда mute) и отложенный повтор («snooze»):
+//   - отключение действует на пару «получатель + фильтр» либо «получатель + чат-источник»,
+//     отключение без получателя — на фильтр для всех получателей;
+//   - отключения хранятся в State.Mutes вместе с очередью, поэтому переживают рестарт;
+//   - совпадения отключённых фильтров и чатов не создают заданий, а уже ожидающие задания,
+//     целиком попадающие под отключение, снимаются с очереди;
+//   - истёкшие отключения удаляются при следующем изменении списка.
+
+package notifications
+
+import (
+	"slices"
+	"time"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Длительность отключений, выставляемых кнопками уведомления.
+const (
+	MuteFilterFor = time.Hour
+	MuteChatFor   = 24 * time.Hour
+)
+
+// Mute — отключение уведомлений получателю Recipient до Until: по фильтру FilterID
+// или, если он пуст, по чату-источнику Chat. Нулевой Recipient — все получатели.
+type Mute struct {
+	Recipient Recipient `json:"recipient"`
+	FilterID  string    `json:"filter_id,omitempty"`
+	Chat      Recipient `json:"chat,omitzero"`
+	Until     time.Time `json:"until"`
+}
+
+// sameTarget сообщает, что отключения относятся к одной паре получателя и фильтра/чата.
+func (m Mute) sameTarget(other Mute) bool {
+	return m.Recipient == other.Recipient && m.FilterID == other.FilterID && m.Chat == other.Chat
+}
+
+// Mute добавляет отключение (продлевает существующее для той же пары, но не сокращает его:
+// сократить можно только снятием через Unmute) и снимает ожидающие задания получателя,
+// целиком попадающие под действующие отключения. Возвращает число снятых заданий.
+func (q *Queue) Mute(m Mute) int {
+	now := q.now()
+	m.Until = m.Until.UTC()
+
+	q.mu.Lock()
+	q.state.Mutes = slices.DeleteFunc(q.state.Mutes, func(prev Mute) bool {
+		if now.Before(prev.Until) && prev.sameTarget(m) && prev.Until.After(m.Until) {
+			m.Until = prev.Until
+		}
+		return !now.Before(prev.Until) || prev.sameTarget(m)
+	})
+	q.state.Mutes = append(q.state.Mutes, m)
+
+	muted := func(job Job) bool { return q.jobMutedLocked(job, now) }
+	before := len(q.state.Regular) + len(q.state.Urgent)
+	q.state.Regular = slices.DeleteFunc(q.state.Regular, muted)
+	q.state.Urgent = slices.DeleteFunc(q.state.Urgent, muted)
+	removed := before - len(q.state.Regular) - len(q.state.Urgent)
+	q.persistLocked()
+	q.mu.Unlock()
+
+	logger.Infof("Queue: muted filter=%q chat=%s:%d for %s:%d until %s, dropped %d pending job(s)",
+		m.FilterID, m.Chat.Type, m.Chat.ID, m.Recipient.Type, m.Recipient.ID,
+		m.Until.Format(time.RFC3339), removed)
+	return removed
+}
+
+// Unmute снимает все отключения фильтра filterID и возвращает их число.
+func (q *Queue) Unmute(filterID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	before := len(q.state.Mutes)
+	q.state.Mutes = slices.DeleteFunc(q.state.Mutes, func(m Mute) bool { return m.FilterID == filterID })
+	removed := before - len(q.state.Mutes)
+	if removed > 0 {
+		q.persistLocked()
+		logger.Infof("Queue: filter %q unmuted (%d mute(s) removed)", filterID, removed)
+	}
+	return removed
+}
+
+// Mutes возвращает действующие отключения в порядке добавления.
+func (q *Queue) Mutes() []Mute {
+	now := q.now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []Mute
+	for _, m := range q.state.Mutes {
+		if now.Before(m.Until) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// unmutedLocked оставляет совпадения, не отключённые для получателя r; chat — источник.
+// Отключение чата снимает все совпадения. Вызывать под q.mu.
+func (q *Queue) unmutedLocked(
+	r Recipient,
+	chat Recipient,
+	results []filters.FilterMatchResult,
+	now time.Time,
+) []filters.FilterMatchResult {
+	if len(q.state.Mutes) == 0 {
+		return results
+	}
+	var out []filters.FilterMatchResult
+	for _, res := range results {
+		if !q.mutedLocked(r, chat, res.Filter.ID, now) {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// jobMutedLocked сообщает, что все фильтры задания (или его чат) отключены для получателя.
+// Служебные задания без Source не отключаются. Вызывать под q.mu.
+func (q *Queue) jobMutedLocked(job Job, now time.Time) bool {
+	if job.Source == nil {
+		return false
+	}
+	ids := job.Source.Filters()
+	if len(ids) == 0 {
+		return q.mutedLocked(job.Recipient, job.Source.Peer, "", now)
+	}
+	for _, id := range ids {
+		if !q.mutedLocked(job.Recipient, job.Source.Peer, id, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// mutedLocked проверяет действующее отключение фильтра filterID или чата chat для получателя r.
+func (q *Queue) mutedLocked(r Recipient, chat Recipient, filterID string, now time.Time) bool {
+	return slices.ContainsFunc(q.state.Mutes, func(m Mute) bool {
+		if (m.Recipient != Recipient{} && m.Recipient != r) || !now.Before(m.Until) {
+			return false
+		}
+		if m.FilterID != "" {
+			return m.FilterID == filterID
+		}
+		return m.Chat == chat
+	})
+}
+
+// Snooze повторно ставит доставленное уведомление rec в регулярную очередь: получатель
+// увидит его в ближайшем окне расписания. Повторное нажатие не плодит копий, пока
+// отложенное задание ожидает. Возвращает ID задания и false, если оно уже ожидает.
+func (q *Queue) Snooze(rec DeliveredRecord) (int64, bool) {
+	q.mu.Lock()
+	idx := slices.IndexFunc(q.state.Regular, func(job Job) bool {
+		return job.Recipient == rec.Recipient && job.Source != nil &&
+			job.Source.Peer == rec.Source.Peer && slices.Equal(job.Source.MessageIDs, rec.Source.MessageIDs)
+	})
+	if idx >= 0 {
+		jobID := q.state.Regular[idx].ID
+		q.mu.Unlock()
+		return jobID, false
+	}
+	q.mu.Unlock()
+
+	src := rec.Source
+	jobID := q.enqueue(Job{
+		Priority:  PriorityNormal,
+		Recipient: rec.Recipient,
+		Payload:   Payload{Text: rec.Text},
+		Source:    cloneSourceRef(&src),
+		Transport: rec.Transport,
+	})
+	logger.Infof("Queue: job %d snoozed as job %d until next window (recipient=%s:%d)",
+		rec.JobID, jobID, rec.Recipient.Type, rec.Recipient.ID)
+	return jobID, true
+}
+
+// Delivered возвращает копию записи журнала доставленных заданий по ID задания.
+func (q *Queue) Delivered(jobID int64) (DeliveredRecord, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	idx := slices.IndexFunc(q.state.Delivered, func(rec DeliveredRecord) bool { return rec.JobID == jobID })
+	if idx < 0 {
+		return DeliveredRecord{}, false
+	}
+	return cloneDelivered(q.state.Delivered[idx : idx+1])[0], true
+}
@@ -0,0 +1,118 @@
+// Package notifications / файл priority.go вводит уровни приоритета уведомлений вместо
+// одного флага Urgent. Приоритет определяет и планирование, и «громкость» доставки:
+//   - low      — только регулярное окно расписания, доставка без звука. Отдельного дайджеста
+//     для low нет: в Telegram каждое задание уходит своим сообщением, одним сообщением на окно
+//     задания собираются только у транспортов с DigestSender (e-mail, см. digest.go);
+//   - normal   — регулярное окно расписания, обычная доставка;
+//   - high     — немедленно (срочная очередь);
+//   - critical — немедленно, игнорируя тихие часы получателя.
+//
+// Внутри одной выборки задания отдаются в порядке убывания приоритета, при равенстве — FIFO.
+// Job.Urgent остаётся признаком срочной очереди и выводится из приоритета.
+
+package notifications
+
+import (
+	"strings"
+
+	"telegram-userbot/internal/domain/filters"
+)
+
+// Priority — уровень приоритета уведомления.
+type Priority string
+
+// Уровни приоритета в порядке возрастания.
+const (
+	PriorityLow      Priority = "low"
+	PriorityNormal   Priority = "normal"
+	PriorityHigh     Priority = "high"
+	PriorityCritical Priority = "critical"
+)
+
+// priorityRank задаёт порядок уровней; неизвестный или пустой уровень считается normal.
+var priorityRank = map[Priority]int{
+	PriorityLow:      0,
+	PriorityNormal:   1,
+	PriorityHigh:     2,
+	PriorityCritical: 3,
+}
+
+// ParsePriority разбирает строковый уровень; ok=false для неизвестного значения.
+func ParsePriority(value string) (Priority, bool) {
+	p := Priority(strings.ToLower(strings.TrimSpace(value)))
+	_, ok := priorityRank[p]
+	return p, ok
+}
+
+// rank возвращает порядковый номер уровня.
+func (p Priority) rank() int {
+	if r, ok := priorityRank[p]; ok {
+		return r
+	}
+	return priorityRank[PriorityNormal]
+}
+
+// Immediate сообщает, минует ли уведомление расписание (срочная очередь).
+func (p Priority) Immediate() bool {
+	return p.rank() >= priorityRank[PriorityHigh]
+}
+
+// Silent сообщает, доставлять ли уведомление без звука.
+func (p Priority) Silent() bool {
+	return p == PriorityLow
+}
+
+// BypassQuiet сообщает, игнорирует ли уведомление тихие часы получателя.
+func (p Priority) BypassQuiet() bool {
+	return p == PriorityCritical
+}
+
+// EffectivePriority возвращает приоритет задания; у заданий, сохранённых до введения
+// уровней, он выводится из Urgent.
+func (j Job) EffectivePriority() Priority {
+	if j.Priority != "" {
+		return j.Priority
+	}
+	if j.Urgent {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// FilterPriority возвращает приоритет фильтра: явный notify.priority или, для старых
+// конфигураций, high при urgent=true и normal иначе.
+func FilterPriority(n filters.Notify) Priority {
+	if p, ok := ParsePriority(n.Priority); ok {
+		return p
+	}
+	if n.Urgent {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// maxPriority возвращает наивысший приоритет среди совпадений.
+func maxPriority(results []filters.FilterMatchResult) Priority {
+	best := PriorityLow
+	for _, res := range results {
+		if p := FilterPriority(res.Filter.Notify); p.rank() > best.rank() {
+			best = p
+		}
+	}
+	return best
+}
+
+// nextByPriority возвращает индекс задания для выдачи: наивысший приоритет среди
+// подходящих (ok), при равенстве — первое по порядку; -1, если подходящих нет.
+func nextByPriority(jobs []Job, ok func(Job) bool) int {
+	idx := -1
+	for i, job := range jobs {
+		if !ok(job) {
+			continue
+		}
+		if idx < 0 || job.EffectivePriority().rank() > jobs[idx].EffectivePriority().rank() {
+			idx = i
+		}
+	}
+	return idx
+}
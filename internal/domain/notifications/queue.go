@@ -10,6 +10,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -44,24 +45,51 @@ type PreparedSender interface {
 //   - PermanentFailures — список получателей, которым доставить нельзя (бан, 403 и т.п.);
 //   - PermanentError — агрегированное описание причины перманентного сбоя;
 //   - NetworkDown — транспорт сообщил об оффлайне; очередь приостановит дренирование и подождёт online;
-//   - Retry — рекомендовано повторить попытку позднее (например, 429).
+//   - Retry — рекомендовано повторить попытку позднее (например, 429);
+//   - SentMessageID — ID отправленного текста уведомления у получателя (0, если неизвестен);
+//   - Transport — имя транспорта, выполнившего доставку (заполняет RouterSender).
 type SendOutcome struct {
 	PermanentFailures []Recipient
 	PermanentError    error
 	NetworkDown       bool
 	Retry             bool
+	SentMessageID     int
+	Transport         string
 }
 
 // QueueOptions — зависимости и параметры очереди: транспорт, сторы, расписание, таймзона и часы.
 // Clock допускает внедрение монотонного времени в тестах; по умолчанию используется time.Now.
+// MarkDeleted включает пометку «(deleted)» для уже доставленных уведомлений об удалённых сообщениях.
+// EditPolicy задаёт реакцию на правку источника уже доставленного уведомления (см. EditPolicy*).
+// Retry — политика повторов отдельного задания; нулевые поля заменяются значениями по умолчанию.
+// DefaultTTL — срок актуальности регулярного задания для фильтров без notify.ttl (0 — без срока);
+// ExpiredPolicy — что делать с просроченными заданиями (см. ExpiredPolicy*).
+// Recipients — справочник получателей с окнами тихих часов; QuietPolicy — hold|silent (см. quiet.go).
+// Escalation — эскалация непрочитанных critical-уведомлений (только для транспорта с ID сообщений
+// и апдейтами прочтения, т.е. client); нулевое значение отключает её.
 type QueueOptions struct {
-	Sender   PreparedSender
-	Store    *QueueStore
-	Failed   *FailedStore
-	Schedule []string
-	Location *time.Location
-	Clock    func() time.Time
-	Peers    *peersmgr.Service
+	Sender      PreparedSender
+	Store       *QueueStore
+	Failed      *FailedStore
+	Schedule    []string
+	Location    *time.Location
+	Clock       func() time.Time
+	Peers       *peersmgr.Service
+	MarkDeleted bool
+	EditPolicy  string
+	Retry       RetryPolicy
+
+	DefaultTTL    time.Duration
+	ExpiredPolicy string
+
+	Recipients  *filters.FilterEngine
+	QuietPolicy string
+	Escalation  EscalationPolicy
+
+	// Account — имя аккаунта, чьи сообщения ставятся в очередь: попадает в источник заданий
+	// и кнопки действий; Conn — его соединение (nil — менеджер соединения по умолчанию).
+	Account string
+	Conn    *connection.Manager
 }
 
 // scheduleEntry — нормализованный слот расписания в локальной таймзоне.
@@ -74,9 +102,12 @@ type scheduleEntry struct {
 
 // drainSignal — запрос на дренирование регулярной очереди.
 // preHookDone=true означает, что BeforeDrain уже вызван на продьюсер‑пути.
+// deferredOnly=true — дренировать только созревшие отложенные задания (ретраи, тихие часы),
+// не закрывая окно расписания.
 type drainSignal struct {
-	reason      string
-	preHookDone bool
+	reason       string
+	preHookDone  bool
+	deferredOnly bool
 }
 
 // beforeDrainer объявляет необязательный хук транспорта, вызываемый перед началом дренирования.
@@ -84,6 +115,10 @@ type beforeDrainer interface{ BeforeDrain(context.Context) }
 
 // QueueStats — снимок состояния для CLI/мониторинга.
 // Важно: NextScheduleAt возвращается в UTC; для отображения используйте Location.
+// Retrying — общее число заданий в ретрае, Retries — ближайшие из них (не более retryTimelineLimit).
+// Quiet — получатели, находящиеся сейчас в тихих часах, с числом удерживаемых заданий.
+// Escalations — число critical-уведомлений, ожидающих прочтения.
+// Mutes — действующие отключения фильтров и чатов (см. mute.go).
 type QueueStats struct {
 	Urgent             int
 	Regular            int
@@ -91,6 +126,12 @@ type QueueStats struct {
 	LastFlushAt        time.Time
 	NextScheduleAt     time.Time // в UTC
 	Location           *time.Location
+	Retrying           int
+	Retries            []RetryInfo
+	MaxAttempts        int
+	Quiet              []QuietInfo
+	Escalations        int
+	Mutes              []Mute
 }
 
 // Queue — основная структура очереди уведомлений.
@@ -104,6 +145,25 @@ type Queue struct {
 	schedule []scheduleEntry
 	peers    *peersmgr.Service
 
+	// markDeleted — отправлять ли пометку «(deleted)» по доставленным уведомлениям
+	markDeleted bool
+	// editPolicy — реакция на правку источника (edit|reply|ignore)
+	editPolicy string
+	// retry — политика повторов; retryTimer будит воркер к ближайшему NextAttemptAt (под mu)
+	retry      RetryPolicy
+	retryTimer *time.Timer
+	// defaultTTL и expiredPolicy — срок актуальности регулярных заданий и реакция на его истечение
+	defaultTTL    time.Duration
+	expiredPolicy string
+	// recipients и quietPolicy — тихие часы получателей (nil — тихие часы отключены)
+	recipients  *filters.FilterEngine
+	quietPolicy string
+	// escalation — политика эскалации непрочитанных critical-уведомлений
+	escalation EscalationPolicy
+	// account и conn — аккаунт источников заданий и его соединение
+	account string
+	conn    *connection.Manager
+
 	mu    sync.Mutex
 	state State
 
@@ -182,16 +242,27 @@ func NewQueue(opts QueueOptions) (*Queue, error) {
 	state.Regular = validRegular
 
 	q := &Queue{
-		sender:    opts.Sender,
-		store:     opts.Store,
-		failed:    opts.Failed,
-		location:  location,
-		schedule:  schedule,
-		peers:     opts.Peers,
-		state:     state,
-		urgentCh:  make(chan struct{}, 1),
-		regularCh: make(chan drainSignal, 1),
-		now:       nowFn,
+		sender:      opts.Sender,
+		store:       opts.Store,
+		failed:      opts.Failed,
+		location:    location,
+		schedule:    schedule,
+		peers:       opts.Peers,
+		markDeleted: opts.MarkDeleted,
+		editPolicy:  normalizeEditPolicy(opts.EditPolicy),
+		retry:       opts.Retry.withDefaults(),
+		defaultTTL:  max(opts.DefaultTTL, 0),
+		state:       state,
+		urgentCh:    make(chan struct{}, 1),
+		regularCh:   make(chan drainSignal, 1),
+		now:         nowFn,
+
+		expiredPolicy: normalizeExpiredPolicy(opts.ExpiredPolicy),
+		recipients:    opts.Recipients,
+		quietPolicy:   normalizeQuietPolicy(opts.QuietPolicy),
+		escalation:    opts.Escalation,
+		account:       opts.Account,
+		conn:          opts.Conn,
 	}
 
 	logger.Debugf(
@@ -214,6 +285,12 @@ func (q *Queue) Start(ctx context.Context) {
 		}
 		q.wg.Go(q.workerLoop)
 		q.wg.Go(q.schedulerLoop)
+		if q.escalation.After > 0 {
+			q.wg.Go(q.escalationLoop)
+		}
+
+		// Задания, устаревшие за время простоя, снимаем до восстановления дренирования.
+		q.dropExpired("startup recovery")
 
 		q.mu.Lock()
 		hasUrgent := len(q.state.Urgent) > 0
@@ -232,6 +309,7 @@ func (q *Queue) Start(ctx context.Context) {
 				q.signalRegularDrain("startup missed window")
 			}
 		}
+		q.armRetryTimer()
 	})
 }
 
@@ -247,6 +325,12 @@ func (q *Queue) Close(ctx context.Context) error {
 	if q.cancel != nil {
 		q.cancel()
 	}
+	q.mu.Lock()
+	if q.retryTimer != nil {
+		q.retryTimer.Stop()
+		q.retryTimer = nil
+	}
+	q.mu.Unlock()
 
 	done := make(chan struct{})
 	go func() {
@@ -275,45 +359,117 @@ func (q *Queue) Close(ctx context.Context) error {
 	return nil
 }
 
-// Notify формирует задания из результата фильтра и ставит их в очередь.
-// При флаге Forward добавляет спецификацию пересылки и, на всякий случай,
+// Notify ставит в очередь уведомления о сообщении msg по всем совпавшим фильтрам.
+// Совпадения объединяются по получателю (см. coalesce.go): каждый получатель получает одно
+// задание. При запросе пересылки добавляет спецификацию пересылки и, на всякий случай,
 // подготовленную копию текста (для транспорта без пересылки).
-func (q *Queue) Notify(entities tg.Entities, msg *tg.Message, fres filters.FilterMatchResult) error {
+func (q *Queue) Notify(entities tg.Entities, msg *tg.Message, results []filters.FilterMatchResult) error {
 	if msg == nil {
 		return errors.New("notifications queue: nil message")
 	}
+	return q.notify(entities, msg, []int{msg.ID}, results)
+}
+
+// NotifyAlbum ставит в очередь уведомление об альбоме (медиагруппе с общим grouped_id).
+// msg — сообщение-представитель с объединённой подписью: по нему строятся текст, ссылка и копия.
+// messageIDs — все части альбома в порядке отображения; они уходят в ForwardSpec одной пересылкой.
+func (q *Queue) NotifyAlbum(
+	entities tg.Entities,
+	msg *tg.Message,
+	messageIDs []int,
+	results []filters.FilterMatchResult,
+) error {
+	if msg == nil {
+		return errors.New("notifications queue: nil message")
+	}
+	if len(messageIDs) == 0 {
+		return errors.New("notifications queue: empty album")
+	}
+	return q.notify(entities, msg, messageIDs, results)
+}
+
+// notify — общая часть Notify/NotifyAlbum: группирует совпадения по получателям,
+// рендерит объединённый текст, собирает Payload и создаёт по одному Job на получателя.
+func (q *Queue) notify(
+	entities tg.Entities,
+	msg *tg.Message,
+	messageIDs []int,
+	results []filters.FilterMatchResult,
+) error {
+	if len(results) == 0 {
+		return nil
+	}
 
 	link := BuildMessageLink(q.peers, entities, msg)
-	text := RenderTemplate(fres.Filter.Notify.Template, fres.Result, link)
 
-	payload := Payload{
-		Text: strings.TrimSpace(text),
+	// Ссылка на источник нужна, чтобы снять задания при удалении исходного сообщения.
+	peer, peerErr := peerToRecipient(msg.PeerID)
+	if peerErr != nil {
+		logger.Errorf("Queue: source ref error for message %d: %v", msg.ID, peerErr)
 	}
 
-	if fres.Filter.Notify.Forward {
-		if fwd, err := buildForwardSpec(msg); err != nil {
+	// Спецификация пересылки и копия общие для всех получателей — строим один раз.
+	var (
+		fwd     *ForwardSpec
+		copyTxt *CopyText
+	)
+	if anyForward(results) {
+		spec, err := buildForwardSpec(msg, messageIDs)
+		if err != nil {
 			logger.Errorf("Queue: forward spec error for message %d: %v", msg.ID, err)
-		} else {
-			payload.Forward = fwd
 		}
+		fwd = spec
 		// Если требуется «форвард», а бот не умеет пересылать — подготовим копию текста для Bot API.
-		payload.Copy = BuildCopyTextFromTG(msg)
+		copyTxt = BuildCopyTextFromTG(msg)
 	}
 
-	// Создаем Job'ы
-	for _, r := range fres.Recipients {
+	// Создаем Job'ы: по одному на получателя со всеми его совпадениями,
+	// кроме отключённых получателем фильтров и чатов (см. mute.go).
+	now := q.now()
+	for _, group := range groupByRecipient(results) {
+		q.mu.Lock()
+		group.results = q.unmutedLocked(group.recipient, peer, group.results, now)
+		q.mu.Unlock()
+		if len(group.results) == 0 {
+			logger.Debugf("Queue: message %d muted for %s:%d", msg.ID, group.recipient.Type, group.recipient.ID)
+			continue
+		}
+		payload := Payload{Text: composeMatchText(group.results, link)}
+		if anyForward(group.results) {
+			payload.Forward = fwd
+			payload.Copy = copyTxt
+		}
+		// Получатели вне Telegram (webhook, email) получают исходный текст независимо от пересылки.
+		if _, external := externalTransport(group.recipient.Type); external && payload.Copy == nil {
+			payload.Copy = BuildCopyTextFromTG(msg)
+		}
+
+		filterIDs := matchFilterIDs(group.results)
+		priority := maxPriority(group.results)
 		job := Job{
-			Urgent: fres.Filter.Notify.Urgent,
-			Recipient: Recipient{
-				Type: string(r.Type),
-				ID:   int64(r.PeerID),
-			},
-			Payload: payload,
+			Urgent:    priority.Immediate(),
+			Priority:  priority,
+			Recipient: group.recipient,
+			Payload:   payload,
+		}
+		// Срок актуальности имеет смысл только для регулярных заданий, ждущих окна расписания.
+		if ttl := q.jobTTL(group.results); ttl > 0 && !job.Urgent {
+			job.ExpiresAt = now.Add(ttl).UTC()
+		}
+		if peerErr == nil {
+			job.Source = &SourceRef{
+				Peer:       peer,
+				MessageIDs: append([]int(nil), messageIDs...),
+				FilterIDs:  filterIDs,
+				Link:       link,
+				Terms:      matchTerms(group.results),
+				Account:    q.account,
+			}
 		}
 		jobID := q.enqueue(job)
 		logger.Debugf(
-			"Queue: job %d enqueued (filter=%s urgent=%t recipient=%s:%d)",
-			jobID, fres.Filter.ID, job.Urgent, job.Recipient.Type, job.Recipient.ID)
+			"Queue: job %d enqueued (filters=%s priority=%s recipient=%s:%d)",
+			jobID, strings.Join(filterIDs, ","), job.Priority, job.Recipient.Type, job.Recipient.ID)
 	}
 
 	return nil
@@ -396,6 +552,24 @@ func (q *Queue) HasPending() bool {
 	return u > 0 || r > 0
 }
 
+// Pending возвращает копии ожидающих заданий: сначала срочные, затем регулярные, в порядке очереди.
+func (q *Queue) Pending() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append(cloneJobs(q.state.Urgent), cloneJobs(q.state.Regular)...)
+}
+
+// Failed возвращает журнал окончательно провалившихся заданий.
+func (q *Queue) Failed() ([]FailedRecord, error) {
+	return q.failed.Load()
+}
+
+// Now возвращает текущее время по часам очереди: сроки отключений и повторов
+// считаются от них, а не от системных часов.
+func (q *Queue) Now() time.Time {
+	return q.now()
+}
+
 // Stats возвращает компактный снимок состояния очереди для CLI/мониторинга.
 func (q *Queue) Stats() QueueStats {
 	q.mu.Lock()
@@ -404,9 +578,13 @@ func (q *Queue) Stats() QueueStats {
 	lastDrain := q.state.LastRegularDrainAt
 	lastFlush := q.state.LastFlushAt
 	loc := q.location
+	retries, retrying := q.retryTimelineLocked()
+	quiet := q.quietStatusLocked(q.now())
+	escalations := len(q.state.Escalations)
 	q.mu.Unlock()
 
 	next := q.nextScheduleAfter(q.now())
+	mutes := q.Mutes()
 	return QueueStats{
 		Urgent:             urgent,
 		Regular:            regular,
@@ -414,6 +592,12 @@ func (q *Queue) Stats() QueueStats {
 		LastFlushAt:        lastFlush,
 		NextScheduleAt:     next,
 		Location:           loc,
+		Retrying:           retrying,
+		Retries:            retries,
+		MaxAttempts:        q.retry.MaxAttempts,
+		Quiet:              quiet,
+		Escalations:        escalations,
+		Mutes:              mutes,
 	}
 }
 
@@ -527,6 +711,7 @@ func (q *Queue) drainUrgentOnce(reason string, hookCalled *bool) (bool, bool) {
 func (q *Queue) processRegular(sig drainSignal) {
 	reason := sig.reason
 	logger.Debugf("Queue: start regular drain (%s)", reason)
+	q.dropExpired(reason)
 
 	// drainedAll = true, если дошли до конца regular-очереди без прерываний
 	drainedAll := false
@@ -541,16 +726,22 @@ func (q *Queue) processRegular(sig drainSignal) {
 			continue
 		}
 
-		job, hasRegular := q.popRegular()
+		job, hasRegular := q.popRegular(sig.deferredOnly)
 		if !hasRegular {
-			// Регулярная очередь исчерпана — окно считаем обработанным
-			drainedAll = true
+			// Регулярная очередь исчерпана — окно считаем обработанным (но не при дренировании ретраев)
+			drainedAll = !sig.deferredOnly
 			break
 		}
 
 		q.callBeforeDrainOnce(&hookCalled)
 
-		if q.handleJob(job) {
+		var interrupted bool
+		if jobs := q.popDigest(job, sig.deferredOnly); len(jobs) > 1 {
+			interrupted = q.handleDigest(jobs)
+		} else {
+			interrupted = q.handleJob(job)
+		}
+		if interrupted {
 			// Принудительное прерывание дренирования (requeue / offline / ctx)
 			logger.Debugf("Queue: regular drain interrupted on job %d (%s)", job.ID, reason)
 			break
@@ -567,42 +758,67 @@ func (q *Queue) processRegular(sig drainSignal) {
 }
 
 // handleJob выполняет доставку одного задания и решает, нужно ли прервать текущую выборку.
-// Возвращает true, если задание было возвращено в очередь или потребовалось ждать online/ctx.
+// Возвращает true, если потребовалось ждать online/ctx. Ошибки доставки и запрос Retry
+// не прерывают выборку: задание откладывается по политике повторов (retryLater).
 func (q *Queue) handleJob(job Job) bool {
 	start := q.now()
 	logger.Debugf("Queue: delivering job %d (urgent=%t recipient=%s:%d)",
 		job.ID, job.Urgent, job.Recipient.Type, job.Recipient.ID)
 
-	ctx := q.ctx
-	result, err := q.sender.Deliver(ctx, job)
+	// Политика тихих часов silent: доставляем сразу, но без звука.
+	job.Silent = q.silentForQuiet(job)
 
-	// Если transport сообщил, что соединение разорвано, возвращаем задание в начало очереди
-	// и ждём, пока connection.WaitOnline не подтвердит восстановление.
+	result, err := q.sender.Deliver(q.ctx, job)
+	if q.interrupted([]Job{job}, result, err) {
+		return true
+	}
+	q.settle(job, result, err)
+
+	duration := time.Since(start)
+	logger.Debugf("Queue: job %d processed in %s", job.ID, duration)
+	return false
+}
+
+// interrupted проверяет исход доставки jobs на разрыв соединения и отмену контекста: в этих
+// случаях задания возвращаются в начало очереди (с сохранением порядка) и выборка прерывается.
+func (q *Queue) interrupted(jobs []Job, result SendOutcome, err error) bool {
+	ctx := q.ctx
+	// Если transport сообщил, что соединение разорвано, возвращаем задания в начало очереди
+	// и ждём, пока соединение аккаунта (WaitOnline) не подтвердит восстановление.
 	if result.NetworkDown {
-		logger.Warnf("Queue: network offline, requeue job %d", job.ID)
-		q.requeueJob(job, true)
+		for i := len(jobs) - 1; i >= 0; i-- {
+			logger.Warnf("Queue: network offline, requeue job %d", jobs[i].ID)
+			q.requeueJob(jobs[i], true)
+		}
 		if ctxErr := ctx.Err(); ctxErr != nil {
-			logger.Warnf("Queue: job %d waiting for connection but context already done: %v", job.ID, ctxErr)
+			logger.Warnf("Queue: job %d waiting for connection but context already done: %v", jobs[0].ID, ctxErr)
 		}
-		connection.WaitOnline(ctx)
+		q.conn.WaitOnline(ctx)
 		return true
 	}
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		for i := len(jobs) - 1; i >= 0; i-- {
+			logger.Warnf("Queue: context canceled while delivering job %d, requeue", jobs[i].ID)
+			q.requeueJob(jobs[i], true)
+		}
+		return true
+	}
+	return false
+}
 
+// settle применяет исход доставки к заданию: ошибка и запрос Retry — повтор по политике
+// (retryLater), перманентный отказ — запись в FailedStore, успех — журнал и эскалация.
+func (q *Queue) settle(job Job, result SendOutcome, err error) {
 	if err != nil {
-		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			logger.Warnf("Queue: context canceled while delivering job %d, requeue", job.ID)
-			q.requeueJob(job, true)
-			return true
-		}
 		logger.Errorf("Queue: delivery error for job %d: %v", job.ID, err)
-		q.requeueJob(job, false)
-		return true
+		q.retryLater(job, err.Error())
+		return
 	}
 
 	if result.Retry {
 		logger.Warnf("Queue: sender requested retry for job %d", job.ID)
-		q.requeueJob(job, false)
-		return true
+		q.retryLater(job, "sender requested retry")
+		return
 	}
 
 	// Перманентные ошибки фиксируем в отдельном файле failed, чтобы оператор мог расследовать инцидент.
@@ -622,11 +838,10 @@ func (q *Queue) handleJob(job Job) bool {
 		logger.Errorf(
 			"Queue: job %d permanent failure for recipient %s:%d: %s",
 			job.ID, job.Recipient.Type, job.Recipient.ID, errMsg)
+		return
 	}
-
-	duration := time.Since(start)
-	logger.Debugf("Queue: job %d processed in %s", job.ID, duration)
-	return false
+	q.recordDelivered(job, result)
+	q.trackEscalation(job, result)
 }
 
 // requeueJob возвращает задание обратно в соответствующую очередь. front=true — поставить в начало.
@@ -655,32 +870,40 @@ func (q *Queue) requeueJob(job Job, front bool) {
 	}
 }
 
-// popUrgent снимает первое срочное задание, обновляет состояние и планирует persist.
+// popUrgent снимает готовое к отправке срочное задание с наивысшим приоритетом
+// (отложенные ретраи и удержанные тихими часами пропускаются), см. popDue.
 func (q *Queue) popUrgent() (Job, bool) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+	return q.popDue(&q.state.Urgent, func(Job) bool { return true })
+}
 
-	if len(q.state.Urgent) == 0 {
-		return Job{}, false
-	}
-	job := q.state.Urgent[0]
-	q.state.Urgent = q.state.Urgent[1:]
-	q.persistLocked()
-	return job, true
+// popRegular снимает готовое к отправке регулярное задание с наивысшим приоритетом, см. popDue.
+// deferredOnly=true ограничивает выборку созревшими отложенными заданиями.
+func (q *Queue) popRegular(deferredOnly bool) (Job, bool) {
+	return q.popDue(&q.state.Regular, func(job Job) bool { return !deferredOnly || job.deferred() })
 }
 
-// popRegular снимает первое регулярное задание, обновляет состояние и планирует persist.
-func (q *Queue) popRegular() (Job, bool) {
+// popDue — общая часть выборки: удерживает задания получателей в тихих часах, затем снимает
+// из list готовое задание с наивысшим приоритетом среди подходящих под match и планирует persist.
+// Если что-то было удержано, перезаводит таймер отложенных заданий.
+func (q *Queue) popDue(list *[]Job, match func(Job) bool) (Job, bool) {
 	q.mu.Lock()
-	defer q.mu.Unlock()
+	now := q.now()
+	held := q.holdQuietLocked(*list, now)
+	idx := nextByPriority(*list, func(job Job) bool { return job.isDue(now) && match(job) })
+	var job Job
+	if idx >= 0 {
+		job = (*list)[idx]
+		*list = slices.Delete(*list, idx, idx+1)
+	}
+	if idx >= 0 || held {
+		q.persistLocked()
+	}
+	q.mu.Unlock()
 
-	if len(q.state.Regular) == 0 {
-		return Job{}, false
+	if held {
+		q.armRetryTimer()
 	}
-	job := q.state.Regular[0]
-	q.state.Regular = q.state.Regular[1:]
-	q.persistLocked()
-	return job, true
+	return job, idx >= 0
 }
 
 // persistLocked помечает время последней синхронизации и планирует запись состояния (без блокировки диска здесь).
@@ -710,6 +933,17 @@ func (q *Queue) signalRegularDrain(reason string) {
 	}
 }
 
+// signalRetryDrain неблокирующе просит воркер доставить созревшие отложенные регулярные задания
+// (ретраи и удержанные тихими часами) вне расписания.
+// Если в канале уже есть сигнал полного дренирования, он покроет и ретраи.
+func (q *Queue) signalRetryDrain() {
+	req := drainSignal{reason: "deferred jobs due", deferredOnly: true}
+	select {
+	case q.regularCh <- req:
+	default:
+	}
+}
+
 // FlushImmediately инициирует внеплановый слив регулярной очереди из CLI/оператора (неблокирующе).
 func (q *Queue) FlushImmediately(reason string) {
 	if reason == "" {
@@ -758,8 +992,8 @@ func (q *Queue) previousScheduleAt(now time.Time) time.Time {
 	return prev.UTC()
 }
 
-// buildForwardSpec готовит спецификацию пересылки исходного сообщения.
-func buildForwardSpec(msg *tg.Message) (*ForwardSpec, error) {
+// buildForwardSpec готовит спецификацию пересылки исходного сообщения (или всех частей альбома).
+func buildForwardSpec(msg *tg.Message, messageIDs []int) (*ForwardSpec, error) {
 	if msg == nil {
 		return nil, errors.New("message is nil")
 	}
@@ -770,7 +1004,7 @@ func buildForwardSpec(msg *tg.Message) (*ForwardSpec, error) {
 	return &ForwardSpec{
 		Enabled:    true,
 		FromPeer:   fromPeer,
-		MessageIDs: []int{msg.ID},
+		MessageIDs: append([]int(nil), messageIDs...),
 	}, nil
 }
 
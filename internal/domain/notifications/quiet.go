@@ -0,0 +1,121 @@
+// Package notifications / файл quiet.go реализует тихие часы (do-not-disturb) получателей.
+// Окна задаются в recipients.json (поле quiet, в таймзоне получателя). Пока получатель
+// в окне, задания для него, кроме critical, по политике очереди:
+//   - hold   — удерживаются: выборка их пропускает и помечает HeldUntil = конец окна,
+//     а общий таймер отложенных заданий (см. retry.go) выпускает их по окончании окна;
+//   - silent — доставляются сразу, но без звука.
+
+package notifications
+
+import (
+	"strings"
+	"time"
+
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Политики тихих часов.
+const (
+	// QuietPolicyHold — удерживать задания до конца окна.
+	QuietPolicyHold = "hold"
+	// QuietPolicySilent — доставлять без звука.
+	QuietPolicySilent = "silent"
+)
+
+// QuietInfo — получатель в тихих часах для CLI/мониторинга.
+type QuietInfo struct {
+	Name      string // ID получателя из recipients.json
+	Recipient Recipient
+	Until     time.Time // конец окна, в UTC
+	Held      int       // число удерживаемых заданий
+}
+
+// normalizeQuietPolicy приводит значение политики к одной из известных; пустое — hold.
+func normalizeQuietPolicy(policy string) string {
+	switch p := strings.ToLower(strings.TrimSpace(policy)); p {
+	case QuietPolicyHold, QuietPolicySilent:
+		return p
+	case "":
+		return QuietPolicyHold
+	default:
+		logger.Warnf("Queue: unknown quiet policy %q, using %q", policy, QuietPolicyHold)
+		return QuietPolicyHold
+	}
+}
+
+// quietUntil сообщает, находится ли получатель задания в тихих часах, и конец окна.
+func (q *Queue) quietUntil(r Recipient, now time.Time) (time.Time, bool) {
+	if q.recipients == nil {
+		return time.Time{}, false
+	}
+	rcpt, ok := q.recipients.RecipientByPeer(r.Type, r.ID)
+	if !ok {
+		return time.Time{}, false
+	}
+	return rcpt.QuietUntil(now, q.location)
+}
+
+// holdQuietLocked помечает HeldUntil у готовых к выдаче заданий, получатели которых
+// в тихих часах (только при политике hold; critical не удерживается). Возвращает true,
+// если состояние изменилось. Вызывать под q.mu.
+func (q *Queue) holdQuietLocked(jobs []Job, now time.Time) bool {
+	if q.quietPolicy != QuietPolicyHold || q.recipients == nil {
+		return false
+	}
+	changed := false
+	for i := range jobs {
+		job := &jobs[i]
+		if !job.isDue(now) || job.EffectivePriority().BypassQuiet() {
+			continue
+		}
+		until, quiet := q.quietUntil(job.Recipient, now)
+		if !quiet {
+			continue
+		}
+		job.HeldUntil = until.UTC()
+		changed = true
+		logger.Debugf("Queue: job %d held until %s (recipient %s:%d in quiet hours)",
+			job.ID, job.HeldUntil.Format(time.RFC3339), job.Recipient.Type, job.Recipient.ID)
+	}
+	return changed
+}
+
+// silentForQuiet сообщает, нужно ли доставить задание без звука по политике silent.
+func (q *Queue) silentForQuiet(job Job) bool {
+	if q.quietPolicy != QuietPolicySilent || job.EffectivePriority().BypassQuiet() {
+		return false
+	}
+	_, quiet := q.quietUntil(job.Recipient, q.now())
+	return quiet
+}
+
+// quietStatusLocked собирает получателей, находящихся в тихих часах, с числом удерживаемых
+// для них заданий. Вызывать под q.mu.
+func (q *Queue) quietStatusLocked(now time.Time) []QuietInfo {
+	if q.recipients == nil {
+		return nil
+	}
+	var out []QuietInfo
+	for _, rcpt := range q.recipients.GetRecipients() {
+		until, quiet := rcpt.QuietUntil(now, q.location)
+		if !quiet {
+			continue
+		}
+		target := Recipient{Type: string(rcpt.Type), ID: int64(rcpt.PeerID)}
+		count := 0
+		for _, list := range [][]Job{q.state.Urgent, q.state.Regular} {
+			for _, job := range list {
+				if job.Recipient == target && job.HeldUntil.After(now) {
+					count++
+				}
+			}
+		}
+		out = append(out, QuietInfo{
+			Name:      string(rcpt.ID),
+			Recipient: target,
+			Until:     until.UTC(),
+			Held:      count,
+		})
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+// Package notifications / файл retry.go реализует политику повторов для отдельных заданий.
+// Раньше временный сбой возвращал задание в очередь без ограничений, и одно «отравленное»
+// задание могло бесконечно прерывать дренирование. Теперь:
+//   - каждая неудачная попытка увеличивает Attempts и откладывает задание на
+//     экспоненциальный backoff (NextAttemptAt), не блокируя задания за ним;
+//   - общий таймер будит воркер, когда подходит ближайший NextAttemptAt (он же выпускает
+//     задания, удержанные тихими часами, по HeldUntil — см. quiet.go);
+//   - после MaxAttempts попыток задание уходит в FailedStore (dead-letter).
+
+package notifications
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Значения политики повторов по умолчанию (используются, если поля RetryPolicy не заданы).
+const (
+	defaultRetryMaxAttempts = 8
+	defaultRetryBaseDelay   = 30 * time.Second
+	defaultRetryMaxDelay    = time.Hour
+)
+
+// retryTimelineLimit ограничивает число заданий в ретрае, возвращаемых в QueueStats.
+const retryTimelineLimit = 10
+
+// RetryPolicy задаёт повторы одного задания: число попыток до dead-letter
+// и границы экспоненциального backoff (BaseDelay * 2^(attempt-1), не больше MaxDelay).
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// RetryInfo — строка «таймлайна» ретраев для CLI/мониторинга.
+type RetryInfo struct {
+	JobID         int64
+	Urgent        bool
+	Recipient     Recipient
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time // в UTC
+}
+
+// withDefaults подставляет значения по умолчанию вместо неположительных полей.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultRetryMaxDelay
+	}
+	return p
+}
+
+// backoff возвращает задержку перед попыткой номер attempts+1.
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// notBefore возвращает момент, раньше которого задание нельзя выдавать в работу.
+func (j Job) notBefore() time.Time {
+	if j.HeldUntil.After(j.NextAttemptAt) {
+		return j.HeldUntil
+	}
+	return j.NextAttemptAt
+}
+
+// isDue сообщает, можно ли выдавать задание в работу в момент now.
+func (j Job) isDue(now time.Time) bool {
+	return !j.notBefore().After(now)
+}
+
+// deferred сообщает, откладывалось ли задание (ретрай или тихие часы): такие задания
+// выпускаются таймером вне расписания.
+func (j Job) deferred() bool {
+	return j.Attempts > 0 || !j.HeldUntil.IsZero()
+}
+
+// retryLater фиксирует неудачную попытку: при исчерпании лимита переносит задание
+// в FailedStore, иначе возвращает его в конец своей очереди с отложенным NextAttemptAt.
+func (q *Queue) retryLater(job Job, reason string) {
+	job.Attempts++
+	job.LastError = reason
+
+	if job.Attempts >= q.retry.MaxAttempts {
+		record := FailedRecord{
+			Job:      job.Clone(),
+			FailedAt: q.now().UTC(),
+			Error:    fmt.Sprintf("retry limit reached after %d attempt(s): %s", job.Attempts, reason),
+		}
+		if err := q.failed.Append(record); err != nil {
+			logger.Errorf("Queue: failed store append error: %v", err)
+		}
+		logger.Errorf("Queue: job %d dead-lettered after %d attempt(s): %s", job.ID, job.Attempts, reason)
+		return
+	}
+
+	delay := q.retry.backoff(job.Attempts)
+	job.NextAttemptAt = q.now().Add(delay).UTC()
+	logger.Warnf("Queue: job %d attempt %d/%d failed, next attempt in %s: %s",
+		job.ID, job.Attempts, q.retry.MaxAttempts, delay, reason)
+	q.requeueJob(job, false)
+	q.armRetryTimer()
+}
+
+// armRetryTimer перезаводит общий таймер ретраев на ближайший будущий NextAttemptAt/HeldUntil.
+// Уже наступившие попытки обрабатываются по сигналам, поэтому в расчёт не входят.
+func (q *Queue) armRetryTimer() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.retryTimer != nil {
+		q.retryTimer.Stop()
+		q.retryTimer = nil
+	}
+	if q.ctx == nil || q.ctx.Err() != nil {
+		return
+	}
+
+	now := q.now()
+	var next time.Time
+	for _, list := range [][]Job{q.state.Urgent, q.state.Regular} {
+		for _, job := range list {
+			if job.isDue(now) {
+				continue
+			}
+			if at := job.notBefore(); next.IsZero() || at.Before(next) {
+				next = at
+			}
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+	q.retryTimer = time.AfterFunc(next.Sub(now), q.onRetryDue)
+}
+
+// onRetryDue срабатывает по таймеру ретраев: будит обработку созревших заданий
+// (urgent — обычным сигналом, regular — дренированием только отложенных) и перезаводит таймер.
+func (q *Queue) onRetryDue() {
+	if q.ctx == nil || q.ctx.Err() != nil {
+		return
+	}
+	now := q.now()
+	due := func(job Job) bool { return job.deferred() && job.isDue(now) }
+
+	q.mu.Lock()
+	urgentDue := slices.ContainsFunc(q.state.Urgent, due)
+	regularDue := slices.ContainsFunc(q.state.Regular, due)
+	q.mu.Unlock()
+
+	if urgentDue {
+		q.signalUrgent()
+	}
+	if regularDue {
+		q.signalRetryDrain()
+	}
+	q.armRetryTimer()
+}
+
+// retryTimelineLocked собирает задания в ретрае, отсортированные по NextAttemptAt.
+// Вызывать под q.mu.
+func (q *Queue) retryTimelineLocked() ([]RetryInfo, int) {
+	var out []RetryInfo
+	for _, list := range [][]Job{q.state.Urgent, q.state.Regular} {
+		for _, job := range list {
+			if job.Attempts == 0 {
+				continue
+			}
+			out = append(out, RetryInfo{
+				JobID:         job.ID,
+				Urgent:        job.Urgent,
+				Recipient:     job.Recipient,
+				Attempts:      job.Attempts,
+				LastError:     job.LastError,
+				NextAttemptAt: job.NextAttemptAt,
+			})
+		}
+	}
+	slices.SortFunc(out, func(a, b RetryInfo) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) })
+	total := len(out)
+	if total > retryTimelineLimit {
+		out = out[:retryTimelineLimit]
+	}
+	return out, total
+}
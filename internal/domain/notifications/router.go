@@ -0,0 +1,224 @@
+// Package notifications / файл router.go реализует маршрутизацию заданий по транспортам.
+// Раньше app выбирал один PreparedSender по NOTIFIER, и все получатели получали уведомления
+// либо от аккаунта, либо от бота. RouterSender держит несколько транспортов (у каждого свой
+// троттлер и свои исходы) и для каждого задания выбирает маршрут:
+//   - Job.Transport — задание привязано к транспорту (правка/ответ на уже отправленное им);
+//   - transport получателя в recipients.json — список в порядке предпочтения;
+//   - иначе маршрут по умолчанию (NOTIFIER).
+//
+// Получатели вне Telegram (webhook, email) всегда доставляются транспортом своего типа.
+// Если транспорт поддерживает дайджест (DigestSender), маршрутизатор пробрасывает его очереди.
+//
+// Если транспорт вернул перманентный отказ (например, бот заблокирован), задание
+// передаётся следующему транспорту маршрута. Временные ошибки не переключают транспорт:
+// их обрабатывает политика повторов очереди.
+//
+// Когда процесс обслуживает несколько аккаунтов, у каждого аккаунта своя очередь и свой
+// маршрутизатор, а транспорты вне Telegram общие: они регистрируются через RegisterShared,
+// и их Start/Stop вызывает владелец, а не каждый маршрутизатор.
+
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/infra/logger"
+)
+
+// Имена встроенных транспортов.
+const (
+	TransportClient  = "client"
+	TransportBot     = "bot"
+	TransportWebhook = "webhook"
+	TransportEmail   = "email"
+)
+
+// externalTransport возвращает транспорт получателя вне Telegram; ok=false — получатель в Telegram.
+func externalTransport(recipientType string) (string, bool) {
+	switch recipientType {
+	case RecipientTypeWebhook:
+		return TransportWebhook, true
+	case RecipientTypeEmail:
+		return TransportEmail, true
+	default:
+		return "", false
+	}
+}
+
+// RouterSender — PreparedSender, распределяющий задания между зарегистрированными транспортами.
+type RouterSender struct {
+	senders      map[string]PreparedSender
+	names        []string        // порядок регистрации: для Start/Stop/BeforeDrain
+	shared       map[string]bool // общие транспорты: их жизненным циклом управляет владелец
+	defaultRoute []string
+	recipients   *filters.FilterEngine
+}
+
+// NewRouterSender создаёт маршрутизатор с маршрутом по умолчанию defaultRoute.
+// recipients — справочник получателей с полем transport (nil — всегда маршрут по умолчанию).
+func NewRouterSender(defaultRoute []string, recipients *filters.FilterEngine) *RouterSender {
+	return &RouterSender{
+		senders:      make(map[string]PreparedSender),
+		defaultRoute: slices.Clone(defaultRoute),
+		recipients:   recipients,
+	}
+}
+
+// Register добавляет транспорт под именем name. Повторная регистрация заменяет транспорт.
+func (r *RouterSender) Register(name string, sender PreparedSender) {
+	if _, ok := r.senders[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.senders[name] = sender
+	delete(r.shared, name)
+}
+
+// RegisterShared добавляет транспорт name, общий для нескольких маршрутизаторов.
+// Маршрутизатор не запускает и не останавливает его: это делает владелец транспорта.
+func (r *RouterSender) RegisterShared(name string, sender PreparedSender) {
+	r.Register(name, sender)
+	if r.shared == nil {
+		r.shared = make(map[string]bool)
+	}
+	r.shared[name] = true
+}
+
+// Has сообщает, зарегистрирован ли транспорт name.
+func (r *RouterSender) Has(name string) bool {
+	_, ok := r.senders[name]
+	return ok
+}
+
+// Start запускает собственные транспорты, реализующие Start(ctx).
+func (r *RouterSender) Start(ctx context.Context) {
+	for _, name := range r.names {
+		if r.shared[name] {
+			continue
+		}
+		if lifecycle, ok := r.senders[name].(interface{ Start(context.Context) }); ok {
+			lifecycle.Start(ctx)
+		}
+	}
+}
+
+// Stop останавливает собственные транспорты, реализующие Stop().
+func (r *RouterSender) Stop() {
+	for _, name := range r.names {
+		if r.shared[name] {
+			continue
+		}
+		if lifecycle, ok := r.senders[name].(interface{ Stop() }); ok {
+			lifecycle.Stop()
+		}
+	}
+}
+
+// BeforeDrain пробрасывает хук дренирования транспортам, которые его поддерживают.
+func (r *RouterSender) BeforeDrain(ctx context.Context) {
+	for _, name := range r.names {
+		if h, ok := r.senders[name].(beforeDrainer); ok {
+			h.BeforeDrain(ctx)
+		}
+	}
+}
+
+// Deliver доставляет задание по маршруту получателя, переходя к следующему транспорту
+// при перманентном отказе. В исходе указывается транспорт последней попытки.
+func (r *RouterSender) Deliver(ctx context.Context, job Job) (SendOutcome, error) {
+	route := r.route(job)
+	if len(route) == 0 {
+		err := fmt.Errorf("no transport available for %s:%d", job.Recipient.Type, job.Recipient.ID)
+		return SendOutcome{
+			PermanentFailures: []Recipient{job.Recipient},
+			PermanentError:    err,
+		}, nil
+	}
+
+	var (
+		outcome SendOutcome
+		err     error
+	)
+	for i, name := range route {
+		outcome, err = r.senders[name].Deliver(ctx, job)
+		outcome.Transport = name
+		if err != nil || len(outcome.PermanentFailures) == 0 || i == len(route)-1 {
+			return outcome, err
+		}
+		logger.Warnf("Router: job %d failed permanently via %s for %s:%d (%v), falling back to %s",
+			job.ID, name, job.Recipient.Type, job.Recipient.ID, outcome.PermanentError, route[i+1])
+	}
+	return outcome, errors.New("router: empty route")
+}
+
+// Digest сообщает, доставляются ли задания получателя дайджестом: первый транспорт
+// его маршрута реализует DigestSender и поддерживает получателя.
+func (r *RouterSender) Digest(recipient Recipient) bool {
+	route := r.route(Job{Recipient: recipient})
+	if len(route) == 0 {
+		return false
+	}
+	ds, ok := r.senders[route[0]].(DigestSender)
+	return ok && ds.Digest(recipient)
+}
+
+// DeliverDigest доставляет дайджест первым транспортом маршрута получателя (без fallback:
+// часть заданий могла бы уйти в другой транспорт, а дайджест атомарен).
+func (r *RouterSender) DeliverDigest(ctx context.Context, jobs []Job) (SendOutcome, error) {
+	if len(jobs) == 0 {
+		return SendOutcome{}, nil
+	}
+	route := r.route(jobs[0])
+	var ds DigestSender
+	if len(route) > 0 {
+		ds, _ = r.senders[route[0]].(DigestSender)
+	}
+	if ds == nil {
+		recipient := jobs[0].Recipient
+		return SendOutcome{
+			PermanentFailures: []Recipient{recipient},
+			PermanentError:    fmt.Errorf("no digest transport for %s:%d", recipient.Type, recipient.ID),
+		}, nil
+	}
+	outcome, err := ds.DeliverDigest(ctx, jobs)
+	outcome.Transport = route[0]
+	return outcome, err
+}
+
+// route возвращает список зарегистрированных транспортов для задания в порядке попыток.
+func (r *RouterSender) route(job Job) []string {
+	if name, external := externalTransport(job.Recipient.Type); external {
+		if r.Has(name) {
+			return []string{name}
+		}
+		return nil
+	}
+	if job.Transport != "" {
+		if r.Has(job.Transport) {
+			return []string{job.Transport}
+		}
+		return nil
+	}
+	var route []string
+	if r.recipients != nil {
+		if rcpt, ok := r.recipients.RecipientByPeer(job.Recipient.Type, job.Recipient.ID); ok {
+			for _, name := range rcpt.Transport {
+				if r.Has(name) && !slices.Contains(route, name) {
+					route = append(route, name)
+				}
+			}
+		}
+	}
+	if len(route) > 0 {
+		return route
+	}
+	for _, name := range r.defaultRoute {
+		if r.Has(name) {
+			route = append(route, name)
+		}
+	}
+	return route
+}
@@ -75,14 +75,14 @@ func NewQueueStore(path string, debounce time.Duration) (*QueueStore, error) {
 func ensureStateFile(path string) (State, error) {
 	clean := filepath.Clean(path)
 
-	bytes, errRead := os.ReadFile(clean)
-	if os.IsNotExist(errRead) || len(bytes) == 0 {
+	bytes, errRead := storage.ReadSealedFile(clean)
+	if os.IsNotExist(errRead) || (errRead == nil && len(bytes) == 0) {
 		st := DefaultState()
 		b, errJSON := json.MarshalIndent(st, "", "  ")
 		if errJSON != nil {
 			return DefaultState(), fmt.Errorf("encode default queue state: %w", errJSON)
 		}
-		if err := storage.AtomicWriteFile(clean, b); err != nil {
+		if err := storage.AtomicWriteSealedFile(clean, b); err != nil {
 			return DefaultState(), fmt.Errorf("init queue state file: %w", err)
 		}
 		logger.Debugf("QueueStore: created initial state file %s", clean)
@@ -100,7 +100,7 @@ func ensureStateFile(path string) (State, error) {
 		if errJSON != nil {
 			return DefaultState(), fmt.Errorf("encode default queue state: %w", errJSON)
 		}
-		if err := storage.AtomicWriteFile(clean, b); err != nil {
+		if err := storage.AtomicWriteSealedFile(clean, b); err != nil {
 			return DefaultState(), fmt.Errorf("rewrite default queue state: %w", err)
 		}
 		return st, nil
@@ -125,7 +125,7 @@ func ensureStateFile(path string) (State, error) {
 		if errJSON != nil {
 			return st, fmt.Errorf("encode fixed queue state: %w", errJSON)
 		}
-		if err := storage.AtomicWriteFile(clean, b); err != nil {
+		if err := storage.AtomicWriteSealedFile(clean, b); err != nil {
 			return st, fmt.Errorf("persist fixed queue state: %w", err)
 		}
 	}
@@ -284,7 +284,7 @@ func NewFailedStore(path string) (*FailedStore, error) {
 	clean := filepath.Clean(path)
 	if _, err := os.Stat(clean); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			if errFile := storage.AtomicWriteFile(clean, []byte("[]")); errFile != nil {
+			if errFile := storage.AtomicWriteSealedFile(clean, []byte("[]")); errFile != nil {
 				return nil, fmt.Errorf("init failed store file: %w", errFile)
 			}
 			logger.Debugf("FailedStore: created file %s", clean)
@@ -297,7 +297,7 @@ func NewFailedStore(path string) (*FailedStore, error) {
 
 // Load возвращает все записи журнала. Пустой файл или отсутствие файла трактуются как пустой список.
 func (s *FailedStore) Load() ([]FailedRecord, error) {
-	bytes, errRead := os.ReadFile(s.path)
+	bytes, errRead := storage.ReadSealedFile(s.path)
 	if errRead != nil {
 		if errors.Is(errRead, os.ErrNotExist) {
 			return nil, nil
@@ -334,7 +334,7 @@ func (s *FailedStore) Append(records ...FailedRecord) error {
 	if errJSON != nil {
 		return fmt.Errorf("encode failed store: %w", errJSON)
 	}
-	if err := storage.AtomicWriteFile(s.path, data); err != nil {
+	if err := storage.AtomicWriteSealedFile(s.path, data); err != nil {
 		logger.Errorf("FailedStore: write error: %v", err)
 		return err
 	}
@@ -349,7 +349,7 @@ func (s *QueueStore) writeState(state State) error {
 		logger.Errorf("QueueStore: marshal error: %v", errJSON)
 		return fmt.Errorf("encode queue state: %w", errJSON)
 	}
-	if err := storage.AtomicWriteFile(s.path, data); err != nil {
+	if err := storage.AtomicWriteSealedFile(s.path, data); err != nil {
 		logger.Errorf("QueueStore: write error: %v", err)
 		return err
 	}
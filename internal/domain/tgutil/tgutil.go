@@ -1,6 +1,10 @@
 package tgutil
 
-import "github.com/gotd/td/tg"
+import (
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
 
 // GetPeerID нормализует получателя до его числового идентификатора (user/chat/channel).
 // Возвращает 0 для неизвестного типа peer. Удобно для сопоставления фильтров по chat‑whitelist.
@@ -16,3 +20,45 @@ func GetPeerID(peer tg.PeerClass) int64 {
 		return 0
 	}
 }
+
+// GetPeerKind возвращает вид peer в тех же строковых метках, что и получатели
+// уведомлений: "user", "chat" или "channel". Для неизвестного типа — пустая строка.
+func GetPeerKind(peer tg.PeerClass) string {
+	switch peer.(type) {
+	case *tg.PeerUser:
+		return "user"
+	case *tg.PeerChat:
+		return "chat"
+	case *tg.PeerChannel:
+		return "channel"
+	default:
+		return ""
+	}
+}
+
+// GetPeerTitle возвращает отображаемое имя peer из entities апдейта: имя пользователя
+// (или @username), название группы или канала. Пусто, если peer в entities нет.
+func GetPeerTitle(entities tg.Entities, peer tg.PeerClass) string {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		user, ok := entities.Users[p.UserID]
+		if !ok || user == nil {
+			return ""
+		}
+		if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+			return name
+		}
+		if user.Username != "" {
+			return "@" + user.Username
+		}
+	case *tg.PeerChat:
+		if chat, ok := entities.Chats[p.ChatID]; ok && chat != nil {
+			return chat.Title
+		}
+	case *tg.PeerChannel:
+		if channel, ok := entities.Channels[p.ChannelID]; ok && channel != nil {
+			return channel.Title
+		}
+	}
+	return ""
+}
@@ -0,0 +1,261 @@
+// Package updates / файл album.go собирает медиа-альбомы перед фильтрацией.
+// Telegram присылает альбом как несколько UpdateNew(Channel)Message с общим
+// grouped_id, и подпись обычно есть только у одной части. Если фильтровать части
+// по отдельности, получаем либо пересылку одной фотографии, либо дубли.
+// Здесь реализован короткий буфер:
+//   - части копятся по ключу (peerID, groupedID), каждая новая часть продлевает окно;
+//   - по истечении окна альбом фильтруется по объединённой подписи;
+//   - на каждый матч ставится одно уведомление, ForwardSpec несёт все части альбома;
+//   - при остановке накопленные альбомы обрабатываются синхронно, без потерь;
+//   - правка подписи одной части перечитывает остальные части и фильтрует альбом целиком.
+
+package updates
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"telegram-userbot/internal/domain/notifications"
+	"telegram-userbot/internal/domain/tgutil"
+	"telegram-userbot/internal/infra/logger"
+
+	"github.com/gotd/td/tg"
+)
+
+// albumKey идентифицирует альбом: grouped_id уникален только в пределах чата.
+type albumKey struct {
+	peerID    int64
+	groupedID int64
+}
+
+// albumEntry — накопленные части одного альбома и таймер окна сборки.
+type albumEntry struct {
+	timer    *time.Timer
+	entities tg.Entities
+	parts    []*tg.Message
+}
+
+// albumBuffer копит части альбомов и отдаёт собранный альбом в onReady по
+// истечении окна тишины. Потокобезопасен; onReady вызывается вне мьютекса.
+type albumBuffer struct {
+	mu      sync.Mutex
+	pending map[albumKey]*albumEntry
+	window  time.Duration
+	stopped bool
+
+	onReady func(entities tg.Entities, parts []*tg.Message)
+}
+
+// newAlbumBuffer создаёт буфер с окном сборки windowMS миллисекунд.
+// Нулевое окно означает «без буферизации»: каждая часть уходит в onReady сразу.
+func newAlbumBuffer(windowMS int, onReady func(entities tg.Entities, parts []*tg.Message)) *albumBuffer {
+	return &albumBuffer{
+		pending: make(map[albumKey]*albumEntry),
+		window:  time.Duration(windowMS) * time.Millisecond,
+		onReady: onReady,
+	}
+}
+
+// Add регистрирует часть альбома. Повторная часть того же альбома перезапускает
+// окно сборки; entities апдейтов объединяются, чтобы ссылки строились по свежим данным.
+// После Stop буфер не копит, а обрабатывает часть немедленно.
+func (b *albumBuffer) Add(entities tg.Entities, msg *tg.Message, groupedID int64) {
+	key := albumKey{peerID: tgutil.GetPeerID(msg.PeerID), groupedID: groupedID}
+
+	b.mu.Lock()
+	if b.stopped || b.window <= 0 {
+		b.mu.Unlock()
+		b.onReady(entities, []*tg.Message{msg})
+		return
+	}
+
+	entry, exists := b.pending[key]
+	if !exists {
+		entry = &albumEntry{entities: cloneEntities(entities)}
+		b.pending[key] = entry
+	} else {
+		mergeEntities(&entry.entities, entities)
+		if entry.timer != nil {
+			entry.timer.Stop()
+		}
+	}
+	entry.parts = append(entry.parts, msg)
+	entry.timer = time.AfterFunc(b.window, func() {
+		b.flush(key)
+	})
+	b.mu.Unlock()
+}
+
+// Stop запрещает дальнейшую буферизацию и синхронно обрабатывает все накопленные альбомы.
+func (b *albumBuffer) Stop() {
+	b.mu.Lock()
+	b.stopped = true
+	entries := make([]*albumEntry, 0, len(b.pending))
+	for key, entry := range b.pending {
+		if entry.timer != nil {
+			entry.timer.Stop()
+		}
+		entries = append(entries, entry)
+		delete(b.pending, key)
+	}
+	b.mu.Unlock()
+
+	for _, entry := range entries {
+		b.onReady(entry.entities, entry.parts)
+	}
+}
+
+// flush извлекает альбом по ключу под локом и передаёт его в onReady вне критической секции.
+// Отсутствие записи — норма (альбом уже обработан в Stop).
+func (b *albumBuffer) flush(key albumKey) {
+	b.mu.Lock()
+	entry, ok := b.pending[key]
+	if ok {
+		delete(b.pending, key)
+	}
+	b.mu.Unlock()
+
+	if ok {
+		b.onReady(entry.entities, entry.parts)
+	}
+}
+
+// onAlbumReady фильтрует собранный альбом как одно сообщение и ставит уведомления.
+// Представителем альбома выступает часть с подписью (или первая часть, если подписей нет):
+// по ней ведётся отметка notified, чтобы последующие правки подписи не дали дубль.
+func (h *Handlers) onAlbumReady(entities tg.Entities, parts []*tg.Message) {
+	if len(parts) == 0 {
+		return
+	}
+	slices.SortFunc(parts, func(a, b *tg.Message) int { return a.ID - b.ID })
+
+	album := buildAlbumMessage(parts)
+	ids := make([]int, 0, len(parts))
+	for _, part := range parts {
+		ids = append(ids, part.ID)
+	}
+	logger.Debugf("Album: %d part(s) collected for peer %d (ids=%v)",
+		len(parts), tgutil.GetPeerID(album.PeerID), ids)
+
+	results := h.filters.ProcessMessage(entities, album)
+	h.archiveMatches(entities, album, ids, results)
+	if _, fresh := h.splitNotified(album, results); len(fresh) > 0 {
+		if err := h.notif.NotifyAlbum(entities, album, ids, fresh); err != nil {
+			logger.Errorf("notify enqueue error: %v", err)
+		} else {
+			h.markAllNotified(album, fresh)
+		}
+		h.runActions(album, ids, fresh)
+		h.archiveMedia(entities, album, ids, fresh)
+	}
+}
+
+// albumEditWindow — на сколько ID в каждую сторону от отредактированной части ищутся остальные
+// части альбома: части получают идущие подряд ID, а в альбоме не больше 10 элементов.
+const albumEditWindow = 9
+
+// albumFetchTimeout — таймаут перечитывания частей альбома при правке.
+const albumFetchTimeout = 15 * time.Second
+
+// MessageReader перечитывает сообщения чата под общим троттлером аккаунта
+// (реализация — telegramnotifier.ClientSender).
+type MessageReader interface {
+	GetMessages(ctx context.Context, peer notifications.Recipient, ids []int) ([]*tg.Message, error)
+}
+
+// editedAlbum перечитывает части альбома groupedID вокруг отредактированной части msg и собирает
+// представителя альбома, как onAlbumReady: уведомление об альбоме строится по всем подписям,
+// а не по тексту одной части. Возвращает представителя и ID частей по возрастанию.
+func (h *Handlers) editedAlbum(msg *tg.Message, groupedID int64) (*tg.Message, []int, error) {
+	if h.reader == nil {
+		return nil, nil, errors.New("message reader is not configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), albumFetchTimeout)
+	defer cancel()
+
+	peer := notifications.Recipient{Type: tgutil.GetPeerKind(msg.PeerID), ID: tgutil.GetPeerID(msg.PeerID)}
+	ids := make([]int, 0, 2*albumEditWindow+1)
+	for id := max(1, msg.ID-albumEditWindow); id <= msg.ID+albumEditWindow; id++ {
+		ids = append(ids, id)
+	}
+	messages, err := h.reader.GetMessages(ctx, peer, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Отредактированная часть берётся из апдейта: она не старше перечитанной копии.
+	parts := []*tg.Message{msg}
+	for _, part := range messages {
+		if part.ID == msg.ID {
+			continue
+		}
+		if id, grouped := part.GetGroupedID(); grouped && id == groupedID {
+			parts = append(parts, part)
+		}
+	}
+	slices.SortFunc(parts, func(a, b *tg.Message) int { return a.ID - b.ID })
+	ids = ids[:0]
+	for _, part := range parts {
+		ids = append(ids, part.ID)
+	}
+	return buildAlbumMessage(parts), ids, nil
+}
+
+// buildAlbumMessage собирает сообщение-представитель альбома: копию первой части с подписью
+// и объединённым текстом всех подписей. Entities сохраняются, только если подпись одна —
+// при склейке нескольких подписей смещения UTF-16 перестают быть валидными.
+func buildAlbumMessage(parts []*tg.Message) *tg.Message {
+	var (
+		captions []string
+		captured *tg.Message
+	)
+	for _, part := range parts {
+		text := strings.TrimSpace(part.Message)
+		if text == "" {
+			continue
+		}
+		captions = append(captions, text)
+		if captured == nil {
+			captured = part
+		}
+	}
+	if captured == nil {
+		captured = parts[0]
+	}
+
+	album := *captured
+	album.Message = strings.Join(captions, "\n")
+	if len(captions) != 1 {
+		album.Entities = nil
+	}
+	return &album
+}
+
+// cloneEntities делает поверхностную копию карт entities, чтобы слияние не трогало исходный апдейт.
+func cloneEntities(in tg.Entities) tg.Entities {
+	out := tg.Entities{
+		Short:    in.Short,
+		Users:    make(map[int64]*tg.User, len(in.Users)),
+		Chats:    make(map[int64]*tg.Chat, len(in.Chats)),
+		Channels: make(map[int64]*tg.Channel, len(in.Channels)),
+	}
+	mergeEntities(&out, in)
+	return out
+}
+
+// mergeEntities добавляет в dst пользователей, чаты и каналы из src (src имеет приоритет).
+func mergeEntities(dst *tg.Entities, src tg.Entities) {
+	for id, user := range src.Users {
+		dst.Users[id] = user
+	}
+	for id, chat := range src.Chats {
+		dst.Chats[id] = chat
+	}
+	for id, channel := range src.Channels {
+		dst.Channels[id] = channel
+	}
+}
@@ -0,0 +1,46 @@
+// Package updates / файл backfill.go — обработка сообщений истории для backfill
+// (см. internal/domain/backfill). Handlers реализует backfill.Processor.
+//
+// Отличия от живых апдейтов:
+//   - исходящие сообщения и команды «Избранного» пропускаются;
+//   - части альбомов фильтруются по отдельности, без буфера сборки;
+//   - автоматические действия фильтров не выполняются: реакция на старые сообщения
+//     задним числом (пересылка, пометка прочитанным) почти никогда не ожидается;
+//   - отметки notified и дедупликатор общие с живыми апдейтами, поэтому уже обработанное
+//     и уведомлённое не повторяется (важно для восстановления пропусков, которое может
+//     пересечься с разницей, догружаемой updates.Manager).
+
+package updates
+
+import (
+	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/tgutil"
+	"telegram-userbot/internal/infra/logger"
+
+	"github.com/gotd/td/tg"
+)
+
+// ProcessHistory прогоняет сообщение истории через фильтры и возвращает новые
+// (ещё не уведомлённые) совпадения. При report=true только возвращает их: без архива,
+// уведомлений и отметок notified; иначе проходит обычный путь notified → очередь.
+func (h *Handlers) ProcessHistory(entities tg.Entities, msg *tg.Message, report bool) []filters.FilterMatchResult {
+	if msg == nil || msg.Out {
+		return nil
+	}
+	if !report && h.dupCache.DedupSeen(tgutil.GetPeerID(msg.PeerID), msg.ID, msg.EditDate) {
+		return nil
+	}
+	results := h.filters.ProcessMessage(entities, msg)
+	_, fresh := h.splitNotified(msg, results)
+	if report || len(fresh) == 0 {
+		return fresh
+	}
+	h.archiveMatches(entities, msg, nil, fresh)
+	if err := h.notif.Notify(entities, msg, fresh); err != nil {
+		logger.Errorf("notify enqueue error: %v", err)
+		return fresh
+	}
+	h.markAllNotified(msg, fresh)
+	h.archiveMedia(entities, msg, nil, fresh)
+	return fresh
+}
@@ -0,0 +1,46 @@
+// Package updates / файл deleted.go обрабатывает удаление сообщений.
+// Если исходное сообщение удалили до окна расписания, уведомление о нём
+// теряет смысл: очередь снимает ожидающие задания, а при NOTIFY_MARK_DELETED
+// отправляет получателям пометку «(deleted)» по уже доставленным.
+
+package updates
+
+import (
+	"context"
+
+	"telegram-userbot/internal/infra/logger"
+
+	"github.com/gotd/td/tg"
+)
+
+// OnDeleteMessages обрабатывает удаление сообщений в личных чатах и обычных группах.
+// Telegram не передаёт в апдейте чат: ID сообщений здесь уникальны в пределах аккаунта.
+func (h *Handlers) OnDeleteMessages(
+	ctx context.Context,
+	entities tg.Entities,
+	u *tg.UpdateDeleteMessages,
+) error {
+	logger.Debugf("OnDeleteMessages: ids=%v", u.Messages)
+	h.dropDeleted(0, u.Messages)
+	return nil
+}
+
+// OnDeleteChannelMessages обрабатывает удаление сообщений в каналах и мегагруппах.
+func (h *Handlers) OnDeleteChannelMessages(
+	ctx context.Context,
+	entities tg.Entities,
+	u *tg.UpdateDeleteChannelMessages,
+) error {
+	logger.Debugf("OnDeleteChannelMessages: channel=%d ids=%v", u.ChannelID, u.Messages)
+	h.dropDeleted(u.ChannelID, u.Messages)
+	return nil
+}
+
+// dropDeleted передаёт удалённые ID в очередь уведомлений и логирует итог.
+func (h *Handlers) dropDeleted(channelID int64, messageIDs []int) {
+	removed, marked := h.notif.DropDeleted(channelID, messageIDs)
+	if removed > 0 || marked > 0 {
+		logger.Infof("Deleted messages: dropped %d pending job(s), %d deleted mark(s) (channel=%d ids=%v)",
+			removed, marked, channelID, messageIDs)
+	}
+}
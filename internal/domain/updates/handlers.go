@@ -5,7 +5,10 @@
 //  2. идемпотентная доставка уведомлений (notified-кэш + очередь уведомлений),
 //  3. защита от повторной обработки (Deduplicator по peerID/msgID/EditDate),
 //  4. сглаживание всплесков при частых правках одного сообщения (Debouncer),
-//  5. поддержание локальных счетчиков непрочитанного для эвристик.
+//  5. сборка медиа-альбомов (grouped_id) в одно уведомление,
+//  6. снятие уведомлений об удалённых сообщениях,
+//  7. поддержание локальных счетчиков непрочитанного для эвристик,
+//  8. команды управления из «Избранного» (см. selfcmd.go).
 //
 // Пакет не отправляет сообщения сам по себе — он формирует и ставит задачи в
 // очередь уведомлений, а также ведет кэш «что уже уведомляли», чтобы не
@@ -15,14 +18,22 @@ package updates
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"telegram-userbot/internal/domain/actions"
+	"telegram-userbot/internal/domain/archive"
+	"telegram-userbot/internal/domain/backfill"
 	"telegram-userbot/internal/domain/filters"
+	"telegram-userbot/internal/domain/mediaarchive"
 	"telegram-userbot/internal/domain/notifications"
 	"telegram-userbot/internal/domain/tgutil"
 	"telegram-userbot/internal/infra/concurrency"
 	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
+	"telegram-userbot/internal/infra/telegram/connection"
 	"telegram-userbot/internal/infra/telegram/peersmgr"
+	"telegram-userbot/internal/infra/telegram/status"
 	"telegram-userbot/internal/support/debug"
 
 	"telegram-userbot/internal/infra/config"
@@ -34,27 +45,38 @@ import (
 // апдейтов Telegram. Экземпляр поддерживает:
 //   - обращение к Telegram API для служебных операций;
 //   - постановку уведомлений в очередь с соблюдением идемпотентности;
-//   - локальный кэш комбинаций «сообщение × фильтр», уже отработанных;
+//   - персистентный кэш комбинаций «сообщение × фильтр», уже отработанных;
 //   - дедупликацию по (peerID, msgID, editDate), чтобы не переобрабатывать
 //     одно и то же содержимое;
 //   - дебаунс частых правок одного сообщения, чтобы не заспамить очередь;
+//   - сборку частей альбома в одно сообщение перед фильтрацией;
 //   - грубые счетчики непрочитанного по пирам для вспомогательных эвристик;
-//   - фоновую очистку устаревших отметок notified и периодический сброс их на диск.
+//   - фоновую очистку устаревших отметок notified.
 type Handlers struct {
 	api       *tg.Client                // api предоставляет доступ к TDLib-клиенту для служебных запросов
 	filters   *filters.FilterEngine     // filters содержит движок фильтров для матчинга сообщений
 	notif     *notifications.Queue      // notif отвечает за доставку уведомлений конечному пользователю
-	notified  map[string]time.Time      // notified запоминает, какие комбинации «сообщение-фильтр» уже уведомлялись
-	mu        sync.Mutex                // mu защищает доступ к карте notified в конкурентной среде
+	notified  *storage.TTLBucket        // notified запоминает, какие комбинации «сообщение-фильтр» уже уведомлялись
 	dupCache  *concurrency.Deduplicator // dupCache предотвращает повторную обработку одинаковых сообщений
 	debouncer *concurrency.Debouncer    // debouncer сглаживает частые обновления одного сообщения (редактирования)
 	unread    map[int64]int             // unread хранит счётчики непрочитанных сообщений по пирами
 	unreadMu  sync.Mutex                // unreadMu синхронизирует конкурентные обновления карты unread
 	peers     *peersmgr.Service         // peers предоставляет доступ к менеджеру пиров и локальному снапшоту
+	albums    *albumBuffer              // albums копит части медиа-альбомов до фильтрации
+	actions   *actions.Service          // actions исполняет автоматические действия фильтров (nil — выключены)
+	archive   *archive.Archive          // archive хранит совпавшие сообщения для поиска (nil — выключен)
+	media     *mediaarchive.Service     // media скачивает медиа совпавших сообщений (nil — выключено)
+	history   *backfill.Service         // history помнит последние сообщения чатов для восстановления пропусков
+	conn      *connection.Manager       // conn — соединение аккаунта (nil — менеджер по умолчанию)
+	presence  *status.StatusManager     // presence — онлайн-статус аккаунта (nil — менеджер по умолчанию)
+	reader    MessageReader             // reader перечитывает части альбома при правке под троттлером аккаунта
 
-	notifiedCacheFile string
-	notifiedDirty     bool
-	notifiedSaveTimer *time.Timer
+	notifiedCacheFile string // notifiedCacheFile — устаревший JSON‑снимок notified для однократного импорта
+
+	commands   CommandExecutor // commands выполняет команды из «Избранного» (nil — канал выключен)
+	selfPrefix string          // selfPrefix — префикс команд; пустой — канал выключен
+	selfChat   int64           // selfChat — дополнительный личный чат для команд (0 — только «Избранное»)
+	selfID     atomic.Int64    // selfID — ID аккаунта, известен после логина (SetSelfID)
 
 	startOnce sync.Once
 	stopOnce  sync.Once
@@ -65,37 +87,74 @@ type Handlers struct {
 	shutdown context.CancelFunc
 }
 
+// Account привязывает обработчики к аккаунту процесса: соединение и онлайн-статус
+// аккаунта (nil — менеджеры по умолчанию), его устаревший JSON‑снимок notified и чтение
+// сообщений под троттлером аккаунта (Reader, нужен для правок альбомов).
+type Account struct {
+	Conn              *connection.Manager
+	Presence          *status.StatusManager
+	NotifiedCacheFile string
+	Reader            MessageReader
+}
+
 // NewHandlers подготавливает инстанс обработчиков: связывает Telegram-клиента,
 // очередь уведомлений и утилиты конкурентного доступа (дедупликатор,
-// дебаунсер). Значимые параметры берутся из конфигурации окружения:
+// дебаунсер) и бакет notified в кэш-базе аккаунта account. Значимые параметры берутся
+// из конфигурации окружения:
 //   - NotifiedTTLDays — срок хранения отметок «уже уведомлено»;
-//   - NotifiedCacheFile — путь файла для периодического флаша notified-кэша.
+//   - AlbumWindowMS — окно сборки частей альбома;
+//   - SelfCommandPrefix/SelfCommandChat — канал команд из «Избранного» (commands == nil — выключен).
+//
+// Совпавшие сообщения сохраняются в архив messages (nil — архив выключен), а медиа фильтров
+// с archive_media — в архив медиа media (nil — выключен). history запоминает последнее
+// обработанное сообщение отслеживаемых чатов для восстановления пропусков (nil — выключено).
+// Устаревший JSON‑снимок notified аккаунта (account.NotifiedCacheFile) импортируется при старте.
 //
 // Возвращает полностью инициализированную структуру без запуска фоновых горутин.
 func NewHandlers(api *tg.Client, filters *filters.FilterEngine, notif *notifications.Queue,
-	dup *concurrency.Deduplicator, debouncer *concurrency.Debouncer,
-	shutdown func(), peers *peersmgr.Service) *Handlers {
+	dup *concurrency.Deduplicator, debouncer *concurrency.Debouncer, cache *storage.TTLDB,
+	shutdown func(), peers *peersmgr.Service, commands CommandExecutor, autoActions *actions.Service,
+	messages *archive.Archive, media *mediaarchive.Service, history *backfill.Service, account Account,
+) (*Handlers, error) {
 	cfg := config.Env()
-	return &Handlers{
+	notified, err := cache.Bucket("notified", notifiedMaxEntries)
+	if err != nil {
+		return nil, err
+	}
+	h := &Handlers{
 		api:               api,
 		filters:           filters,
 		notif:             notif,
-		notified:          make(map[string]time.Time),
+		notified:          notified,
 		dupCache:          dup,
 		debouncer:         debouncer,
 		unread:            make(map[int64]int),
 		cleanTTL:          time.Duration(cfg.NotifiedTTLDays) * 24 * time.Hour,
 		shutdown:          shutdown,
-		notifiedCacheFile: cfg.NotifiedCacheFile,
+		notifiedCacheFile: account.NotifiedCacheFile,
 		peers:             peers,
+		commands:          commands,
+		actions:           autoActions,
+		archive:           messages,
+		media:             media,
+		history:           history,
+		conn:              account.Conn,
+		presence:          account.Presence,
+		reader:            account.Reader,
+		selfPrefix:        cfg.SelfCommandPrefix,
+		selfChat:          int64(cfg.SelfCommandChat),
 	}
+	h.albums = newAlbumBuffer(cfg.AlbumWindowMS, h.onAlbumReady)
+	return h, nil
 }
 
 // Start запускает фоновые воркеры и восстанавливает состояние notified-кэша.
 // Последовательность:
 //  1. опционально переопределяет TTL очистки, если передан аргумент > 0;
-//  2. загружает кэш notified с диска (best-effort, ошибки не критичны);
+//  2. импортирует устаревший JSON‑снимок notified, если он остался (best-effort);
 //  3. поднимает контекст отмены и стартует:
+//     - исполнитель автоматических действий фильтров (если задан),
+//     - загрузчик архива медиа (если задан),
 //     - планировщик отметок прочитанного (runMarkReadScheduler),
 //     - сборщик мусора для notified (runNotificationCacheCleaner).
 //
@@ -109,11 +168,17 @@ func (h *Handlers) Start(ctx context.Context, cleanTTL time.Duration) {
 		if cleanTTL > 0 {
 			h.cleanTTL = cleanTTL
 		}
-		// загрузка кэша notified с диска
-		h.loadNotifiedFromDisk()
+		// перенос отметок из устаревшего JSON‑снимка, если он остался
+		h.importLegacyNotified()
 
 		runCtx, cancel := context.WithCancel(ctx)
 		h.cancel = cancel
+		if h.actions != nil {
+			h.actions.Start(runCtx)
+		}
+		if h.media != nil {
+			h.media.Start(runCtx)
+		}
 
 		h.wg.Go(func() {
 			h.runMarkReadScheduler(runCtx)
@@ -126,29 +191,38 @@ func (h *Handlers) Start(ctx context.Context, cleanTTL time.Duration) {
 }
 
 // Stop корректно останавливает запущенные воркеры: вызывает cancel контекста,
-// дожидается завершения горутин и делает принудительный флаш notified-кэша на
-// диск. Повторные вызовы безопасны и игнорируются (stopOnce).
+// дожидается завершения горутин и обрабатывает недособранные альбомы. Отметки
+// notified уже записаны в bbolt, отдельный флаш не нужен. Повторные вызовы
+// безопасны и игнорируются (stopOnce).
 func (h *Handlers) Stop() {
 	h.stopOnce.Do(func() {
 		if h.cancel != nil {
 			h.cancel()
 		}
 		h.wg.Wait()
-		// Финальный флаш кэша notified на диск
-		h.flushNotifiedNow()
+		// Альбомы, ожидающие окна сборки, обрабатываем сейчас, чтобы не потерять матчи.
+		h.albums.Stop()
+		if h.actions != nil {
+			h.actions.Stop()
+		}
+		// Незавершённые загрузки медиа остаются в персистентной очереди до следующего запуска.
+		if h.media != nil {
+			h.media.Stop()
+		}
 	})
 }
 
 // OnNewMessage обрабатывает входящее личное или групповое сообщение.
 // Пайплайн:
-//  1. отбрасывает исходящие сообщения (msg.Out);
-//  2. прогревает кэш inputPeer по entities;
-//  3. делает быструю дедупликацию по (peerID, msgID, editDate);
-//  4. обрабатывает служебную команду "Exit" для завершения процесса;
-//  5. прогоняет текст через filters.ProcessMessage и для каждого совпадения
-//     проверяет идемпотентность (hasNotified);
-//  6. ставит задачу уведомления в очередь и помечает пару (msg, filterID)
-//     как доставленную, чтобы избежать повторов при редактированиях;
+//  1. прогревает кэш inputPeer по entities;
+//  2. делает быструю дедупликацию по (peerID, msgID, editDate);
+//  3. исходящие сообщения (msg.Out) не фильтрует: выполняет только команды
+//     из «Избранного», см. selfcmd.go;
+//  4. части альбома (grouped_id) откладывает в буфер сборки, см. album.go;
+//  5. прогоняет текст через filters.ProcessMessage и отбрасывает уже
+//     уведомлённые пары (msg, filterID) (splitNotified);
+//  6. ставит новые совпадения в очередь одним вызовом (одно задание на получателя)
+//     и помечает каждую пару (msg, filterID), чтобы избежать повторов при редактированиях;
 //  7. обновляет локальные счётчики непрочитанного.
 //
 // Возвращает ошибку только в случае сбоя постановки уведомления.
@@ -158,7 +232,7 @@ func (h *Handlers) OnNewMessage(
 	u *tg.UpdateNewMessage,
 ) error {
 	msg, ok := u.Message.(*tg.Message)
-	if !ok || msg.Out {
+	if !ok {
 		return nil
 	}
 
@@ -173,31 +247,36 @@ func (h *Handlers) OnNewMessage(
 		return nil
 	}
 
-	// Сервисный триггер: входящее сообщение с текстом "Exit" инициирует graceful shutdown.
-	if msg.Message == "Exit" {
-		logger.Info("Shutdown requested via incoming message")
-		// if h.cancel != nil {
-		// 	h.cancel()
-		// }
-		if h.shutdown != nil {
-			h.shutdown()
+	// Исходящие сообщения не фильтруются; команды из «Избранного» выполняются и
+	// получают ответ правкой того же сообщения.
+	if msg.Out {
+		if line, isCmd := h.selfCommandLine(msg); isCmd {
+			h.handleSelfCommand(ctx, msg, line)
 		}
 		return nil
 	}
 
 	logger.Debug("OnNewMessage")
 	debug.PrintUpdate("DM/Group", msg, entities, h.peers)
+	h.observe(msg)
+	// Части альбома фильтруются вместе после окна сборки.
+	if groupedID, grouped := msg.GetGroupedID(); grouped {
+		h.albums.Add(entities, msg, groupedID)
+		h.setUnreadCache(peerID, msg.ID)
+		return nil
+	}
 	results := h.filters.ProcessMessage(entities, msg)
-	for _, res := range results {
-		if h.hasNotified(msg, res.Filter.ID) {
-			continue
-		}
-		if err := h.notif.Notify(entities, msg, res); err != nil {
-			// Ошибка здесь — редкая валидационная (nil msg / пустые получатели). Не помечаем.
+	h.archiveMatches(entities, msg, nil, results)
+	if _, fresh := h.splitNotified(msg, results); len(fresh) > 0 {
+		// Все новые совпадения уходят одним вызовом: очередь объединит их по получателю.
+		if err := h.notif.Notify(entities, msg, fresh); err != nil {
+			// Ошибка здесь — редкая валидационная (nil msg). Не помечаем.
 			logger.Errorf("notify enqueue error: %v", err)
-			continue
+		} else {
+			h.markAllNotified(msg, fresh)
 		}
-		h.markNotified(msg, res.Filter.ID)
+		h.runActions(msg, nil, fresh)
+		h.archiveMedia(entities, msg, nil, fresh)
 	}
 	// Обновляем локальный счётчик "непрочитанных" для дальнейших эвристик.
 	h.setUnreadCache(peerID, msg.ID)
@@ -206,7 +285,8 @@ func (h *Handlers) OnNewMessage(
 
 // OnNewChannelMessage обрабатывает входящее сообщение из канала. Логика
 // идентична личным/групповым сообщениям: прогрев кэша, дедупликация,
-// фильтрация, идемпотентная постановка уведомлений и обновление счётчиков.
+// сборка альбомов, фильтрация, идемпотентная постановка уведомлений и
+// обновление счётчиков.
 func (h *Handlers) OnNewChannelMessage(
 	ctx context.Context,
 	entities tg.Entities,
@@ -228,17 +308,24 @@ func (h *Handlers) OnNewChannelMessage(
 	}
 	logger.Debug("OnNewChannelMessage")
 	debug.PrintUpdate("Channel", msg, entities, h.peers)
+	h.observe(msg)
+	if groupedID, grouped := msg.GetGroupedID(); grouped {
+		h.albums.Add(entities, msg, groupedID)
+		h.setUnreadCache(peerID, msg.ID)
+		return nil
+	}
 	results := h.filters.ProcessMessage(entities, msg)
-	for _, res := range results {
-		if h.hasNotified(msg, res.Filter.ID) {
-			continue
-		}
-		if err := h.notif.Notify(entities, msg, res); err != nil {
-			// Ошибка здесь — редкая валидационная (nil msg / пустые получатели). Не помечаем.
+	h.archiveMatches(entities, msg, nil, results)
+	if _, fresh := h.splitNotified(msg, results); len(fresh) > 0 {
+		// Все новые совпадения уходят одним вызовом: очередь объединит их по получателю.
+		if err := h.notif.Notify(entities, msg, fresh); err != nil {
+			// Ошибка здесь — редкая валидационная (nil msg). Не помечаем.
 			logger.Errorf("notify enqueue error: %v", err)
-			continue
+		} else {
+			h.markAllNotified(msg, fresh)
 		}
-		h.markNotified(msg, res.Filter.ID)
+		h.runActions(msg, nil, fresh)
+		h.archiveMedia(entities, msg, nil, fresh)
 	}
 	h.setUnreadCache(peerID, msg.ID)
 	return nil
@@ -247,8 +334,7 @@ func (h *Handlers) OnNewChannelMessage(
 // OnEditMessage реагирует на редактирование личных/групповых сообщений.
 // Использует Debouncer для сглаживания частых правок и Deduplicator по
 // комбинации (peerID, msgID, editDate), чтобы повторно не обрабатывать
-// идентичное содержимое. При появлении новых совпадений фильтров ставит
-// уведомления и фиксирует отметку notified для пары (msg, filterID).
+// идентичное содержимое. Обработка правки — см. processEdited.
 func (h *Handlers) OnEditMessage(
 	ctx context.Context,
 	entities tg.Entities,
@@ -262,27 +348,14 @@ func (h *Handlers) OnEditMessage(
 	logger.Debug("OnEditMessage")
 	debug.PrintUpdate("OnEditMessage", msg, entities, h.peers)
 	// Дебаунсим лавину апдейтов при частых правках одного и того же сообщения.
-	h.debouncer.Do(msg.ID, func() {
-		if !h.dupCache.DedupSeen(tgutil.GetPeerID(msg.PeerID), msg.ID, msg.EditDate) {
-			results := h.filters.ProcessMessage(entities, msg)
-			for _, res := range results {
-				if h.hasNotified(msg, res.Filter.ID) {
-					continue
-				}
-				if err := h.notif.Notify(entities, msg, res); err != nil {
-					logger.Errorf("notify enqueue error: %v", err)
-					continue
-				}
-				h.markNotified(msg, res.Filter.ID)
-			}
-		}
+	h.debouncer.Do(editKey(msg), func(info concurrency.DebounceInfo) {
+		h.processEdited(entities, msg, info)
 	})
 	return nil
 }
 
 // OnEditChannelMessage обрабатывает редактирование сообщений в каналах.
-// Логика: дебаунс правок, проверка на дедупликацию, повторный прогон через
-// фильтры и, при наличии новых матчей, постановка уведомлений с отметкой notified.
+// Логика: дебаунс правок, затем та же обработка, что и в личке (processEdited).
 func (h *Handlers) OnEditChannelMessage(
 	ctx context.Context,
 	entities tg.Entities,
@@ -295,20 +368,114 @@ func (h *Handlers) OnEditChannelMessage(
 	logger.Debug("OnEditChannelMessage")
 	debug.PrintUpdate("OnEditChannelMessage", msg, entities, h.peers)
 	// Дебаунсим частые правки сообщений канала, чтобы не заспамить очередь.
-	h.debouncer.Do(msg.ID, func() {
-		if !h.dupCache.DedupSeen(tgutil.GetPeerID(msg.PeerID), msg.ID, msg.EditDate) {
-			results := h.filters.ProcessMessage(entities, msg)
-			for _, res := range results {
-				if h.hasNotified(msg, res.Filter.ID) {
-					continue
-				}
-				if err := h.notif.Notify(entities, msg, res); err != nil {
-					logger.Errorf("notify enqueue error: %v", err)
-					continue
-				}
-				h.markNotified(msg, res.Filter.ID)
-			}
-		}
+	h.debouncer.Do(editKey(msg), func(info concurrency.DebounceInfo) {
+		h.processEdited(entities, msg, info)
 	})
 	return nil
 }
+
+// editKey строит ключ дебаунса правок: ID сообщений в каналах уникальны только
+// внутри канала, поэтому ключ включает вид и ID peer.
+func editKey(msg *tg.Message) concurrency.DebounceKey {
+	return concurrency.DebounceKey{
+		PeerKind: tgutil.GetPeerKind(msg.PeerID),
+		PeerID:   tgutil.GetPeerID(msg.PeerID),
+		MsgID:    msg.ID,
+	}
+}
+
+// processEdited прогоняет отредактированное сообщение через фильтры после дебаунса.
+// Новые совпадения ставятся в очередь с отметкой notified; для уже уведомлённых пар
+// (msg, filterID) очередь обновляет ожидающие и доставленные уведомления по политике правок.
+// Правка части альбома фильтрует альбом целиком (см. editedAlbum), как при его получении.
+// info описывает серию правок: по нему в логе отличаем «новый матч после правки»
+// от правки, не изменившей результата фильтрации.
+func (h *Handlers) processEdited(entities tg.Entities, msg *tg.Message, info concurrency.DebounceInfo) {
+	if h.dupCache.DedupSeen(tgutil.GetPeerID(msg.PeerID), msg.ID, msg.EditDate) {
+		return
+	}
+	logger.Debugf("Edit settled: peer=%d msg=%d edits=%d since_first=%s capped=%t",
+		tgutil.GetPeerID(msg.PeerID), msg.ID, info.Events, info.SinceFirst(), info.Capped)
+	var ids []int
+	if groupedID, grouped := msg.GetGroupedID(); grouped {
+		album, parts, err := h.editedAlbum(msg, groupedID)
+		if err != nil {
+			logger.Warnf("Album edit skipped: peer=%d msg=%d: %v", tgutil.GetPeerID(msg.PeerID), msg.ID, err)
+			return
+		}
+		msg, ids = album, parts
+	}
+	results := h.filters.ProcessMessage(entities, msg)
+	h.archiveMatches(entities, msg, ids, results)
+	notified, fresh := h.splitNotified(msg, results)
+	if len(notified) > 0 {
+		if _, err := h.notif.NotifyEdited(entities, msg, notified); err != nil {
+			logger.Errorf("notify edit error: %v", err)
+		}
+	}
+	if len(fresh) == 0 {
+		return
+	}
+	// Порядок как в OnNewMessage: сначала уведомление, затем действия и загрузка медиа.
+	var err error
+	if ids != nil {
+		err = h.notif.NotifyAlbum(entities, msg, ids, fresh)
+	} else {
+		err = h.notif.Notify(entities, msg, fresh)
+	}
+	if err != nil {
+		logger.Errorf("notify enqueue error: %v", err)
+	} else {
+		h.markAllNotified(msg, fresh)
+		for _, res := range fresh {
+			logger.Infof("New match after edit: filter=%s peer=%d msg=%d (%d edit(s) over %s)",
+				res.Filter.ID, tgutil.GetPeerID(msg.PeerID), msg.ID, info.Events, info.SinceFirst())
+		}
+	}
+	h.runActions(msg, ids, fresh)
+	h.archiveMedia(entities, msg, ids, fresh)
+}
+
+// runActions планирует автоматические действия фильтров для новых совпадений;
+// messageIDs — части альбома (nil — только само сообщение).
+func (h *Handlers) runActions(msg *tg.Message, messageIDs []int, fresh []filters.FilterMatchResult) {
+	if h.actions != nil {
+		h.actions.Run(msg, messageIDs, fresh)
+	}
+}
+
+// archiveMedia ставит в очередь загрузку медиа для новых совпадений фильтров с archive_media;
+// messageIDs — части альбома (nil — только само сообщение).
+func (h *Handlers) archiveMedia(
+	entities tg.Entities,
+	msg *tg.Message,
+	messageIDs []int,
+	fresh []filters.FilterMatchResult,
+) {
+	if h.media != nil {
+		h.media.Enqueue(entities, msg, messageIDs, fresh)
+	}
+}
+
+// observe отмечает сообщение последним обработанным в его чате для восстановления пропусков.
+func (h *Handlers) observe(msg *tg.Message) {
+	if h.history != nil {
+		h.history.Observe(msg)
+	}
+}
+
+// archiveMatches сохраняет совпавшее сообщение в архив; правка обновляет прежнюю запись.
+// Ошибка архива не мешает уведомлениям и только логируется.
+func (h *Handlers) archiveMatches(
+	entities tg.Entities,
+	msg *tg.Message,
+	messageIDs []int,
+	results []filters.FilterMatchResult,
+) {
+	if h.archive == nil || len(results) == 0 {
+		return
+	}
+	if err := h.archive.Add(entities, msg, messageIDs, results); err != nil {
+		logger.Errorf("Archive: failed to store message %d: %v", msg.ID, err)
+	}
+}
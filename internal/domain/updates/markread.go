@@ -18,9 +18,7 @@ import (
 
 	"telegram-userbot/internal/domain/tgutil"
 	"telegram-userbot/internal/infra/logger"
-	"telegram-userbot/internal/infra/telegram/connection"
 	tgruntime "telegram-userbot/internal/infra/telegram/runtime"
-	"telegram-userbot/internal/infra/telegram/status"
 
 	"github.com/gotd/td/tg"
 )
@@ -133,8 +131,8 @@ func (h *Handlers) flushUnread(ctx context.Context) {
 	}
 
 	// Перед серией сетевых вызовов убеждаемся, что клиент онлайн, и кратко «засветим» активность.
-	connection.WaitOnline(ctx)
-	status.GoOnline()
+	h.conn.WaitOnline(ctx)
+	h.presence.GoOnline()
 	// Небольшая задержка перед первым запросом, чтобы не выглядеть как бот-триггер.
 	tgruntime.WaitRandomTimeMs(ctx, readDelayMinMs, readDelayMaxMs)
 
@@ -155,7 +153,7 @@ func (h *Handlers) flushUnread(ctx context.Context) {
 //   - для пользователей/групп — MessagesReadHistory,
 //   - для каналов — ChannelsReadHistory.
 //
-// Перед каждым вызовом дожидается онлайна, ошибки пробрасывает в connection.HandleError
+// Перед каждым вызовом дожидается онлайна, ошибки пробрасывает в HandleError соединения аккаунта
 // и при успехе синхронизирует локальный кэш lastUnreadCache, чтобы не повторять работу.
 func (h *Handlers) markRead(ctx context.Context, msg *tg.Message) {
 	if h.peers == nil {
@@ -172,12 +170,12 @@ func (h *Handlers) markRead(ctx context.Context, msg *tg.Message) {
 
 	switch p := peer.(type) {
 	case *tg.InputPeerUser, *tg.InputPeerChat:
-		connection.WaitOnline(ctx)
+		h.conn.WaitOnline(ctx)
 		if _, err := h.api.MessagesReadHistory(ctx, &tg.MessagesReadHistoryRequest{
 			Peer:  p,
 			MaxID: msg.ID,
 		}); err != nil {
-			connection.HandleError(err)
+			h.conn.HandleError(err)
 			logger.Errorf("markRead: Messages.readHistory failed: %v", err.Error())
 		} else {
 			h.lastUnreadCache(peerID, msg.ID)
@@ -187,12 +185,12 @@ func (h *Handlers) markRead(ctx context.Context, msg *tg.Message) {
 			ChannelID:  p.ChannelID,
 			AccessHash: p.AccessHash,
 		}
-		connection.WaitOnline(ctx)
+		h.conn.WaitOnline(ctx)
 		if _, err := h.api.ChannelsReadHistory(ctx, &tg.ChannelsReadHistoryRequest{
 			Channel: ch,
 			MaxID:   msg.ID,
 		}); err != nil {
-			connection.HandleError(err)
+			h.conn.HandleError(err)
 			logger.Errorf("markRead: channels.readHistory failed: %v", err.Error())
 		} else {
 			h.lastUnreadCache(peerID, msg.ID)
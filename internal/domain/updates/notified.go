@@ -1,23 +1,25 @@
 // Package updates / файл notified.go отвечает за идемпотентность рассылки:
-// хранит отметки «сообщение × фильтр уже уведомлено», периодически чистит их
-// по TTL и обеспечивает безопасную и экономную запись состояния на диск.
+// хранит отметки «сообщение × фильтр уже уведомлено» в bbolt-бакете с TTL.
 // Ключевые задачи:
-//   - детерминированный ключ (peerID:msgID:filterID) для быстрых проверок,
-//   - TTL‑очистка в фоне (ticker + h.cleanTTL),
-//   - ленивый debounced‑флаш при изменениях, с дренированием таймера,
-//   - загрузка состояния при старте с отсевом устаревших записей.
+//   - детерминированный бинарный ключ (peerID, msgID, filterID) для быстрых проверок,
+//   - инкрементальная запись каждой отметки без перезаписи всего снимка,
+//   - TTL‑очистка и ограничение размера в фоне (ticker + notifiedMaxEntries),
+//   - однократный импорт устаревшего JSON‑снимка (NOTIFIED_CACHE_FILE) при старте.
 
 package updates
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"telegram-userbot/internal/domain/filters"
 	"telegram-userbot/internal/domain/tgutil"
 	"telegram-userbot/internal/infra/logger"
 	"telegram-userbot/internal/infra/storage"
@@ -25,18 +27,20 @@ import (
 	"github.com/gotd/td/tg"
 )
 
-// notifiedSaveDebounce — минимальный интервал между дисковыми сохранениями
-// notified.json. Сглаживает частые правки и уменьшает износ FS/IO.
-const notifiedSaveDebounce = 10 * time.Second
+// notifiedMaxEntries ограничивает размер бакета отметок notified: при переполнении
+// первыми вычищаются записи с ближайшим сроком истечения.
+const notifiedMaxEntries = 200000
 
-// persistedNotified — on‑disk формат: key -> unix seconds (UTC).
-// key = "<peerID>:<msgID>:<filterID>". Значения мапы конвертируются в time.Time при загрузке.
+// legacyImportedSuffix добавляется к имени JSON‑снимка после успешного импорта,
+// чтобы не импортировать его повторно и сохранить файл для ручной проверки.
+const legacyImportedSuffix = ".imported"
+
+// persistedNotified — устаревший on‑disk формат: key -> unix seconds (UTC).
+// key = "<peerID>:<msgID>:<filterID>". Читается только при импорте.
 type persistedNotified map[string]int64
 
-// runNotificationCacheCleaner проходит по h.notified раз в час и удаляет записи
-// старше h.cleanTTL. По факту удаления помечает кэш грязным и планирует
-// отложенный флаш на диск через scheduleNotifiedSaveLocked(). Останавливается
-// по ctx.Done(). Тикер останавливается корректно в defer.
+// runNotificationCacheCleaner раз в час удаляет из бакета просроченные отметки и
+// подрезает его до notifiedMaxEntries. Останавливается по ctx.Done().
 func (h *Handlers) runNotificationCacheCleaner(ctx context.Context) {
 	ticker := time.NewTicker(time.Hour) // таймер инициирует проверку раз в час
 	defer ticker.Stop()
@@ -46,160 +50,128 @@ func (h *Handlers) runNotificationCacheCleaner(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			cutoff := time.Now().Add(-h.cleanTTL)
-			// cutoff — нижняя граница допустимого возраста записи.
-
-			h.mu.Lock()
-			// Внутри критической секции безопасно удаляем устаревшие ключи.
-			deleted := false
-			for key, t := range h.notified {
-				if t.Before(cutoff) {
-					delete(h.notified, key)
-					// Если что-то удалили, запланируем отложенную запись на диск.
-					deleted = true
-				}
-			}
-			if deleted {
-				h.scheduleNotifiedSaveLocked()
+			if removed, err := h.notified.Cleanup(); err != nil {
+				logger.Errorf("notified: cleanup failed: %v", err)
+			} else if removed > 0 {
+				logger.Debugf("notified: cleanup removed %d entries", removed)
 			}
-			h.mu.Unlock()
 		}
 	}
 }
 
-// loadNotifiedFromDisk загружает JSON‑снимок notified из файла (если он есть),
-// отбрасывает записи старше TTL и восстанавливает h.notified. Путь очищается
-// через filepath.Clean; отсутствие файла не считается ошибкой (первый запуск).
-func (h *Handlers) loadNotifiedFromDisk() {
-	path := filepath.Clean(h.notifiedCacheFile)
-	// Санитизируем путь; пустой — ничего не делаем.
-	if path == "" {
+// importLegacyNotified переносит отметки из старого JSON‑снимка (если он есть) в бакет,
+// отбрасывая записи старше TTL, и переименовывает файл в *.imported. Отсутствие файла —
+// нормальная ситуация; ошибки не критичны и только логируются.
+func (h *Handlers) importLegacyNotified() {
+	if h.notifiedCacheFile == "" {
 		return
 	}
-	data, readErr := os.ReadFile(path)
+	path := filepath.Clean(h.notifiedCacheFile)
+	data, readErr := storage.ReadSealedFile(path)
 	if readErr != nil {
-		if errors.Is(readErr, os.ErrNotExist) {
-			// Файл отсутствует — нормальная ситуация на первом запуске.
-			return
+		if !errors.Is(readErr, os.ErrNotExist) {
+			logger.Warnf("notified: read legacy cache failed: %v", readErr)
 		}
-		logger.Warnf("notified: read failed: %v", readErr)
 		return
 	}
 	var onDisk persistedNotified
 	if err := json.Unmarshal(data, &onDisk); err != nil {
-		logger.Warnf("notified: unmarshal failed: %v", err)
+		logger.Warnf("notified: unmarshal legacy cache failed: %v", err)
 		return
 	}
-	now := time.Now()
-	cutoff := now.Add(-h.cleanTTL)
-	// Отбрасываем устаревшие записи прямо при загрузке, чтобы не раздувать кэш.
 
-	h.mu.Lock()
-	for k, ts := range onDisk {
-		when := time.Unix(ts, 0)
-		if when.Before(cutoff) {
+	now := time.Now()
+	entries := make(map[string]time.Time, len(onDisk))
+	for legacyKey, ts := range onDisk {
+		peerID, msgID, filterID, ok := parseLegacyNotifiedKey(legacyKey)
+		if !ok {
 			continue
 		}
-		h.notified[k] = when
-	}
-	h.mu.Unlock()
-}
-
-// scheduleNotifiedSaveLocked планирует отложенное сохранение notified.json через
-// дебаунс. Вызывать строго под h.mu. Первый вызов создаёт таймер и горутину,
-// которая по тикеру вызывает flushNotifiedNow(). Повторные вызовы перезапускают
-// таймер с корректным дренированием канала, если тик уже произошёл.
-func (h *Handlers) scheduleNotifiedSaveLocked() {
-	h.notifiedDirty = true
-	if h.notifiedSaveTimer == nil {
-		t := time.NewTimer(notifiedSaveDebounce)
-		// Создаём одноразовый таймер и регистрируем фоновую задачу через h.wg.
-		h.notifiedSaveTimer = t
-		h.wg.Go(func() {
-			<-t.C
-			h.flushNotifiedNow()
-		})
-		return
-	}
-	if !h.notifiedSaveTimer.Stop() {
-		// Дрейним канал таймера, если тик уже успел случиться, чтобы избежать немедленного срабатывания после Reset.
-		select {
-		case <-h.notifiedSaveTimer.C:
-		default:
-		}
-	}
-	h.notifiedSaveTimer.Reset(notifiedSaveDebounce)
-}
-
-// flushNotifiedNow выполняет немедленную запись notified.json, если есть изменения.
-// Снимок формируется под локом, запись на диск — без блокировки. При ошибках
-// маршалинга или записи флаг грязности возвращается, чтобы повторить позже.
-func (h *Handlers) flushNotifiedNow() {
-	// Снимок под локом
-	h.mu.Lock()
-	if h.notifiedSaveTimer != nil {
-		if !h.notifiedSaveTimer.Stop() {
-			select {
-			case <-h.notifiedSaveTimer.C:
-			default:
-			}
+		expireAt := time.Unix(ts, 0).Add(h.cleanTTL)
+		if !expireAt.After(now) {
+			continue
 		}
-		h.notifiedSaveTimer = nil
+		entries[string(notifiedKey(peerID, msgID, filterID))] = expireAt
 	}
-	if !h.notifiedDirty {
-		h.mu.Unlock()
+	if err := h.notified.Import(entries); err != nil {
+		logger.Errorf("notified: import legacy cache failed: %v", err)
 		return
 	}
-	snapshot := make(persistedNotified, len(h.notified))
-	for k, t := range h.notified {
-		snapshot[k] = t.Unix()
+	if err := os.Rename(path, path+legacyImportedSuffix); err != nil {
+		logger.Warnf("notified: rename legacy cache failed: %v", err)
 	}
-	path := filepath.Clean(h.notifiedCacheFile)
-	h.notifiedDirty = false
-	h.mu.Unlock()
+	logger.Infof("notified: imported %d entries from legacy cache %s", len(entries), path)
+}
 
-	if path == "" {
-		return
+// parseLegacyNotifiedKey разбирает ключ старого формата "<peerID>:<msgID>:<filterID>".
+// filterID может содержать двоеточия, поэтому отделяются только первые два поля.
+func parseLegacyNotifiedKey(key string) (int64, int, string, bool) {
+	parts := strings.SplitN(key, ":", 3) //nolint: mnd // peerID, msgID, filterID
+	if len(parts) != 3 {                 //nolint: mnd // см. выше
+		return 0, 0, "", false
 	}
-	data, err := json.MarshalIndent(snapshot, "", "  ")
+	peerID, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		logger.Errorf("notified: marshal failed: %v", err)
-		// пометим грязным, чтобы не потерять изменения
-		h.mu.Lock()
-		h.notifiedDirty = true
-		h.mu.Unlock()
-		return
+		return 0, 0, "", false
 	}
-	if storeErr := storage.AtomicWriteFile(path, data); storeErr != nil {
-		logger.Errorf("notified: save failed: %v", storeErr)
-		// повторим сохранение позже
-		h.mu.Lock()
-		h.notifiedDirty = true
-		h.mu.Unlock()
+	msgID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, "", false
 	}
+	return peerID, msgID, parts[2], true
+}
+
+// notifiedKey строит бинарный ключ отметки: peerID и msgID фиксированной длины, затем filterID.
+func notifiedKey(peerID int64, msgID int, filterID string) []byte {
+	key := make([]byte, 16, 16+len(filterID))            //nolint: mnd // два uint64
+	binary.BigEndian.PutUint64(key[0:8], uint64(peerID)) // #nosec G115
+	binary.BigEndian.PutUint64(key[8:16], uint64(msgID)) // #nosec G115
+	return append(key, filterID...)
 }
 
 // hasNotified проверяет идемпотентность: была ли пара (msg, filterID) уже
-// уведомлена ранее. Ключ строится как "<peerID>:<msgID>:<filterID>". Доступ к
-// карте защищён h.mu.
+// уведомлена ранее. Ошибка хранилища трактуется как «не уведомляли»:
+// лучше возможный дубль, чем потерянное уведомление.
 func (h *Handlers) hasNotified(msg *tg.Message, filterID string) bool {
-	key := fmt.Sprintf("%d:%d:%s", tgutil.GetPeerID(msg.PeerID), msg.ID, filterID)
-
-	h.mu.Lock()
-	_, hasNotified := h.notified[key]
-	h.mu.Unlock()
-
-	return hasNotified
+	found, err := h.notified.Has(notifiedKey(tgutil.GetPeerID(msg.PeerID), msg.ID, filterID))
+	if err != nil {
+		logger.Errorf("notified: lookup failed: %v", err)
+		return false
+	}
+	return found
 }
 
 // markNotified фиксирует, что пара (msg, filterID) уже поставлена в очередь
 // уведомлений. Вызывать после успешной постановки, иначе возможны ложные
-// «уже отправлено». Помечает кэш как грязный и планирует отложенный флаш на диск.
+// «уже отправлено». Запись сразу уходит в bbolt со сроком h.cleanTTL.
 func (h *Handlers) markNotified(msg *tg.Message, filterID string) {
-	key := fmt.Sprintf("%d:%d:%s", tgutil.GetPeerID(msg.PeerID), msg.ID, filterID)
+	key := notifiedKey(tgutil.GetPeerID(msg.PeerID), msg.ID, filterID)
+	if err := h.notified.Put(key, h.cleanTTL); err != nil {
+		logger.Errorf("notified: save failed: %v", err)
+	}
+}
 
-	h.mu.Lock()
-	h.notified[key] = time.Now()
-	h.scheduleNotifiedSaveLocked()
-	h.mu.Unlock()
+// splitNotified делит совпадения фильтров на уже уведомлённые пары (msg, filterID)
+// и новые, сохраняя исходный порядок в обеих частях.
+func (h *Handlers) splitNotified(
+	msg *tg.Message,
+	results []filters.FilterMatchResult,
+) ([]filters.FilterMatchResult, []filters.FilterMatchResult) {
+	var notified, fresh []filters.FilterMatchResult
+	for _, res := range results {
+		if h.hasNotified(msg, res.Filter.ID) {
+			notified = append(notified, res)
+		} else {
+			fresh = append(fresh, res)
+		}
+	}
+	return notified, fresh
+}
+
+// markAllNotified помечает каждую пару (msg, filterID) из results: объединённое задание
+// покрывает все свои фильтры, и повтор любого из них должен отсекаться.
+func (h *Handlers) markAllNotified(msg *tg.Message, results []filters.FilterMatchResult) {
+	for _, res := range results {
+		h.markNotified(msg, res.Filter.ID)
+	}
 }
@@ -0,0 +1,31 @@
+// Package updates / файл read.go обрабатывает прочтение исходящих сообщений.
+// Прочтение уведомления получателем подтверждает critical-эскалацию в очереди
+// (см. notifications/escalation.go): повторы и передача по цепочке прекращаются.
+
+package updates
+
+import (
+	"context"
+
+	"github.com/gotd/td/tg"
+)
+
+// OnReadHistoryOutbox обрабатывает прочтение наших сообщений в личке или обычной группе.
+func (h *Handlers) OnReadHistoryOutbox(
+	ctx context.Context,
+	entities tg.Entities,
+	u *tg.UpdateReadHistoryOutbox,
+) error {
+	h.notif.AckRead(u.Peer, u.MaxID)
+	return nil
+}
+
+// OnReadChannelOutbox обрабатывает прочтение наших сообщений в канале или мегагруппе.
+func (h *Handlers) OnReadChannelOutbox(
+	ctx context.Context,
+	entities tg.Entities,
+	u *tg.UpdateReadChannelOutbox,
+) error {
+	h.notif.AckRead(&tg.PeerChannel{ChannelID: u.ChannelID}, u.MaxID)
+	return nil
+}
@@ -0,0 +1,128 @@
+// Package updates / файл selfcmd.go — канал команд через «Избранное» (Saved Messages).
+//
+// Исходящее сообщение аккаунта в «Избранное» (или в личный чат SELF_COMMAND_CHAT), начинающееся
+// с префикса SELF_COMMAND_PREFIX (по умолчанию "!ub"), разбирается как команда CLI:
+// "!ub status", "!ub mute f1 2h". Ответ дописывается в то же сообщение правкой.
+//
+// Канал аутентифицирован самим Telegram: исходящие сообщения пишет только владелец аккаунта.
+// Пересланные сообщения и сообщения через inline-ботов не принимаются, а набор команд
+// ограничен явным списком selfCommandAllowList.
+
+package updates
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"telegram-userbot/internal/infra/logger"
+
+	"github.com/gotd/td/tg"
+)
+
+// selfCommandAllowList — команды, доступные из «Избранного». Общие команды выполняет
+// CommandExecutor, help и exit обрабатываются здесь.
+var selfCommandAllowList = []string{
+	"help", "status", "flush", "reload", "queue", "failed", "mute", "try", "search", "export", "backfill", "exit",
+}
+
+// selfReplyRunes — предел длины сообщения с ответом (лимит Telegram — 4096 символов).
+const selfReplyRunes = 4000
+
+// CommandExecutor выполняет строку команды "<имя> [аргументы]" и возвращает текст ответа
+// (реализация — adapters/commands.Executor, общая с CLI и командами бота).
+type CommandExecutor interface {
+	Execute(line string) (string, error)
+}
+
+// SetSelfID задаёт ID аккаунта: сообщения в чат с самим собой — это «Избранное».
+// До вызова команды принимаются только из SELF_COMMAND_CHAT.
+func (h *Handlers) SetSelfID(id int64) {
+	h.selfID.Store(id)
+}
+
+// selfCommandLine возвращает строку команды без префикса, если исходящее сообщение msg —
+// команда канала «Избранного».
+func (h *Handlers) selfCommandLine(msg *tg.Message) (string, bool) {
+	if h.commands == nil || h.selfPrefix == "" || !msg.Out {
+		return "", false
+	}
+	// Пересланный текст и результаты inline-ботов написаны не владельцем аккаунта.
+	if _, fwd := msg.GetFwdFrom(); fwd {
+		return "", false
+	}
+	if _, via := msg.GetViaBotID(); via {
+		return "", false
+	}
+	user, ok := msg.PeerID.(*tg.PeerUser)
+	if !ok || (user.UserID != h.selfID.Load() && user.UserID != h.selfChat) {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(msg.Message), h.selfPrefix)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\n') {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// handleSelfCommand выполняет команду из «Избранного» и дописывает ответ в сообщение.
+// Команда exit после ответа инициирует graceful shutdown.
+func (h *Handlers) handleSelfCommand(ctx context.Context, msg *tg.Message, line string) {
+	name, _, _ := strings.Cut(line, " ")
+	logger.Infof("Self command: %q", line)
+
+	var reply string
+	switch {
+	case name == "" || name == "help":
+		usage := make([]string, 0, len(selfCommandAllowList))
+		for _, cmd := range selfCommandAllowList {
+			usage = append(usage, h.selfPrefix+" "+cmd)
+		}
+		reply = "Commands: " + strings.Join(usage, ", ")
+	case !slices.Contains(selfCommandAllowList, name):
+		reply = fmt.Sprintf("Command %q is not allowed here. Send %s help for the list.", name, h.selfPrefix)
+	case name == "exit":
+		reply = "Shutting down..."
+	default:
+		out, err := h.commands.Execute(line)
+		if err != nil {
+			reply = "Error: " + err.Error()
+		} else {
+			reply = out
+		}
+	}
+	h.replySelfCommand(ctx, msg, reply)
+
+	if name == "exit" && h.shutdown != nil {
+		logger.Info("Shutdown requested via self command")
+		h.shutdown()
+	}
+}
+
+// replySelfCommand дописывает ответ reply под текстом команды правкой исходного сообщения.
+func (h *Handlers) replySelfCommand(ctx context.Context, msg *tg.Message, reply string) {
+	var peer tg.InputPeerClass = &tg.InputPeerSelf{}
+	if user, ok := msg.PeerID.(*tg.PeerUser); ok && user.UserID != h.selfID.Load() {
+		input, err := h.peers.InputPeerFromMessage(ctx, msg)
+		if err != nil {
+			logger.Errorf("Self command: failed to resolve chat: %v", err)
+			return
+		}
+		peer = input
+	}
+
+	text := msg.Message + "\n\n" + reply
+	if runes := []rune(text); len(runes) > selfReplyRunes {
+		text = string(runes[:selfReplyRunes]) + "…"
+	}
+	h.conn.WaitOnline(ctx)
+	if _, err := h.api.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      msg.ID,
+		Message: text,
+	}); err != nil {
+		handled := h.conn.HandleError(err)
+		logger.Errorf("Self command: reply failed (handled=%t): %v", handled, err)
+	}
+}
@@ -1,12 +1,14 @@
 // Package concurrency — утилиты для безопасного конкурентного исполнения.
 // В этом файле реализован Debouncer — механизм «сглаживания» повторяющихся событий
-// по идентификатору сообщения. Он откладывает выполнение функции до тех пор, пока
-// активность по тому же msgID не утихнет, и запускает обработку один раз — по
-// «последнему слову».
+// по ключу (вид peer, ID peer, ID сообщения). Он откладывает выполнение функции до тех пор,
+// пока активность по тому же ключу не утихнет, и запускает обработку один раз — по
+// «последнему слову». ID сообщений в каналах уникальны только внутри канала, поэтому
+// ключ обязан включать peer, иначе правки в разных чатах затирают друг друга.
 //
 // Применение: снятие нагрузки с обработчиков входящих апдейтов Telegram при частых
-// правках одного и того же сообщения. Гарантии: потокобезопасность, отсутствие
-// сетевых вызовов под мьютексом, выполнение отложенных функций вне критической секции.
+// правках одного и того же сообщения. Потолок maxWait гарантирует, что сообщение,
+// которое правят без пауз, всё равно будет обработано. Гарантии: потокобезопасность,
+// отсутствие сетевых вызовов под мьютексом, выполнение отложенных функций вне критической секции.
 
 package concurrency
 
@@ -16,13 +18,38 @@ import (
 	"time"
 )
 
-// Debouncer группирует повторяющиеся действия по msgID и запускает их только
-// один раз после паузы. Структура потокобезопасна, поэтому её можно переиспользовать
-// несколькими горутинами без дополнительной синхронизации.
+// DebounceKey идентифицирует серию событий: вид peer (user/chat/channel), его ID и ID сообщения.
+type DebounceKey struct {
+	PeerKind string
+	PeerID   int64
+	MsgID    int
+}
+
+// DebounceInfo описывает серию событий, схлопнутую в один вызов.
+//   - FirstAt — момент первого события серии;
+//   - FiredAt — момент запуска колбэка;
+//   - Events — сколько раз вызывался Do по ключу в этой серии;
+//   - Capped — запуск произошёл по потолку maxWait, а не по паузе.
+type DebounceInfo struct {
+	FirstAt time.Time
+	FiredAt time.Time
+	Events  int
+	Capped  bool
+}
+
+// SinceFirst возвращает время от первого события серии до запуска колбэка.
+func (i DebounceInfo) SinceFirst() time.Duration {
+	return i.FiredAt.Sub(i.FirstAt)
+}
+
+// Debouncer группирует повторяющиеся действия по DebounceKey и запускает их только
+// один раз после паузы (но не позже maxWait от первого события). Структура потокобезопасна,
+// поэтому её можно переиспользовать несколькими горутинами без дополнительной синхронизации.
 type Debouncer struct {
-	mu      sync.Mutex           // mu защищает доступ к pending и гарантирует потокобезопасность.
-	pending map[int]pendingEntry // pending хранит активные таймеры и соответствующие функции по msgID.
-	timeout time.Duration        // timeout определяет задержку между последним событием и выполнением fn.
+	mu      sync.Mutex                   // mu защищает доступ к pending и гарантирует потокобезопасность.
+	pending map[DebounceKey]pendingEntry // pending хранит активные таймеры и соответствующие функции по ключу.
+	timeout time.Duration                // timeout определяет задержку между последним событием и выполнением fn.
+	maxWait time.Duration                // maxWait ограничивает ожидание от первого события серии; 0 — без потолка.
 
 	runMu  sync.Mutex         // runMu отвечает за запуск/остановку фонового наблюдателя.
 	ctx    context.Context    // ctx хранит активный контекст, используемый для отмены работы дебаунсера.
@@ -30,19 +57,25 @@ type Debouncer struct {
 	wg     sync.WaitGroup     // wg позволяет дождаться завершения горутины watchCancel.
 }
 
-// pendingEntry сохраняет таймер и отложенный колбэк, чтобы при форсированной остановке их можно было вызвать вручную.
+// pendingEntry сохраняет таймер, отложенный колбэк и сведения о серии, чтобы при
+// форсированной остановке их можно было вызвать вручную.
 type pendingEntry struct {
-	timer *time.Timer
-	fn    func()
+	timer   *time.Timer
+	fn      func(DebounceInfo)
+	firstAt time.Time
+	events  int
+	capped  bool
 }
 
 // NewDebouncer создаёт дебаунсер с заданной задержкой между последним событием
-// и исполнением функции. Таймаут задаётся в миллисекундах. Конструктор только
-// инициализирует структуру; привязка к жизненному циклу выполняется через Start.
-func NewDebouncer(timeoutMS int) *Debouncer {
+// и исполнением функции и потолком ожидания от первого события (оба — в миллисекундах;
+// maxWaitMS <= 0 отключает потолок). Конструктор только инициализирует структуру;
+// привязка к жизненному циклу выполняется через Start.
+func NewDebouncer(timeoutMS, maxWaitMS int) *Debouncer {
 	return &Debouncer{
-		pending: make(map[int]pendingEntry),
+		pending: make(map[DebounceKey]pendingEntry),
 		timeout: time.Duration(timeoutMS) * time.Millisecond,
+		maxWait: time.Duration(maxWaitMS) * time.Millisecond,
 	}
 }
 
@@ -100,56 +133,78 @@ func (d *Debouncer) Stop() {
 	d.flushPending()
 }
 
-// Do регистрирует функцию для msgID и откладывает её запуск на timeout.
-// Повторные вызовы для того же msgID перезапускают таймер и заменяют колбэк
-// на новый. Если дебаунсер остановлен или контекст отменён, функция выполняется
-// немедленно, без ожидания таймаута.
-func (d *Debouncer) Do(msgID int, fn func()) {
+// Do регистрирует функцию для key и откладывает её запуск на timeout.
+// Повторные вызовы для того же key перезапускают таймер и заменяют колбэк
+// на новый, но серия не ждёт дольше maxWait от первого события. Колбэк получает
+// DebounceInfo серии. Если дебаунсер остановлен или контекст отменён, функция
+// выполняется немедленно, без ожидания таймаута.
+func (d *Debouncer) Do(key DebounceKey, fn func(DebounceInfo)) {
+	now := time.Now()
 	d.mu.Lock()
 
 	// Если не запущены или контекст уже отменён — выполняем без отложки.
 	if d.ctx == nil || d.ctx.Err() != nil {
 		d.mu.Unlock()
-		fn()
+		fn(DebounceInfo{FirstAt: now, FiredAt: now, Events: 1})
 		return
 	}
 
-	if entry, exists := d.pending[msgID]; exists {
+	entry, exists := d.pending[key]
+	if exists {
 		// Перезапускаем окно дебаунса: старый таймер останавливаем, колбэк заменяем.
 		if entry.timer != nil {
 			entry.timer.Stop()
 		}
+	} else {
+		entry.firstAt = now
+	}
+	entry.fn = fn
+	entry.events++
+
+	// Пауза не может вывести серию за потолок maxWait от первого события.
+	delay := d.timeout
+	entry.capped = false
+	if d.maxWait > 0 {
+		if left := entry.firstAt.Add(d.maxWait).Sub(now); left < delay {
+			delay = max(left, 0)
+			entry.capped = true
+		}
 	}
 
-	// Планируем отложенное выполнение: по истечении timeout вызовем execute(msgID).
-	timer := time.AfterFunc(d.timeout, func() {
-		d.execute(msgID)
+	// Планируем отложенное выполнение: по истечении delay вызовем execute(key).
+	entry.timer = time.AfterFunc(delay, func() {
+		d.execute(key)
 	})
-	d.pending[msgID] = pendingEntry{
-		timer: timer,
-		fn:    fn,
-	}
+	d.pending[key] = entry
 	d.mu.Unlock()
 }
 
-// execute извлекает и удаляет отложенный вызов для msgID под локом, затем
+// execute извлекает и удаляет отложенный вызов для key под локом, затем
 // выполняет его вне критической секции. Отсутствие записи считается нормой
 // (например, если вызов был уже сброшен Stop()).
-func (d *Debouncer) execute(msgID int) {
-	var fn func()
-
+func (d *Debouncer) execute(key DebounceKey) {
 	d.mu.Lock()
-	if entry, ok := d.pending[msgID]; ok {
-		delete(d.pending, msgID)
-		fn = entry.fn
+	entry, ok := d.pending[key]
+	if ok {
+		delete(d.pending, key)
 	}
 	d.mu.Unlock()
 
-	if fn != nil {
-		fn()
+	if ok {
+		entry.run()
 	}
 }
 
+// run вызывает отложенный колбэк с описанием серии на момент запуска.
+func (e pendingEntry) run() {
+	e.fn(DebounceInfo{
+		FirstAt: e.firstAt,
+		FiredAt: time.Now(),
+		Events:  e.events,
+		Capped:  e.capped,
+	})
+}
+
 // waitCancel ожидает отмены контекста и инициирует немедленный дренаж всех накопленных функций.
 func (d *Debouncer) waitCancel(ctx context.Context) {
 	<-ctx.Done()
@@ -174,6 +229,6 @@ func (d *Debouncer) flushPending() {
 	d.mu.Unlock()
 
 	for _, entry := range entries {
-		entry.fn()
+		entry.run()
 	}
 }
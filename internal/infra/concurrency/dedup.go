@@ -8,35 +8,44 @@ package concurrency
 
 import (
 	"context"
-	"fmt"
+	"encoding/binary"
 	"sync"
 	"time"
 
 	"telegram-userbot/internal/infra/logger"
+	"telegram-userbot/internal/infra/storage"
 )
 
+// dedupMaxEntries ограничивает размер персистентного кэша дедупликации: при типичной
+// нагрузке окно в пару минут покрывает на порядки меньше записей.
+const dedupMaxEntries = 50000
+
 // Deduplicator хранит «сигнатуры» недавно обработанных событий и решает,
 // считать ли очередное событие повтором в рамках заданного окна.
-// Ключ формируется как `<chatID>:<msgID>:<editDate>`; изменение editDate при
-// правке сообщения приводит к новой сигнатуре. Структура потокобезопасна.
+// Ключ — бинарная сигнатура (chatID, msgID, editDate); изменение editDate при
+// правке сообщения приводит к новой сигнатуре. Записи хранятся в bbolt-бакете,
+// поэтому рестарт внутри окна не приводит к повторной обработке.
 type Deduplicator struct {
-	mu     sync.Mutex           // mu защищает доступ к карте seen из параллельных горутин.
-	seen   map[string]time.Time // key -> expireAt; хранит срок годности записи для быстрой проверки повторов.
-	window time.Duration        // длительность окна дедупликации; до истечения expireAt событие считается повтором.
+	store  *storage.TTLBucket // store — персистентный TTL-кэш сигнатур.
+	window time.Duration      // длительность окна дедупликации; до истечения срока событие считается повтором.
 
 	runMu  sync.Mutex         // runMu защищает старт/остановку фоновой горутины очистки.
 	cancel context.CancelFunc // cancel завершает цикл очистки, если он был запущен.
 	wg     sync.WaitGroup     // wg дожидается завершения фоновой горутины при остановке.
 }
 
-// NewDeduplicator создаёт кэш подавления повторов с окном `windowSec` секунд.
-// Нулевое значение означает «повторов нет» только мгновенно на текущем тике времени,
-// поэтому обычно имеет смысл задавать положительное окно (например 60 сек).
-func NewDeduplicator(windowSec int) *Deduplicator {
+// NewDeduplicator создаёт кэш подавления повторов с окном `windowSec` секунд поверх
+// бакета "dedup" базы db. Нулевое окно означает «повторов нет» только мгновенно
+// на текущем тике времени, поэтому обычно имеет смысл задавать положительное окно.
+func NewDeduplicator(windowSec int, db *storage.TTLDB) (*Deduplicator, error) {
+	bucket, err := db.Bucket("dedup", dedupMaxEntries)
+	if err != nil {
+		return nil, err
+	}
 	return &Deduplicator{
-		seen:   make(map[string]time.Time),
+		store:  bucket,
 		window: time.Duration(windowSec) * time.Second,
-	}
+	}, nil
 }
 
 // Start поднимает фоновую горутину очистки устаревших ключей. Повторные вызовы
@@ -57,7 +66,7 @@ func (d *Deduplicator) Start(ctx context.Context) {
 	runCtx, cancel := context.WithCancel(ctx)
 	d.cancel = cancel
 	d.wg.Go(func() {
-		// Раз в минуту вычищаем просроченные записи, чтобы карта не росла бесконечно.
+		// Раз в минуту вычищаем просроченные записи, чтобы бакет не рос бесконечно.
 		ticker := time.NewTicker(time.Minute)
 		defer ticker.Stop()
 
@@ -73,7 +82,7 @@ func (d *Deduplicator) Start(ctx context.Context) {
 }
 
 // Stop корректно завершает фоновую очистку и дожидается её окончания, гарантируя,
-// что во время остановки не происходит конкурирующей модификации карты.
+// что после возврата фоновая очистка не обращается к хранилищу.
 func (d *Deduplicator) Stop() {
 	d.runMu.Lock()
 	cancel := d.cancel
@@ -88,39 +97,35 @@ func (d *Deduplicator) Stop() {
 	d.wg.Wait()
 }
 
-// DedupSeen сообщает, видели ли уже событие с сигнатурой `<chatID>:<msgID>:<editDate>`
+// DedupSeen сообщает, видели ли уже событие с сигнатурой (chatID, msgID, editDate)
 // в пределах окна. Возвращает true, если запись ещё актуальна (повтор), иначе
 // регистрирует новую запись с истечением через d.window и возвращает false.
+// Ошибка хранилища не блокирует обработку: событие считается новым.
 func (d *Deduplicator) DedupSeen(chatID int64, msgID int, editDate int) bool {
-	key := fmt.Sprintf("%d:%d:%d", chatID, msgID, editDate)
-
 	// editDate == 0 для «первой версии» сообщения; при правке появится новое значение,
 	// что естественным образом снимает дедупликацию для изменённого текста.
-
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	// Сравниваем текущее время с запланированным expireAt для ключа.
-	now := time.Now()
-	if exp, ok := d.seen[key]; ok && now.Before(exp) {
-		logger.Debug(fmt.Sprintf("DEDUP SEEN: %v", key))
-		return true
+	var key [24]byte
+	binary.BigEndian.PutUint64(key[0:8], uint64(chatID))     // #nosec G115
+	binary.BigEndian.PutUint64(key[8:16], uint64(msgID))     // #nosec G115
+	binary.BigEndian.PutUint64(key[16:24], uint64(editDate)) // #nosec G115
+
+	seen, err := d.store.Seen(key[:], d.window)
+	if err != nil {
+		logger.Errorf("dedup: store error for %d:%d:%d: %v", chatID, msgID, editDate, err)
+		return false
 	}
-	d.seen[key] = now.Add(d.window)
-	return false
+	if seen {
+		logger.Debugf("DEDUP SEEN: %d:%d:%d", chatID, msgID, editDate)
+	}
+	return seen
 }
 
-// DedupCleanup удаляет из карты все записи с истёкшим сроком. Метод потокобезопасен
-// и может вызываться как фоново (через Start), так и синхронно по необходимости.
+// DedupCleanup удаляет просроченные записи и подрезает кэш до dedupMaxEntries.
+// Метод потокобезопасен и может вызываться как фоново (через Start), так и синхронно.
 func (d *Deduplicator) DedupCleanup() {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	// Линейный проход по карте; объём обычно мал благодаря периодической очистке.
-	now := time.Now()
-	for k, exp := range d.seen {
-		if now.After(exp) {
-			delete(d.seen, k)
-		}
+	if removed, err := d.store.Cleanup(); err != nil {
+		logger.Errorf("dedup: cleanup error: %v", err)
+	} else if removed > 0 {
+		logger.Debugf("dedup: cleanup removed %d entries", removed)
 	}
 }
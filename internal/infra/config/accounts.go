@@ -0,0 +1,160 @@
+// Пакет config / файл accounts.go — аккаунты Telegram, обслуживаемые одним процессом.
+//
+// По умолчанию процесс обслуживает один аккаунт "main" с файлами из .env (PHONE_NUMBER,
+// SESSION_FILE, STATE_FILE и т. д.) — поведение до появления нескольких аккаунтов.
+// ACCOUNTS_FILE задаёт JSON-список аккаунтов:
+//
+//	[
+//	  {"name": "work", "phone": "+79990000001"},
+//	  {"name": "home", "phone": "+79990000002", "dir": "data/home", "filters_file": "assets/home.json"}
+//	]
+//
+// Каждый аккаунт держит своё состояние в каталоге dir (по умолчанию data/<name>): сессию,
+// state.json, базы пиров, кэшей и архива, очередь уведомлений, архив медиа и задания backfill.
+// filters_file по умолчанию — общий FILTERS_FILE; получатели (RECIPIENTS_FILE), транспорты
+// уведомлений и остальные настройки .env общие для всех аккаунтов.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultAccountName — имя единственного аккаунта, если ACCOUNTS_FILE не задан.
+const DefaultAccountName = "main"
+
+// accountNamePattern ограничивает имена аккаунтов: они входят в пути и в команды (@work).
+var accountNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Account описывает один аккаунт процесса: имя для команд, номер для авторизации и файлы состояния.
+type Account struct {
+	Name              string
+	PhoneNumber       string
+	SessionFile       string
+	StateFile         string
+	PeersCacheFile    string
+	CacheDBFile       string
+	FiltersFile       string
+	NotifyQueueFile   string
+	NotifyFailedFile  string
+	NotifiedCacheFile string
+	ActionsAuditFile  string
+	ArchiveDBFile     string
+	ExportDir         string
+	MediaArchiveDir   string
+	MediaQueueFile    string
+	BackfillDir       string
+}
+
+// accountEntry — запись ACCOUNTS_FILE.
+type accountEntry struct {
+	Name        string `json:"name"`
+	Phone       string `json:"phone"`
+	Dir         string `json:"dir,omitempty"`
+	FiltersFile string `json:"filters_file,omitempty"`
+}
+
+// Accounts возвращает копию списка аккаунтов. Первый аккаунт — основной: он используется
+// командами без @имени и обслуживает общие подсистемы.
+func Accounts() []Account {
+	cfgInstance.mu.RLock()
+	defer cfgInstance.mu.RUnlock()
+	return slices.Clone(cfgInstance.accounts)
+}
+
+// loadAccounts строит список аккаунтов: из ACCOUNTS_FILE или единственный аккаунт по .env.
+func loadAccounts(env EnvConfig) ([]Account, error) {
+	if env.AccountsFile == "" {
+		return []Account{{
+			Name:              DefaultAccountName,
+			PhoneNumber:       env.PhoneNumber,
+			SessionFile:       env.SessionFile,
+			StateFile:         env.StateFile,
+			PeersCacheFile:    env.PeersCacheFile,
+			CacheDBFile:       env.CacheDBFile,
+			FiltersFile:       env.FiltersFile,
+			NotifyQueueFile:   env.NotifyQueueFile,
+			NotifyFailedFile:  env.NotifyFailedFile,
+			NotifiedCacheFile: env.NotifiedCacheFile,
+			ActionsAuditFile:  env.ActionsAuditFile,
+			ArchiveDBFile:     env.ArchiveDBFile,
+			ExportDir:         env.ExportDir,
+			MediaArchiveDir:   env.MediaArchiveDir,
+			MediaQueueFile:    env.MediaQueueFile,
+			BackfillDir:       env.BackfillDir,
+		}}, nil
+	}
+
+	data, err := os.ReadFile(env.AccountsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read accounts file: %w", err)
+	}
+	var entries []accountEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse accounts file %s: %w", env.AccountsFile, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("accounts file %s: no accounts", env.AccountsFile)
+	}
+
+	accounts := make([]Account, 0, len(entries))
+	dirs := make(map[string]string, len(entries))
+	for i, entry := range entries {
+		name := strings.ToLower(strings.TrimSpace(entry.Name))
+		if !accountNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("accounts file: account #%d: invalid name %q (allowed: a-z, 0-9, _ and -)",
+				i+1, entry.Name)
+		}
+		if slices.ContainsFunc(accounts, func(a Account) bool { return a.Name == name }) {
+			return nil, fmt.Errorf("accounts file: duplicate account %q", name)
+		}
+		phone := strings.TrimSpace(entry.Phone)
+		if phone == "" {
+			return nil, fmt.Errorf("accounts file: account %q: phone must be set", name)
+		}
+		dir := filepath.Join("data", name)
+		if custom := strings.TrimSpace(entry.Dir); custom != "" {
+			dir = filepath.Clean(custom)
+		}
+		// Общий каталог смешал бы сессии и базы аккаунтов.
+		if other, ok := dirs[dir]; ok {
+			return nil, fmt.Errorf("accounts file: accounts %q and %q share directory %s", other, name, dir)
+		}
+		dirs[dir] = name
+		filtersFile := strings.TrimSpace(entry.FiltersFile)
+		if filtersFile == "" {
+			filtersFile = env.FiltersFile
+		}
+		accounts = append(accounts, accountFiles(name, phone, dir, filtersFile))
+	}
+	return accounts, nil
+}
+
+// accountFiles раскладывает файлы состояния аккаунта по каталогу dir под стандартными именами.
+func accountFiles(name, phone, dir, filtersFile string) Account {
+	file := func(base string) string { return filepath.Join(dir, filepath.Base(base)) }
+	return Account{
+		Name:              name,
+		PhoneNumber:       phone,
+		SessionFile:       file(defaultSessionFile),
+		StateFile:         file(defaultStateFile),
+		PeersCacheFile:    file(defaultPeersCacheFile),
+		CacheDBFile:       file(defaultCacheDBFile),
+		FiltersFile:       filtersFile,
+		NotifyQueueFile:   file(defaultNotifyQueueFile),
+		NotifyFailedFile:  file(defaultNotifyFailedFile),
+		NotifiedCacheFile: file(defaultNotifiedCacheFile),
+		ActionsAuditFile:  file(defaultActionsAuditFile),
+		ArchiveDBFile:     file(defaultArchiveDBFile),
+		ExportDir:         file(defaultExportDir),
+		MediaArchiveDir:   file(defaultMediaArchiveDir),
+		MediaQueueFile:    file(defaultMediaQueueFile),
+		BackfillDir:       file(defaultBackfillDir),
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -43,20 +44,61 @@ type EnvConfig struct {
 	ThrottleRPS       int
 	DedupWindowSec    int
 	DebounceEditMS    int
+	DebounceMaxWaitMS int
+	AlbumWindowMS     int
 	TestDC            bool
 	BotToken          string
+	BotActions        bool
 	AdminUID          int
+	BotAdmins         []int64
+	SelfCommandPrefix string
+	SelfCommandChat   int
 	Notifier          string
 	NotifyQueueFile   string
 	NotifyFailedFile  string
 	NotifyTimezone    string
 	AppTimezone       string
 	NotifySchedule    []string
+	NotifyMarkDeleted bool
+	NotifyEditPolicy  string
+	RetryMaxAttempts  int
+	RetryBaseSec      int
+	RetryMaxSec       int
+	JobTTLHours       int
+	ExpiredPolicy     string
+	QuietPolicy       string
+	EscalateAfterMin  int
+	EscalateResends   int
+	WebhookSecret     string
+	SMTPHost          string
+	SMTPPort          int
+	SMTPUsername      string
+	SMTPPassword      string
+	SMTPFrom          string
+	SMTPSecurity      string
 	NotifiedCacheFile string
+	ActionsDryRun     bool
+	ActionsAuditFile  string
+	ArchiveDBFile     string
+	ArchiveDays       int
+	ExportDir         string
+	MediaArchiveDir   string
+	MediaQueueFile    string
+	MediaMaxMB        int
+	MediaTypes        []string
+	MediaWorkers      int
+	BackfillDir       string
+	GapRecoveryMax    int
 	NotifiedTTLDays   int
 	FiltersFile       string
 	PeersCacheFile    string
+	CacheDBFile       string
 	RecipientsFile    string // НОВОЕ
+	AccountsFile      string
+	EncryptionKey     string
+	EncryptionKeyFile string
+	EncryptionPrompt  bool
+	EncryptionMeta    string
 }
 
 // Config хранит конфигурацию среды.
@@ -65,6 +107,7 @@ type EnvConfig struct {
 // (loadFilters) держит эксклюзивный Lock на время обновления полей.
 type Config struct {
 	Env      EnvConfig
+	accounts []Account    // аккаунты процесса; первый — основной (см. accounts.go)
 	warnings []string     // предупреждения, накопленные при чтении окружения
 	mu       sync.RWMutex // защита конкурентного доступа к конфигурации
 }
@@ -74,7 +117,11 @@ const (
 	defaultThrottleRPS       = 1
 	defaultDedupWindowSec    = 120
 	defaultDebounceEditMS    = 2000
+	defaultDebounceMaxWaitMS = 10000
+	defaultAlbumWindowMS     = 1500
 	defaultAdminUID          = 0
+	defaultSelfCommandPrefix = "!ub"
+	defaultSelfCommandChat   = 0
 	defaultLogLevel          = "debug"
 	defaultSessionFile       = "data/session.bin"
 	defaultStateFile         = "data/state.json"
@@ -82,12 +129,35 @@ const (
 	defaultNotifyQueueFile   = "data/notify_queue.json"
 	defaultNotifyFailedFile  = "data/notify_failed.json"
 	defaultNotifyTimezone    = "Europe/Moscow"
+	defaultNotifyEditPolicy  = "edit"
+	defaultRetryMaxAttempts  = 8
+	defaultRetryBaseSec      = 30
+	defaultRetryMaxSec       = 3600
+	defaultJobTTLHours       = 0
+	defaultExpiredPolicy     = "summary"
+	defaultQuietPolicy       = "hold"
+	defaultEscalateAfterMin  = 0
+	defaultEscalateResends   = 2
+	defaultSMTPPort          = 587
+	defaultSMTPSecurity      = "starttls"
 	defaultAppTimezone       = "UTC"
 	defaultNotifiedCacheFile = "data/notified_cache.json"
+	defaultActionsAuditFile  = "data/actions_audit.jsonl"
+	defaultArchiveDBFile     = "data/archive.bbolt"
+	defaultArchiveDays       = 90
+	defaultExportDir         = "data/exports"
+	defaultMediaArchiveDir   = "data/media"
+	defaultMediaQueueFile    = "data/media_queue.json"
+	defaultMediaMaxMB        = 100
+	defaultMediaWorkers      = 2
+	defaultBackfillDir       = "data/backfill"
+	defaultGapRecoveryMax    = 500
 	defaultNotifiedTTLDays   = 30
 	defaultFiltersFile       = "assets/filters.json"
 	defaultRecipientsFile    = "assets/recipients.json"
 	defaultPeersCacheFile    = "data/peers_cache.bbolt"
+	defaultCacheDBFile       = "data/cache.bbolt"
+	defaultEncryptionMeta    = "data/encryption.json"
 )
 
 var defaultNotifySchedule = []string{"08:00", "17:00"}
@@ -137,8 +207,10 @@ func loadConfig(envPath string) (*Config, error) {
 		return nil, errors.New("env API_HASH must be set")
 	}
 
+	// При списке аккаунтов номера задаются в нём, PHONE_NUMBER не обязателен.
+	accountsFile := strings.TrimSpace(os.Getenv("ACCOUNTS_FILE"))
 	phone := strings.TrimSpace(os.Getenv("PHONE_NUMBER"))
-	if phone == "" {
+	if phone == "" && accountsFile == "" {
 		return nil, errors.New("env PHONE_NUMBER must be set")
 	}
 
@@ -147,10 +219,16 @@ func loadConfig(envPath string) (*Config, error) {
 	throttleRPS := parseIntDefault("THROTTLE_RPS", defaultThrottleRPS, greaterThanZero, &warnings)
 	dedupWindow := parseIntDefault("DEDUP_WINDOW_SEC", defaultDedupWindowSec, nonNegative, &warnings)
 	debounceMS := parseIntDefault("DEBOUNCE_EDIT_MS", defaultDebounceEditMS, nonNegative, &warnings)
+	debounceMaxWaitMS := parseIntDefault("DEBOUNCE_EDIT_MAX_WAIT_MS", defaultDebounceMaxWaitMS, nonNegative, &warnings)
+	albumWindowMS := parseIntDefault("ALBUM_WINDOW_MS", defaultAlbumWindowMS, nonNegative, &warnings)
 	adminUID := parseIntDefault("ADMIN_UID", defaultAdminUID, nonNegative, &warnings)
 	logLevel := sanitizeLogLevel(os.Getenv("LOG_LEVEL"), &warnings)
 	botToken := strings.TrimSpace(os.Getenv("BOT_TOKEN"))
 	notifier := sanitizeNotifier(botToken, os.Getenv("NOTIFIER"), &warnings)
+	botActions := !strings.EqualFold(strings.TrimSpace(os.Getenv("BOT_ACTIONS")), "false")
+	botAdmins := sanitizeBotAdmins(os.Getenv("BOT_ADMINS"), &warnings)
+	selfCommandPrefix := sanitizeSelfCommandPrefix(os.Getenv("SELF_COMMAND_PREFIX"))
+	selfCommandChat := parseIntDefault("SELF_COMMAND_CHAT", defaultSelfCommandChat, nonNegative, &warnings)
 	sessionFile := sanitizeFile("SESSION_FILE", os.Getenv("SESSION_FILE"), defaultSessionFile, &warnings)
 	stateFile := sanitizeFile("STATE_FILE", os.Getenv("STATE_FILE"), defaultStateFile, &warnings)
 	testDC := strings.EqualFold(strings.TrimSpace(os.Getenv("TEST_DC")), "true")
@@ -161,13 +239,52 @@ func loadConfig(envPath string) (*Config, error) {
 	notifyTimezone := sanitizeTimezoneFlexible(os.Getenv("NOTIFY_TIMEZONE"), defaultNotifyTimezone, &warnings)
 	appTimezone := sanitizeTimezoneFlexible(os.Getenv("APP_TIMEZONE"), defaultAppTimezone, &warnings)
 	notifySchedule := sanitizeSchedule(os.Getenv("NOTIFY_SCHEDULE"), defaultNotifySchedule, &warnings)
+	notifyMarkDeleted := strings.EqualFold(strings.TrimSpace(os.Getenv("NOTIFY_MARK_DELETED")), "true")
+	notifyEditPolicy := sanitizeEditPolicy(os.Getenv("NOTIFY_EDIT_POLICY"), &warnings)
+	retryMaxAttempts := parseIntDefault("NOTIFY_RETRY_MAX_ATTEMPTS", defaultRetryMaxAttempts,
+		greaterThanZero, &warnings)
+	retryBaseSec := parseIntDefault("NOTIFY_RETRY_BASE_SEC", defaultRetryBaseSec, greaterThanZero, &warnings)
+	retryMaxSec := parseIntDefault("NOTIFY_RETRY_MAX_SEC", defaultRetryMaxSec, greaterThanZero, &warnings)
+	jobTTLHours := parseIntDefault("NOTIFY_JOB_TTL_HOURS", defaultJobTTLHours, nonNegative, &warnings)
+	expiredPolicy := sanitizeExpiredPolicy(os.Getenv("NOTIFY_EXPIRED_POLICY"), &warnings)
+	quietPolicy := sanitizeQuietPolicy(os.Getenv("NOTIFY_QUIET_POLICY"), &warnings)
+	escalateAfterMin := parseIntDefault("NOTIFY_ESCALATE_AFTER_MIN", defaultEscalateAfterMin, nonNegative, &warnings)
+	escalateResends := parseIntDefault("NOTIFY_ESCALATE_RESENDS", defaultEscalateResends, nonNegative, &warnings)
+	webhookSecret := strings.TrimSpace(os.Getenv("NOTIFY_WEBHOOK_SECRET"))
+	smtpHost := strings.TrimSpace(os.Getenv("SMTP_HOST"))
+	smtpPort := parseIntDefault("SMTP_PORT", defaultSMTPPort, greaterThanZero, &warnings)
+	smtpUsername := strings.TrimSpace(os.Getenv("SMTP_USERNAME"))
+	smtpPassword := os.Getenv("SMTP_PASSWORD")
+	smtpFrom := strings.TrimSpace(os.Getenv("SMTP_FROM"))
+	smtpSecurity := sanitizeSMTPSecurity(os.Getenv("SMTP_SECURITY"), &warnings)
 	notifiedCacheFile := sanitizeFile("NOTIFIED_CACHE_FILE", os.Getenv("NOTIFIED_CACHE_FILE"),
 		defaultNotifiedCacheFile, &warnings)
+	actionsDryRun := strings.EqualFold(strings.TrimSpace(os.Getenv("ACTIONS_DRY_RUN")), "true")
+	actionsAuditFile := sanitizeFile("ACTIONS_AUDIT_FILE", os.Getenv("ACTIONS_AUDIT_FILE"),
+		defaultActionsAuditFile, &warnings)
+	archiveDBFile := sanitizeFile("ARCHIVE_DB_FILE", os.Getenv("ARCHIVE_DB_FILE"), defaultArchiveDBFile, &warnings)
+	archiveDays := parseIntDefault("ARCHIVE_RETENTION_DAYS", defaultArchiveDays, nonNegative, &warnings)
+	exportDir := sanitizeFile("EXPORT_DIR", os.Getenv("EXPORT_DIR"), defaultExportDir, &warnings)
+	mediaArchiveDir := sanitizeFile("MEDIA_ARCHIVE_DIR", os.Getenv("MEDIA_ARCHIVE_DIR"),
+		defaultMediaArchiveDir, &warnings)
+	mediaQueueFile := sanitizeFile("MEDIA_ARCHIVE_QUEUE_FILE", os.Getenv("MEDIA_ARCHIVE_QUEUE_FILE"),
+		defaultMediaQueueFile, &warnings)
+	mediaMaxMB := parseIntDefault("MEDIA_ARCHIVE_MAX_MB", defaultMediaMaxMB, greaterThanZero, &warnings)
+	mediaTypes := sanitizeMediaTypes(os.Getenv("MEDIA_ARCHIVE_TYPES"), &warnings)
+	mediaWorkers := parseIntDefault("MEDIA_ARCHIVE_WORKERS", defaultMediaWorkers, greaterThanZero, &warnings)
+	backfillDir := sanitizeFile("BACKFILL_DIR", os.Getenv("BACKFILL_DIR"), defaultBackfillDir, &warnings)
+	gapRecoveryMax := parseIntDefault("GAP_RECOVERY_MAX", defaultGapRecoveryMax, nonNegative, &warnings)
 	notifiedTTLDays := parseIntDefault("NOTIFIED_CACHE_TTL_DAYS", defaultNotifiedTTLDays, greaterThanZero, &warnings)
 	filtersFile := sanitizeFile("FILTERS_FILE", os.Getenv("FILTERS_FILE"), defaultFiltersFile, &warnings)
 	peersCacheFile := sanitizeFile("PEERS_CACHE_FILE", os.Getenv("PEERS_CACHE_FILE"), defaultPeersCacheFile, &warnings)
+	cacheDBFile := sanitizeFile("CACHE_DB_FILE", os.Getenv("CACHE_DB_FILE"), defaultCacheDBFile, &warnings)
 	recipientsFile := sanitizeFile("RECIPIENTS_FILE", os.Getenv("RECIPIENTS_FILE"),
 		defaultRecipientsFile, &warnings)
+	encryptionKey := os.Getenv("ENCRYPTION_KEY")
+	encryptionKeyFile := strings.TrimSpace(os.Getenv("ENCRYPTION_KEY_FILE"))
+	encryptionPrompt := strings.EqualFold(strings.TrimSpace(os.Getenv("ENCRYPTION_PROMPT")), "true")
+	encryptionMeta := sanitizeFile("ENCRYPTION_META_FILE", os.Getenv("ENCRYPTION_META_FILE"),
+		defaultEncryptionMeta, &warnings)
 
 	env := EnvConfig{
 		APIID:             apiID,
@@ -179,24 +296,71 @@ func loadConfig(envPath string) (*Config, error) {
 		ThrottleRPS:       throttleRPS,
 		DedupWindowSec:    dedupWindow,
 		DebounceEditMS:    debounceMS,
+		DebounceMaxWaitMS: debounceMaxWaitMS,
+		AlbumWindowMS:     albumWindowMS,
 		TestDC:            testDC,
 		BotToken:          botToken,
+		BotActions:        botActions,
 		AdminUID:          adminUID,
+		BotAdmins:         botAdmins,
+		SelfCommandPrefix: selfCommandPrefix,
+		SelfCommandChat:   selfCommandChat,
 		Notifier:          notifier,
 		NotifyQueueFile:   notifyQueueFile,
 		NotifyFailedFile:  notifyFailedFile,
 		NotifyTimezone:    notifyTimezone,
 		AppTimezone:       appTimezone,
 		NotifySchedule:    notifySchedule,
+		NotifyMarkDeleted: notifyMarkDeleted,
+		NotifyEditPolicy:  notifyEditPolicy,
+		RetryMaxAttempts:  retryMaxAttempts,
+		RetryBaseSec:      retryBaseSec,
+		RetryMaxSec:       retryMaxSec,
+		JobTTLHours:       jobTTLHours,
+		ExpiredPolicy:     expiredPolicy,
+		QuietPolicy:       quietPolicy,
+		EscalateAfterMin:  escalateAfterMin,
+		EscalateResends:   escalateResends,
+		WebhookSecret:     webhookSecret,
+		SMTPHost:          smtpHost,
+		SMTPPort:          smtpPort,
+		SMTPUsername:      smtpUsername,
+		SMTPPassword:      smtpPassword,
+		SMTPFrom:          smtpFrom,
+		SMTPSecurity:      smtpSecurity,
 		NotifiedCacheFile: notifiedCacheFile,
+		ActionsDryRun:     actionsDryRun,
+		ActionsAuditFile:  actionsAuditFile,
+		ArchiveDBFile:     archiveDBFile,
+		ArchiveDays:       archiveDays,
+		ExportDir:         exportDir,
+		MediaArchiveDir:   mediaArchiveDir,
+		MediaQueueFile:    mediaQueueFile,
+		MediaMaxMB:        mediaMaxMB,
+		MediaTypes:        mediaTypes,
+		MediaWorkers:      mediaWorkers,
+		BackfillDir:       backfillDir,
+		GapRecoveryMax:    gapRecoveryMax,
 		NotifiedTTLDays:   notifiedTTLDays,
 		FiltersFile:       filtersFile,
 		RecipientsFile:    recipientsFile,
 		PeersCacheFile:    peersCacheFile,
+		CacheDBFile:       cacheDBFile,
+		AccountsFile:      accountsFile,
+		EncryptionKey:     encryptionKey,
+		EncryptionKeyFile: encryptionKeyFile,
+		EncryptionPrompt:  encryptionPrompt,
+		EncryptionMeta:    encryptionMeta,
+	}
+
+	accounts, err := loadAccounts(env)
+	if err != nil {
+		return nil, err
 	}
 
 	cfg := &Config{
 		Env:      env,
+		accounts: accounts,
 		warnings: warnings,
 	}
 
@@ -306,6 +470,71 @@ func sanitizeNotifier(botToken, notifier string, warnings *[]string) string {
 	return defaultNotifier
 }
 
+// sanitizeEditPolicy проверяет политику реакции на правку источника уже доставленного
+// уведомления (edit|reply|ignore). Пустое значение молча заменяется значением по умолчанию,
+// некорректное — с предупреждением.
+func sanitizeEditPolicy(policy string, warnings *[]string) string {
+	p := strings.ToLower(strings.TrimSpace(policy))
+	switch p {
+	case "":
+		return defaultNotifyEditPolicy
+	case "edit", "reply", "ignore":
+		return p
+	default:
+		appendWarningf(warnings, "env NOTIFY_EDIT_POLICY value %q is invalid; using default %q",
+			policy, defaultNotifyEditPolicy)
+		return defaultNotifyEditPolicy
+	}
+}
+
+// sanitizeExpiredPolicy нормализует NOTIFY_EXPIRED_POLICY: drop|summary.
+// Пустое или неизвестное значение заменяется на summary с предупреждением.
+func sanitizeExpiredPolicy(policy string, warnings *[]string) string {
+	p := strings.ToLower(strings.TrimSpace(policy))
+	switch p {
+	case "":
+		return defaultExpiredPolicy
+	case "drop", "summary":
+		return p
+	default:
+		appendWarningf(warnings, "env NOTIFY_EXPIRED_POLICY value %q is invalid; using default %q",
+			policy, defaultExpiredPolicy)
+		return defaultExpiredPolicy
+	}
+}
+
+// sanitizeQuietPolicy нормализует NOTIFY_QUIET_POLICY: hold|silent.
+// Пустое или неизвестное значение заменяется на hold с предупреждением.
+func sanitizeQuietPolicy(policy string, warnings *[]string) string {
+	p := strings.ToLower(strings.TrimSpace(policy))
+	switch p {
+	case "":
+		return defaultQuietPolicy
+	case "hold", "silent":
+		return p
+	default:
+		appendWarningf(warnings, "env NOTIFY_QUIET_POLICY value %q is invalid; using default %q",
+			policy, defaultQuietPolicy)
+		return defaultQuietPolicy
+	}
+}
+
+// sanitizeSMTPSecurity нормализует SMTP_SECURITY: starttls|tls|none.
+// Пустое или некорректное значение заменяется на starttls (с предупреждением во втором случае).
+func sanitizeSMTPSecurity(security string, warnings *[]string) string {
+	s := strings.ToLower(strings.TrimSpace(security))
+	switch s {
+	case "":
+		return defaultSMTPSecurity
+	case "starttls", "tls", "none":
+		return s
+	default:
+		appendWarningf(warnings, "env SMTP_SECURITY value %q is invalid; using default %q",
+			security, defaultSMTPSecurity)
+		return defaultSMTPSecurity
+	}
+}
+
 // sanitizeFile возвращает валидное имя файла конфигурации. Если переменная не
 // задана, подставляет fallback и пишет предупреждение.
 func sanitizeFile(name, value, fallback string, warnings *[]string) string {
@@ -398,6 +627,65 @@ func parseUTCOffsetToLocation(value string) (*time.Location, bool) {
 	return time.FixedZone(name, offset), true
 }
 
+// sanitizeBotAdmins парсит CSV-список Telegram ID администраторов бота. Некорректные
+// и неположительные записи пропускаются с предупреждением, дубликаты убираются.
+func sanitizeBotAdmins(value string, warnings *[]string) []int64 {
+	var result []int64
+	for part := range strings.SplitSeq(value, ",") {
+		token := strings.TrimSpace(part)
+		if token == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(token, 10, 64)
+		if err != nil || id <= 0 {
+			appendWarningf(warnings, "env BOT_ADMINS entry %q is invalid; expected positive user ID", token)
+			continue
+		}
+		if !slices.Contains(result, id) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// mediaArchiveKinds — виды медиа, допустимые в MEDIA_ARCHIVE_TYPES.
+var mediaArchiveKinds = []string{"photo", "video", "animation", "audio", "voice", "document"}
+
+// sanitizeMediaTypes парсит CSV-список видов медиа для архива. Неизвестные виды
+// пропускаются с предупреждением; пустой результат — все виды.
+func sanitizeMediaTypes(value string, warnings *[]string) []string {
+	var result []string
+	for part := range strings.SplitSeq(value, ",") {
+		kind := strings.ToLower(strings.TrimSpace(part))
+		if kind == "" {
+			continue
+		}
+		if !slices.Contains(mediaArchiveKinds, kind) {
+			appendWarningf(warnings, "env MEDIA_ARCHIVE_TYPES entry %q is unknown; expected one of %s",
+				kind, strings.Join(mediaArchiveKinds, ", "))
+			continue
+		}
+		if !slices.Contains(result, kind) {
+			result = append(result, kind)
+		}
+	}
+	return result
+}
+
+// sanitizeSelfCommandPrefix возвращает префикс команд из «Избранного»: пустое значение —
+// префикс по умолчанию, "off" — команды выключены (пустой префикс).
+func sanitizeSelfCommandPrefix(value string) string {
+	prefix := strings.TrimSpace(value)
+	switch {
+	case prefix == "":
+		return defaultSelfCommandPrefix
+	case strings.EqualFold(prefix, "off"):
+		return ""
+	default:
+		return prefix
+	}
+}
+
 // sanitizeSchedule парсит CSV-строку формата "HH:MM,HH:MM,...", фильтрует
 // некорректные записи, убирает дубликаты и возвращает итоговый список. При
 // пустом результате подставляет fallback и пишет предупреждение.
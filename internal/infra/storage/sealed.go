@@ -0,0 +1,185 @@
+// Package storage / файл sealed.go — шифрование чувствительных файлов на диске.
+//
+// Сессия MTProto, состояние апдейтов, очередь уведомлений и журнал провалов, а также значения
+// базы пиров (access hash) дают доступ к аккаунту или его переписке. Если задан ключ (SetKey),
+// они пишутся «запечатанными»: AES-256-GCM со случайным nonce на каждую запись.
+//
+// Формат запечатанных данных: sealedMagic | nonce (12 байт) | шифротекст с тегом.
+// Чтение прозрачно: данные без sealedMagic возвращаются как есть, поэтому открытые файлы,
+// записанные до включения шифрования, читаются и запечатываются при следующей записи
+// (или сразу — миграцией, см. ResealFile). Запечатанные данные без ключа не читаются.
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// sealedMagic открывает запечатанные данные; версия формата входит в метку.
+var sealedMagic = []byte("UBSEAL1\x00")
+
+// sealKeySize — длина ключа AES-256.
+const sealKeySize = 32
+
+var (
+	// ErrNoKey — данные запечатаны, а ключ шифрования не задан.
+	ErrNoKey = errors.New("storage: data is encrypted, but no encryption key is configured")
+	// ErrWrongKey — данные не расшифровываются заданным ключом (чужой ключ или повреждение).
+	ErrWrongKey = errors.New("storage: cannot decrypt data: wrong encryption key or corrupted file")
+)
+
+// sealer хранит AEAD процесса; nil — шифрование выключено.
+var sealer struct {
+	mu   sync.RWMutex
+	aead cipher.AEAD
+}
+
+// SetKey включает шифрование ключом key (32 байта, см. DeriveKey); nil выключает его.
+func SetKey(key []byte) error {
+	var aead cipher.AEAD
+	if key != nil {
+		var err error
+		if aead, err = newSealAEAD(key); err != nil {
+			return err
+		}
+	}
+	sealer.mu.Lock()
+	sealer.aead = aead
+	sealer.mu.Unlock()
+	return nil
+}
+
+// Encrypted сообщает, включено ли шифрование.
+func Encrypted() bool {
+	return currentAEAD() != nil
+}
+
+// IsSealed сообщает, запечатаны ли данные.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedMagic)
+}
+
+// Seal запечатывает data, если шифрование включено, иначе возвращает data как есть.
+func Seal(data []byte) ([]byte, error) {
+	aead := currentAEAD()
+	if aead == nil {
+		return data, nil
+	}
+	return seal(aead, data)
+}
+
+// Unseal возвращает открытые данные: расшифровывает запечатанные и пропускает открытые.
+func Unseal(data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return data, nil
+	}
+	aead := currentAEAD()
+	if aead == nil {
+		return nil, ErrNoKey
+	}
+	return unseal(aead, data)
+}
+
+// ReadSealedFile читает файл и снимает с него шифрование. Ошибки файловой системы
+// возвращаются без обёртки, поэтому os.IsNotExist и errors.Is(err, os.ErrNotExist) работают.
+func ReadSealedFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := Unseal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return plain, nil
+}
+
+// AtomicWriteSealedFile запечатывает data (если шифрование включено) и атомарно пишет в path.
+func AtomicWriteSealedFile(path string, data []byte) error {
+	sealed, err := Seal(data)
+	if err != nil {
+		return err
+	}
+	return AtomicWriteFile(path, sealed)
+}
+
+// ResealFile переписывает существующий файл: encrypt=true запечатывает открытый файл,
+// encrypt=false расшифровывает запечатанный. Оба направления требуют ключа (SetKey).
+// Возвращает true, если файл переписан; отсутствующий файл пропускается.
+func ResealFile(path string, encrypt bool) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	out, changed, err := Reseal(data, encrypt)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := AtomicWriteFile(path, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Reseal переводит data в нужный вид (см. ResealFile); changed=false — данные уже в нём.
+func Reseal(data []byte, encrypt bool) (out []byte, changed bool, err error) {
+	aead := currentAEAD()
+	if aead == nil {
+		return nil, false, errors.New("storage: encryption key is not configured")
+	}
+	if IsSealed(data) == encrypt {
+		return data, false, nil
+	}
+	if encrypt {
+		out, err = seal(aead, data)
+	} else {
+		out, err = unseal(aead, data)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+func currentAEAD() cipher.AEAD {
+	sealer.mu.RLock()
+	defer sealer.mu.RUnlock()
+	return sealer.aead
+}
+
+func seal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("storage: generate nonce: %w", err)
+	}
+	out := make([]byte, 0, len(sealedMagic)+len(nonce)+len(data)+aead.Overhead())
+	out = append(out, sealedMagic...)
+	out = append(out, nonce...)
+	// Метка формата входит в аутентифицируемые данные: её подмена ломает проверку тега.
+	return aead.Seal(out, nonce, data, sealedMagic), nil
+}
+
+// unseal проверяет метку и длину до разбора: усечённые или чужие данные дают ErrWrongKey.
+func unseal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if !IsSealed(data) || len(data) < len(sealedMagic)+aead.NonceSize()+aead.Overhead() {
+		return nil, ErrWrongKey
+	}
+	body := data[len(sealedMagic):]
+	nonce, ciphertext := body[:aead.NonceSize()], body[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, sealedMagic)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
@@ -0,0 +1,151 @@
+// Package storage / файл sealkey.go — ключ шифрования файлов из секрета.
+//
+// Секрет (пароль, содержимое файла ключа или переменной окружения) превращается в ключ
+// AES-256 через scrypt. Соль и параметры scrypt хранятся в открытом файле метаданных вместе
+// с контрольной записью, запечатанной тем же ключом: неверный секрет обнаруживается при
+// старте, до чтения сессии и очередей. Потеря файла метаданных делает запечатанные данные
+// нечитаемыми — его нужно хранить и копировать вместе с каталогом данных.
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Параметры scrypt для новых файлов метаданных (рекомендация для интерактивного входа).
+const (
+	scryptN        = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+	sealSaltSize   = 16
+	sealCheckPlain = "telegram-userbot"
+)
+
+// sealKeyMeta — содержимое файла метаданных ключа.
+type sealKeyMeta struct {
+	KDF   string `json:"kdf"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Salt  []byte `json:"salt"`
+	Check []byte `json:"check"`
+}
+
+// DeriveKey выводит ключ шифрования из секрета secret. Соль и параметры берутся из файла
+// метаданных metaPath; если его нет, он создаётся с новой солью — но только если ни один из
+// файлов stateFiles ещё не запечатан: иначе файл метаданных потерян (или путь к нему указан
+// неверно), и новая соль не откроет уже зашифрованные данные. Возвращает ErrWrongKey,
+// если секрет не совпадает с тем, которым создан файл метаданных.
+func DeriveKey(secret []byte, metaPath string, stateFiles []string) ([]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("storage: encryption secret is empty")
+	}
+	data, err := os.ReadFile(metaPath)
+	if errors.Is(err, os.ErrNotExist) {
+		for _, path := range stateFiles {
+			sealed, sealedErr := fileSealed(path)
+			if sealedErr != nil {
+				return nil, sealedErr
+			}
+			if sealed {
+				return nil, fmt.Errorf("encryption meta %s is missing, but %s is already encrypted: "+
+					"the meta file is lost or ENCRYPTION_META_FILE points to the wrong path; "+
+					"restore it from a backup", metaPath, path)
+			}
+		}
+		return createSealKey(secret, metaPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read encryption meta: %w", err)
+	}
+
+	var meta sealKeyMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("parse encryption meta %s: %w", metaPath, err)
+	}
+	if meta.KDF != "scrypt" {
+		return nil, fmt.Errorf("encryption meta %s: unsupported kdf %q", metaPath, meta.KDF)
+	}
+	key, err := scrypt.Key(secret, meta.Salt, meta.N, meta.R, meta.P, sealKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("derive encryption key: %w", err)
+	}
+	aead, err := newSealAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if plain, openErr := unseal(aead, meta.Check); openErr != nil || string(plain) != sealCheckPlain {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
+
+// fileSealed сообщает, начинается ли файл path с метки запечатанных данных (нет файла — false).
+func fileSealed(path string) (bool, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("check %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	head := make([]byte, len(sealedMagic))
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("check %s: %w", path, err)
+	}
+	return IsSealed(head[:n]), nil
+}
+
+// createSealKey выводит ключ с новой солью и сохраняет метаданные с контрольной записью.
+func createSealKey(secret []byte, metaPath string) ([]byte, error) {
+	meta := sealKeyMeta{KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, sealSaltSize)}
+	if _, err := rand.Read(meta.Salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	key, err := scrypt.Key(secret, meta.Salt, meta.N, meta.R, meta.P, sealKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("derive encryption key: %w", err)
+	}
+	aead, err := newSealAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Check, err = seal(aead, []byte(sealCheckPlain)); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode encryption meta: %w", err)
+	}
+	if err := AtomicWriteFile(metaPath, data); err != nil {
+		return nil, fmt.Errorf("write encryption meta: %w", err)
+	}
+	return key, nil
+}
+
+// newSealAEAD создаёт AES-256-GCM для ключа key.
+func newSealAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != sealKeySize {
+		return nil, fmt.Errorf("storage: encryption key must be %d bytes, got %d", sealKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("storage: init cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("storage: init gcm: %w", err)
+	}
+	return aead, nil
+}
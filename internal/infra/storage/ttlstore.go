@@ -0,0 +1,203 @@
+// Package storage / файл ttlstore.go — персистентные кэши с TTL поверх bbolt.
+// Используется для «коротких» кэшей идемпотентности (дедупликация апдейтов,
+// отметки «уже уведомляли»), которые должны переживать рестарт процесса:
+//   - одна база — несколько бакетов, по бакету на кэш;
+//   - значение записи — момент истечения (unix nanos, big-endian);
+//   - каждая запись пишется инкрементально, без перезаписи всего снимка;
+//   - Cleanup удаляет просроченное и подрезает бакет до maxEntries (старые — первыми).
+//
+// База открывается с NoSync: падение процесса не теряет данные (страницы уже в кэше ОС),
+// а потеря последних записей при отказе питания для таких кэшей допустима. Close делает Sync.
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ttlDBOpenTimeout — сколько ждать файловую блокировку базы (вторая копия процесса).
+const ttlDBOpenTimeout = time.Second
+
+// ttlValueSize — размер значения записи: int64 момента истечения.
+const ttlValueSize = 8
+
+// TTLDB — bbolt-база для кэшей с ограниченным сроком жизни записей.
+type TTLDB struct {
+	db *bbolt.DB
+}
+
+// TTLBucket — один кэш внутри TTLDB. Потокобезопасен: сериализацию записей обеспечивает bbolt.
+type TTLBucket struct {
+	db         *bbolt.DB
+	name       []byte
+	maxEntries int
+}
+
+// OpenTTLDB открывает (или создаёт) базу по пути path, гарантируя наличие каталога.
+func OpenTTLDB(path string) (*TTLDB, error) {
+	path = filepath.Clean(strings.TrimSpace(path))
+	if path == "" || path == "." {
+		return nil, errors.New("ttl store: db path is empty")
+	}
+	if err := EnsureDir(path); err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(path, defaultFilePerm, &bbolt.Options{Timeout: ttlDBOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("ttl store: open %q: %w", path, err)
+	}
+	db.NoSync = true
+	return &TTLDB{db: db}, nil
+}
+
+// Close сбрасывает данные на диск и закрывает базу. Повторный вызов безопасен.
+func (d *TTLDB) Close() error {
+	if d == nil || d.db == nil {
+		return nil
+	}
+	syncErr := d.db.Sync()
+	closeErr := d.db.Close()
+	d.db = nil
+	return errors.Join(syncErr, closeErr)
+}
+
+// Bucket возвращает кэш с именем name, создавая бакет при необходимости.
+// maxEntries <= 0 отключает ограничение размера.
+func (d *TTLDB) Bucket(name string, maxEntries int) (*TTLBucket, error) {
+	if d == nil || d.db == nil {
+		return nil, errors.New("ttl store: db is closed")
+	}
+	key := []byte(name)
+	if err := d.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(key)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("ttl store: create bucket %q: %w", name, err)
+	}
+	return &TTLBucket{db: d.db, name: key, maxEntries: maxEntries}, nil
+}
+
+// Seen атомарно проверяет и регистрирует ключ: true — ключ есть и не истёк (повтор);
+// иначе ключ записывается со сроком ttl и возвращается false.
+func (b *TTLBucket) Seen(key []byte, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	seen := false
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.name)
+		if exp, ok := decodeExpiry(bucket.Get(key)); ok && now.Before(exp) {
+			seen = true
+			return nil
+		}
+		return bucket.Put(key, encodeExpiry(now.Add(ttl)))
+	})
+	return seen, err
+}
+
+// Has сообщает, есть ли в кэше неистёкший ключ.
+func (b *TTLBucket) Has(key []byte) (bool, error) {
+	now := time.Now()
+	found := false
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		exp, ok := decodeExpiry(tx.Bucket(b.name).Get(key))
+		found = ok && now.Before(exp)
+		return nil
+	})
+	return found, err
+}
+
+// Put записывает ключ со сроком жизни ttl (перезаписывая прежний срок).
+func (b *TTLBucket) Put(key []byte, ttl time.Duration) error {
+	expireAt := time.Now().Add(ttl)
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(b.name).Put(key, encodeExpiry(expireAt))
+	})
+}
+
+// Import записывает пачку ключей с явными моментами истечения одной транзакцией.
+// Нужен для переноса данных из старых форматов хранения.
+func (b *TTLBucket) Import(entries map[string]time.Time) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.name)
+		for key, exp := range entries {
+			if err := bucket.Put([]byte(key), encodeExpiry(exp)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Len возвращает число записей в кэше (включая ещё не вычищенные просроченные).
+func (b *TTLBucket) Len() (int, error) {
+	n := 0
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket(b.name).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// Cleanup удаляет просроченные записи, а при превышении maxEntries — самые старые
+// по моменту истечения. Возвращает число удалённых записей.
+func (b *TTLBucket) Cleanup() (int, error) {
+	now := time.Now()
+	removed := 0
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.name)
+		type entry struct {
+			key []byte
+			exp time.Time
+		}
+		var (
+			stale [][]byte
+			live  []entry
+		)
+		if err := bucket.ForEach(func(k, v []byte) error {
+			exp, ok := decodeExpiry(v)
+			if !ok || !now.Before(exp) {
+				stale = append(stale, slices.Clone(k))
+				return nil
+			}
+			live = append(live, entry{key: slices.Clone(k), exp: exp})
+			return nil
+		}); err != nil {
+			return err
+		}
+		if b.maxEntries > 0 && len(live) > b.maxEntries {
+			slices.SortFunc(live, func(a, b entry) int { return a.exp.Compare(b.exp) })
+			for _, e := range live[:len(live)-b.maxEntries] {
+				stale = append(stale, e.key)
+			}
+		}
+		for _, k := range stale {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return nil
+	})
+	return removed, err
+}
+
+// encodeExpiry кодирует момент истечения в 8 байт (unix nanos, big-endian).
+func encodeExpiry(t time.Time) []byte {
+	buf := make([]byte, ttlValueSize)
+	binary.BigEndian.PutUint64(buf, uint64(t.UnixNano())) // #nosec G115
+	return buf
+}
+
+// decodeExpiry разбирает значение записи; ok=false для отсутствующего или битого значения.
+func decodeExpiry(v []byte) (time.Time, bool) {
+	if len(v) != ttlValueSize {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v))), true // #nosec G115
+}
@@ -5,6 +5,9 @@
 //   - мониторинг с периодическими Ping и детекцией сетевых сбоев;
 //   - безопасная остановка и «генерационный» канал ожидания для снятия гонок.
 //
+// У каждого аккаунта свой Manager; функции пакета обращаются к менеджеру по умолчанию
+// (основного аккаунта), назначенному через SetDefault.
+//
 // Менеджер потокобезопасен: взаимодействие с ожидателями ведётся через снимки
 // wait‑канала, а сетевые ошибки нормализуются через HandleError.
 package connection
@@ -43,105 +46,171 @@ const (
 )
 
 var (
-	// globalMu защищает глобальные переменные менеджера от гонок.
+	// globalMu защищает менеджер по умолчанию от гонок.
 	globalMu sync.RWMutex
-	// globalManager содержит единственный экземпляр менеджера, разделяемый приложением.
-	globalManager *manager
+	// defaultManager — менеджер основного аккаунта, которым пользуются функции пакета.
+	defaultManager *Manager
 )
 
-// Shutdown завершает глобальный менеджер соединений, отменяет фоновый мониторинг
-// и закрывает каналы ожидания, чтобы разблокировать все зависшие горутины.
-func Shutdown() {
-	globalMu.Lock()
-	m := globalManager
-	globalManager = nil
-	globalMu.Unlock()
+// Manager отслеживает соединение одного MTProto‑клиента. Каждый аккаунт процесса имеет
+// свой Manager; функции пакета (WaitOnline, HandleError...) работают с менеджером по
+// умолчанию (SetDefault). Методы безопасны для nil: nil‑менеджер означает менеджер по умолчанию.
+// До Start и после Shutdown менеджер ничего не блокирует и не отслеживает.
+type Manager struct {
+	client *telegram.Client // клиент Telegram, используемый для отправки Ping
 
-	if m != nil {
-		m.shutdown()
-	}
+	mu    sync.RWMutex // защищает state
+	state *state       // состояние запущенного менеджера; nil — не запущен
 }
 
-// manager хранит ссылку на клиент, текущее состояние online/offline и «поколенческий»
-// канал ожидания восстановления (waitCh). Когда связь теряется, создаётся новый
-// открытый канал и стартует monitorLoop; при восстановлении канал закрывается, что
-// неблокирующим образом снимает все ожидатели. Доступ к полям защищён мьютексами,
-// признак online хранится в atomic.Bool.
-type manager struct {
-	client *telegram.Client // клиент Telegram, используемый для отправки Ping
-	ctx    context.Context  // базовый контекст жизненного цикла менеджера
+// New создаёт менеджер соединения клиента client. Отслеживание начинается после Start.
+func New(client *telegram.Client) *Manager {
+	return &Manager{client: client}
+}
 
-	connected atomic.Bool // признак, что клиент в онлайне
+// SetDefault назначает менеджер, с которым работают функции пакета.
+func SetDefault(m *Manager) {
+	globalMu.Lock()
+	defaultManager = m
+	globalMu.Unlock()
+}
 
-	mu            sync.RWMutex       // защищает waitCh и monitorCancel
-	waitCh        chan struct{}      // канал, закрывающийся при восстановлении соединения
-	monitorCancel context.CancelFunc // отменяет текущий цикл мониторинга
+// Default возвращает менеджер по умолчанию или nil, если он не назначен.
+func Default() *Manager {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return defaultManager
 }
 
-// Init инициализирует глобальный менеджер поверх заданного tg‑клиента и контекста
-// жизненного цикла. По умолчанию состояние — online: создаётся закрытый waitCh,
-// чтобы текущие вызовы WaitOnline не блокировались. Повторный вызов перетирает
-// предыдущий инстанс менеджера.
-func Init(ctx context.Context, client *telegram.Client) {
-	if client == nil {
+// Start запускает менеджер в контексте жизненного цикла ctx. По умолчанию состояние —
+// online: создаётся закрытый waitCh, чтобы текущие вызовы WaitOnline не блокировались.
+// Повторный вызов перетирает предыдущее состояние.
+func (m *Manager) Start(ctx context.Context) {
+	if m == nil || m.client == nil {
 		return
 	}
 
-	m := &manager{
-		client: client,
+	st := &state{
+		client: m.client,
 		ctx:    ctx,
 	}
 
 	// Стартуем в состоянии online: ожидатели не должны блокироваться «на ровном месте».
-	m.connected.Store(true)
+	st.connected.Store(true)
 	// Создаём и сразу закрываем канал ожидания: снимок для WaitOnline в «онлайне».
 	ready := make(chan struct{})
 	close(ready)
-	m.waitCh = ready
+	st.waitCh = ready
 
-	globalMu.Lock()
-	globalManager = m
-	globalMu.Unlock()
+	m.mu.Lock()
+	m.state = st
+	m.mu.Unlock()
+}
+
+// Shutdown останавливает менеджер, отменяет фоновый мониторинг и закрывает каналы
+// ожидания, чтобы разблокировать все зависшие горутины.
+func (m *Manager) Shutdown() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	st := m.state
+	m.state = nil
+	m.mu.Unlock()
+
+	if st != nil {
+		st.shutdown()
+	}
 }
 
-// MarkConnected переводит глобальное состояние в online, останавливает мониторинг
+// MarkConnected переводит состояние в online, останавливает мониторинг
 // и закрывает текущий wait‑канал, разблокируя всех ожидателей.
-func MarkConnected() {
-	if m := getManager(); m != nil {
-		m.markConnected()
+func (m *Manager) MarkConnected() {
+	if st := m.current(); st != nil {
+		st.markConnected()
 	}
 }
 
-// MarkDisconnected переводит глобальное состояние в offline. Идемпотентен: если
-// уже офлайн — ничего не делает. Создаёт новое «поколение» wait‑канала и запускает
-// мониторинг восстановления (monitorLoop).
-func MarkDisconnected() {
-	if m := getManager(); m != nil {
-		m.markDisconnected()
+// MarkDisconnected переводит состояние в offline. Идемпотентен: если уже офлайн —
+// ничего не делает. Создаёт новое «поколение» wait‑канала и запускает мониторинг
+// восстановления (monitorLoop).
+func (m *Manager) MarkDisconnected() {
+	if st := m.current(); st != nil {
+		st.markDisconnected()
 	}
 }
 
 // WaitOnline блокирует вызывающую горутину до восстановления соединения или отмены
-// контекста. Если уже online, возвращает сразу. Логика использует «снимки» канала
-// ожидания: если мы проснулись по старому закрытому каналу, цикл продолжится до
-// закрытия актуального канала текущего поколения.
+// контекста. Если уже online, возвращает сразу.
+func (m *Manager) WaitOnline(ctx context.Context) {
+	m.waitOnline(ctx, 2)
+}
+
+// HandleError анализирует ошибку err, полученную из RPC-слоя. Если ошибка
+// напоминает сетевую и свидетельствует о разрыве соединения, менеджер
+// переводится в offline, а метод возвращает true. Иначе возвращается false.
+func (m *Manager) HandleError(err error) bool {
+	if !isNetworkError(err) {
+		return false
+	}
+
+	m.MarkDisconnected()
+	return true
+}
+
+// MarkConnected переводит менеджер по умолчанию в online (см. Manager.MarkConnected).
+func MarkConnected() {
+	Default().MarkConnected()
+}
+
+// MarkDisconnected переводит менеджер по умолчанию в offline (см. Manager.MarkDisconnected).
+func MarkDisconnected() {
+	Default().MarkDisconnected()
+}
+
+// WaitOnline ждёт соединения менеджера по умолчанию (см. Manager.WaitOnline).
 func WaitOnline(ctx context.Context) {
+	Default().waitOnline(ctx, 2)
+}
+
+// HandleError прогоняет ошибку через менеджер по умолчанию (см. Manager.HandleError).
+func HandleError(err error) bool {
+	return Default().HandleError(err)
+}
+
+// current возвращает состояние запущенного менеджера (для nil — менеджера по умолчанию)
+// или nil, если менеджер не запущен.
+func (m *Manager) current() *state {
+	if m == nil {
+		if m = Default(); m == nil {
+			return nil
+		}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// waitOnline — реализация WaitOnline; skip — глубина вызова для диагностики места ожидания.
+// Логика использует «снимки» канала ожидания: если мы проснулись по старому закрытому
+// каналу, цикл продолжится до закрытия актуального канала текущего поколения.
+func (m *Manager) waitOnline(ctx context.Context, skip int) {
 	if ctx == nil || ctx.Err() != nil {
 		return
 	}
 
-	m := getManager()
-	if m == nil {
+	st := m.current()
+	if st == nil {
 		return
 	}
 
-	if m.connected.Load() {
+	if st.connected.Load() {
 		return
 	}
 
 	// Для удобства диагностики логируем место вызова, которое заблокировалось в ожидании.
 	callerLocation := "unknown"
-	if _, file, line, ok := runtime.Caller(1); ok {
+	if _, file, line, ok := runtime.Caller(skip); ok {
 		if wd, err := os.Getwd(); err == nil {
 			if rel, relErr := filepath.Rel(wd, file); relErr == nil {
 				file = rel
@@ -154,7 +223,7 @@ func WaitOnline(ctx context.Context) {
 
 	for {
 		// Берём моментальный снимок канала текущего поколения.
-		ch := m.currentWaitCh() // не-nil снимок
+		ch := st.currentWaitCh() // не-nil снимок
 		select {
 		case <-ctx.Done():
 			logger.Debugf("WaitOnline: context done before reconnect: %v", ctx.Err())
@@ -162,7 +231,7 @@ func WaitOnline(ctx context.Context) {
 			return
 		case <-ch:
 			// Проснулись. Если это канал актуального поколения — можно продолжать работу.
-			if ch == m.currentWaitCh() { // закрыли актуальный канал
+			if ch == st.currentWaitCh() { // закрыли актуальный канал
 				logger.Debug("WaitOnline: connection restored, resuming")
 				return
 			}
@@ -171,53 +240,26 @@ func WaitOnline(ctx context.Context) {
 	}
 }
 
-// // DoOnline ждёт восстановление соединения (если нужно) и затем вызывает fn.
-// // Если fn вернул ошибку — она прогоняется через HandleError и возвращается вызывающему.
-// func DoOnline(ctx context.Context, fn func(context.Context) error) error {
-// 	WaitOnline(ctx)
-// 	if err := fn(ctx); err != nil {
-// 		HandleError(err)
-// 		return err
-// 	}
-// 	return nil
-// }
-
-// // CallOnline аналогичен DoOnline, но возвращает произвольный результат.
-// // Тип результата выводится из сигнатуры переданной функции.
-// func CallOnline[T any](ctx context.Context, fn func(context.Context) (T, error)) (T, error) {
-// 	WaitOnline(ctx)
-// 	v, err := fn(ctx)
-// 	if err != nil {
-// 		HandleError(err)
-// 		return v, err
-// 	}
-// 	return v, nil
-// }
-
-// HandleError анализирует ошибку err, полученную из RPC-слоя. Если ошибка
-// напоминает сетевую и свидетельствует о разрыве соединения, менеджер
-// переводится в offline, а функция возвращает true. Иначе возвращается false.
-func HandleError(err error) bool {
-	if !isNetworkError(err) {
-		return false
-	}
+// state хранит ссылку на клиент, текущее состояние online/offline и «поколенческий»
+// канал ожидания восстановления (waitCh). Когда связь теряется, создаётся новый
+// открытый канал и стартует monitorLoop; при восстановлении канал закрывается, что
+// неблокирующим образом снимает все ожидатели. Доступ к полям защищён мьютексами,
+// признак online хранится в atomic.Bool.
+type state struct {
+	client *telegram.Client // клиент Telegram, используемый для отправки Ping
+	ctx    context.Context  // базовый контекст жизненного цикла менеджера
 
-	MarkDisconnected()
-	return true
-}
+	connected atomic.Bool // признак, что клиент в онлайне
 
-// getManager возвращает текущий глобальный менеджер или nil, если тот не
-// инициализирован.
-func getManager() *manager {
-	globalMu.RLock()
-	defer globalMu.RUnlock()
-	return globalManager
+	mu            sync.RWMutex       // защищает waitCh и monitorCancel
+	waitCh        chan struct{}      // канал, закрывающийся при восстановлении соединения
+	monitorCancel context.CancelFunc // отменяет текущий цикл мониторинга
 }
 
 // currentWaitCh возвращает снимок актуального канала ожидания. Если канал ещё
 // не инициализирован (nil), возвращается закрытый канал, чтобы WaitOnline не
 // блокировался по ошибке.
-func (m *manager) currentWaitCh() <-chan struct{} {
+func (m *state) currentWaitCh() <-chan struct{} {
 	m.mu.RLock()
 	ch := m.waitCh
 	m.mu.RUnlock()
@@ -231,7 +273,7 @@ func (m *manager) currentWaitCh() <-chan struct{} {
 
 // markConnected помечает менеджер как online: отменяет мониторинг, закрывает
 // канал ожидания (если ещё не закрыт) и логирует событие. Идемпотентен.
-func (m *manager) markConnected() {
+func (m *state) markConnected() {
 	if m == nil {
 		return
 	}
@@ -262,7 +304,7 @@ func (m *manager) markConnected() {
 
 // markDisconnected атомарно переключает состояние из online в offline, создаёт новый
 // открытый канал ожидания и запускает monitorLoop в отдельной горутине.
-func (m *manager) markDisconnected() {
+func (m *state) markDisconnected() {
 	if m == nil {
 		return
 	}
@@ -290,7 +332,7 @@ func (m *manager) markDisconnected() {
 
 // shutdown мягко останавливает мониторинг и закрывает канал ожидания, гарантируя,
 // что все заблокированные ожидатели проснутся и корректно завершатся.
-func (m *manager) shutdown() {
+func (m *state) shutdown() {
 	if m == nil {
 		return
 	}
@@ -317,7 +359,7 @@ func (m *manager) shutdown() {
 // менеджер переводится в online и цикл завершается. Закрытые/мертвые соединения
 // считаются «abort» попытками и ограничены pingAbortedAttempts. Нечёткие сетевые
 // ошибки логируются, контекстная отмена завершает цикл без шума.
-func (m *manager) monitorLoop(ctx context.Context) {
+func (m *state) monitorLoop(ctx context.Context) {
 	// Периодический пинг позволяет выйти из офлайна без внешнего участия.
 	ticker := time.NewTicker(reconnectPingInterval)
 	defer ticker.Stop()
@@ -374,7 +416,7 @@ func (m *manager) monitorLoop(ctx context.Context) {
 
 // safePingClient оборачивает client.Ping защитой от паник и переводит их в
 // сетевую ошибку (net.ErrClosed). При nil‑клиенте сразу возвращает net.ErrClosed.
-func (m *manager) safePingClient(ctx context.Context, client *telegram.Client) (err error) {
+func (m *state) safePingClient(ctx context.Context, client *telegram.Client) (err error) {
 	if client == nil {
 		return net.ErrClosed
 	}
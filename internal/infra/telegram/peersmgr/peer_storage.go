@@ -0,0 +1,334 @@
+// Package peersmgr / файл peer_storage.go — bbolt-хранилище пиров с шифрованием значений.
+//
+// Повторяет формат gotd/contrib bbolt.PeerStorage (ключ "peer<kind>_<id>" → JSON Peer,
+// ключ-ассоциация → ключ пира), но значения пиров проходят через storage.Seal/Unseal:
+// при включённом шифровании access hash и профиль не лежат в файле открыто. Ассоциации
+// (username, телефон) при шифровании не пишутся вовсе — иначе они остались бы открытыми
+// ключами bbolt; Resolve по ним в этом режиме всегда даёт ErrPeerNotFound (бот его не использует).
+package peersmgr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"telegram-userbot/internal/infra/storage"
+
+	contribstorage "github.com/gotd/contrib/storage"
+	"go.etcd.io/bbolt"
+)
+
+var _ contribstorage.PeerStorage = (*peerStorage)(nil)
+
+// peerStorage — contribstorage.PeerStorage поверх бакета bbolt с запечатанными значениями.
+type peerStorage struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+func newPeerStorage(db *bbolt.DB, bucket []byte) *peerStorage {
+	return &peerStorage{db: db, bucket: bucket}
+}
+
+// Add сохраняет пира и его ассоциации.
+func (s *peerStorage) Add(_ context.Context, value contribstorage.Peer) error {
+	return s.add(value.Keys(), value)
+}
+
+// Find ищет пира по ключу; ErrPeerNotFound — пира нет.
+func (s *peerStorage) Find(_ context.Context, key contribstorage.PeerKey) (p contribstorage.Peer, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		if bucket == nil {
+			return contribstorage.ErrPeerNotFound
+		}
+		data := bucket.Get(key.Bytes(nil))
+		if data == nil {
+			return contribstorage.ErrPeerNotFound
+		}
+		return decodePeer(data, &p)
+	})
+	return p, err
+}
+
+// Assign сохраняет пира и связывает его с ключом key.
+func (s *peerStorage) Assign(_ context.Context, key string, value contribstorage.Peer) error {
+	return s.add(append(value.Keys(), key), value)
+}
+
+// Resolve ищет пира по ассоциированному ключу (username, телефон).
+func (s *peerStorage) Resolve(_ context.Context, key string) (p contribstorage.Peer, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		if bucket == nil {
+			return contribstorage.ErrPeerNotFound
+		}
+		id := bucket.Get([]byte(key))
+		if id == nil {
+			return contribstorage.ErrPeerNotFound
+		}
+		data := bucket.Get(id)
+		if data == nil {
+			return contribstorage.ErrPeerNotFound
+		}
+		return decodePeer(data, &p)
+	})
+	return p, err
+}
+
+// Iterate открывает читающую транзакцию и перебирает сохранённых пиров.
+func (s *peerStorage) Iterate(_ context.Context) (contribstorage.PeerIterator, error) {
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("create tx: %w", err)
+	}
+	bucket := tx.Bucket(s.bucket)
+	if bucket == nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("bucket %q does not exist", s.bucket)
+	}
+	return &peerIterator{tx: tx, cursor: bucket.Cursor()}, nil
+}
+
+func (s *peerStorage) add(associated []string, value contribstorage.Peer) error {
+	data, err := encodePeer(value)
+	if err != nil {
+		return err
+	}
+	id := contribstorage.KeyFromPeer(value).Bytes(nil)
+	if storage.Encrypted() {
+		associated = nil
+	}
+	return s.db.Batch(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(s.bucket)
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+		if err := bucket.Put(id, data); err != nil {
+			return fmt.Errorf("set id <-> data: %w", err)
+		}
+		for _, key := range associated {
+			if err := bucket.Put([]byte(key), id); err != nil {
+				return fmt.Errorf("set key <-> id: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// peerIterator перебирает только записи пиров, пропуская ассоциации.
+type peerIterator struct {
+	tx      *bbolt.Tx
+	cursor  *bbolt.Cursor
+	started bool
+	lastErr error
+	value   contribstorage.Peer
+}
+
+func (it *peerIterator) Next(_ context.Context) bool {
+	var k, v []byte
+	if it.started {
+		k, v = it.cursor.Next()
+	} else {
+		it.started = true
+		k, v = it.cursor.Seek(contribstorage.PeerKeyPrefix)
+	}
+	for k != nil && !isPeerRecordKey(k) {
+		if !bytes.HasPrefix(k, contribstorage.PeerKeyPrefix) {
+			return false
+		}
+		k, v = it.cursor.Next()
+	}
+	if k == nil {
+		return false
+	}
+	it.value = contribstorage.Peer{}
+	if err := decodePeer(v, &it.value); err != nil {
+		it.lastErr = err
+		return false
+	}
+	return true
+}
+
+func (it *peerIterator) Err() error { return it.lastErr }
+
+func (it *peerIterator) Value() contribstorage.Peer { return it.value }
+
+func (it *peerIterator) Close() error { return it.tx.Rollback() }
+
+// isPeerRecordKey отличает ключ пира от ассоциации: username вида "peerless" тоже
+// начинается с префикса, поэтому ключ разбирается целиком.
+func isPeerRecordKey(k []byte) bool {
+	var key contribstorage.PeerKey
+	return key.Parse(k) == nil
+}
+
+func encodePeer(value contribstorage.Peer) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+	return storage.Seal(data)
+}
+
+func decodePeer(data []byte, p *contribstorage.Peer) error {
+	plain, err := storage.Unseal(data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(plain, p); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	return nil
+}
+
+// compactTxMaxSize — объём записи одной транзакции при копировании базы в новый файл.
+const compactTxMaxSize = 1 << 20
+
+// ResealDB переводит файл кэша пиров в нужный вид: encrypt=true запечатывает значения пиров
+// и снимок диалогов и удаляет открытые ассоциации, encrypt=false расшифровывает их и
+// восстанавливает ассоциации из профилей. Требует ключа (storage.SetKey) и работает только
+// с закрытой базой (бот должен быть остановлен). Возвращает число переписанных записей.
+//
+// bbolt освобождает страницы со старыми значениями, не затирая их, поэтому после перезаписи
+// база копируется в новый файл (только живые данные), который атомарно заменяет прежний.
+func ResealDB(path string, encrypt bool) (int, error) {
+	db, err := bbolt.Open(path, dbFileMode, &bbolt.Options{Timeout: dbOpenTimeout})
+	if err != nil {
+		return 0, fmt.Errorf("peersmgr: open db: %w", err)
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			_ = db.Close()
+		}
+	}()
+
+	changed := 0
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if bucket := tx.Bucket(peersBucketBytes); bucket != nil {
+			n, resealErr := resealPeersBucket(bucket, encrypt)
+			if resealErr != nil {
+				return resealErr
+			}
+			changed += n
+		}
+		if bucket := tx.Bucket(dialogsSnapshotBuckets); bucket != nil {
+			value := bucket.Get(dialogsSnapshotKeyBytes)
+			if len(value) == 0 {
+				return nil
+			}
+			out, ok, resealErr := storage.Reseal(value, encrypt)
+			if resealErr != nil {
+				return fmt.Errorf("dialogs snapshot: %w", resealErr)
+			}
+			if ok {
+				if err := bucket.Put(dialogsSnapshotKeyBytes, out); err != nil {
+					return err
+				}
+				changed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("peersmgr: reseal %s: %w", path, err)
+	}
+
+	tmp := path + ".reseal"
+	if err = compactDB(db, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return 0, fmt.Errorf("peersmgr: compact %s: %w", path, err)
+	}
+	closed = true
+	if err = db.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return 0, fmt.Errorf("peersmgr: close db: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return 0, fmt.Errorf("peersmgr: replace %s: %w", path, err)
+	}
+	return changed, nil
+}
+
+// compactDB копирует живые данные src в новый файл path (прежний файл с тем же именем удаляется).
+func compactDB(src *bbolt.DB, path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dst, err := bbolt.Open(path, dbFileMode, &bbolt.Options{Timeout: dbOpenTimeout})
+	if err != nil {
+		return err
+	}
+	if err = bbolt.Compact(dst, src, compactTxMaxSize); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// resealPeersBucket переписывает значения пиров бакета и ассоциации (см. ResealDB).
+func resealPeersBucket(bucket *bbolt.Bucket, encrypt bool) (int, error) {
+	type record struct{ key, value []byte }
+	var (
+		peersOut     []record
+		associations [][]byte
+		restored     []record
+	)
+	err := bucket.ForEach(func(k, v []byte) error {
+		if !isPeerRecordKey(k) {
+			associations = append(associations, append([]byte(nil), k...))
+			return nil
+		}
+		out, ok, err := storage.Reseal(v, encrypt)
+		if err != nil {
+			return fmt.Errorf("peer %s: %w", k, err)
+		}
+		if ok {
+			peersOut = append(peersOut, record{key: append([]byte(nil), k...), value: out})
+		}
+		if !encrypt {
+			var p contribstorage.Peer
+			if err := decodePeer(v, &p); err != nil {
+				return fmt.Errorf("peer %s: %w", k, err)
+			}
+			for _, name := range p.Keys() {
+				restored = append(restored, record{key: []byte(name), value: append([]byte(nil), k...)})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, rec := range peersOut {
+		if err := bucket.Put(rec.key, rec.value); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+	if encrypt {
+		for _, key := range associations {
+			if err := bucket.Delete(key); err != nil {
+				return 0, err
+			}
+			changed++
+		}
+	}
+	for _, rec := range restored {
+		if bytes.Equal(bucket.Get(rec.key), rec.value) {
+			continue
+		}
+		if err := bucket.Put(rec.key, rec.value); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+	return changed, nil
+}
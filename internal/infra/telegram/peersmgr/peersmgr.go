@@ -3,7 +3,8 @@
 //   - открытие/закрытие базы данных кэша пиров;
 //   - подготовку менеджера пиров (в памяти) и доступ к нему;
 //   - загрузку сохранённых peers из файла в менеджер при старте;
-//   - хранение снимка диалогов, доступного офлайн (CLI list).
+//   - хранение снимка диалогов, доступного офлайн (CLI list);
+//   - шифрование значений пиров и снимка при заданном ключе (см. peer_storage.go).
 package peersmgr
 
 import (
@@ -17,7 +18,8 @@ import (
 	"sync"
 	"time"
 
-	bboltdb "github.com/gotd/contrib/bbolt"
+	"telegram-userbot/internal/infra/storage"
+
 	contribstorage "github.com/gotd/contrib/storage"
 	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/telegram/query/dialogs"
@@ -91,7 +93,7 @@ func New(api *tg.Client, dbPath string) (*Service, error) {
 
 	service := &Service{
 		db:      db,
-		store:   bboltdb.NewPeerStorage(db, peersBucketBytes),
+		store:   newPeerStorage(db, peersBucketBytes),
 		Mgr:     (peers.Options{}).Build(api),
 		dialogs: make([]DialogRef, 0),
 	}
@@ -411,6 +413,10 @@ func (s *Service) loadDialogsSnapshot() error {
 		return nil
 	}
 
+	data, err := storage.Unseal(data)
+	if err != nil {
+		return fmt.Errorf("peersmgr: load snapshot: %w", err)
+	}
 	var refs []DialogRef
 	if err := json.Unmarshal(data, &refs); err != nil {
 		return fmt.Errorf("peersmgr: decode snapshot: %w", err)
@@ -443,6 +449,9 @@ func (s *Service) saveDialogsSnapshot(source []tg.DialogClass) error {
 	if err != nil {
 		return fmt.Errorf("peersmgr: marshal snapshot: %w", err)
 	}
+	if payload, err = storage.Seal(payload); err != nil {
+		return fmt.Errorf("peersmgr: seal snapshot: %w", err)
+	}
 
 	err = s.db.Update(func(tx *bbolt.Tx) error {
 		bucket, bucketErr := tx.CreateBucketIfNotExists(dialogsSnapshotBuckets)
@@ -468,3 +477,24 @@ func (s *Service) setDialogs(refs []DialogRef) {
 	s.dialogs = make([]DialogRef, len(refs))
 	copy(s.dialogs, refs)
 }
+
+// KindByID подбирает вид диалога по числовому ID без вида (как в filters.json): сначала
+// по снимку диалогов, затем по персистентному хранилищу пиров (каналы, группы, пользователи).
+// ok=false — диалог с таким ID неизвестен.
+func (s *Service) KindByID(ctx context.Context, id int64) (DialogKind, bool, error) {
+	for _, ref := range s.Dialogs() {
+		if ref.ID == id && ref.Kind != DialogKindFolder {
+			return ref.Kind, true, nil
+		}
+	}
+	for _, kind := range []DialogKind{DialogKindChannel, DialogKindChat, DialogKindUser} {
+		_, found, err := s.LookupPeer(ctx, kind, id)
+		if err != nil {
+			return "", false, err
+		}
+		if found {
+			return kind, true, nil
+		}
+	}
+	return "", false, nil
+}
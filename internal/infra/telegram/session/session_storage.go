@@ -2,7 +2,8 @@ package session
 
 // Пакет session содержит обёртки поверх tdsession.Storage для MTProto‑сессий.
 // Цели:
-//   - атомарная запись файла сессии на диск (без частичных состояний);
+//   - атомарная запись файла сессии на диск (без частичных состояний), зашифрованная
+//     при заданном ключе (storage.SetKey);
 //   - сигнализация менеджеру соединения о готовности/восстановлении сессии;
 //   - потокобезопасный доступ к файловой системе при конкурирующих вызовах.
 // Обновление сессии обычно свидетельствует об успешном логине/реавторизации, поэтому
@@ -24,9 +25,11 @@ import (
 // NotifyStorage реализует tdsession.Storage поверх обычного файла и дополняет
 // сохранение уведомлением connection.Manager о том, что сессия актуальна.
 // Потокобезопасен: операции Load/Store защищены мьютексом. Поле Path указывает
-// абсолютный или относительный путь до файла сессии на диске.
+// абсолютный или относительный путь до файла сессии на диске, Conn — менеджер соединения
+// аккаунта (nil — менеджер по умолчанию).
 type NotifyStorage struct {
 	Path string
+	Conn *connection.Manager
 	mux  sync.Mutex
 }
 
@@ -42,7 +45,7 @@ func (n *NotifyStorage) LoadSession(_ context.Context) ([]byte, error) {
 	defer n.mux.Unlock()
 
 	// Читаем содержимое файла полностью; отсутствие файла интерпретируем как «сессия не найдена».
-	data, err := os.ReadFile(n.Path)
+	data, err := storage.ReadSealedFile(n.Path)
 	if os.IsNotExist(err) {
 		return nil, tdsession.ErrNotFound
 	}
@@ -53,7 +56,7 @@ func (n *NotifyStorage) LoadSession(_ context.Context) ([]byte, error) {
 }
 
 // StoreSession атомарно сохраняет данные сессии на диск и уведомляет менеджер
-// соединения о готовности. Запись выполняется через storage.AtomicWriteFile,
+// соединения о готовности. Запись выполняется через storage.AtomicWriteSealedFile,
 // поэтому либо файл полностью обновлён, либо остаётся предыдущая корректная версия.
 func (n *NotifyStorage) StoreSession(_ context.Context, data []byte) error {
 	n.mux.Lock()
@@ -61,11 +64,11 @@ func (n *NotifyStorage) StoreSession(_ context.Context, data []byte) error {
 	defer n.mux.Unlock()
 
 	// Атомарная запись: создаём временный файл и заменяем целевой, что устойчиво к сбоям.
-	if err := storage.AtomicWriteFile(n.Path, data); err != nil {
+	if err := storage.AtomicWriteSealedFile(n.Path, data); err != nil {
 		return fmt.Errorf("atomic write session: %w", err)
 	}
 	// Сигнализируем connection.Manager: сессия актуальна, можно разблокировать WaitOnline.
 	logger.Debug("StoreSession: connection.MarkConnected")
-	connection.MarkConnected()
+	n.Conn.MarkConnected()
 	return nil
 }
@@ -1,5 +1,5 @@
 // File online.go: сигналы активности и переходы online/offline.
-// Содержит публичные триггеры GoOnline/GoOnlineMinMs, внутренний ping,
+// Содержит публичные триггеры GoOnline/GoOnlineMinMs (методы и функции аккаунта по умолчанию), внутренний ping,
 // вычисление случайной задержки до авто‑offline и основной цикл run().
 package status
 
@@ -7,9 +7,6 @@ import (
 	"context"
 	"math/rand/v2"
 	"telegram-userbot/internal/infra/logger"
-	"telegram-userbot/internal/infra/telegram/connection"
-
-	// "telegram-userbot/internal/infra/telegram/connection"
 	"time"
 )
 
@@ -26,11 +23,22 @@ func (m *StatusManager) ping(wait int) {
 	}
 }
 
-// GoOnline немедленно инициирует переход аккаунта в online через глобальный менеджер.
-// Если менеджер не инициализирован — функция молча возвращает.
+// GoOnline инициирует переход аккаунта по умолчанию в online (см. StatusManager.GoOnline).
+func GoOnline() {
+	Default().GoOnline()
+}
+
+// GoOnlineMinMs — GoOnlineMinMs для аккаунта по умолчанию (см. StatusManager.GoOnlineMinMs).
+func GoOnlineMinMs(minMs, maxMs int) {
+	Default().GoOnlineMinMs(minMs, maxMs)
+}
+
+// GoOnline немедленно инициирует переход аккаунта в online.
+// Если менеджер не запущен — метод молча возвращает.
 // Время до авто‑ухода в offline выбирается случайно из двух диапазонов (короткий/длинный)
 // с вероятностями 80/20, чтобы поведение выглядело менее шаблонным.
-func GoOnline() {
+func (m *StatusManager) GoOnline() {
+	manager := m.resolve()
 	if manager == nil {
 		return
 	}
@@ -57,14 +65,15 @@ func GoOnline() {
 
 // GoOnlineMinMs — вариант GoOnline с явными границами окна ожидания до offline.
 // Если max < min, пишет ошибку в лог и откатывается к GoOnline() с дефолтными диапазонами.
-func GoOnlineMinMs(minMs, maxMs int) {
+func (m *StatusManager) GoOnlineMinMs(minMs, maxMs int) {
+	manager := m.resolve()
 	if manager == nil {
 		return
 	}
 
 	if maxMs < minMs {
 		logger.Error("GoOnlineMinMs: max < min; used GoOnline() instead")
-		GoOnline()
+		manager.GoOnline()
 		return
 	}
 	manager.ping(randomMs(minMs, maxMs))
@@ -91,9 +100,9 @@ func (m *StatusManager) setOnlineOnce(ctx context.Context, online *bool, lastOnl
 	if *online && time.Since(*lastOnlineAt) < time.Minute {
 		return
 	}
-	connection.WaitOnline(ctx)
+	m.conn.WaitOnline(ctx)
 	if _, err := m.api.AccountUpdateStatus(ctx, false); err != nil {
-		connection.HandleError(err)
+		m.conn.HandleError(err)
 		logger.Errorf("StatusManager: failed to go online: %v", err)
 		return
 	}
@@ -119,9 +128,9 @@ func (m *StatusManager) setOffline(ctx context.Context, reason string, online *b
 		defer cancel()
 	}
 
-	connection.WaitOnline(callCtx)
+	m.conn.WaitOnline(callCtx)
 	if _, err := m.api.AccountUpdateStatus(callCtx, true); err != nil {
-		connection.HandleError(err)
+		m.conn.HandleError(err)
 		logger.Errorf("StatusManager: failed to go offline (%s): %v", reason, err)
 		return
 	}
@@ -130,9 +139,9 @@ func (m *StatusManager) setOffline(ctx context.Context, reason string, online *b
 }
 
 // run управляет жизненным циклом статуса: реагирует на pingCh, включает online и по таймеру уходит в offline.
-// На завершение контекста пытается аккуратно отправить offline и закрывает doneCh. Перед Reset таймера всегда
+// На завершение контекста пытается аккуратно отправить offline и закрывает done. Перед Reset таймера всегда
 // выполняется drain его канала, чтобы избежать спурионных тиков.
-func (m *StatusManager) run(ctx context.Context) {
+func (m *StatusManager) run(ctx context.Context, done chan struct{}) {
 	online := false
 	lastOnlineAt := time.Now()
 	timer := time.NewTimer(time.Hour)
@@ -144,7 +153,7 @@ func (m *StatusManager) run(ctx context.Context) {
 		case <-ctx.Done():
 			// контекст завершён — выключаем онлайн и завершаем горутину
 			m.setOffline(ctx, "context cancel", &online)
-			close(m.doneCh)
+			close(done)
 			return
 		case waitMs := <-m.pingCh:
 			// получен "пинг" — активность обнаружена, продлеваем онлайн-сессию
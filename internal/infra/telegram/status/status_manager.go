@@ -8,68 +8,111 @@ package status
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
-	// "telegram-userbot/internal/infra/telegram/connection"
+	"telegram-userbot/internal/infra/telegram/connection"
 
 	"github.com/gotd/td/tg"
 )
 
-// StatusManager управляет онлайн-статусом пользователя. Это процессный синглтон, который
-// принимает сигналы активности и синхронно/асинхронно инициирует AccountUpdateStatus.
-// Он также следит за тайм-аутом простоя, чтобы вовремя уйти в offline, если нет пингов.
-// Через него все подсистемы сообщают о «жизни» клиента, а он гарантирует консистентность вызовов API.
+// StatusManager управляет онлайн-статусом одного аккаунта. Принимает сигналы активности
+// и синхронно/асинхронно инициирует AccountUpdateStatus. Он также следит за тайм-аутом
+// простоя, чтобы вовремя уйти в offline, если нет пингов. Через него все подсистемы аккаунта
+// сообщают о «жизни» клиента, а он гарантирует консистентность вызовов API.
+// Функции пакета (GoOnline, DoTyping*) работают с менеджером по умолчанию (SetDefault);
+// методы безопасны для nil: nil‑менеджер означает менеджер по умолчанию.
 type StatusManager struct {
-	api    *tg.Client    // Клиент gotd для вызовов AccountUpdateStatus (online/offline/typing и т.п.).
-	pingCh chan int      // Буферизованный канал (1) для сигналов активности; всплески схлопываются.
-	doneCh chan struct{} // Закрывается после завершения run(); на нём ждёт Shutdown().
+	api     *tg.Client          // Клиент gotd для вызовов AccountUpdateStatus (online/offline/typing и т.п.).
+	conn    *connection.Manager // Соединение аккаунта: ожидание online и разбор сетевых ошибок.
+	pingCh  chan int            // Буферизованный канал (1) для сигналов активности; всплески схлопываются.
+	running atomic.Bool         // Признак запущенного run(); до Start и после Shutdown сигналы игнорируются.
+
+	mu     sync.Mutex         // Защищает doneCh и cancel.
+	doneCh chan struct{}      // Закрывается после завершения run(); на нём ждёт Shutdown().
+	cancel context.CancelFunc // Останавливает run().
 }
 
-// Глобальное хранение синглтона менеджера и его cancel-функции. Доступ защищён mutex-ом.
+// Менеджер по умолчанию (основного аккаунта) для функций пакета. Доступ защищён mutex-ом.
 var (
-	manager *StatusManager // manager хранит глобальный экземпляр менеджера статуса для всего процесса
-
-	statusMu     sync.Mutex
-	statusCancel context.CancelFunc
+	defaultMu      sync.RWMutex
+	defaultManager *StatusManager
 )
 
-// Init создаёт и запускает менеджер статуса. Безопасна к повторным вызовам: второй и далее — no-op.
-// Контекст управляет жизненным циклом фоновой горутины. Через api выполняются вызовы AccountUpdateStatus.
-func Init(ctx context.Context, api *tg.Client) {
-	statusMu.Lock()
-	defer statusMu.Unlock()
+// New создаёт менеджер статуса аккаунта: api — для вызовов AccountUpdateStatus,
+// conn — соединение аккаунта (nil — менеджер соединения по умолчанию). Работает после Start.
+func New(api *tg.Client, conn *connection.Manager) *StatusManager {
+	return &StatusManager{
+		api:    api,
+		conn:   conn,
+		pingCh: make(chan int, 1),
+	}
+}
+
+// SetDefault назначает менеджер, с которым работают функции пакета.
+func SetDefault(m *StatusManager) {
+	defaultMu.Lock()
+	defaultManager = m
+	defaultMu.Unlock()
+}
+
+// Default возвращает менеджер по умолчанию или nil, если он не назначен.
+func Default() *StatusManager {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultManager
+}
 
-	if manager != nil {
+// Start запускает фоновую горутину менеджера. Безопасна к повторным вызовам: второй и далее — no-op.
+// Контекст управляет жизненным циклом фоновой горутины.
+func (m *StatusManager) Start(ctx context.Context) {
+	if m == nil {
 		return
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	runCtx, cancel := context.WithCancel(ctx)
-	// Отдельный под-контекст, чтобы можно было целенаправленно гасить менеджер из Shutdown().
-	manager = &StatusManager{
-		api:    api,
-		pingCh: make(chan int, 1),
-		doneCh: make(chan struct{}),
+	if m.cancel != nil {
+		return
 	}
+
+	// Отдельный под-контекст, чтобы можно было целенаправленно гасить менеджер из Shutdown().
+	runCtx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+	m.doneCh = make(chan struct{})
+	m.running.Store(true)
 	// pingCh имеет размер 1, поэтому частые пинги будут схлопываться до одного непроцессенного сигнала.
-	statusCancel = cancel
-	go manager.run(runCtx)
+	go m.run(runCtx, m.doneCh)
 }
 
 // Shutdown останавливает менеджер: Cancel контекста → ожидание закрытия doneCh. Повторные вызовы — безопасны.
-func Shutdown() {
-	statusMu.Lock()
-	m := manager
-	cancel := statusCancel
-	manager = nil
-	statusCancel = nil
-	statusMu.Unlock()
-
+func (m *StatusManager) Shutdown() {
 	if m == nil {
 		return
 	}
+	m.mu.Lock()
+	cancel := m.cancel
+	done := m.doneCh
+	m.cancel = nil
+	m.doneCh = nil
+	m.running.Store(false)
+	m.mu.Unlock()
 
-	if cancel != nil {
-		cancel()
+	if cancel == nil {
+		return
 	}
+
+	cancel()
 	// Ждём корректного завершения run(), чтобы не оставить висящие таймеры/горрутины.
-	<-m.doneCh
+	<-done
+}
+
+// resolve возвращает запущенный менеджер (для nil — менеджер по умолчанию) или nil.
+func (m *StatusManager) resolve() *StatusManager {
+	if m == nil {
+		m = Default()
+	}
+	if m == nil || !m.running.Load() {
+		return nil
+	}
+	return m
 }
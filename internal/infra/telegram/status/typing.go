@@ -1,6 +1,7 @@
 // File typing.go: эмуляция статуса "печатает" и дружеский пинок онлайн-статусу.
-// Публичные хелперы DoTypingWaitMs/DoTypingWaitChars включают typing, ждут псевдореалистичное
-// время и продлевают online через GoOnlineMinMs с небольшим случайным хвостом.
+// Хелперы DoTypingWaitMs/DoTypingWaitChars (методы менеджера и функции для менеджера по умолчанию)
+// включают typing, ждут псевдореалистичное время и продлевают online через GoOnlineMinMs
+// с небольшим случайным хвостом.
 package status
 
 import (
@@ -17,14 +18,15 @@ const deltaMaxMs = 11111
 
 // DoTypingWaitMs включает статус "печатает" на случайный промежуток [minMs, maxMs] миллисекунд
 // и продлевает online на этот же интервал плюс небольшой случайный хвост (deltaMinMs..deltaMaxMs).
-// Если менеджер статуса ещё не инициализирован, функция молча возвращает.
-func DoTypingWaitMs(ctx context.Context, peer tg.InputPeerClass, minMs, maxMs int) {
+// Если менеджер статуса ещё не запущен, метод молча возвращает.
+func (m *StatusManager) DoTypingWaitMs(ctx context.Context, peer tg.InputPeerClass, minMs, maxMs int) {
+	manager := m.resolve()
 	if manager == nil {
 		return
 	}
 	// Добавляем хвост, чтобы аккаунт не выключал online ровно в момент окончания печати.
 	deltaMs := shared.Random(deltaMinMs, deltaMaxMs)
-	GoOnlineMinMs(deltaMs+minMs, deltaMs+maxMs)
+	manager.GoOnlineMinMs(deltaMs+minMs, deltaMs+maxMs)
 	// Включаем typing через API; ошибки намеренно глотаем — это косметика.
 	_, _ = manager.api.MessagesSetTyping(ctx, &tg.MessagesSetTypingRequest{
 		Peer:   peer,
@@ -36,8 +38,9 @@ func DoTypingWaitMs(ctx context.Context, peer tg.InputPeerClass, minMs, maxMs in
 
 // DoTypingWaitChars оценивает длительность печати текста по числу символов и включает typing.
 // Базовое окно [wtMin, wtMax] мс увеличивается на charMs за каждый символ, но не более wtMaxAtAll.
-// Если менеджер не инициализирован — молча выходим.
-func DoTypingWaitChars(ctx context.Context, peer tg.InputPeerClass, text string) {
+// Если менеджер не запущен — молча выходим.
+func (m *StatusManager) DoTypingWaitChars(ctx context.Context, peer tg.InputPeerClass, text string) {
+	manager := m.resolve()
 	if manager == nil {
 		return
 	}
@@ -52,5 +55,15 @@ func DoTypingWaitChars(ctx context.Context, peer tg.InputPeerClass, text string)
 	// min — встроенная с Go 1.21; если таргет старше, в пакете должен быть helper min(int,int).
 	textMs := min(len([]rune(text))*charMs, wtMaxAtAll)
 	// В итоге ждём базу + поправку на длину текста.
-	DoTypingWaitMs(ctx, peer, wtMin+textMs, wtMax+textMs)
+	manager.DoTypingWaitMs(ctx, peer, wtMin+textMs, wtMax+textMs)
+}
+
+// DoTypingWaitMs — DoTypingWaitMs для аккаунта по умолчанию (см. StatusManager.DoTypingWaitMs).
+func DoTypingWaitMs(ctx context.Context, peer tg.InputPeerClass, minMs, maxMs int) {
+	Default().DoTypingWaitMs(ctx, peer, minMs, maxMs)
+}
+
+// DoTypingWaitChars — DoTypingWaitChars для аккаунта по умолчанию (см. StatusManager.DoTypingWaitChars).
+func DoTypingWaitChars(ctx context.Context, peer tg.InputPeerClass, text string) {
+	Default().DoTypingWaitChars(ctx, peer, text)
 }
@@ -44,6 +44,14 @@ func WithMaxRetries(maxRetries int) Option {
 	}
 }
 
+// WithMaxWaits ограничивает число серверных пауз (retry_after, FLOOD_WAIT) внутри одного Do.
+// После исчерпания лимита ошибка возвращается вызывающему коду. Значение <=0 — без ограничения.
+func WithMaxWaits(maxWaits int) Option {
+	return func(t *Throttler) {
+		t.maxWaits = maxWaits
+	}
+}
+
 // WithBurst переопределяет ёмкость токен-бакета (число накопленных токенов).
 // Если burst <= 0, будет использовано значение по умолчанию 2*rate.
 func WithBurst(burst int) Option {
@@ -96,6 +104,7 @@ type Throttler struct {
 
 	waitExtractors []WaitExtractor // цепочка экстракторов, извлекающих «сколько подождать» из ошибок
 	maxRetries     int             // лимит ретраев; -1 означает «без ограничений»
+	maxWaits       int             // лимит серверных пауз за один Do; -1 означает «без ограничений»
 
 	startOnce sync.Once
 	stopOnce  sync.Once
@@ -120,6 +129,7 @@ func New(rate int, opts ...Option) *Throttler {
 		rate:       rate,
 		burst:      rate * burstBultiplier,
 		maxRetries: -1,
+		maxWaits:   -1,
 	}
 
 	for _, opt := range opts {
@@ -189,7 +199,7 @@ func (t *Throttler) SetMaxRetries(n int) {
 //  1. ждём токен (с уважением к ctx и Stop);
 //  2. вызываем fn;
 //  3. если err: StopRetryer → вернуть сразу; контекст сорван → вернуть;
-//     extractor дал паузу → подождать и повторить без роста attempt;
+//     extractor дал паузу → подождать и повторить без роста attempt (не больше maxWaits раз);
 //     иначе экспоненциальный backoff с джиттером, учитывая лимит ретраев.
 //
 // Возвращает nil при успехе либо последнюю ошибку при исчерпании стратегии.
@@ -206,7 +216,7 @@ func (t *Throttler) Do(ctx context.Context, fn func() error) error {
 	// Снимок лимита ретраев: не меняем его внутри, чтобы не наращивать ветвления.
 	maxRetries := t.currentMaxRetries()
 
-	attempt := 0
+	attempt, waits := 0, 0
 	for {
 		// Получаем токен (может прерваться по ctx/root).
 		if err := t.takeToken(ctx, root); err != nil {
@@ -234,6 +244,10 @@ func (t *Throttler) Do(ctx context.Context, fn func() error) error {
 
 		case hasWait:
 			// Сервер велел подождать — ждём и повторяем без роста attempt.
+			if t.maxWaits > 0 && waits >= t.maxWaits {
+				return fmt.Errorf("throttle: max waits reached (%d): last error: %w", t.maxWaits, callErr)
+			}
+			waits++
 			if wErr := t.wait(ctx, root, waitDur); wErr != nil {
 				return wErr
 			}